@@ -6,6 +6,9 @@ package modbus
 
 import "context"
 
+// Client sends the requests of the Modbus function codes. Helpers built
+// on them, such as ReadCoilsBitmap, are functions taking a Client, so that
+// they work with any implementation.
 type Client interface {
 	// Bit access
 
@@ -48,4 +51,8 @@ type Client interface {
 	// ReadFIFOQueue reads the contents of a First-In-First-Out (FIFO) queue
 	// of register in a remote device and returns FIFO value register.
 	ReadFIFOQueue(ctx context.Context, address uint16) (results []byte, err error)
+
+	// Diagnostics sends a diagnostics request (serial line only) with the
+	// given sub-function and data and returns the data of the response.
+	Diagnostics(ctx context.Context, subFunction uint16, data []byte) (results []byte, err error)
 }
@@ -8,7 +8,9 @@ import (
 	"bytes"
 	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"sync/atomic"
 	"time"
 )
 
@@ -21,6 +23,38 @@ const (
 	hexTable = "0123456789ABCDEF"
 )
 
+// LineEnding is the terminator of ASCII frames.
+type LineEnding string
+
+const (
+	// CRLF ends frames with a carriage return and a line feed, as the
+	// specification requires.
+	CRLF LineEnding = "\r\n"
+	// LF ends frames with a bare line feed.
+	LF LineEnding = "\n"
+	// CR ends frames with a bare carriage return.
+	CR LineEnding = "\r"
+)
+
+// terminator returns the characters ending a frame. An unset line ending
+// is CRLF.
+func (e LineEnding) terminator() (string, error) {
+	switch e {
+	case CRLF, "":
+		return asciiEnd, nil
+	case LF, CR:
+		return string(e), nil
+	default:
+		return "", fmt.Errorf("%w: line ending %q must be CRLF, LF or CR", ErrInvalidData, string(e))
+	}
+}
+
+// asciiFrameMinSize returns the size of a frame without data ending with
+// end: colon, address, function, LRC and end.
+func asciiFrameMinSize(end string) int {
+	return 1 + asciiMinSize*2 + len(end)
+}
+
 // ASCIIClientHandler implements Packager and Transporter interface.
 type ASCIIClientHandler struct {
 	asciiPackager
@@ -37,6 +71,8 @@ func NewASCIIClientHandler(address string) *ASCIIClientHandler {
 	handler.Parity = EvenParity
 	handler.Timeout = serialTimeout
 	handler.IdleTimeout = serialIdleTimeout
+	handler.ReconnectBackoff = serialReconnectBackoff
+	handler.MaxReconnectBackoff = serialMaxReconnectBackoff
 	return handler
 }
 
@@ -49,6 +85,44 @@ func ASCIIClient(address string) Client {
 // asciiPackager implements Packager interface.
 type asciiPackager struct {
 	SlaveID byte
+	// SkipSlaveIDCheck accepts responses whose slave id does not match the
+	// request, for gateways that answer with their own id. The LRC and
+	// frame structure are still checked. Leave it disabled unless a device is
+	// known to need it: without the check, replies from another device on the
+	// bus (cross-talk) can no longer be detected.
+	//
+	// Deprecated: Set Compliance to Lenient, which relaxes this check
+	// along with the others of noncompliant devices.
+	SkipSlaveIDCheck bool
+	// VerboseErrors includes the offending frame, truncated to 64 bytes,
+	// in Decode errors for field debugging of malformed frames.
+	VerboseErrors bool
+	// LineEnding terminates the frames sent and expected in responses.
+	// The default CRLF is the only compliant choice; LF and CR are for
+	// devices and gateways that don't follow the specification.
+	LineEnding LineEnding
+	// Compliance selects the checks relaxed for noncompliant devices, see
+	// Lenient.
+	Compliance Compliance
+
+	// framingErrors counts responses that failed the LRC check
+	framingErrors atomic.Uint64
+}
+
+func (mb *asciiPackager) copiesPDUData() {}
+
+func (mb *asciiPackager) relaxedChecks() checks {
+	relaxed := mb.Compliance.relaxed()
+	if mb.SkipSlaveIDCheck {
+		relaxed |= checkSlaveID
+	}
+	return relaxed
+}
+
+// FramingErrorCount returns the number of responses rejected by Decode
+// because of an LRC mismatch, an indicator of line quality.
+func (mb *asciiPackager) FramingErrorCount() uint64 {
+	return mb.framingErrors.Load()
 }
 
 // Encode encodes PDU in a ASCII frame:
@@ -60,6 +134,10 @@ type asciiPackager struct {
 //	LRC             : 2 chars
 //	End             : 2 chars
 func (mb *asciiPackager) Encode(pdu *ProtocolDataUnit) (adu []byte, err error) {
+	end, err := mb.LineEnding.terminator()
+	if err != nil {
+		return nil, err
+	}
 	var buf bytes.Buffer
 
 	if _, err = buf.WriteString(asciiStart); err != nil {
@@ -78,7 +156,7 @@ func (mb *asciiPackager) Encode(pdu *ProtocolDataUnit) (adu []byte, err error) {
 	if err = writeHex(&buf, []byte{lrc.value()}); err != nil {
 		return nil, fmt.Errorf("writing LRC: %w", err)
 	}
-	if _, err = buf.WriteString(asciiEnd); err != nil {
+	if _, err = buf.WriteString(end); err != nil {
 		return nil, fmt.Errorf("writing end: %w", err)
 	}
 	return buf.Bytes(), nil
@@ -86,24 +164,34 @@ func (mb *asciiPackager) Encode(pdu *ProtocolDataUnit) (adu []byte, err error) {
 
 // Verify verifies response length, frame boundary and slave id.
 func (mb *asciiPackager) Verify(aduRequest, aduResponse []byte) (err error) {
+	end, err := mb.LineEnding.terminator()
+	if err != nil {
+		return err
+	}
+	if mb.relaxedChecks()&checkFrameParity != 0 {
+		aduResponse = repairFrameParity(aduResponse, end)
+	}
 	length := len(aduResponse)
 	// Minimum size (including address, function and LRC)
-	if length < asciiMinSize+6 {
-		return fmt.Errorf("%w: response length '%v' does not meet minimum '%v'", ErrShortFrame, length, 9)
+	if minSize := asciiFrameMinSize(end); length < minSize {
+		return fmt.Errorf("%w: response length '%v' does not meet minimum '%v'", ErrShortFrame, length, minSize)
 	}
-	// Length excluding colon must be an even number
-	if length%2 != 1 {
-		return fmt.Errorf("%w: response length '%v' is not an even number", ErrProtocolError, length-1)
+	// Length excluding colon and end must be an even number
+	if (length-1-len(end))%2 != 0 {
+		return fmt.Errorf("%w: response length '%v' is not an even number", ErrProtocolError, length-1-len(end))
 	}
 	// First char must be a colon
 	str := string(aduResponse[0:len(asciiStart)])
 	if str != asciiStart {
 		return fmt.Errorf("%w: response frame '%v'... is not started with '%v'", ErrProtocolError, str, asciiStart)
 	}
-	// 2 last chars must be \r\n
-	str = string(aduResponse[len(aduResponse)-len(asciiEnd):])
-	if str != asciiEnd {
-		return fmt.Errorf("%w: response frame ...'%v' is not ended with '%v'", ErrProtocolError, str, asciiEnd)
+	// Last chars must be the line ending
+	str = string(aduResponse[len(aduResponse)-len(end):])
+	if str != end {
+		return fmt.Errorf("%w: response frame ...%q is not ended with %q", ErrProtocolError, str, end)
+	}
+	if mb.relaxedChecks()&checkSlaveID != 0 {
+		return nil
 	}
 	// Slave id
 	responseVal, err := readHex(aduResponse[1:])
@@ -122,6 +210,25 @@ func (mb *asciiPackager) Verify(aduRequest, aduResponse []byte) (err error) {
 
 // Decode extracts PDU from ASCII frame and verify LRC.
 func (mb *asciiPackager) Decode(adu []byte) (pdu *ProtocolDataUnit, err error) {
+	if mb.VerboseErrors {
+		defer func() {
+			if err != nil {
+				frame, more := truncateFrame(adu)
+				err = fmt.Errorf("%w (frame %q%s)", err, frame, more)
+			}
+		}()
+	}
+	end, err := mb.LineEnding.terminator()
+	if err != nil {
+		return nil, err
+	}
+	if mb.relaxedChecks()&checkFrameParity != 0 {
+		adu = repairFrameParity(adu, end)
+	}
+	// Minimum size (including address, function and LRC)
+	if minSize := asciiFrameMinSize(end); len(adu) < minSize {
+		return nil, fmt.Errorf("%w: response length '%v' does not meet minimum '%v'", ErrShortFrame, len(adu), minSize)
+	}
 	pdu = &ProtocolDataUnit{}
 	// Slave address
 	address, err := readHex(adu[1:])
@@ -133,7 +240,7 @@ func (mb *asciiPackager) Decode(adu []byte) (pdu *ProtocolDataUnit, err error) {
 		return nil, fmt.Errorf("reading function code: %w", err)
 	}
 	// Data
-	dataEnd := len(adu) - 4
+	dataEnd := len(adu) - 2 - len(end)
 	data := adu[5:dataEnd]
 	pdu.Data = make([]byte, hex.DecodedLen(len(data)))
 	if _, err = hex.Decode(pdu.Data, data); err != nil {
@@ -149,6 +256,7 @@ func (mb *asciiPackager) Decode(adu []byte) (pdu *ProtocolDataUnit, err error) {
 	lrc.reset()
 	lrc.pushByte(address).pushByte(pdu.FunctionCode).pushBytes(pdu.Data)
 	if lrcVal != lrc.value() {
+		mb.framingErrors.Add(1)
 		return nil, fmt.Errorf("%w: response lrc '%v' does not match expected '%v'", ErrProtocolError, lrcVal, lrc.value())
 	}
 	return pdu, nil
@@ -157,19 +265,27 @@ func (mb *asciiPackager) Decode(adu []byte) (pdu *ProtocolDataUnit, err error) {
 // asciiSerialTransporter implements Transporter interface.
 type asciiSerialTransporter struct {
 	serialPort
+
+	// Resync enables recovery from line noise: bytes before the start of a
+	// frame are discarded, and if the frame is still invalid (bad framing
+	// or LRC) one more frame is read within the remaining timeout.
+	Resync bool
 }
 
 func (mb *asciiSerialTransporter) Send(ctx context.Context, aduRequest []byte) (aduResponse []byte, err error) {
 	mb.mu.Lock()
 	defer mb.mu.Unlock()
 
+	mb.stats.requests.Add(1)
+	defer func() { mb.stats.done(aduResponse, err) }()
+
 	// Check context before starting
 	if err = ctx.Err(); err != nil {
 		return nil, fmt.Errorf("context cancelled before send: %w", err)
 	}
 
 	// Make sure port is connected
-	if err = mb.connect(); err != nil {
+	if err = mb.connectContext(ctx); err != nil {
 		return nil, fmt.Errorf("connecting: %w", err)
 	}
 
@@ -184,7 +300,10 @@ func (mb *asciiSerialTransporter) Send(ctx context.Context, aduRequest []byte) (
 
 	// Send the request
 	mb.logf("modbus: sending %q\n", aduRequest)
-	if _, err = mb.port.Write(aduRequest); err != nil {
+	var written int
+	written, err = mb.port.Write(aduRequest)
+	mb.stats.bytesSent.Add(uint64(written))
+	if err != nil {
 		return nil, fmt.Errorf("writing request: %w", err)
 	}
 
@@ -193,33 +312,156 @@ func (mb *asciiSerialTransporter) Send(ctx context.Context, aduRequest []byte) (
 		return nil, fmt.Errorf("context cancelled: %w", err)
 	}
 
-	// Get the response
+	// Set read timeout based on context deadline
+	readTimeout := mb.Timeout
+	if deadline, ok := ctx.Deadline(); ok {
+		readTimeout = time.Until(deadline)
+		if readTimeout <= 0 {
+			return nil, fmt.Errorf("%w: deadline passed before read", ErrContextDeadline)
+		}
+	}
+	if err = mb.setReadTimeout(readTimeout); err != nil {
+		return nil, fmt.Errorf("setting read timeout: %w", err)
+	}
+	defer func() {
+		if restoreErr := mb.setReadTimeout(mb.Timeout); restoreErr != nil {
+			mb.logf("modbus: warning - failed to restore read timeout: %v\n", restoreErr)
+		}
+	}()
+
+	// Get the response, ended like the request
+	end := requestLineEnding(aduRequest)
+	if aduResponse, err = mb.readFrame(ctx, end, readTimeout); err != nil {
+		return nil, err
+	}
+	for retries := mb.ShortFrameRetries; retries > 0 && len(aduResponse) < asciiFrameMinSize(end); retries-- {
+		// Discard the rest of the truncated frame and read the next one
+		mb.logf("modbus: discarding short frame %q\n", aduResponse)
+		if flushErr := mb.port.ResetInputBuffer(); flushErr != nil {
+			mb.logf("modbus: warning - failed to flush input buffer: %v\n", flushErr)
+		}
+		if aduResponse, err = mb.readFrame(ctx, end, readTimeout); err != nil {
+			return nil, err
+		}
+	}
+	if mb.Resync {
+		if frame, ok := resyncFrame(aduResponse, end); ok {
+			aduResponse = frame
+		} else {
+			// Discard the corrupted frame and give the device one more chance
+			mb.logf("modbus: discarding invalid frame %q\n", aduResponse)
+			if aduResponse, err = mb.readFrame(ctx, end, readTimeout); err != nil {
+				return nil, err
+			}
+			if frame, ok := resyncFrame(aduResponse, end); ok {
+				aduResponse = frame
+			}
+		}
+	}
+	mb.logf("modbus: received %q\n", aduResponse)
+	return aduResponse, nil
+}
+
+// SendNoResponse transmits a request without waiting for a response.
+func (mb *asciiSerialTransporter) SendNoResponse(ctx context.Context, aduRequest []byte) (err error) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.stats.requests.Add(1)
+	defer func() { mb.stats.done(nil, err) }()
+
+	if err = ctx.Err(); err != nil {
+		return fmt.Errorf("context cancelled before send: %w", err)
+	}
+	if err = mb.connectContext(ctx); err != nil {
+		return fmt.Errorf("connecting: %w", err)
+	}
+	mb.lastActivity = time.Now()
+	mb.startCloseTimer()
+
+	mb.logf("modbus: sending %q (no response expected)\n", aduRequest)
+	written, err := mb.port.Write(aduRequest)
+	mb.stats.bytesSent.Add(uint64(written))
+	if err != nil {
+		return fmt.Errorf("writing request: %w", err)
+	}
+	return nil
+}
+
+// requestLineEnding returns the line ending of a request frame.
+func requestLineEnding(aduRequest []byte) string {
+	for _, end := range []string{asciiEnd, string(LF), string(CR)} {
+		if bytes.HasSuffix(aduRequest, []byte(end)) {
+			return end
+		}
+	}
+	return asciiEnd
+}
+
+// readFrame reads from the port until end, the maximum frame size or a read
+// timeout. A frame that the line falls silent in, or that is still not
+// complete once a positive timeout has elapsed since the first read, fails
+// with a timeout; a frame too short to be valid is returned for the caller to
+// discard or report.
+func (mb *asciiSerialTransporter) readFrame(ctx context.Context, end string, timeout time.Duration) (frame []byte, err error) {
 	var n int
 	var data [asciiMaxSize]byte
 	length := 0
+	deadline := time.Now().Add(timeout)
 	for {
 		// Check context before each read iteration
 		if err = ctx.Err(); err != nil {
-			return nil, fmt.Errorf("context cancelled: %w", err)
+			return nil, fmt.Errorf("context cancelled: %w", timeoutError(ctx, err))
 		}
 
 		if n, err = mb.port.Read(data[length:]); err != nil {
 			return nil, fmt.Errorf("reading response: %w", err)
 		}
 		length += n
-		if length >= asciiMaxSize || n == 0 {
+		if n == 0 && length == 0 {
+			// Nothing received within the read timeout
+			return nil, fmt.Errorf("reading response: %w", timeoutError(ctx, errors.New("no data received")))
+		}
+		if length >= asciiMaxSize {
 			break
 		}
 		// Expect end of frame in the data received
 		if length > asciiMinSize {
-			if string(data[length-len(asciiEnd):length]) == asciiEnd {
+			if string(data[length-len(end):length]) == end {
 				break
 			}
 		}
+		if n == 0 && length < asciiFrameMinSize(end) {
+			// A short frame
+			break
+		}
+		// The line fell silent within the frame, or the device trickles
+		// it out too slowly for the read timeout to fire
+		if n == 0 || (timeout > 0 && !time.Now().Before(deadline)) {
+			err = fmt.Errorf("incomplete frame %q after %v", data[:length], timeout)
+			return nil, fmt.Errorf("reading response: %w", timeoutError(ctx, err))
+		}
 	}
-	aduResponse = data[:length]
-	mb.logf("modbus: received %q\n", aduResponse)
-	return aduResponse, nil
+	return data[:length], nil
+}
+
+// resyncFrame returns the last complete frame ending with end in data,
+// skipping any bytes before its start character. It reports false if that
+// frame is not a valid ASCII frame with a matching LRC.
+func resyncFrame(data []byte, end string) ([]byte, bool) {
+	start := bytes.LastIndex(data, []byte(asciiStart))
+	if start < 0 {
+		return nil, false
+	}
+	frame := data[start:]
+	if len(frame) < asciiFrameMinSize(end) || (len(frame)-1-len(end))%2 != 0 || !bytes.HasSuffix(frame, []byte(end)) {
+		return nil, false
+	}
+	packager := asciiPackager{LineEnding: LineEnding(end)}
+	if _, err := packager.Decode(frame); err != nil {
+		return nil, false
+	}
+	return frame, true
 }
 
 // writeHex encodes byte to string in hexadecimal, e.g. 0xA5 => "A5"
@@ -6,6 +6,10 @@ package modbus
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
 	"testing"
 )
 
@@ -46,6 +50,148 @@ func TestASCIIDecoding(t *testing.T) {
 	}
 }
 
+func TestASCIIDecodeVerboseErrors(t *testing.T) {
+	adu := []byte(":F7031389000A61\r\n")
+	decoder := asciiPackager{}
+	_, err := decoder.Decode(adu)
+	if err == nil || strings.Contains(err.Error(), "frame") {
+		t.Fatalf("expected LRC error without the frame, got %v", err)
+	}
+	decoder.VerboseErrors = true
+	_, err = decoder.Decode(adu)
+	if err == nil || !strings.Contains(err.Error(), `(frame ":F7031389000A61\r\n")`) {
+		t.Fatalf("expected LRC error with the frame, got %v", err)
+	}
+}
+
+func TestASCIIFramingErrorCount(t *testing.T) {
+	handler := NewASCIIClientHandler("")
+	handler.Decode([]byte(":F7031389000A61\r\n"))
+	handler.Decode([]byte(":F703\r\n"))
+	if _, err := handler.Decode([]byte(":F7031389000A60\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	handler.Decode([]byte(":F7031389000A62\r\n"))
+	// Only the LRC mismatches count, not the short frame
+	if count := handler.FramingErrorCount(); count != 2 {
+		t.Errorf("expected 2 framing errors, got %v", count)
+	}
+}
+
+func TestASCIIVerifySkipSlaveIDCheck(t *testing.T) {
+	request := []byte(":F7031389000A60\r\n")
+	response := []byte(":F6031389000A61\r\n")
+
+	packager := asciiPackager{}
+	if err := packager.Verify(request, response); err == nil {
+		t.Fatal("expected slave id mismatch error")
+	}
+	packager.SkipSlaveIDCheck = true
+	if err := packager.Verify(request, response); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := packager.Decode(response); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestASCIIResync(t *testing.T) {
+	response := []byte(":F7031389000A60\r\n")
+	tests := []struct {
+		name   string
+		chunks [][]byte
+	}{
+		{"garbage prefix", [][]byte{[]byte("\x00\xff\x13"), response}},
+		{"corrupted frame", [][]byte{[]byte(":F7031389000A61\r\n"), response}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port := &nopCloser{
+				ReadWriter: struct {
+					io.Reader
+					io.Writer
+				}{
+					Reader: &silentReader{chunks: tt.chunks},
+					Writer: io.Discard,
+				},
+			}
+			transporter := asciiSerialTransporter{Resync: true}
+			transporter.port = port
+
+			aduResponse, err := transporter.Send(context.Background(), []byte(":F7031389000A60\r\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(response, aduResponse) {
+				t.Fatalf("response: expected %q, actual %q", response, aduResponse)
+			}
+		})
+	}
+}
+
+func TestASCIILineEnding(t *testing.T) {
+	tests := []struct {
+		name       string
+		lineEnding LineEnding
+		adu        string
+	}{
+		{"default", "", ":F7031389000A60\r\n"},
+		{"CRLF", CRLF, ":F7031389000A60\r\n"},
+		{"LF", LF, ":F7031389000A60\n"},
+		{"CR", CR, ":F7031389000A60\r"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packager := asciiPackager{SlaveID: 247, LineEnding: tt.lineEnding}
+			pdu := ProtocolDataUnit{FunctionCode: 3, Data: []byte{0x13, 0x89, 0, 0x0A}}
+			adu, err := packager.Encode(&pdu)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(adu) != tt.adu {
+				t.Fatalf("adu: expected %q, actual %q", tt.adu, adu)
+			}
+
+			// The transporter reads the response up to the request's line ending
+			port := &nopCloser{
+				ReadWriter: struct {
+					io.Reader
+					io.Writer
+				}{
+					Reader: &silentReader{chunks: [][]byte{[]byte(tt.adu)}},
+					Writer: io.Discard,
+				},
+			}
+			transporter := asciiSerialTransporter{}
+			transporter.port = port
+			aduResponse, err := transporter.Send(context.Background(), adu)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = packager.Verify(adu, aduResponse); err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := packager.Decode(aduResponse)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded.FunctionCode != pdu.FunctionCode || !bytes.Equal(decoded.Data, pdu.Data) {
+				t.Fatalf("pdu: expected %+v, actual %+v", pdu, decoded)
+			}
+		})
+	}
+
+	// A frame with another line ending is rejected
+	packager := asciiPackager{SlaveID: 247, LineEnding: LF}
+	if err := packager.Verify([]byte(":F7031389000A60\n"), []byte(":F7031389000A60\r\n")); err == nil {
+		t.Error("expected a CRLF response to fail verification with LF")
+	}
+	packager.LineEnding = "\n\r"
+	if _, err := packager.Encode(&ProtocolDataUnit{FunctionCode: 3}); !errors.Is(err, ErrInvalidData) {
+		t.Errorf("expected ErrInvalidData for an unknown line ending, got %v", err)
+	}
+}
+
 func BenchmarkASCIIEncoder(b *testing.B) {
 	encoder := asciiPackager{
 		SlaveID: 10,
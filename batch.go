@@ -0,0 +1,110 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"context"
+	"fmt"
+)
+
+// maxWriteRegisters is the maximum quantity of a Write Multiple Registers request.
+const maxWriteRegisters = 123
+
+// RegisterWrite is a block of holding register values starting at Address.
+type RegisterWrite struct {
+	Address uint16
+	Values  []uint16
+}
+
+// BatchWriteError reports which request of a WriteBatch failed. Index is the
+// position in the writes slice of the RegisterWrite containing Address.
+type BatchWriteError struct {
+	Index    int
+	Address  uint16
+	Quantity uint16
+	Err      error
+}
+
+// Error returns the failed request and the underlying error.
+func (e *BatchWriteError) Error() string {
+	return fmt.Sprintf("modbus: batch write %v failed at address '%v' quantity '%v': %v", e.Index, e.Address, e.Quantity, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *BatchWriteError) Unwrap() error {
+	return e.Err
+}
+
+// WriteBatch writes several blocks of holding registers in order. Blocks that
+// follow each other contiguously are coalesced into Write Multiple Registers
+// requests of up to 123 registers, or the limit set with
+// WithMaxWriteQuantity; a lone register is written with Write Single
+// Register. The sequence stops at the first failure, which is returned as
+// a *BatchWriteError.
+func WriteBatch(ctx context.Context, client Client, writes []RegisterWrite) error {
+	for i, w := range writes {
+		if len(w.Values) == 0 {
+			return &BatchWriteError{Index: i, Address: w.Address,
+				Err: fmt.Errorf("%w: write has no values", ErrInvalidQuantity)}
+		}
+		if int(w.Address)+len(w.Values) > 65536 {
+			return &BatchWriteError{Index: i, Address: w.Address, Quantity: uint16(len(w.Values)),
+				Err: fmt.Errorf("%w: address '%v' plus quantity '%v' exceeds address space", ErrInvalidAddress, w.Address, len(w.Values))}
+		}
+	}
+	limit := int(writeLimitOf(client))
+	for _, seg := range coalesceWrites(writes) {
+		for offset := 0; offset < len(seg.values); offset += limit {
+			values := seg.values[offset:min(offset+limit, len(seg.values))]
+			address := seg.address + uint16(offset)
+			var err error
+			if len(values) == 1 {
+				_, err = client.WriteSingleRegister(ctx, address, values[0])
+			} else {
+				_, err = client.WriteMultipleRegisters(ctx, address, uint16(len(values)), dataBlock(values...))
+			}
+			if err != nil {
+				return &BatchWriteError{Index: seg.indexes[offset], Address: address, Quantity: uint16(len(values)), Err: err}
+			}
+		}
+	}
+	return nil
+}
+
+// writeSegment is a contiguous run of register values. indexes holds, for
+// each value, the position of the RegisterWrite it came from.
+type writeSegment struct {
+	address uint16
+	values  []uint16
+	indexes []int
+}
+
+// coalesceWrites merges consecutive writes whose ranges are contiguous.
+// Writes are never reordered.
+func coalesceWrites(writes []RegisterWrite) []writeSegment {
+	var segments []writeSegment
+	for i, w := range writes {
+		if n := len(segments); n > 0 {
+			last := &segments[n-1]
+			if int(last.address)+len(last.values) == int(w.Address) {
+				last.values = append(last.values, w.Values...)
+				for range w.Values {
+					last.indexes = append(last.indexes, i)
+				}
+				continue
+			}
+		}
+		seg := writeSegment{
+			address: w.Address,
+			values:  append([]uint16(nil), w.Values...),
+			indexes: make([]int, len(w.Values)),
+		}
+		for j := range seg.indexes {
+			seg.indexes[j] = i
+		}
+		segments = append(segments, seg)
+	}
+	return segments
+}
@@ -0,0 +1,219 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// recordingTransporter acknowledges write requests and records them.
+type recordingTransporter struct {
+	requests [][]byte
+	failAt   int
+}
+
+func (r *recordingTransporter) Send(_ context.Context, req []byte) ([]byte, error) {
+	r.requests = append(r.requests, append([]byte(nil), req...))
+	if len(r.requests) == r.failAt {
+		return []byte{req[0] | 0x80, ExceptionCodeIllegalDataAddress}, nil
+	}
+	return req[:5], nil
+}
+
+func TestWriteBatch(t *testing.T) {
+	values := make([]uint16, 130)
+	writes := []RegisterWrite{
+		{Address: 10, Values: []uint16{1, 2}},
+		{Address: 12, Values: []uint16{3}},
+		{Address: 100, Values: []uint16{4}},
+		{Address: 200, Values: values},
+	}
+	rt := &recordingTransporter{}
+	client := NewClientWithPackagerTransporter(&mockPackager{}, rt)
+	if err := WriteBatch(context.Background(), client, writes); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		functionCode byte
+		address      uint16
+		quantity     uint16 // register value for single writes
+	}{
+		{FuncCodeWriteMultipleRegisters, 10, 3},
+		{FuncCodeWriteSingleRegister, 100, 4},
+		{FuncCodeWriteMultipleRegisters, 200, 123},
+		{FuncCodeWriteMultipleRegisters, 323, 7},
+	}
+	if len(rt.requests) != len(expected) {
+		t.Fatalf("expected %d requests, got %d", len(expected), len(rt.requests))
+	}
+	for i, e := range expected {
+		req := rt.requests[i]
+		if req[0] != e.functionCode {
+			t.Errorf("request %d: function code %v, want %v", i, req[0], e.functionCode)
+		}
+		if v := binary.BigEndian.Uint16(req[1:]); v != e.address {
+			t.Errorf("request %d: address %v, want %v", i, v, e.address)
+		}
+		if v := binary.BigEndian.Uint16(req[3:]); v != e.quantity {
+			t.Errorf("request %d: quantity %v, want %v", i, v, e.quantity)
+		}
+	}
+}
+
+func TestWriteBatchError(t *testing.T) {
+	writes := []RegisterWrite{
+		{Address: 0, Values: []uint16{1}},
+		{Address: 5, Values: []uint16{2, 3}},
+		{Address: 50, Values: []uint16{4}},
+	}
+	rt := &recordingTransporter{failAt: 2}
+	client := NewClientWithPackagerTransporter(&mockPackager{}, rt)
+
+	err := WriteBatch(context.Background(), client, writes)
+	var batchErr *BatchWriteError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("expected BatchWriteError, got %v", err)
+	}
+	if batchErr.Index != 1 || batchErr.Address != 5 || batchErr.Quantity != 2 {
+		t.Errorf("unexpected error details: %+v", batchErr)
+	}
+	var modbusErr *ModbusError
+	if !errors.As(err, &modbusErr) {
+		t.Errorf("expected wrapped ModbusError, got %v", err)
+	}
+	if len(rt.requests) != 2 {
+		t.Errorf("expected sequence to stop after 2 requests, got %d", len(rt.requests))
+	}
+
+	err = WriteBatch(context.Background(), client, []RegisterWrite{{Address: 65535, Values: []uint16{1, 2}}})
+	if !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("expected ErrInvalidAddress, got %v", err)
+	}
+}
+
+func TestWriteMultipleRegistersChunked(t *testing.T) {
+	values := make([]uint16, 300)
+	for i := range values {
+		values[i] = uint16(i)
+	}
+	rt := &recordingTransporter{}
+	client := NewClientWithPackagerTransporter(&mockPackager{}, rt)
+	if err := WriteMultipleRegistersChunked(context.Background(), client, 1000, values); err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct{ address, quantity uint16 }{{1000, 123}, {1123, 123}, {1246, 54}}
+	if len(rt.requests) != len(expected) {
+		t.Fatalf("expected %d requests, got %d", len(expected), len(rt.requests))
+	}
+	for i, e := range expected {
+		req := rt.requests[i]
+		if req[0] != FuncCodeWriteMultipleRegisters {
+			t.Errorf("request %d: function code %v, want %v", i, req[0], FuncCodeWriteMultipleRegisters)
+		}
+		if v := binary.BigEndian.Uint16(req[1:]); v != e.address {
+			t.Errorf("request %d: address %v, want %v", i, v, e.address)
+		}
+		if v := binary.BigEndian.Uint16(req[3:]); v != e.quantity {
+			t.Errorf("request %d: quantity %v, want %v", i, v, e.quantity)
+		}
+		if v := binary.BigEndian.Uint16(req[6:]); v != e.address-1000 {
+			t.Errorf("request %d: first value %v, want %v", i, v, e.address-1000)
+		}
+	}
+
+	rt = &recordingTransporter{failAt: 2}
+	client = NewClientWithPackagerTransporter(&mockPackager{}, rt)
+	err := WriteMultipleRegistersChunked(context.Background(), client, 1000, values)
+	var chunkErr *ChunkedWriteError
+	if !errors.As(err, &chunkErr) {
+		t.Fatalf("expected ChunkedWriteError, got %v", err)
+	}
+	if chunkErr.Written != 123 || chunkErr.Address != 1123 || chunkErr.Quantity != 123 {
+		t.Errorf("unexpected error details: %+v", chunkErr)
+	}
+	var modbusErr *ModbusError
+	if !errors.As(err, &modbusErr) {
+		t.Errorf("expected wrapped ModbusError, got %v", err)
+	}
+	if len(rt.requests) != 2 {
+		t.Errorf("expected sequence to stop after 2 requests, got %d", len(rt.requests))
+	}
+
+	err = WriteMultipleRegistersChunked(context.Background(), client, 65500, values)
+	if !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("expected ErrInvalidAddress, got %v", err)
+	}
+	err = WriteMultipleRegistersChunked(context.Background(), client, 0, nil)
+	if !errors.Is(err, ErrInvalidQuantity) {
+		t.Errorf("expected ErrInvalidQuantity, got %v", err)
+	}
+}
+
+func TestMaxQuantity(t *testing.T) {
+	ctx := context.Background()
+	var quantities []uint16
+	// A device answering reads with zeroed registers
+	device := &mockTransporter{sendFunc: func(_ context.Context, req []byte) ([]byte, error) {
+		quantity := binary.BigEndian.Uint16(req[3:])
+		quantities = append(quantities, quantity)
+		return append([]byte{req[0], byte(2 * quantity)}, make([]byte, 2*quantity)...), nil
+	}}
+	client := NewClientWithPackagerTransporter(&mockPackager{}, device, WithMaxReadQuantity(32))
+
+	results, err := ReadHoldingRegistersChunked(ctx, client, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 200 || !slices.Equal(quantities, []uint16{32, 32, 32, 4}) {
+		t.Errorf("expected reads of 32, 32, 32 and 4 registers, got %v", quantities)
+	}
+
+	quantities = nil
+	if _, err := client.ReadHoldingRegisters(ctx, 0, 33); !errors.Is(err, ErrInvalidQuantity) {
+		t.Errorf("ReadHoldingRegisters: expected ErrInvalidQuantity, got %v", err)
+	}
+	if _, err := client.ReadInputRegisters(ctx, 0, 33); !errors.Is(err, ErrInvalidQuantity) {
+		t.Errorf("ReadInputRegisters: expected ErrInvalidQuantity, got %v", err)
+	}
+	if _, err := client.ReadWriteMultipleRegisters(ctx, 0, 33, 0, 1, []byte{0, 0}); !errors.Is(err, ErrInvalidQuantity) {
+		t.Errorf("ReadWriteMultipleRegisters: expected ErrInvalidQuantity, got %v", err)
+	}
+	if len(quantities) != 0 {
+		t.Errorf("expected nothing sent beyond the limit, got %v", quantities)
+	}
+	if _, err := client.ReadHoldingRegisters(ctx, 0, 32); err != nil {
+		t.Errorf("expected a read at the limit to succeed, got %v", err)
+	}
+
+	rt := &recordingTransporter{}
+	client = NewClientWithPackagerTransporter(&mockPackager{}, rt, WithMaxWriteQuantity(50))
+	if err := WriteMultipleRegistersChunked(ctx, client, 0, make([]uint16, 120)); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteBatch(ctx, client, []RegisterWrite{{Address: 0, Values: make([]uint16, 60)}}); err != nil {
+		t.Fatal(err)
+	}
+	quantities = nil
+	for _, req := range rt.requests {
+		quantities = append(quantities, binary.BigEndian.Uint16(req[3:]))
+	}
+	if !slices.Equal(quantities, []uint16{50, 50, 20, 50, 10}) {
+		t.Errorf("expected writes of 50, 50, 20, 50 and 10 registers, got %v", quantities)
+	}
+	if _, err := client.WriteMultipleRegisters(ctx, 0, 51, make([]byte, 102)); !errors.Is(err, ErrInvalidQuantity) {
+		t.Errorf("WriteMultipleRegisters: expected ErrInvalidQuantity, got %v", err)
+	}
+
+	// Limits above the protocol's fall back to it
+	client = NewClientWithPackagerTransporter(&mockPackager{}, device, WithMaxReadQuantity(200))
+	if _, err := client.ReadHoldingRegisters(ctx, 0, 126); !errors.Is(err, ErrInvalidQuantity) {
+		t.Errorf("expected the protocol limit, got %v", err)
+	}
+}
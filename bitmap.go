@@ -0,0 +1,111 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"context"
+)
+
+// Bitmap is a packed sequence of bits as transferred by the bit access
+// functions: bit i is stored in byte i/8 at position i%8 (LSB first).
+type Bitmap struct {
+	data  []byte
+	count int
+}
+
+// NewBitmap allocates a Bitmap holding count bits, all cleared.
+func NewBitmap(count int) Bitmap {
+	if count < 0 {
+		count = 0
+	}
+	return Bitmap{data: make([]byte, (count+7)/8), count: count}
+}
+
+// BitmapFromBytes wraps packed coil or input status bytes as a Bitmap of
+// count bits. The slice is not copied.
+func BitmapFromBytes(data []byte, count int) Bitmap {
+	if count < 0 {
+		count = 0
+	}
+	if count > len(data)*8 {
+		count = len(data) * 8
+	}
+	return Bitmap{data: data, count: count}
+}
+
+// Count returns the number of bits in the bitmap.
+func (b Bitmap) Count() int {
+	return b.count
+}
+
+// Get returns the value of bit i. Bits outside the bitmap read as false.
+func (b Bitmap) Get(i int) bool {
+	if i < 0 || i >= b.count {
+		return false
+	}
+	return b.data[i/8]&(1<<uint(i%8)) != 0
+}
+
+// Set sets bit i to value. Bits outside the bitmap are ignored.
+func (b Bitmap) Set(i int, value bool) {
+	if i < 0 || i >= b.count {
+		return
+	}
+	if value {
+		b.data[i/8] |= 1 << uint(i%8)
+	} else {
+		b.data[i/8] &^= 1 << uint(i%8)
+	}
+}
+
+// Bytes returns the packed representation of the bitmap, suitable for
+// WriteMultipleCoils.
+func (b Bitmap) Bytes() []byte {
+	return b.data
+}
+
+// Bools returns the bitmap as a slice of bool.
+func (b Bitmap) Bools() []bool {
+	result := make([]bool, b.count)
+	for i := range result {
+		result[i] = b.Get(i)
+	}
+	return result
+}
+
+// ReadCoilsBitmap reads quantity coils starting at address and returns
+// them as a Bitmap.
+func ReadCoilsBitmap(ctx context.Context, client Client, address, quantity uint16) (Bitmap, error) {
+	results, err := client.ReadCoils(ctx, address, quantity)
+	if err != nil {
+		return Bitmap{}, err
+	}
+	return BitmapFromBytes(results, int(quantity)), nil
+}
+
+// ReadCoilsWords reads quantity coils starting at address and returns the
+// coil status bytes reassembled as big-endian words, the first byte
+// (coils address to address+7) being the high byte of the first word. An
+// odd final byte is padded with a zero low byte.
+func ReadCoilsWords(ctx context.Context, client Client, address, quantity uint16) ([]uint16, error) {
+	results, err := client.ReadCoils(ctx, address, quantity)
+	if err != nil {
+		return nil, err
+	}
+	if len(results)%2 != 0 {
+		results = append(results, 0)
+	}
+	return decodeRegisters(results), nil
+}
+
+// ReadDiscreteInputsBitmap reads quantity discrete inputs starting at
+// address and returns them as a Bitmap.
+func ReadDiscreteInputsBitmap(ctx context.Context, client Client, address, quantity uint16) (Bitmap, error) {
+	results, err := client.ReadDiscreteInputs(ctx, address, quantity)
+	if err != nil {
+		return Bitmap{}, err
+	}
+	return BitmapFromBytes(results, int(quantity)), nil
+}
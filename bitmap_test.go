@@ -0,0 +1,86 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestBitmap(t *testing.T) {
+	b := NewBitmap(10)
+	if b.Count() != 10 {
+		t.Fatalf("Count() = %d, want 10", b.Count())
+	}
+	b.Set(0, true)
+	b.Set(3, true)
+	b.Set(9, true)
+	b.Set(10, true) // out of range, ignored
+	if !bytes.Equal(b.Bytes(), []byte{0x09, 0x02}) {
+		t.Fatalf("Bytes() = %x, want 0902", b.Bytes())
+	}
+	b.Set(3, false)
+	if b.Get(3) {
+		t.Errorf("bit 3 should be cleared")
+	}
+	if !b.Get(0) || !b.Get(9) || b.Get(10) || b.Get(-1) {
+		t.Errorf("unexpected bit values: %v", b.Bools())
+	}
+	want := []bool{true, false, false, false, false, false, false, false, false, true}
+	got := b.Bools()
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Bools() = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestReadCoilsBitmap(t *testing.T) {
+	mockT := &mockTransporter{
+		sendFunc: func(_ context.Context, _ []byte) ([]byte, error) {
+			return []byte{FuncCodeReadCoils, 0x02, 0xCD, 0x01}, nil
+		},
+	}
+	client := NewClientWithPackagerTransporter(&mockPackager{}, mockT)
+
+	b, err := ReadCoilsBitmap(context.Background(), client, 0x13, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Count() != 10 {
+		t.Fatalf("Count() = %d, want 10", b.Count())
+	}
+	// 0xCD = 1100 1101, 0x01 = 0000 0001
+	want := []bool{true, false, true, true, false, false, true, true, true, false}
+	for i, v := range want {
+		if b.Get(i) != v {
+			t.Errorf("bit %d = %v, want %v", i, b.Get(i), v)
+		}
+	}
+
+	if _, err := ReadCoilsBitmap(context.Background(), client, 0, 0); err == nil {
+		t.Error("expected error for zero quantity")
+	}
+}
+
+func TestReadCoilsWords(t *testing.T) {
+	mockT := &mockTransporter{
+		sendFunc: func(_ context.Context, _ []byte) ([]byte, error) {
+			return []byte{FuncCodeReadCoils, 0x03, 0xCD, 0x6B, 0x05}, nil
+		},
+	}
+	client := NewClientWithPackagerTransporter(&mockPackager{}, mockT)
+
+	words, err := ReadCoilsWords(context.Background(), client, 0x13, 19)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The odd final byte is padded
+	if fmt.Sprintf("%04x", words) != "[cd6b 0500]" {
+		t.Errorf("ReadCoilsWords() = %04x, want [cd6b 0500]", words)
+	}
+}
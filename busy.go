@@ -0,0 +1,52 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// WithBusyRetries makes the client retry a request answered with the
+// Acknowledge or Server Device Busy exception, which mean the device is
+// still processing and the request should be sent again later. The request
+// is retried up to retries times, waiting delay before each retry, and the
+// ModbusError is returned once the retries are used up. Other exceptions
+// are never retried. The default is 0 (no retry).
+func WithBusyRetries(retries int, delay time.Duration) ClientOption {
+	return func(c *client) {
+		c.busyRetries = retries
+		c.busyRetryDelay = delay
+	}
+}
+
+// NewClientWithBusyRetries creates a new modbus client with given backend
+// handler that retries busy responses as described for WithBusyRetries.
+func NewClientWithBusyRetries(handler ClientHandler, retries int, delay time.Duration, opts ...ClientOption) Client {
+	return newClient(handler, handler, append([]ClientOption{WithBusyRetries(retries, delay)}, opts...))
+}
+
+// isBusyError reports whether err is an Acknowledge or Server Device Busy
+// exception.
+func isBusyError(err error) bool {
+	var mbErr *ModbusError
+	if !errors.As(err, &mbErr) {
+		return false
+	}
+	return mbErr.ExceptionCode == ExceptionCodeAcknowledge || mbErr.ExceptionCode == ExceptionCodeServerDeviceBusy
+}
+
+// sleepContext waits for d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// exceptionDevice returns a transporter answering the first failures
+// requests with the given exception and echoing the request afterwards.
+func exceptionDevice(exceptionCode byte, failures int, sends *int) *mockTransporter {
+	return &mockTransporter{
+		sendFunc: func(_ context.Context, req []byte) ([]byte, error) {
+			*sends++
+			if *sends <= failures {
+				return []byte{req[0] | 0x80, exceptionCode}, nil
+			}
+			return req, nil
+		},
+	}
+}
+
+func TestBusyRetries(t *testing.T) {
+	for _, code := range []byte{ExceptionCodeAcknowledge, ExceptionCodeServerDeviceBusy} {
+		sends := 0
+		client := NewClientWithPackagerTransporter(&mockPackager{}, exceptionDevice(code, 2, &sends), WithBusyRetries(2, time.Millisecond))
+		if _, err := client.WriteSingleRegister(context.Background(), 1, 2); err != nil {
+			t.Fatalf("exception %v: unexpected error: %v", code, err)
+		}
+		if sends != 3 {
+			t.Errorf("exception %v: expected 3 sends, got %d", code, sends)
+		}
+	}
+}
+
+func TestBusyRetriesExhausted(t *testing.T) {
+	sends := 0
+	client := NewClientWithPackagerTransporter(&mockPackager{}, exceptionDevice(ExceptionCodeServerDeviceBusy, 5, &sends), WithBusyRetries(2, time.Millisecond))
+	_, err := client.WriteSingleRegister(context.Background(), 1, 2)
+	var mbErr *ModbusError
+	if !errors.As(err, &mbErr) || mbErr.ExceptionCode != ExceptionCodeServerDeviceBusy {
+		t.Fatalf("expected server device busy exception, got %v", err)
+	}
+	if sends != 3 {
+		t.Errorf("expected 3 sends, got %d", sends)
+	}
+}
+
+func TestBusyRetriesOtherException(t *testing.T) {
+	sends := 0
+	client := NewClientWithPackagerTransporter(&mockPackager{}, exceptionDevice(ExceptionCodeIllegalDataAddress, 5, &sends), WithBusyRetries(2, time.Millisecond))
+	if _, err := client.WriteSingleRegister(context.Background(), 1, 2); err == nil {
+		t.Fatal("expected an error")
+	}
+	if sends != 1 {
+		t.Errorf("expected 1 send, got %d", sends)
+	}
+}
+
+func TestBusyRetriesContextCancelled(t *testing.T) {
+	sends := 0
+	client := NewClientWithPackagerTransporter(&mockPackager{}, exceptionDevice(ExceptionCodeServerDeviceBusy, 5, &sends), WithBusyRetries(2, time.Hour))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := client.WriteSingleRegister(ctx, 1, 2)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if sends != 1 {
+		t.Errorf("expected 1 send, got %d", sends)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"math"
+)
+
+// ByteOrder describes how a 32-bit value is laid out across two 16-bit
+// registers. With the value's bytes named A (most significant) to D, the
+// constants are named after the order the bytes appear on the wire.
+type ByteOrder int
+
+const (
+	// BigEndian is ABCD: high word first, high byte first within words.
+	BigEndian ByteOrder = iota
+	// LittleEndian is DCBA: low word first, low byte first within words.
+	LittleEndian
+	// BigEndianWordSwap is CDAB: low word first, high byte first within words.
+	BigEndianWordSwap
+	// LittleEndianWordSwap is BADC: high word first, low byte first within words.
+	LittleEndianWordSwap
+)
+
+// String returns the byte layout, e.g. "ABCD".
+func (o ByteOrder) String() string {
+	switch o {
+	case BigEndian:
+		return "ABCD"
+	case LittleEndian:
+		return "DCBA"
+	case BigEndianWordSwap:
+		return "CDAB"
+	case LittleEndianWordSwap:
+		return "BADC"
+	default:
+		return "unknown"
+	}
+}
+
+// wordSwap reports whether the low word comes first.
+func (o ByteOrder) wordSwap() bool {
+	return o == LittleEndian || o == BigEndianWordSwap
+}
+
+// byteSwap reports whether the low byte of each word comes first.
+func (o ByteOrder) byteSwap() bool {
+	return o == LittleEndian || o == LittleEndianWordSwap
+}
+
+// Uint32 decodes a 32-bit value from the first 4 bytes of b.
+func (o ByteOrder) Uint32(b []byte) uint32 {
+	_ = b[3] // bounds check hint to compiler
+	hi, lo := o.word(b[0:2]), o.word(b[2:4])
+	if o.wordSwap() {
+		hi, lo = lo, hi
+	}
+	return uint32(hi)<<16 | uint32(lo)
+}
+
+// PutUint32 encodes v into the first 4 bytes of b.
+func (o ByteOrder) PutUint32(b []byte, v uint32) {
+	_ = b[3] // bounds check hint to compiler
+	hi, lo := uint16(v>>16), uint16(v)
+	if o.wordSwap() {
+		hi, lo = lo, hi
+	}
+	o.putWord(b[0:2], hi)
+	o.putWord(b[2:4], lo)
+}
+
+// Float32 decodes an IEEE 754 single precision value from the first 4 bytes of b.
+func (o ByteOrder) Float32(b []byte) float32 {
+	return math.Float32frombits(o.Uint32(b))
+}
+
+// PutFloat32 encodes v as IEEE 754 single precision into the first 4 bytes of b.
+func (o ByteOrder) PutFloat32(b []byte, v float32) {
+	o.PutUint32(b, math.Float32bits(v))
+}
+
+func (o ByteOrder) word(b []byte) uint16 {
+	if o.byteSwap() {
+		return uint16(b[1])<<8 | uint16(b[0])
+	}
+	return uint16(b[0])<<8 | uint16(b[1])
+}
+
+func (o ByteOrder) putWord(b []byte, v uint16) {
+	if o.byteSwap() {
+		b[0], b[1] = byte(v), byte(v>>8)
+	} else {
+		b[0], b[1] = byte(v>>8), byte(v)
+	}
+}
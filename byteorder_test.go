@@ -0,0 +1,38 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestByteOrder(t *testing.T) {
+	tests := []struct {
+		order ByteOrder
+		wire  []byte
+	}{
+		{BigEndian, []byte{0x41, 0x42, 0x43, 0x44}},
+		{LittleEndian, []byte{0x44, 0x43, 0x42, 0x41}},
+		{BigEndianWordSwap, []byte{0x43, 0x44, 0x41, 0x42}},
+		{LittleEndianWordSwap, []byte{0x42, 0x41, 0x44, 0x43}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.order.String(), func(t *testing.T) {
+			if v := tt.order.Uint32(tt.wire); v != 0x41424344 {
+				t.Errorf("Uint32: expected 0x41424344, actual 0x%08X", v)
+			}
+			b := make([]byte, 4)
+			tt.order.PutUint32(b, 0x41424344)
+			if !bytes.Equal(b, tt.wire) {
+				t.Errorf("PutUint32: expected % x, actual % x", tt.wire, b)
+			}
+			tt.order.PutFloat32(b, 12.5)
+			if v := tt.order.Float32(b); v != 12.5 {
+				t.Errorf("Float32: expected 12.5, actual %v", v)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"context"
+	"fmt"
+)
+
+// maxReadRegisters is the maximum quantity of a Read Holding Registers request.
+const maxReadRegisters = 125
+
+// ReadHoldingRegistersChunked reads quantity holding registers starting at
+// address, more than fit in one request, with as many Read Holding
+// Registers requests of up to 125 registers, or the limit set with
+// WithMaxReadQuantity, as needed. If client was created by NewClient with
+// a transporter that is a PipelineSender, such as TCP, all requests are
+// sent before the responses are read; otherwise they are sent one after
+// the other with ReadHoldingRegisters. The register values are returned
+// like ReadHoldingRegisters.
+func ReadHoldingRegistersChunked(ctx context.Context, client Client, address, quantity uint16) (results []byte, err error) {
+	if quantity < 1 {
+		return nil, fmt.Errorf("%w: quantity '%v' must be at least '%v'", ErrInvalidQuantity, quantity, 1)
+	}
+	if int(address)+int(quantity) > 65536 {
+		return nil, fmt.Errorf("%w: address '%v' plus quantity '%v' exceeds address space", ErrInvalidAddress, address, quantity)
+	}
+	limit := int(readLimitOf(client))
+	var requests []ProtocolDataUnit
+	var quantities []uint16
+	for offset := 0; offset < int(quantity); offset += limit {
+		n := uint16(min(limit, int(quantity)-offset))
+		requests = append(requests, ProtocolDataUnit{
+			FunctionCode: FuncCodeReadHoldingRegisters,
+			Data:         dataBlock(address+uint16(offset), n),
+		})
+		quantities = append(quantities, n)
+	}
+
+	mb, sender := pipelineSenderOf(client)
+	if sender == nil || len(requests) == 1 {
+		results = make([]byte, 0, 2*int(quantity))
+		for i := range requests {
+			chunk, err := client.ReadHoldingRegisters(ctx, address+uint16(i*limit), quantities[i])
+			if err != nil {
+				return nil, err
+			}
+			if len(chunk) != 2*int(quantities[i]) {
+				return nil, fmt.Errorf("%w: response data size '%v' does not match quantity '%v'", ErrInvalidResponse, len(chunk), quantities[i])
+			}
+			results = append(results, chunk...)
+		}
+		return results, nil
+	}
+
+	aduRequests := make([][]byte, len(requests))
+	for i := range requests {
+		if aduRequests[i], err = mb.packager.Encode(&requests[i]); err != nil {
+			return nil, fmt.Errorf("reading holding registers: encoding PDU: %w", err)
+		}
+	}
+	aduResponses, err := sender.SendPipelined(ctx, aduRequests)
+	if err != nil {
+		return nil, fmt.Errorf("reading holding registers: sending requests: %w", err)
+	}
+	results = make([]byte, 0, 2*int(quantity))
+	for i := range requests {
+		response, err := mb.decodeResponse(&requests[i], aduRequests[i], aduResponses[i])
+		if err != nil {
+			return nil, fmt.Errorf("reading holding registers: %w", err)
+		}
+		count := int(response.Data[0])
+		length := len(response.Data) - 1
+		if count != length || count != 2*int(quantities[i]) {
+			return nil, fmt.Errorf("%w: response data size '%v' does not match count '%v' for quantity '%v'", ErrInvalidResponse, length, count, quantities[i])
+		}
+		results = append(results, response.Data[1:]...)
+	}
+	return results, nil
+}
+
+// pipelineSenderOf returns c as created by NewClient and its transporter if
+// it is a PipelineSender, or nil for other clients, whose requests must go
+// through their own methods.
+func pipelineSenderOf(c Client) (*client, PipelineSender) {
+	if mb, ok := c.(*client); ok {
+		if sender, ok := mb.transporter.(PipelineSender); ok {
+			return mb, sender
+		}
+	}
+	return nil, nil
+}
+
+// ChunkedWriteError reports the chunk of a WriteMultipleRegistersChunked
+// that failed. Written is the number of registers, from the start address,
+// written by the chunks before it; the registers of the failed chunk may or
+// may not have been written.
+type ChunkedWriteError struct {
+	Written  int
+	Address  uint16
+	Quantity uint16
+	Err      error
+}
+
+// Error returns the failed chunk and the underlying error.
+func (e *ChunkedWriteError) Error() string {
+	return fmt.Sprintf("modbus: chunked write failed at address '%v' quantity '%v' after '%v' registers written: %v", e.Address, e.Quantity, e.Written, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ChunkedWriteError) Unwrap() error {
+	return e.Err
+}
+
+// WriteMultipleRegistersChunked writes values to the holding registers
+// starting at address, more than fit in one request, with as many Write
+// Multiple Registers requests of up to 123 registers, or the limit set with
+// WithMaxWriteQuantity, as needed, sent one after the other at increasing
+// addresses. It stops at the first failure, which is returned as a
+// *ChunkedWriteError telling how many registers were written.
+func WriteMultipleRegistersChunked(ctx context.Context, client Client, address uint16, values []uint16) error {
+	if len(values) < 1 {
+		return fmt.Errorf("%w: quantity '%v' must be at least '%v'", ErrInvalidQuantity, len(values), 1)
+	}
+	if int(address)+len(values) > 65536 {
+		return fmt.Errorf("%w: address '%v' plus quantity '%v' exceeds address space", ErrInvalidAddress, address, len(values))
+	}
+	limit := int(writeLimitOf(client))
+	for offset := 0; offset < len(values); offset += limit {
+		chunk := values[offset:min(offset+limit, len(values))]
+		start := address + uint16(offset)
+		if _, err := client.WriteMultipleRegisters(ctx, start, uint16(len(chunk)), dataBlock(chunk...)); err != nil {
+			return &ChunkedWriteError{Written: offset, Address: start, Quantity: uint16(len(chunk)), Err: err}
+		}
+	}
+	return nil
+}
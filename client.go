@@ -8,6 +8,9 @@ import (
 	"context"
 	"encoding/binary"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // ClientHandler is the interface that groups the Packager and Transporter methods.
@@ -19,18 +22,146 @@ type ClientHandler interface {
 type client struct {
 	packager    Packager
 	transporter Transporter
+
+	// Number of times a verified write is retried after a failure
+	verifyRetries int
+	// Set by ForceListenOnly until RestartCommunications
+	listenOnly atomic.Bool
+	// Number of times a request answered with Acknowledge or Server Device
+	// Busy is retried, and the wait before each retry
+	busyRetries    int
+	busyRetryDelay time.Duration
+	// Register quantity limits of the device, 0 for the protocol limits
+	maxReadQuantity  uint16
+	maxWriteQuantity uint16
+	// Accept Write Single Register responses echoing only the value
+	lenientWriteEcho bool
+}
+
+// relaxedChecks returns the checks relaxed by the packager, and by the
+// deprecated client options.
+func (mb *client) relaxedChecks() checks {
+	relaxed := complianceOf(mb.packager)
+	if mb.lenientWriteEcho {
+		relaxed |= checkWriteEcho
+	}
+	return relaxed
+}
+
+// ClientOption configures optional client behavior.
+type ClientOption func(*client)
+
+// WithVerifyRetries sets how many times WriteRegisterVerified retries the
+// write after a failed or mismatched read back. The default is 0 (no retry).
+func WithVerifyRetries(retries int) ClientOption {
+	return func(c *client) {
+		c.verifyRetries = retries
+	}
+}
+
+// WithMaxReadQuantity limits the registers read per request to the device's
+// own limit, for devices supporting fewer than the 125 the protocol allows.
+// Register reads of more fail with ErrInvalidQuantity before anything is
+// sent, and ReadHoldingRegistersChunked splits reads at the limit. 0 or a
+// limit above the protocol's means the protocol limit.
+func WithMaxReadQuantity(quantity uint16) ClientOption {
+	return func(c *client) {
+		c.maxReadQuantity = quantity
+	}
+}
+
+// WithLenientWriteEcho makes WriteSingleRegister accept a response holding
+// only the 2-byte register value rather than the address and value the
+// protocol requires, as sent by the firmware of some low-cost devices and
+// serial bridges. Such a response is checked against the value written
+// only, and over RTU ends on line silence. The default is false (strict).
+//
+// Deprecated: Set the handler's Compliance to Lenient, which relaxes this
+// check along with the others of noncompliant devices.
+func WithLenientWriteEcho(lenient bool) ClientOption {
+	return func(c *client) {
+		c.lenientWriteEcho = lenient
+	}
+}
+
+// WithMaxWriteQuantity limits the registers written per request like
+// WithMaxReadQuantity limits reads, applying to writes of multiple
+// registers and splitting those of WriteMultipleRegistersChunked and
+// WriteBatch.
+func WithMaxWriteQuantity(quantity uint16) ClientOption {
+	return func(c *client) {
+		c.maxWriteQuantity = quantity
+	}
+}
+
+// quantityLimit returns the device limit if set and lower than the
+// protocol limit, otherwise the protocol limit.
+func quantityLimit(device, protocol uint16) uint16 {
+	if device > 0 && device < protocol {
+		return device
+	}
+	return protocol
+}
+
+// readLimit returns the maximum quantity of a register read request.
+func (mb *client) readLimit() uint16 {
+	return quantityLimit(mb.maxReadQuantity, maxReadRegisters)
+}
+
+// writeLimit returns the maximum quantity of a register write request.
+func (mb *client) writeLimit() uint16 {
+	return quantityLimit(mb.maxWriteQuantity, maxWriteRegisters)
+}
+
+// clientOf returns the client created by NewClient behind c, looking
+// through a ResilientClient, or nil for other Client implementations.
+func clientOf(c Client) *client {
+	switch c := c.(type) {
+	case *client:
+		return c
+	case *ResilientClient:
+		return clientOf(c.client)
+	default:
+		return nil
+	}
+}
+
+// readLimitOf returns the maximum quantity of a register read request sent
+// by c: the one set with WithMaxReadQuantity, or the protocol limit.
+func readLimitOf(c Client) uint16 {
+	if mb := clientOf(c); mb != nil {
+		return mb.readLimit()
+	}
+	return maxReadRegisters
+}
+
+// writeLimitOf returns the maximum quantity of a register write request
+// sent by c: the one set with WithMaxWriteQuantity, or the protocol limit.
+func writeLimitOf(c Client) uint16 {
+	if mb := clientOf(c); mb != nil {
+		return mb.writeLimit()
+	}
+	return maxWriteRegisters
 }
 
 // NewClient creates a new modbus client with given backend handler.
-func NewClient(handler ClientHandler) Client {
-	return &client{packager: handler, transporter: handler}
+func NewClient(handler ClientHandler, opts ...ClientOption) Client {
+	return newClient(handler, handler, opts)
 }
 
 // NewClientWithPackagerTransporter creates a new modbus client with separate packager and transporter.
 // This is useful for advanced use cases where you want to use different implementations
 // for the packager and transporter, such as in testing scenarios.
-func NewClientWithPackagerTransporter(packager Packager, transporter Transporter) Client {
-	return &client{packager: packager, transporter: transporter}
+func NewClientWithPackagerTransporter(packager Packager, transporter Transporter, opts ...ClientOption) Client {
+	return newClient(packager, transporter, opts)
+}
+
+func newClient(packager Packager, transporter Transporter, opts []ClientOption) *client {
+	mb := &client{packager: packager, transporter: transporter}
+	for _, opt := range opts {
+		opt(mb)
+	}
+	return mb
 }
 
 // Request:
@@ -48,11 +179,9 @@ func (mb *client) ReadCoils(ctx context.Context, address, quantity uint16) (resu
 	if quantity < 1 || quantity > 2000 {
 		return nil, fmt.Errorf("%w: quantity '%v' must be between '%v' and '%v'", ErrInvalidQuantity, quantity, 1, 2000)
 	}
-	request := ProtocolDataUnit{
-		FunctionCode: FuncCodeReadCoils,
-		Data:         dataBlock(address, quantity),
-	}
-	response, err := mb.send(ctx, &request)
+	request := mb.newRequest(FuncCodeReadCoils, address, quantity)
+	defer request.release()
+	response, err := mb.send(ctx, &request.pdu)
 	if err != nil {
 		return nil, fmt.Errorf("reading coils: %w", err)
 	}
@@ -61,6 +190,9 @@ func (mb *client) ReadCoils(ctx context.Context, address, quantity uint16) (resu
 	if count != length {
 		return nil, fmt.Errorf("%w: response data size '%v' does not match count '%v'", ErrInvalidResponse, length, count)
 	}
+	if expected := (int(quantity) + 7) / 8; count != expected {
+		return nil, fmt.Errorf("%w: response count '%v' does not match quantity '%v'", ErrInvalidResponse, count, expected)
+	}
 	return response.Data[1:], nil
 }
 
@@ -79,11 +211,9 @@ func (mb *client) ReadDiscreteInputs(ctx context.Context, address, quantity uint
 	if quantity < 1 || quantity > 2000 {
 		return nil, fmt.Errorf("%w: quantity '%v' must be between '%v' and '%v'", ErrInvalidQuantity, quantity, 1, 2000)
 	}
-	request := ProtocolDataUnit{
-		FunctionCode: FuncCodeReadDiscreteInputs,
-		Data:         dataBlock(address, quantity),
-	}
-	response, err := mb.send(ctx, &request)
+	request := mb.newRequest(FuncCodeReadDiscreteInputs, address, quantity)
+	defer request.release()
+	response, err := mb.send(ctx, &request.pdu)
 	if err != nil {
 		return nil, fmt.Errorf("reading discrete inputs: %w", err)
 	}
@@ -92,6 +222,9 @@ func (mb *client) ReadDiscreteInputs(ctx context.Context, address, quantity uint
 	if count != length {
 		return nil, fmt.Errorf("%w: response data size '%v' does not match count '%v'", ErrInvalidResponse, length, count)
 	}
+	if expected := (int(quantity) + 7) / 8; count != expected {
+		return nil, fmt.Errorf("%w: response count '%v' does not match quantity '%v'", ErrInvalidResponse, count, expected)
+	}
 	return response.Data[1:], nil
 }
 
@@ -107,14 +240,12 @@ func (mb *client) ReadDiscreteInputs(ctx context.Context, address, quantity uint
 //	Byte count            : 1 byte
 //	Register value        : Nx2 bytes
 func (mb *client) ReadHoldingRegisters(ctx context.Context, address, quantity uint16) (results []byte, err error) {
-	if quantity < 1 || quantity > 125 {
-		return nil, fmt.Errorf("%w: quantity '%v' must be between '%v' and '%v'", ErrInvalidQuantity, quantity, 1, 125)
-	}
-	request := ProtocolDataUnit{
-		FunctionCode: FuncCodeReadHoldingRegisters,
-		Data:         dataBlock(address, quantity),
+	if limit := mb.readLimit(); quantity < 1 || quantity > limit {
+		return nil, fmt.Errorf("%w: quantity '%v' must be between '%v' and '%v'", ErrInvalidQuantity, quantity, 1, limit)
 	}
-	response, err := mb.send(ctx, &request)
+	request := mb.newRequest(FuncCodeReadHoldingRegisters, address, quantity)
+	defer request.release()
+	response, err := mb.send(ctx, &request.pdu)
 	if err != nil {
 		return nil, fmt.Errorf("reading holding registers: %w", err)
 	}
@@ -123,9 +254,49 @@ func (mb *client) ReadHoldingRegisters(ctx context.Context, address, quantity ui
 	if count != length {
 		return nil, fmt.Errorf("%w: response data size '%v' does not match count '%v'", ErrInvalidResponse, length, count)
 	}
+	if count != 2*int(quantity) {
+		return nil, fmt.Errorf("%w: response count '%v' does not match quantity '%v'", ErrInvalidResponse, count, quantity)
+	}
 	return response.Data[1:], nil
 }
 
+// ReadHoldingRegistersInto reads quantity holding registers like
+// ReadHoldingRegisters but copies the register bytes into dst, returning
+// the number of bytes written. dst must hold at least 2*quantity bytes.
+// The client of NewClient returns a slice of the response frame, so the
+// bytes are copied straight from the response: polling into the same dst
+// allocates nothing beyond the frames of the packager and transporter.
+func ReadHoldingRegistersInto(ctx context.Context, client Client, address, quantity uint16, dst []byte) (n int, err error) {
+	if len(dst) < 2*int(quantity) {
+		return 0, fmt.Errorf("%w: buffer size '%v' is smaller than '%v'", ErrInvalidData, len(dst), 2*int(quantity))
+	}
+	results, err := client.ReadHoldingRegisters(ctx, address, quantity)
+	if err != nil {
+		return 0, err
+	}
+	return copy(dst, results), nil
+}
+
+// ReadHoldingRegistersIntoWords reads quantity holding registers like
+// ReadHoldingRegisters but decodes them into dst, returning the number of
+// registers written. dst must hold at least quantity registers. Like
+// ReadHoldingRegistersInto, the registers are decoded straight from the
+// response frame, so polling into the same dst allocates nothing beyond
+// the frames of the packager and transporter.
+func ReadHoldingRegistersIntoWords(ctx context.Context, client Client, address, quantity uint16, dst []uint16) (n int, err error) {
+	if len(dst) < int(quantity) {
+		return 0, fmt.Errorf("%w: buffer size '%v' is smaller than '%v'", ErrInvalidData, len(dst), quantity)
+	}
+	results, err := client.ReadHoldingRegisters(ctx, address, quantity)
+	if err != nil {
+		return 0, err
+	}
+	for ; n < len(results)/2; n++ {
+		dst[n] = binary.BigEndian.Uint16(results[2*n:])
+	}
+	return n, nil
+}
+
 // Request:
 //
 //	Function code         : 1 byte (0x04)
@@ -138,14 +309,12 @@ func (mb *client) ReadHoldingRegisters(ctx context.Context, address, quantity ui
 //	Byte count            : 1 byte
 //	Input registers       : N bytes
 func (mb *client) ReadInputRegisters(ctx context.Context, address, quantity uint16) (results []byte, err error) {
-	if quantity < 1 || quantity > 125 {
-		return nil, fmt.Errorf("%w: quantity '%v' must be between '%v' and '%v'", ErrInvalidQuantity, quantity, 1, 125)
+	if limit := mb.readLimit(); quantity < 1 || quantity > limit {
+		return nil, fmt.Errorf("%w: quantity '%v' must be between '%v' and '%v'", ErrInvalidQuantity, quantity, 1, limit)
 	}
-	request := ProtocolDataUnit{
-		FunctionCode: FuncCodeReadInputRegisters,
-		Data:         dataBlock(address, quantity),
-	}
-	response, err := mb.send(ctx, &request)
+	request := mb.newRequest(FuncCodeReadInputRegisters, address, quantity)
+	defer request.release()
+	response, err := mb.send(ctx, &request.pdu)
 	if err != nil {
 		return nil, fmt.Errorf("reading input registers: %w", err)
 	}
@@ -154,6 +323,9 @@ func (mb *client) ReadInputRegisters(ctx context.Context, address, quantity uint
 	if count != length {
 		return nil, fmt.Errorf("%w: response data size '%v' does not match count '%v'", ErrInvalidResponse, length, count)
 	}
+	if count != 2*int(quantity) {
+		return nil, fmt.Errorf("%w: response count '%v' does not match quantity '%v'", ErrInvalidResponse, count, quantity)
+	}
 	return response.Data[1:], nil
 }
 
@@ -173,11 +345,9 @@ func (mb *client) WriteSingleCoil(ctx context.Context, address, value uint16) (r
 	if value != 0xFF00 && value != 0x0000 {
 		return nil, fmt.Errorf("%w: state '%v' must be either 0xFF00 (ON) or 0x0000 (OFF)", ErrInvalidData, value)
 	}
-	request := ProtocolDataUnit{
-		FunctionCode: FuncCodeWriteSingleCoil,
-		Data:         dataBlock(address, value),
-	}
-	response, err := mb.send(ctx, &request)
+	request := mb.newRequest(FuncCodeWriteSingleCoil, address, value)
+	defer request.release()
+	response, err := mb.send(ctx, &request.pdu)
 	if err != nil {
 		return nil, fmt.Errorf("writing single coil: %w", err)
 	}
@@ -209,14 +379,23 @@ func (mb *client) WriteSingleCoil(ctx context.Context, address, value uint16) (r
 //	Register address      : 2 bytes
 //	Register value        : 2 bytes
 func (mb *client) WriteSingleRegister(ctx context.Context, address, value uint16) (results []byte, err error) {
-	request := ProtocolDataUnit{
-		FunctionCode: FuncCodeWriteSingleRegister,
-		Data:         dataBlock(address, value),
-	}
-	response, err := mb.send(ctx, &request)
+	request := mb.newRequest(FuncCodeWriteSingleRegister, address, value)
+	defer request.release()
+	relaxed := mb.relaxedChecks()
+	if relaxed&checkWriteEcho != 0 {
+		// The RTU transporter can't size a value only echo from the request
+		ctx = withRelaxedChecks(ctx, relaxed)
+	}
+	response, err := mb.send(ctx, &request.pdu)
 	if err != nil {
 		return nil, fmt.Errorf("writing single register: %w", err)
 	}
+	if relaxed&checkWriteEcho != 0 && len(response.Data) == 2 {
+		if respValue := binary.BigEndian.Uint16(response.Data); value != respValue {
+			return nil, fmt.Errorf("%w: response value '%v' does not match request '%v'", ErrInvalidResponse, respValue, value)
+		}
+		return response.Data, nil
+	}
 	// Fixed response length
 	if len(response.Data) != 4 {
 		return nil, fmt.Errorf("%w: response data size '%v' does not match expected '%v'", ErrInvalidResponse, len(response.Data), 4)
@@ -250,11 +429,9 @@ func (mb *client) WriteMultipleCoils(ctx context.Context, address, quantity uint
 	if quantity < 1 || quantity > 1968 {
 		return nil, fmt.Errorf("%w: quantity '%v' must be between '%v' and '%v'", ErrInvalidQuantity, quantity, 1, 1968)
 	}
-	request := ProtocolDataUnit{
-		FunctionCode: FuncCodeWriteMultipleCoils,
-		Data:         dataBlockSuffix(value, address, quantity),
-	}
-	response, err := mb.send(ctx, &request)
+	request := mb.newSuffixRequest(FuncCodeWriteMultipleCoils, value, address, quantity)
+	defer request.release()
+	response, err := mb.send(ctx, &request.pdu)
 	if err != nil {
 		return nil, fmt.Errorf("writing multiple coils: %w", err)
 	}
@@ -288,14 +465,12 @@ func (mb *client) WriteMultipleCoils(ctx context.Context, address, quantity uint
 //	Starting address      : 2 bytes
 //	Quantity of registers : 2 bytes
 func (mb *client) WriteMultipleRegisters(ctx context.Context, address, quantity uint16, value []byte) (results []byte, err error) {
-	if quantity < 1 || quantity > 123 {
-		return nil, fmt.Errorf("%w: quantity '%v' must be between '%v' and '%v'", ErrInvalidQuantity, quantity, 1, 123)
-	}
-	request := ProtocolDataUnit{
-		FunctionCode: FuncCodeWriteMultipleRegisters,
-		Data:         dataBlockSuffix(value, address, quantity),
+	if limit := mb.writeLimit(); quantity < 1 || quantity > limit {
+		return nil, fmt.Errorf("%w: quantity '%v' must be between '%v' and '%v'", ErrInvalidQuantity, quantity, 1, limit)
 	}
-	response, err := mb.send(ctx, &request)
+	request := mb.newSuffixRequest(FuncCodeWriteMultipleRegisters, value, address, quantity)
+	defer request.release()
+	response, err := mb.send(ctx, &request.pdu)
 	if err != nil {
 		return nil, fmt.Errorf("writing multiple registers: %w", err)
 	}
@@ -329,11 +504,9 @@ func (mb *client) WriteMultipleRegisters(ctx context.Context, address, quantity
 //	AND-mask              : 2 bytes
 //	OR-mask               : 2 bytes
 func (mb *client) MaskWriteRegister(ctx context.Context, address, andMask, orMask uint16) (results []byte, err error) {
-	request := ProtocolDataUnit{
-		FunctionCode: FuncCodeMaskWriteRegister,
-		Data:         dataBlock(address, andMask, orMask),
-	}
-	response, err := mb.send(ctx, &request)
+	request := mb.newRequest(FuncCodeMaskWriteRegister, address, andMask, orMask)
+	defer request.release()
+	response, err := mb.send(ctx, &request.pdu)
 	if err != nil {
 		return nil, fmt.Errorf("mask writing register: %w", err)
 	}
@@ -372,24 +545,29 @@ func (mb *client) MaskWriteRegister(ctx context.Context, address, andMask, orMas
 //	Byte count            : 1 byte
 //	Read registers value  : Nx2 bytes
 func (mb *client) ReadWriteMultipleRegisters(ctx context.Context, readAddress, readQuantity, writeAddress, writeQuantity uint16, value []byte) (results []byte, err error) {
-	if readQuantity < 1 || readQuantity > 125 {
-		return nil, fmt.Errorf("%w: read quantity '%v' must be between '%v' and '%v'", ErrInvalidQuantity, readQuantity, 1, 125)
+	if limit := mb.readLimit(); readQuantity < 1 || readQuantity > limit {
+		return nil, fmt.Errorf("%w: read quantity '%v' must be between '%v' and '%v'", ErrInvalidQuantity, readQuantity, 1, limit)
 	}
-	if writeQuantity < 1 || writeQuantity > 121 {
-		return nil, fmt.Errorf("%w: write quantity '%v' must be between '%v' and '%v'", ErrInvalidQuantity, writeQuantity, 1, 121)
+	if limit := quantityLimit(mb.maxWriteQuantity, 121); writeQuantity < 1 || writeQuantity > limit {
+		return nil, fmt.Errorf("%w: write quantity '%v' must be between '%v' and '%v'", ErrInvalidQuantity, writeQuantity, 1, limit)
 	}
-	request := ProtocolDataUnit{
-		FunctionCode: FuncCodeReadWriteMultipleRegisters,
-		Data:         dataBlockSuffix(value, readAddress, readQuantity, writeAddress, writeQuantity),
-	}
-	response, err := mb.send(ctx, &request)
+	request := mb.newSuffixRequest(FuncCodeReadWriteMultipleRegisters, value, readAddress, readQuantity, writeAddress, writeQuantity)
+	defer request.release()
+	response, err := mb.send(ctx, &request.pdu)
 	if err != nil {
 		return nil, fmt.Errorf("reading/writing multiple registers: %w", err)
 	}
 	count := int(response.Data[0])
+	// readQuantity is at least 1, an empty read is a device error
+	if count == 0 {
+		return nil, fmt.Errorf("%w: response byte count is zero for read quantity '%v'", ErrInvalidResponse, readQuantity)
+	}
 	if count != (len(response.Data) - 1) {
 		return nil, fmt.Errorf("%w: response data size '%v' does not match count '%v'", ErrInvalidResponse, len(response.Data)-1, count)
 	}
+	if count != 2*int(readQuantity) {
+		return nil, fmt.Errorf("%w: response count '%v' does not match read quantity '%v'", ErrInvalidResponse, count, readQuantity)
+	}
 	return response.Data[1:], nil
 }
 
@@ -406,11 +584,9 @@ func (mb *client) ReadWriteMultipleRegisters(ctx context.Context, readAddress, r
 //	FIFO count            : 2 bytes (<=31)
 //	FIFO value register   : Nx2 bytes
 func (mb *client) ReadFIFOQueue(ctx context.Context, address uint16) (results []byte, err error) {
-	request := ProtocolDataUnit{
-		FunctionCode: FuncCodeReadFIFOQueue,
-		Data:         dataBlock(address),
-	}
-	response, err := mb.send(ctx, &request)
+	request := mb.newRequest(FuncCodeReadFIFOQueue, address)
+	defer request.release()
+	response, err := mb.send(ctx, &request.pdu)
 	if err != nil {
 		return nil, fmt.Errorf("reading FIFO queue: %w", err)
 	}
@@ -432,6 +608,19 @@ func (mb *client) ReadFIFOQueue(ctx context.Context, address uint16) (results []
 
 // send sends request and checks possible exception in the response.
 func (mb *client) send(ctx context.Context, request *ProtocolDataUnit) (response *ProtocolDataUnit, err error) {
+	for attempt := 0; ; attempt++ {
+		response, err = mb.sendOnce(ctx, request)
+		if attempt >= mb.busyRetries || !isBusyError(err) {
+			return response, err
+		}
+		if waitErr := sleepContext(ctx, mb.busyRetryDelay); waitErr != nil {
+			return nil, fmt.Errorf("waiting to retry busy request: %w", waitErr)
+		}
+	}
+}
+
+// sendOnce sends a request and returns its decoded and checked response.
+func (mb *client) sendOnce(ctx context.Context, request *ProtocolDataUnit) (response *ProtocolDataUnit, err error) {
 	aduRequest, err := mb.packager.Encode(request)
 	if err != nil {
 		return nil, fmt.Errorf("encoding PDU: %w", err)
@@ -440,6 +629,12 @@ func (mb *client) send(ctx context.Context, request *ProtocolDataUnit) (response
 	if err != nil {
 		return nil, fmt.Errorf("sending request: %w", err)
 	}
+	return mb.decodeResponse(request, aduRequest, aduResponse)
+}
+
+// decodeResponse verifies and decodes the response to a request and checks
+// it is not an exception.
+func (mb *client) decodeResponse(request *ProtocolDataUnit, aduRequest, aduResponse []byte) (response *ProtocolDataUnit, err error) {
 	if err = mb.packager.Verify(aduRequest, aduResponse); err != nil {
 		return nil, fmt.Errorf("verifying response: %w", err)
 	}
@@ -479,6 +674,62 @@ func dataBlockSuffix(suffix []byte, value ...uint16) []byte {
 	return data
 }
 
+// requestPool holds request PDUs with their data buffers, reused between
+// requests so that polling loops don't allocate them for every request.
+var requestPool = sync.Pool{
+	New: func() any { return new(pooledRequest) },
+}
+
+// pduCopier is implemented by the built-in packagers, whose Encode copies
+// the PDU data into the ADU. Requests are only taken from requestPool for
+// them: other packagers may retain the data of the PDUs they encode.
+type pduCopier interface {
+	copiesPDUData()
+}
+
+// pooledRequest is a request PDU, from requestPool if pooled. The data of
+// a pooled request is only valid until release.
+type pooledRequest struct {
+	pdu    ProtocolDataUnit
+	data   []byte
+	pooled bool
+}
+
+// newRequest is dataBlock in a PDU, from the pool if the packager copies
+// the data it encodes.
+func (mb *client) newRequest(functionCode byte, value ...uint16) *pooledRequest {
+	var r *pooledRequest
+	if _, ok := mb.packager.(pduCopier); ok {
+		r = requestPool.Get().(*pooledRequest)
+		r.data, r.pooled = r.data[:0], true
+	} else {
+		r = &pooledRequest{}
+	}
+	for _, v := range value {
+		r.data = binary.BigEndian.AppendUint16(r.data, v)
+	}
+	r.pdu = ProtocolDataUnit{FunctionCode: functionCode, Data: r.data}
+	return r
+}
+
+// newSuffixRequest is dataBlockSuffix in a PDU like newRequest.
+func (mb *client) newSuffixRequest(functionCode byte, suffix []byte, value ...uint16) *pooledRequest {
+	r := mb.newRequest(functionCode, value...)
+	r.data = append(r.data, uint8(len(suffix)))
+	r.data = append(r.data, suffix...)
+	r.pdu.Data = r.data
+	return r
+}
+
+// release returns a pooled request to the pool.
+func (r *pooledRequest) release() {
+	if !r.pooled {
+		return
+	}
+	r.pdu = ProtocolDataUnit{}
+	requestPool.Put(r)
+}
+
 func responseError(response *ProtocolDataUnit) error {
 	mbError := &ModbusError{FunctionCode: response.FunctionCode}
 	if len(response.Data) > 0 {
@@ -38,6 +38,18 @@ func TestReadCoilsInvalidResponse(t *testing.T) {
 			wantErr:  true,
 			errMsg:   "response data is empty",
 		},
+		{
+			name:     "one byte more than quantity",
+			response: []byte{0x01, 0x03, 0xCD, 0x6B, 0x00}, // 10 coils need 2 bytes
+			wantErr:  true,
+			errMsg:   "does not match quantity",
+		},
+		{
+			name:     "one byte less than quantity",
+			response: []byte{0x01, 0x01, 0xCD},
+			wantErr:  true,
+			errMsg:   "does not match quantity",
+		},
 	}
 
 	for _, tt := range tests {
@@ -67,6 +79,53 @@ func TestReadCoilsInvalidResponse(t *testing.T) {
 	}
 }
 
+// TestReadDiscreteInputsQuantityMismatch tests that the byte count must
+// match the requested quantity
+func TestReadDiscreteInputsQuantityMismatch(t *testing.T) {
+	for _, response := range [][]byte{
+		{0x02, 0x02, 0xAC, 0xDB}, // 20 inputs need 3 bytes
+		{0x02, 0x04, 0xAC, 0xDB, 0x35, 0x00},
+	} {
+		mockT := &mockTransporter{
+			sendFunc: func(_ context.Context, _ []byte) ([]byte, error) {
+				return response, nil
+			},
+		}
+		client := NewClientWithPackagerTransporter(&mockPackager{}, mockT)
+
+		_, err := client.ReadDiscreteInputs(context.Background(), 0, 20)
+		if !errors.Is(err, ErrInvalidResponse) {
+			t.Errorf("response % x: expected ErrInvalidResponse, got %v", response, err)
+		}
+	}
+}
+
+// TestReadRegistersQuantityMismatch tests that the byte count must match
+// twice the requested quantity of registers
+func TestReadRegistersQuantityMismatch(t *testing.T) {
+	for _, response := range [][]byte{
+		{0x00, 0x04, 0x00, 0x01, 0x00, 0x02}, // 3 registers need 6 bytes
+		{0x00, 0x08, 0x00, 0x01, 0x00, 0x02, 0x00, 0x03, 0x00, 0x04},
+	} {
+		mockT := &mockTransporter{
+			sendFunc: func(_ context.Context, req []byte) ([]byte, error) {
+				return append([]byte{req[0]}, response[1:]...), nil
+			},
+		}
+		client := NewClientWithPackagerTransporter(&mockPackager{}, mockT)
+
+		if _, err := client.ReadHoldingRegisters(context.Background(), 0, 3); !errors.Is(err, ErrInvalidResponse) {
+			t.Errorf("holding registers, response % x: expected ErrInvalidResponse, got %v", response[1:], err)
+		}
+		if _, err := client.ReadInputRegisters(context.Background(), 0, 3); !errors.Is(err, ErrInvalidResponse) {
+			t.Errorf("input registers, response % x: expected ErrInvalidResponse, got %v", response[1:], err)
+		}
+		if _, err := client.ReadWriteMultipleRegisters(context.Background(), 0, 3, 10, 1, []byte{0x00, 0x01}); !errors.Is(err, ErrInvalidResponse) {
+			t.Errorf("read/write registers, response % x: expected ErrInvalidResponse, got %v", response[1:], err)
+		}
+	}
+}
+
 // TestWriteSingleCoilInvalidResponse tests response validation errors
 func TestWriteSingleCoilInvalidResponse(t *testing.T) {
 	tests := []struct {
@@ -5,8 +5,10 @@
 package modbus
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
+	"errors"
 	"testing"
 )
 
@@ -283,6 +285,55 @@ func TestReadHoldingRegisters(t *testing.T) {
 	}
 }
 
+// TestReadHoldingRegistersInto tests reading registers into a caller buffer
+func TestReadHoldingRegistersInto(t *testing.T) {
+	mockT := &mockTransporter{
+		sendFunc: func(_ context.Context, _ []byte) ([]byte, error) {
+			return []byte{0x03, 0x04, 0x12, 0x34, 0x56, 0x78}, nil
+		},
+	}
+	client := NewClientWithPackagerTransporter(&mockPackager{}, mockT)
+
+	dst := make([]byte, 8)
+	n, err := ReadHoldingRegistersInto(context.Background(), client, 0, 2, dst)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 4 || !bytes.Equal(dst[:n], []byte{0x12, 0x34, 0x56, 0x78}) {
+		t.Errorf("unexpected result: n=%d dst=% x", n, dst)
+	}
+
+	_, err = ReadHoldingRegistersInto(context.Background(), client, 0, 2, make([]byte, 3))
+	if !errors.Is(err, ErrInvalidData) {
+		t.Errorf("expected ErrInvalidData for short buffer, got %v", err)
+	}
+}
+
+// TestReadHoldingRegistersIntoWords tests reading registers into a caller
+// word slice
+func TestReadHoldingRegistersIntoWords(t *testing.T) {
+	mockT := &mockTransporter{
+		sendFunc: func(_ context.Context, _ []byte) ([]byte, error) {
+			return []byte{0x03, 0x04, 0x12, 0x34, 0x56, 0x78}, nil
+		},
+	}
+	client := NewClientWithPackagerTransporter(&mockPackager{}, mockT)
+
+	dst := []uint16{0xAAAA, 0xAAAA, 0xAAAA}
+	n, err := ReadHoldingRegistersIntoWords(context.Background(), client, 0, 2, dst)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 2 || dst[0] != 0x1234 || dst[1] != 0x5678 || dst[2] != 0xAAAA {
+		t.Errorf("unexpected result: n=%d dst=%04x", n, dst)
+	}
+
+	_, err = ReadHoldingRegistersIntoWords(context.Background(), client, 0, 2, make([]uint16, 1))
+	if !errors.Is(err, ErrInvalidData) {
+		t.Errorf("expected ErrInvalidData for short buffer, got %v", err)
+	}
+}
+
 // TestReadInputRegisters tests the ReadInputRegisters function
 func TestReadInputRegisters(t *testing.T) {
 	tests := []struct {
@@ -457,6 +508,48 @@ func TestWriteSingleRegister(t *testing.T) {
 	}
 }
 
+// TestWriteSingleRegisterLenientEcho tests WriteSingleRegister against a
+// device echoing only the value
+func TestWriteSingleRegisterLenientEcho(t *testing.T) {
+	tests := []struct {
+		name     string
+		lenient  bool
+		response []byte
+		wantErr  bool
+	}{
+		{"strict value only", false, []byte{0x06, 0x12, 0x34}, true},
+		{"lenient value only", true, []byte{0x06, 0x12, 0x34}, false},
+		{"lenient wrong value", true, []byte{0x06, 0x12, 0x35}, true},
+		{"lenient full echo", true, []byte{0x06, 0x00, 0x64, 0x12, 0x34}, false},
+		{"lenient wrong address", true, []byte{0x06, 0x00, 0x65, 0x12, 0x34}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockT := &mockTransporter{
+				sendFunc: func(_ context.Context, _ []byte) ([]byte, error) {
+					return tt.response, nil
+				},
+			}
+			client := NewClientWithPackagerTransporter(&mockPackager{}, mockT, WithLenientWriteEcho(tt.lenient))
+
+			result, err := client.WriteSingleRegister(context.Background(), 100, 0x1234)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidResponse) {
+					t.Errorf("expected ErrInvalidResponse, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !bytes.Equal(result, []byte{0x12, 0x34}) {
+				t.Errorf("result = % x, want 12 34", result)
+			}
+		})
+	}
+}
+
 // TestWriteMultipleCoils tests the WriteMultipleCoils function
 func TestWriteMultipleCoils(t *testing.T) {
 	tests := []struct {
@@ -735,6 +828,20 @@ func TestReadWriteMultipleRegisters(t *testing.T) {
 	}
 }
 
+func TestReadWriteMultipleRegistersZeroByteCount(t *testing.T) {
+	mockT := &mockTransporter{
+		sendFunc: func(_ context.Context, _ []byte) ([]byte, error) {
+			return []byte{FuncCodeReadWriteMultipleRegisters, 0}, nil
+		},
+	}
+	client := NewClientWithPackagerTransporter(&mockPackager{}, mockT)
+
+	results, err := client.ReadWriteMultipleRegisters(context.Background(), 0, 1, 100, 1, []byte{0x00, 0x0A})
+	if !errors.Is(err, ErrInvalidResponse) {
+		t.Fatalf("expected ErrInvalidResponse, got %v (results % x)", err, results)
+	}
+}
+
 // TestReadFIFOQueue tests the ReadFIFOQueue function
 func TestReadFIFOQueue(t *testing.T) {
 	tests := []struct {
@@ -903,3 +1010,122 @@ func TestDataBlockSuffix(t *testing.T) {
 		})
 	}
 }
+
+func TestPooledRequestNotRetained(t *testing.T) {
+	var sent [][]byte
+	client := NewClientWithPackagerTransporter(&mockPackager{}, &mockTransporter{
+		sendFunc: func(_ context.Context, aduRequest []byte) ([]byte, error) {
+			sent = append(sent, aduRequest)
+			return []byte{aduRequest[0], 2, 0x00, 0x2A}, nil
+		},
+	})
+	first, err := client.ReadHoldingRegisters(context.Background(), 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.WriteMultipleRegisters(context.Background(), 0xFFFF, 1, []byte{0xFF, 0xFF}); err == nil {
+		t.Fatal("expected the write to fail on the canned response")
+	}
+	if expected := []byte{FuncCodeReadHoldingRegisters, 0, 1, 0, 1}; !bytes.Equal(sent[0], expected) {
+		t.Errorf("first request changed by a later one: expected % x, actual % x", expected, sent[0])
+	}
+	if !bytes.Equal(first, []byte{0x00, 0x2A}) {
+		t.Errorf("first results changed by a later request: % x", first)
+	}
+}
+
+func TestRequestNotPooledForCustomPackager(t *testing.T) {
+	// A packager keeping the PDU data, which the Packager interface allows
+	var retained [][]byte
+	packager := &mockPackager{
+		encodeFunc: func(pdu *ProtocolDataUnit) ([]byte, error) {
+			retained = append(retained, pdu.Data)
+			return append([]byte{pdu.FunctionCode}, pdu.Data...), nil
+		},
+	}
+	client := NewClientWithPackagerTransporter(packager, &mockTransporter{
+		sendFunc: func(_ context.Context, aduRequest []byte) ([]byte, error) {
+			return []byte{aduRequest[0], 2, 0x00, 0x2A}, nil
+		},
+	})
+	if _, err := client.ReadHoldingRegisters(context.Background(), 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ReadInputRegisters(context.Background(), 0x1234, 1); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []byte{0, 1, 0, 1}; !bytes.Equal(retained[0], expected) {
+		t.Errorf("retained data changed by a later request: expected % x, actual % x", expected, retained[0])
+	}
+}
+
+// newTCPRegisterClient returns a client of a TCP device answering every
+// request with the request's header and two registers, from one buffer.
+func newTCPRegisterClient() Client {
+	response := []byte{0, 0, 0, 0, 0, 7, 1, FuncCodeReadHoldingRegisters, 4, 0x00, 0x2A, 0x01, 0x00}
+	return NewClientWithPackagerTransporter(&tcpPackager{SlaveID: 1}, &mockTransporter{
+		sendFunc: func(_ context.Context, aduRequest []byte) ([]byte, error) {
+			copy(response, aduRequest[:2])
+			return response, nil
+		},
+	})
+}
+
+func TestReadHoldingRegistersIntoAllocs(t *testing.T) {
+	client := newTCPRegisterClient()
+	ctx := context.Background()
+	dst := make([]byte, 4)
+
+	// Only the frames of the packager are allocated, as by
+	// ReadHoldingRegisters: none for the results
+	frames := testing.AllocsPerRun(100, func() {
+		if _, err := client.ReadHoldingRegisters(ctx, 100, 2); err != nil {
+			t.Fatal(err)
+		}
+	})
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := ReadHoldingRegistersInto(ctx, client, 100, 2, dst); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs > frames {
+		t.Errorf("expected at most %v allocations, got %v", frames, allocs)
+	}
+	if !bytes.Equal(dst, []byte{0x00, 0x2A, 0x01, 0x00}) {
+		t.Errorf("unexpected result % x", dst)
+	}
+}
+
+func TestReadHoldingRegistersIntoWordsAllocs(t *testing.T) {
+	client := newTCPRegisterClient()
+	ctx := context.Background()
+	dst := make([]uint16, 2)
+
+	frames := testing.AllocsPerRun(100, func() {
+		if _, err := client.ReadHoldingRegisters(ctx, 100, 2); err != nil {
+			t.Fatal(err)
+		}
+	})
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := ReadHoldingRegistersIntoWords(ctx, client, 100, 2, dst); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs > frames {
+		t.Errorf("expected at most %v allocations, got %v", frames, allocs)
+	}
+	if dst[0] != 0x002A || dst[1] != 0x0100 {
+		t.Errorf("unexpected result %04x", dst)
+	}
+}
+
+func BenchmarkReadHoldingRegisters(b *testing.B) {
+	client := newTCPRegisterClient()
+	ctx := context.Background()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := client.ReadHoldingRegisters(ctx, 100, 2); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"context"
+	"time"
+)
+
+// Clock is the source of time for frame delays, the serial reconnect
+// backoff and simulated response delays, so that tests can replace the
+// real clock with a fake one.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is the Clock of the time package.
+type SystemClock struct{}
+
+// Now returns time.Now.
+func (SystemClock) Now() time.Time { return time.Now() }
+
+// Sleep calls time.Sleep.
+func (SystemClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// After returns time.After.
+func (SystemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// sleepClock waits for d on clock like sleepContext, returning the error
+// of ctx if it is done first.
+func sleepClock(ctx context.Context, clock Clock, d time.Duration) error {
+	select {
+	case <-clock.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -3,10 +3,14 @@ package main
 import (
 	"context"
 	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -21,16 +25,18 @@ func main() {
 		Usage: "Command-line tool for Modbus communication",
 		Flags: []cli.Flag{
 			&cli.StringFlag{
-				Name:     "protocol",
-				Aliases:  []string{"p"},
-				Usage:    "Protocol type: tcp, rtu, or ascii",
-				Required: true,
+				Name:  "config",
+				Usage: "JSON file with connection defaults; command-line flags override its values",
 			},
 			&cli.StringFlag{
-				Name:     "address",
-				Aliases:  []string{"a"},
-				Usage:    "Connection address (TCP: host:port, RTU/ASCII: /dev/ttyUSB0)",
-				Required: true,
+				Name:    "protocol",
+				Aliases: []string{"p"},
+				Usage:   "Protocol type: tcp, rtu, or ascii (required)",
+			},
+			&cli.StringFlag{
+				Name:    "address",
+				Aliases: []string{"a"},
+				Usage:   "Connection address (TCP: host[:port], RTU/ASCII: /dev/ttyUSB0) (required)",
 			},
 			&cli.IntFlag{
 				Name:    "slave-id",
@@ -44,6 +50,11 @@ func main() {
 				Usage:   "Timeout duration",
 				Value:   5 * time.Second,
 			},
+			&cli.DurationFlag{
+				Name:  "idle-timeout",
+				Usage: "Close the connection after this much inactivity (0 disables)",
+				Value: 60 * time.Second,
+			},
 			// Serial-specific options
 			&cli.IntFlag{
 				Name:  "baud",
@@ -62,10 +73,19 @@ func main() {
 			},
 			&cli.StringFlag{
 				Name:  "parity",
-				Usage: "Parity: none, odd, even (RTU/ASCII only)",
+				Usage: "Parity: none, even, odd, mark or space, or N, E, O, M or S (RTU/ASCII only)",
 				Value: "none",
 			},
+			&cli.BoolFlag{
+				Name:  "dtr",
+				Usage: "Set the DTR line after connecting, --dtr=false clears it (RTU/ASCII only)",
+			},
+			&cli.BoolFlag{
+				Name:  "rts",
+				Usage: "Set the RTS line after connecting, --rts=false clears it (RTU/ASCII only)",
+			},
 		},
+		Before: loadConnectionConfig,
 		Commands: []*cli.Command{
 			{
 				Name:  "read-coils",
@@ -155,6 +175,38 @@ func main() {
 				},
 				Action: readInputRegistersAction,
 			},
+			{
+				Name:  "read-write-registers",
+				Usage: "Write and read holding registers in one transaction (function code 23)",
+				Flags: []cli.Flag{
+					&cli.UintFlag{
+						Name:     "read-start",
+						Usage:    "Starting address to read",
+						Required: true,
+					},
+					&cli.UintFlag{
+						Name:     "read-count",
+						Usage:    "Number of registers to read (1-125)",
+						Required: true,
+					},
+					&cli.UintFlag{
+						Name:     "write-start",
+						Usage:    "Starting address to write",
+						Required: true,
+					},
+					&cli.UintSliceFlag{
+						Name:     "write-value",
+						Usage:    "Register value to write, repeat for consecutive registers (1-121 values)",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "Output format: hex, decimal",
+						Value: "hex",
+					},
+				},
+				Action: readWriteRegistersAction,
+			},
 			{
 				Name:  "read-fifo",
 				Usage: "Read FIFO queue (function code 24)",
@@ -176,21 +228,87 @@ func main() {
 	}
 
 	if err := app.Run(os.Args); err != nil {
+		var mbErr *modbus.ModbusError
+		if errors.As(err, &mbErr) {
+			log.Fatalf("%v [%s]", err, modbus.FunctionCodeName(mbErr.FunctionCode))
+		}
 		log.Fatal(err)
 	}
 }
 
+// connectionConfig holds the connection defaults of a --config file.
+type connectionConfig struct {
+	Protocol    string `json:"protocol"`
+	Address     string `json:"address"`
+	SlaveID     *int   `json:"slaveId"`
+	Timeout     string `json:"timeout"`
+	IdleTimeout string `json:"idleTimeout"`
+	Baud        *int   `json:"baud"`
+	DataBits    *int   `json:"dataBits"`
+	StopBits    *int   `json:"stopBits"`
+	Parity      string `json:"parity"`
+}
+
+// loadConnectionConfig applies the values of the --config file to the
+// global flags that were not given on the command line.
+func loadConnectionConfig(c *cli.Context) error {
+	path := c.String("config")
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	var config connectionConfig
+	if err = json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	values := map[string]string{
+		"protocol":     config.Protocol,
+		"address":      config.Address,
+		"timeout":      config.Timeout,
+		"idle-timeout": config.IdleTimeout,
+		"parity":       config.Parity,
+	}
+	for name, value := range map[string]*int{
+		"slave-id":  config.SlaveID,
+		"baud":      config.Baud,
+		"data-bits": config.DataBits,
+		"stop-bits": config.StopBits,
+	} {
+		if value != nil {
+			values[name] = strconv.Itoa(*value)
+		}
+	}
+	for name, value := range values {
+		if value == "" || c.IsSet(name) {
+			continue
+		}
+		if err = c.Set(name, value); err != nil {
+			return fmt.Errorf("invalid %s in config file %s: %w", name, path, err)
+		}
+	}
+	return nil
+}
+
 // createClient creates a Modbus client based on the global flags
 func createClient(c *cli.Context) (modbus.Client, error) {
 	protocol := c.String("protocol")
 	address := c.String("address")
+	if protocol == "" || address == "" {
+		return nil, fmt.Errorf("protocol and address must be set with flags or a config file")
+	}
 	slaveID := byte(c.Int("slave-id"))
 	timeout := c.Duration("timeout")
+	idleTimeout := c.Duration("idle-timeout")
 
 	switch protocol {
 	case "tcp":
 		handler := modbus.NewTCPClientHandler(address)
 		handler.Timeout = timeout
+		handler.IdleTimeout = idleTimeout
 		handler.SlaveID = slaveID
 		return modbus.NewClient(handler), nil
 
@@ -199,9 +317,17 @@ func createClient(c *cli.Context) (modbus.Client, error) {
 		handler.BaudRate = c.Int("baud")
 		handler.DataBits = c.Int("data-bits")
 		handler.StopBits = parseStopBits(c.Int("stop-bits"))
-		handler.Parity = parseParity(c.String("parity"))
+		parity, err := parseParity(c.String("parity"))
+		if err != nil {
+			return nil, err
+		}
+		handler.Parity = parity
 		handler.Timeout = timeout
+		handler.IdleTimeout = idleTimeout
 		handler.SlaveID = slaveID
+		if err := setControlLines(c, handler); err != nil {
+			return nil, err
+		}
 		return modbus.NewClient(handler), nil
 
 	case "ascii":
@@ -209,9 +335,17 @@ func createClient(c *cli.Context) (modbus.Client, error) {
 		handler.BaudRate = c.Int("baud")
 		handler.DataBits = c.Int("data-bits")
 		handler.StopBits = parseStopBits(c.Int("stop-bits"))
-		handler.Parity = parseParity(c.String("parity"))
+		parity, err := parseParity(c.String("parity"))
+		if err != nil {
+			return nil, err
+		}
+		handler.Parity = parity
 		handler.Timeout = timeout
+		handler.IdleTimeout = idleTimeout
 		handler.SlaveID = slaveID
+		if err := setControlLines(c, handler); err != nil {
+			return nil, err
+		}
 		return modbus.NewClient(handler), nil
 
 	default:
@@ -219,6 +353,28 @@ func createClient(c *cli.Context) (modbus.Client, error) {
 	}
 }
 
+// controlLiner is implemented by the serial handlers.
+type controlLiner interface {
+	SetDTR(dtr bool) error
+	SetRTS(rts bool) error
+}
+
+// setControlLines applies the --dtr and --rts flags, if given. The handler
+// sets the lines when it connects.
+func setControlLines(c *cli.Context, handler controlLiner) error {
+	if c.IsSet("dtr") {
+		if err := handler.SetDTR(c.Bool("dtr")); err != nil {
+			return err
+		}
+	}
+	if c.IsSet("rts") {
+		if err := handler.SetRTS(c.Bool("rts")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func parseStopBits(bits int) modbus.StopBits {
 	switch bits {
 	case 1:
@@ -230,16 +386,20 @@ func parseStopBits(bits int) modbus.StopBits {
 	}
 }
 
-func parseParity(parity string) modbus.Parity {
-	switch parity {
-	case "none":
-		return modbus.NoParity
-	case "odd":
-		return modbus.OddParity
-	case "even":
-		return modbus.EvenParity
+func parseParity(parity string) (modbus.Parity, error) {
+	switch strings.ToLower(parity) {
+	case "none", "n":
+		return modbus.NoParity, nil
+	case "even", "e":
+		return modbus.EvenParity, nil
+	case "odd", "o":
+		return modbus.OddParity, nil
+	case "mark", "m":
+		return modbus.MarkParity, nil
+	case "space", "s":
+		return modbus.SpaceParity, nil
 	default:
-		return modbus.EvenParity
+		return "", fmt.Errorf("unsupported parity: %s (must be none, even, odd, mark or space)", parity)
 	}
 }
 
@@ -368,6 +528,46 @@ func readInputRegistersAction(c *cli.Context) error {
 	return nil
 }
 
+// readWriteRegistersAction handles the read-write-registers command
+func readWriteRegistersAction(c *cli.Context) error {
+	client, err := createClient(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := createContextWithSignalHandler()
+	defer cancel()
+
+	readStart := uint16(c.Uint("read-start"))
+	readCount := uint16(c.Uint("read-count"))
+	writeStart := uint16(c.Uint("write-start"))
+	format := c.String("format")
+
+	if readCount < 1 || readCount > 125 {
+		return fmt.Errorf("read-count must be between 1 and 125")
+	}
+
+	writeValues := c.UintSlice("write-value")
+	if len(writeValues) < 1 || len(writeValues) > 121 {
+		return fmt.Errorf("between 1 and 121 write values are required")
+	}
+	values := make([]uint16, len(writeValues))
+	for i, v := range writeValues {
+		if v > 0xFFFF {
+			return fmt.Errorf("write value %d does not fit in a register", v)
+		}
+		values[i] = uint16(v)
+	}
+
+	results, err := modbus.ReadWriteMultipleRegistersTyped(ctx, client, readStart, readCount, writeStart, values)
+	if err != nil {
+		return fmt.Errorf("failed to read/write registers: %w", err)
+	}
+
+	printRegisterValues(readStart, results, format)
+	return nil
+}
+
 // readFIFOAction handles the read-fifo command
 func readFIFOAction(c *cli.Context) error {
 	client, err := createClient(c)
@@ -424,19 +624,26 @@ func printBitResults(start, count uint16, data []byte, format string) {
 
 // printRegisterResults prints register values
 func printRegisterResults(start, count uint16, data []byte, format string) {
+	values := make([]uint16, 0, count)
 	for i := uint16(0); i < count; i++ {
 		offset := i * 2
 		if int(offset+1) >= len(data) {
 			break
 		}
+		values = append(values, binary.BigEndian.Uint16(data[offset:offset+2]))
+	}
+	printRegisterValues(start, values, format)
+}
 
-		value := binary.BigEndian.Uint16(data[offset : offset+2])
-
+// printRegisterValues prints decoded register values
+func printRegisterValues(start uint16, values []uint16, format string) {
+	for i, value := range values {
+		address := start + uint16(i)
 		switch format {
 		case "decimal":
-			fmt.Printf("0x%04X: %d\n", start+i, value)
+			fmt.Printf("0x%04X: %d\n", address, value)
 		default: // hex
-			fmt.Printf("0x%04X: 0x%04X\n", start+i, value)
+			fmt.Printf("0x%04X: 0x%04X\n", address, value)
 		}
 	}
 }
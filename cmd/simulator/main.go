@@ -7,6 +7,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/urfave/cli/v2"
 
+	"github.com/lumberbarons/modbus"
 	"github.com/lumberbarons/modbus/internal/simulator"
 )
 
@@ -25,7 +27,7 @@ func main() {
 			&cli.StringFlag{
 				Name:    "mode",
 				Aliases: []string{"m"},
-				Usage:   "Modbus mode: tcp, rtu, or ascii",
+				Usage:   "Modbus mode: tcp, rtu, ascii, or gateway (TCP to RTU bridge)",
 				Value:   "tcp",
 			},
 			&cli.StringFlag{
@@ -50,6 +52,27 @@ func main() {
 				Aliases: []string{"c"},
 				Usage:   "JSON config file for initial data values",
 			},
+			&cli.StringFlag{
+				Name:  "serial",
+				Usage: "RTU serial device to forward to (gateway mode only)",
+			},
+			&cli.StringFlag{
+				Name:  "request-log",
+				Usage: "File to append one JSON line per handled request",
+			},
+			&cli.BoolFlag{
+				Name:  "respond-broadcast-reads",
+				Usage: "Answer read requests sent to unit 0 like nonconforming gateways",
+			},
+			&cli.BoolFlag{
+				Name:    "verbose",
+				Aliases: []string{"v"},
+				Usage:   "Log a decoded summary of every request and response",
+			},
+			&cli.Float64Flag{
+				Name:  "corruption-probability",
+				Usage: "Probability (0-1) of altering a byte of each response, to test client checksum handling",
+			},
 		},
 		Action: runSimulator,
 	}
@@ -65,6 +88,18 @@ func runSimulator(c *cli.Context) error {
 	baudRate := c.Int("baud")
 	tcpAddress := c.String("addr")
 	configFile := c.String("config")
+	requestLogFile := c.String("request-log")
+	serialDevice := c.String("serial")
+	respondToBroadcastReads := c.Bool("respond-broadcast-reads")
+	corruptionProbability := c.Float64("corruption-probability")
+	logLevel := simulator.LogLevelInfo
+	if c.Bool("verbose") {
+		logLevel = simulator.LogLevelDebug
+	}
+
+	if corruptionProbability < 0 || corruptionProbability > 1 {
+		return fmt.Errorf("invalid corruption probability %v: must be between 0 and 1", corruptionProbability)
+	}
 
 	// Validate slave ID
 	if slaveID < 1 || slaveID > 247 {
@@ -79,12 +114,26 @@ func runSimulator(c *cli.Context) error {
 		if err != nil {
 			return fmt.Errorf("failed to load config: %w", err)
 		}
+		if err := config.Validate(); err != nil {
+			return fmt.Errorf("invalid config %s: %w", configFile, err)
+		}
 		log.Printf("loaded initial data from %s", configFile)
 	}
 
 	// Create data store
 	ds := simulator.NewDataStore(config)
 
+	// Open structured request log
+	var requestLog io.Writer
+	if requestLogFile != "" {
+		f, err := os.OpenFile(requestLogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open request log: %w", err)
+		}
+		defer f.Close()
+		requestLog = f
+	}
+
 	// Warn if timeout configuration is set for RTU/ASCII modes
 	if config != nil && config.Delays != nil && (mode == "rtu" || mode == "ascii") {
 		hasTimeouts := false
@@ -129,8 +178,12 @@ func runSimulator(c *cli.Context) error {
 	switch mode {
 	case "rtu":
 		rtuServer, err := simulator.NewRTUServer(ds, &simulator.RTUServerConfig{
-			SlaveID:  byte(slaveID),
-			BaudRate: baudRate,
+			SlaveID:                 byte(slaveID),
+			BaudRate:                baudRate,
+			RequestLog:              requestLog,
+			RespondToBroadcastReads: respondToBroadcastReads,
+			LogLevel:                logLevel,
+			CorruptionProbability:   corruptionProbability,
 		})
 		if err != nil {
 			return fmt.Errorf("failed to create RTU server: %w", err)
@@ -140,8 +193,12 @@ func runSimulator(c *cli.Context) error {
 
 	case "ascii":
 		asciiServer, err := simulator.NewASCIIServer(ds, &simulator.ASCIIServerConfig{
-			SlaveID:  byte(slaveID),
-			BaudRate: baudRate,
+			SlaveID:                 byte(slaveID),
+			BaudRate:                baudRate,
+			RequestLog:              requestLog,
+			RespondToBroadcastReads: respondToBroadcastReads,
+			LogLevel:                logLevel,
+			CorruptionProbability:   corruptionProbability,
 		})
 		if err != nil {
 			return fmt.Errorf("failed to create ASCII server: %w", err)
@@ -151,16 +208,38 @@ func runSimulator(c *cli.Context) error {
 
 	case "tcp":
 		tcpServer, err := simulator.NewTCPServer(ds, &simulator.TCPServerConfig{
-			Address: tcpAddress,
+			Address:                 tcpAddress,
+			RequestLog:              requestLog,
+			RespondToBroadcastReads: respondToBroadcastReads,
+			LogLevel:                logLevel,
+			CorruptionProbability:   corruptionProbability,
 		})
 		if err != nil {
 			return fmt.Errorf("failed to create TCP server: %w", err)
 		}
 		server = tcpServer
-		connectionInfo = fmt.Sprintf("TCP address: %s", tcpServer.Address())
+		connectionInfo = fmt.Sprintf("TCP address: %s", tcpServer.ConnectAddress())
+
+	case "gateway":
+		if serialDevice == "" {
+			return fmt.Errorf("gateway mode requires --serial")
+		}
+		rtu := modbus.NewRTUClientHandler(serialDevice)
+		rtu.BaudRate = baudRate
+		gateway, err := simulator.NewGateway(&simulator.GatewayConfig{
+			Address:    tcpAddress,
+			RTU:        rtu,
+			RequestLog: requestLog,
+			LogLevel:   logLevel,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create gateway: %w", err)
+		}
+		server = gateway
+		connectionInfo = fmt.Sprintf("TCP address: %s, forwarding to %s", gateway.ConnectAddress(), serialDevice)
 
 	default:
-		return fmt.Errorf("invalid mode %q: must be tcp, rtu, or ascii", mode)
+		return fmt.Errorf("invalid mode %q: must be tcp, rtu, ascii, or gateway", mode)
 	}
 
 	// Start the server
@@ -0,0 +1,145 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// CoalescingWriter buffers single register writes for a time window and
+// sends only the latest value written to each address when the window
+// closes, for applications that write the same register faster than the
+// device needs, like a setpoint slider. It is safe for concurrent use.
+type CoalescingWriter struct {
+	client Client
+	window time.Duration
+
+	mu      sync.Mutex
+	pending map[uint16]*coalescedWrite
+	errs    []error
+	closed  bool
+	// sending counts the writes sent when their window closes
+	sending sync.WaitGroup
+}
+
+// coalescedWrite is the latest value written to an address in the current
+// window, sent with the values of that write's context but not its
+// cancellation, since the write returned long before it is sent.
+type coalescedWrite struct {
+	ctx   context.Context
+	value uint16
+	timer *time.Timer
+}
+
+// NewCoalescingWriter returns a writer that coalesces the writes to each
+// address within window into one Write Single Register request.
+func NewCoalescingWriter(client Client, window time.Duration) *CoalescingWriter {
+	return &CoalescingWriter{
+		client:  client,
+		window:  window,
+		pending: make(map[uint16]*coalescedWrite),
+	}
+}
+
+// Window returns the time writes to an address are buffered for.
+func (w *CoalescingWriter) Window() time.Duration {
+	return w.window
+}
+
+// WriteSingleRegister buffers value for address. The first write to an
+// address opens a window, later writes within it replace the value. The
+// request sent when the window closes carries the values of ctx, but is not
+// cancelled with it: ctx may be cancelled as soon as this returns. Its
+// duration is bounded by the transport timeout, and its errors are
+// returned by the next Flush or Close.
+func (w *CoalescingWriter) WriteSingleRegister(ctx context.Context, address, value uint16) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return fmt.Errorf("%w: coalescing writer is closed", ErrNotConnected)
+	}
+	if p, ok := w.pending[address]; ok {
+		p.ctx = context.WithoutCancel(ctx)
+		p.value = value
+		return nil
+	}
+	p := &coalescedWrite{ctx: context.WithoutCancel(ctx), value: value}
+	w.pending[address] = p
+	w.sending.Add(1)
+	p.timer = time.AfterFunc(w.window, func() {
+		defer w.sending.Done()
+		w.mu.Lock()
+		if w.pending[address] != p {
+			// Already sent by Flush
+			w.mu.Unlock()
+			return
+		}
+		delete(w.pending, address)
+		w.mu.Unlock()
+		w.send(address, p)
+	})
+	return nil
+}
+
+// Flush sends the buffered writes without waiting for their windows to
+// close and returns the errors of the writes sent since the last Flush.
+func (w *CoalescingWriter) Flush() error {
+	w.mu.Lock()
+	pending := w.pending
+	w.pending = make(map[uint16]*coalescedWrite)
+	for _, p := range pending {
+		if p.timer.Stop() {
+			w.sending.Done()
+		}
+	}
+	w.mu.Unlock()
+
+	addresses := make([]uint16, 0, len(pending))
+	for address := range pending {
+		addresses = append(addresses, address)
+	}
+	slices.Sort(addresses)
+	for _, address := range addresses {
+		w.send(address, pending[address])
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := errors.Join(w.errs...)
+	w.errs = nil
+	return err
+}
+
+// Close flushes the buffered writes, waits for the writes in progress and
+// returns their errors. Writes after Close fail.
+func (w *CoalescingWriter) Close() error {
+	w.mu.Lock()
+	w.closed = true
+	w.mu.Unlock()
+
+	err := w.Flush()
+	w.sending.Wait()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err = errors.Join(append([]error{err}, w.errs...)...)
+	w.errs = nil
+	return err
+}
+
+// send writes a buffered value, recording the error for Flush.
+func (w *CoalescingWriter) send(address uint16, p *coalescedWrite) {
+	if _, err := w.client.WriteSingleRegister(p.ctx, address, p.value); err != nil {
+		w.mu.Lock()
+		w.errs = append(w.errs, fmt.Errorf("coalesced write to address '%v': %w", address, err))
+		w.mu.Unlock()
+	}
+}
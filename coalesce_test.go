@@ -0,0 +1,135 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeRecorder records the Write Single Register requests sent through it.
+type writeRecorder struct {
+	mu     sync.Mutex
+	writes []string
+	err    error
+}
+
+func (r *writeRecorder) client() Client {
+	return NewClientWithPackagerTransporter(&mockPackager{}, &mockTransporter{
+		sendFunc: func(ctx context.Context, aduRequest []byte) ([]byte, error) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if r.err != nil {
+				return nil, r.err
+			}
+			address := uint16(aduRequest[1])<<8 | uint16(aduRequest[2])
+			value := uint16(aduRequest[3])<<8 | uint16(aduRequest[4])
+			r.writes = append(r.writes, fmt.Sprintf("%v=%v", address, value))
+			return aduRequest, nil
+		},
+	})
+}
+
+func (r *writeRecorder) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return fmt.Sprint(r.writes)
+}
+
+func TestCoalescingWriter(t *testing.T) {
+	recorder := &writeRecorder{}
+	w := NewCoalescingWriter(recorder.client(), 50*time.Millisecond)
+	if w.Window() != 50*time.Millisecond {
+		t.Errorf("expected window 50ms, got %v", w.Window())
+	}
+	ctx := context.Background()
+	for _, value := range []uint16{1, 2, 3} {
+		if err := w.WriteSingleRegister(ctx, 5, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := recorder.String(); got != "[]" {
+		t.Errorf("expected no write before the window closes, got %v", got)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if got := recorder.String(); got != "[5=3]" {
+		t.Errorf("expected only the latest value to be written, got %v", got)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCoalescingWriterClose(t *testing.T) {
+	recorder := &writeRecorder{}
+	w := NewCoalescingWriter(recorder.client(), time.Hour)
+	ctx := context.Background()
+	for _, write := range [][2]uint16{{7, 1}, {6, 1}, {7, 2}} {
+		if err := w.WriteSingleRegister(ctx, write[0], write[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := recorder.String(); got != "[6=1 7=2]" {
+		t.Errorf("expected buffered writes to be flushed on close, got %v", got)
+	}
+	if err := w.WriteSingleRegister(ctx, 7, 3); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("expected ErrNotConnected after close, got %v", err)
+	}
+}
+
+func TestCoalescingWriterErrors(t *testing.T) {
+	recorder := &writeRecorder{err: errors.New("no response")}
+	w := NewCoalescingWriter(recorder.client(), time.Millisecond)
+	if err := w.WriteSingleRegister(context.Background(), 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	err := w.Flush()
+	if err == nil {
+		t.Fatal("expected the failed write to be reported by Flush")
+	}
+	if want := "coalesced write to address '1'"; !errors.Is(err, recorder.err) || !strings.Contains(err.Error(), want) {
+		t.Errorf("expected error mentioning %q, got %v", want, err)
+	}
+	if err = w.Close(); err != nil {
+		t.Errorf("expected the error to be reported once, got %v", err)
+	}
+}
+
+func TestCoalescingWriterCancelledContext(t *testing.T) {
+	recorder := &writeRecorder{}
+	w := NewCoalescingWriter(recorder.client(), 20*time.Millisecond)
+
+	// The usual pattern cancels the context as soon as the write returns
+	write := func(value uint16) error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		return w.WriteSingleRegister(ctx, 5, value)
+	}
+	for _, value := range []uint16{1, 2} {
+		if err := write(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := w.Close(); err != nil {
+		t.Fatalf("expected the coalesced write to outlive its context, got %v", err)
+	}
+	if got := recorder.String(); got != "[5=2]" {
+		t.Errorf("expected [5=2], got %v", got)
+	}
+}
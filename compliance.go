@@ -0,0 +1,110 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"bytes"
+	"context"
+)
+
+// Compliance selects whether a handler rejects or repairs responses that
+// violate the specification in ways known from noncompliant devices and
+// gateways. It replaces the flags relaxing the checks one by one, which
+// still work but are deprecated. The zero value is Strict.
+type Compliance int
+
+const (
+	// Strict rejects every response violating the specification. It
+	// relaxes no check.
+	Strict Compliance = iota
+	// Lenient relaxes these checks, accepting the responses failing them:
+	//
+	//   - RTU and ASCII: the slave id must match the request. Replaces
+	//     SkipSlaveIDCheck.
+	//   - TCP: the protocol id must match the request. Replaces
+	//     SkipProtocolIDCheck.
+	//   - ASCII: the frame must have an even number of characters between
+	//     its start and line ending. An odd frame is repaired by removing
+	//     the spaces and NULs padding it before the line ending, or else
+	//     the one character before it.
+	//   - Write Single Register: the response must echo the address and
+	//     value. A response of the value only is accepted if the value
+	//     matches, and over RTU ends on line silence instead of being
+	//     waited on for the full length. Replaces WithLenientWriteEcho.
+	//
+	// Checksums, function codes, transaction and unit ids, and the lengths
+	// of read responses are still checked.
+	Lenient
+)
+
+// checks is a set of the checks relaxed for noncompliant devices.
+type checks uint8
+
+const (
+	checkSlaveID checks = 1 << iota
+	checkProtocolID
+	checkFrameParity
+	checkWriteEcho
+)
+
+// relaxed returns the checks relaxed by the level.
+func (c Compliance) relaxed() checks {
+	if c == Lenient {
+		return checkSlaveID | checkProtocolID | checkFrameParity | checkWriteEcho
+	}
+	return 0
+}
+
+// compliant is implemented by the packagers of the handlers, so that the
+// client can apply the checks they relax to the checks it makes.
+type compliant interface {
+	relaxedChecks() checks
+}
+
+var (
+	_ compliant = (*RTUClientHandler)(nil)
+	_ compliant = (*ASCIIClientHandler)(nil)
+	_ compliant = (*TCPClientHandler)(nil)
+)
+
+// complianceOf returns the checks relaxed by packager, by its Compliance
+// and its deprecated flags, none if it has neither.
+func complianceOf(packager Packager) checks {
+	if c, ok := packager.(compliant); ok {
+		return c.relaxedChecks()
+	}
+	return 0
+}
+
+// relaxedChecksKey is the context key of the checks relaxed for a
+// request, for transporters whose framing depends on them.
+type relaxedChecksKey struct{}
+
+// withRelaxedChecks returns ctx carrying the checks relaxed for a request.
+func withRelaxedChecks(ctx context.Context, relaxed checks) context.Context {
+	return context.WithValue(ctx, relaxedChecksKey{}, relaxed)
+}
+
+// relaxedChecksOf returns the checks relaxed for the request of ctx.
+func relaxedChecksOf(ctx context.Context) checks {
+	relaxed, _ := ctx.Value(relaxedChecksKey{}).(checks)
+	return relaxed
+}
+
+// repairFrameParity makes the number of characters of an ASCII frame
+// between its start and line ending end even, removing the spaces and NULs
+// before end, then the character before it if still odd. Frames already
+// even are returned as is.
+func repairFrameParity(adu []byte, end string) []byte {
+	if !bytes.HasSuffix(adu, []byte(end)) || len(adu) <= len(asciiStart)+len(end) ||
+		(len(adu)-len(asciiStart)-len(end))%2 == 0 {
+		return adu
+	}
+	body := bytes.TrimRight(adu[:len(adu)-len(end)], " \x00")
+	if len(body) > len(asciiStart) && (len(body)-len(asciiStart))%2 != 0 {
+		body = body[:len(body)-1]
+	}
+	return append(body[:len(body):len(body)], end...)
+}
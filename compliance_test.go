@@ -0,0 +1,145 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestComplianceIDChecks(t *testing.T) {
+	rtu := &rtuPackager{}
+	ascii := &asciiPackager{}
+	tcp := &tcpPackager{}
+	tests := []struct {
+		name string
+		// packager is relaxed by lenient, or by the deprecated flag set by
+		// skip, and then restored to Strict by strict
+		packager Packager
+		lenient  func()
+		skip     func()
+		strict   func()
+		check    checks
+		request  []byte
+		response []byte
+	}{
+		{"RTU slave id", rtu,
+			func() { rtu.Compliance = Lenient }, func() { rtu.SkipSlaveIDCheck = true },
+			func() { rtu.Compliance, rtu.SkipSlaveIDCheck = Strict, false }, checkSlaveID,
+			[]byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01, 0x84, 0x0A},
+			[]byte{0x02, 0x03, 0x02, 0x00, 0x2A, 0x7D, 0x9B}},
+		{"ASCII slave id", ascii,
+			func() { ascii.Compliance = Lenient }, func() { ascii.SkipSlaveIDCheck = true },
+			func() { ascii.Compliance, ascii.SkipSlaveIDCheck = Strict, false }, checkSlaveID,
+			[]byte(":F7031389000A60\r\n"),
+			[]byte(":F6031389000A61\r\n")},
+		{"TCP protocol id", tcp,
+			func() { tcp.Compliance = Lenient }, func() { tcp.SkipProtocolIDCheck = true },
+			func() { tcp.Compliance, tcp.SkipProtocolIDCheck = Strict, false }, checkProtocolID,
+			[]byte{0, 1, 0, 0, 0, 6, 17, 3, 0, 120, 0, 1},
+			[]byte{0, 1, 0, 1, 0, 5, 17, 3, 2, 0, 42}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if complianceOf(tt.packager) != 0 {
+				t.Fatal("expected Strict to relax nothing")
+			}
+			if err := tt.packager.Verify(tt.request, tt.response); err == nil {
+				t.Fatal("expected Strict to reject the response")
+			}
+			for _, relax := range []func(){tt.lenient, tt.skip} {
+				relax()
+				if complianceOf(tt.packager)&tt.check == 0 {
+					t.Fatalf("expected check %v to be relaxed", tt.check)
+				}
+				if err := tt.packager.Verify(tt.request, tt.response); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if _, err := tt.packager.Decode(tt.response); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				tt.strict()
+			}
+		})
+	}
+}
+
+func TestComplianceLenientRelaxesAll(t *testing.T) {
+	all := checkSlaveID | checkProtocolID | checkFrameParity | checkWriteEcho
+	if relaxed := Lenient.relaxed(); relaxed != all {
+		t.Errorf("expected Lenient to relax %b, got %b", all, relaxed)
+	}
+	if relaxed := Strict.relaxed(); relaxed != 0 {
+		t.Errorf("expected Strict to relax nothing, got %b", relaxed)
+	}
+}
+
+func TestComplianceASCIIFrameParity(t *testing.T) {
+	request := []byte(":F7031389000A60\r\n")
+	for _, response := range []string{
+		// Padded before the line ending
+		":F7031389000A60 \r\n",
+		":F7031389000A60\x00\x00\x00\r\n",
+		// A surplus character before the line ending
+		":F7031389000A607\r\n",
+	} {
+		packager := &asciiPackager{}
+		if err := packager.Verify(request, []byte(response)); err == nil {
+			t.Fatalf("%q: expected Strict to reject the odd length frame", response)
+		}
+		packager.Compliance = Lenient
+		if err := packager.Verify(request, []byte(response)); err != nil {
+			t.Fatalf("%q: unexpected error: %v", response, err)
+		}
+		adu := []byte(response)
+		pdu, err := packager.Decode(adu)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", response, err)
+		}
+		if pdu.FunctionCode != 3 || !bytes.Equal(pdu.Data, []byte{0x13, 0x89, 0x00, 0x0A}) {
+			t.Errorf("%q: unexpected pdu %+v", response, pdu)
+		}
+		// The frame is repaired, not modified in place
+		if string(adu) != response {
+			t.Errorf("%q: response modified: %q", response, adu)
+		}
+	}
+
+	// Even frames, padded or not, are left alone
+	packager := &asciiPackager{Compliance: Lenient}
+	if _, err := packager.Decode([]byte(":F7031389000A61\r\n")); !errors.Is(err, ErrProtocolError) {
+		t.Errorf("expected the LRC of an even frame to be checked, got %v", err)
+	}
+}
+
+// compliantPackager is a mockPackager with a Compliance.
+type compliantPackager struct {
+	mockPackager
+	level Compliance
+}
+
+func (p *compliantPackager) relaxedChecks() checks {
+	return p.level.relaxed()
+}
+
+func TestComplianceWriteEcho(t *testing.T) {
+	mockT := &mockTransporter{
+		sendFunc: func(_ context.Context, _ []byte) ([]byte, error) {
+			return []byte{FuncCodeWriteSingleRegister, 0x12, 0x34}, nil
+		},
+	}
+	packager := &compliantPackager{}
+	client := NewClientWithPackagerTransporter(packager, mockT)
+
+	if _, err := client.WriteSingleRegister(context.Background(), 100, 0x1234); !errors.Is(err, ErrInvalidResponse) {
+		t.Fatalf("expected Strict to reject the value only echo, got %v", err)
+	}
+	packager.level = Lenient
+	if _, err := client.WriteSingleRegister(context.Background(), 100, 0x1234); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
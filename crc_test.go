@@ -17,3 +17,47 @@ func TestCRC(t *testing.T) {
 		t.Fatalf("crc expected %v, actual %v", 0x1241, crc.value())
 	}
 }
+
+// crcBitwise computes the Modbus CRC-16 bit by bit, as a reference for
+// the table-driven implementation.
+func crcBitwise(data []byte) uint16 {
+	value := uint16(0xFFFF)
+	for _, b := range data {
+		value ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if value&1 != 0 {
+				value = value>>1 ^ 0xA001
+			} else {
+				value >>= 1
+			}
+		}
+	}
+	return value
+}
+
+func TestCRCMatchesBitwise(t *testing.T) {
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	for n := 0; n <= len(data); n++ {
+		var crc crc
+		crc.reset().pushBytes(data[:n])
+		if expected := crcBitwise(data[:n]); crc.value() != expected {
+			t.Fatalf("length %d: crc expected %04x, actual %04x", n, expected, crc.value())
+		}
+	}
+}
+
+func BenchmarkCRC16(b *testing.B) {
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	var crc crc
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		crc.reset().pushBytes(data)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"context"
+	"fmt"
+	"maps"
+)
+
+// maxDeviceIDRequests caps the requests of ReadDeviceIdentificationAll.
+// Every response holds at least one of the 256 object ids, so a device
+// still reporting more objects after that many is never going to finish.
+const maxDeviceIDRequests = 256
+
+// DeviceIdentification is one response of Read Device Identification.
+type DeviceIdentification struct {
+	// ConformityLevel is the identification level and access types the
+	// device supports.
+	ConformityLevel byte
+	// MoreFollows reports that the objects did not fit in the response;
+	// the next ones are read starting at NextObjectID.
+	MoreFollows  bool
+	NextObjectID byte
+	// Objects are the object values keyed by object id.
+	Objects map[byte][]byte
+}
+
+// ReadDeviceIdentification sends one Read Device Identification request for
+// the objects selected by readDeviceIDCode, starting at objectID. It fails
+// with ErrNotSupported for clients other than those of NewClient and
+// NewResilientClient.
+//
+// Request:
+//
+//	Function code         : 1 byte (0x2B)
+//	MEI type              : 1 byte (0x0E)
+//	Read device ID code   : 1 byte
+//	Object id             : 1 byte
+//
+// Response:
+//
+//	Function code         : 1 byte (0x2B)
+//	MEI type              : 1 byte (0x0E)
+//	Read device ID code   : 1 byte
+//	Conformity level      : 1 byte
+//	More follows          : 1 byte (0x00 or 0xFF)
+//	Next object id        : 1 byte
+//	Number of objects     : 1 byte
+//	Objects               : N x (id, length, value)
+func ReadDeviceIdentification(ctx context.Context, client Client, readDeviceIDCode, objectID byte) (*DeviceIdentification, error) {
+	if readDeviceIDCode < ReadDeviceIDBasic || readDeviceIDCode > ReadDeviceIDSpecific {
+		return nil, fmt.Errorf("%w: read device id code '%v' must be between '%v' and '%v'", ErrInvalidData, readDeviceIDCode, ReadDeviceIDBasic, ReadDeviceIDSpecific)
+	}
+	request := ProtocolDataUnit{
+		FunctionCode: FuncCodeEncapsulatedInterface,
+		Data:         []byte{MEITypeReadDeviceIdentification, readDeviceIDCode, objectID},
+	}
+	response, err := sendRequest(ctx, client, &request)
+	if err != nil {
+		return nil, fmt.Errorf("reading device identification: %w", err)
+	}
+	return decodeDeviceIdentification(response.Data, readDeviceIDCode)
+}
+
+// decodeDeviceIdentification decodes the data of a Read Device
+// Identification response to a request for readDeviceIDCode.
+func decodeDeviceIdentification(data []byte, readDeviceIDCode byte) (*DeviceIdentification, error) {
+	if len(data) < 6 {
+		return nil, fmt.Errorf("%w: response data size '%v' is less than expected '%v'", ErrInvalidResponse, len(data), 6)
+	}
+	if data[0] != MEITypeReadDeviceIdentification {
+		return nil, fmt.Errorf("%w: response MEI type '%v' does not match request '%v'", ErrInvalidResponse, data[0], MEITypeReadDeviceIdentification)
+	}
+	if data[1] != readDeviceIDCode {
+		return nil, fmt.Errorf("%w: response read device id code '%v' does not match request '%v'", ErrInvalidResponse, data[1], readDeviceIDCode)
+	}
+	id := &DeviceIdentification{
+		ConformityLevel: data[2],
+		MoreFollows:     data[3] == 0xFF,
+		NextObjectID:    data[4],
+		Objects:         make(map[byte][]byte, data[5]),
+	}
+	objects := data[6:]
+	for i := 0; i < int(data[5]); i++ {
+		if len(objects) < 2 || len(objects) < 2+int(objects[1]) {
+			return nil, fmt.Errorf("%w: object '%v' of '%v' exceeds response data size '%v'", ErrInvalidResponse, i+1, data[5], len(data))
+		}
+		length := int(objects[1])
+		id.Objects[objects[0]] = append([]byte(nil), objects[2:2+length]...)
+		objects = objects[2+length:]
+	}
+	return id, nil
+}
+
+// ReadDeviceIdentificationAll reads all objects of the category selected by
+// readDeviceIDCode, sending as many Read Device Identification requests as
+// the device needs to return them. It fails if the device keeps reporting
+// more objects after 256 requests.
+func ReadDeviceIdentificationAll(ctx context.Context, client Client, readDeviceIDCode byte) (map[byte][]byte, error) {
+	objects := make(map[byte][]byte)
+	var objectID byte
+	for i := 0; i < maxDeviceIDRequests; i++ {
+		id, err := ReadDeviceIdentification(ctx, client, readDeviceIDCode, objectID)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(objects, id.Objects)
+		if !id.MoreFollows {
+			return objects, nil
+		}
+		objectID = id.NextObjectID
+	}
+	return nil, fmt.Errorf("%w: device identification still reports more objects after '%v' requests", ErrInvalidResponse, maxDeviceIDRequests)
+}
@@ -0,0 +1,114 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// deviceIDResponse builds a Read Device Identification response ADU.
+func deviceIDResponse(moreFollows bool, nextObjectID byte, objects ...string) []byte {
+	more := byte(0x00)
+	if moreFollows {
+		more = 0xFF
+	}
+	adu := []byte{FuncCodeEncapsulatedInterface, MEITypeReadDeviceIdentification, ReadDeviceIDBasic, 0x81, more, nextObjectID, 0}
+	for _, object := range objects {
+		id := object[0] - '0'
+		adu = append(adu, id, byte(len(object)-1))
+		adu = append(adu, object[1:]...)
+		adu[6]++
+	}
+	return adu
+}
+
+func TestReadDeviceIdentification(t *testing.T) {
+	mockT := &mockTransporter{
+		sendFunc: func(_ context.Context, req []byte) ([]byte, error) {
+			if want := []byte{FuncCodeEncapsulatedInterface, MEITypeReadDeviceIdentification, ReadDeviceIDBasic, 0x00}; string(req) != string(want) {
+				t.Errorf("request: expected % x, actual % x", want, req)
+			}
+			return deviceIDResponse(true, 2, "0Acme", "1PX-100"), nil
+		},
+	}
+	client := NewClientWithPackagerTransporter(&mockPackager{}, mockT)
+
+	id, err := ReadDeviceIdentification(context.Background(), client, ReadDeviceIDBasic, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.ConformityLevel != 0x81 || !id.MoreFollows || id.NextObjectID != 2 {
+		t.Errorf("unexpected header %+v", id)
+	}
+	if len(id.Objects) != 2 || string(id.Objects[0]) != "Acme" || string(id.Objects[1]) != "PX-100" {
+		t.Errorf("unexpected objects %q", id.Objects)
+	}
+
+	if _, err = ReadDeviceIdentification(context.Background(), client, 5, 0); !errors.Is(err, ErrInvalidData) {
+		t.Errorf("expected ErrInvalidData for read device id code 5, got %v", err)
+	}
+
+	// An object running past the end of the response
+	mockT.sendFunc = func(_ context.Context, _ []byte) ([]byte, error) {
+		adu := deviceIDResponse(false, 0, "0Acme")
+		return adu[:len(adu)-1], nil
+	}
+	if _, err = ReadDeviceIdentification(context.Background(), client, ReadDeviceIDBasic, 0); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("expected ErrInvalidResponse for a truncated object, got %v", err)
+	}
+
+	// A response for another read device id code
+	mockT.sendFunc = func(_ context.Context, _ []byte) ([]byte, error) {
+		return deviceIDResponse(false, 0, "0Acme"), nil
+	}
+	if _, err = ReadDeviceIdentification(context.Background(), client, ReadDeviceIDRegular, 0); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("expected ErrInvalidResponse for a mismatched read device id code, got %v", err)
+	}
+}
+
+func TestReadDeviceIdentificationAll(t *testing.T) {
+	var requested []byte
+	client := NewClientWithPackagerTransporter(&mockPackager{}, &mockTransporter{
+		sendFunc: func(_ context.Context, req []byte) ([]byte, error) {
+			requested = append(requested, req[3])
+			switch req[3] {
+			case 0:
+				return deviceIDResponse(true, 1, "0Acme"), nil
+			case 1:
+				return deviceIDResponse(true, 2, "1PX-100"), nil
+			default:
+				return deviceIDResponse(false, 0, "2v1.2"), nil
+			}
+		},
+	})
+
+	objects, err := ReadDeviceIdentificationAll(context.Background(), client, ReadDeviceIDBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(requested) != "\x00\x01\x02" {
+		t.Errorf("expected object ids 0, 1 and 2 to be requested, got % x", requested)
+	}
+	if len(objects) != 3 || string(objects[0]) != "Acme" || string(objects[1]) != "PX-100" || string(objects[2]) != "v1.2" {
+		t.Errorf("unexpected objects %q", objects)
+	}
+
+	// A device that never clears more follows
+	var requests int
+	client = NewClientWithPackagerTransporter(&mockPackager{}, &mockTransporter{
+		sendFunc: func(_ context.Context, _ []byte) ([]byte, error) {
+			requests++
+			return deviceIDResponse(true, 0, "0Acme"), nil
+		},
+	})
+	if _, err = ReadDeviceIdentificationAll(context.Background(), client, ReadDeviceIDBasic); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("expected ErrInvalidResponse for a runaway device, got %v", err)
+	}
+	if requests != maxDeviceIDRequests {
+		t.Errorf("expected %d requests, got %d", maxDeviceIDRequests, requests)
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+)
+
+// Restart Communications Option data values.
+const (
+	restartKeepLog  = 0x0000
+	restartClearLog = 0xFF00
+)
+
+// Request:
+//
+//	Function code         : 1 byte (0x08)
+//	Sub-function          : 2 bytes
+//	Data                  : N x 2 bytes
+//
+// Response:
+//
+//	Function code         : 1 byte (0x08)
+//	Sub-function          : 2 bytes
+//	Data                  : N x 2 bytes
+func (mb *client) Diagnostics(ctx context.Context, subFunction uint16, data []byte) (results []byte, err error) {
+	request := ProtocolDataUnit{
+		FunctionCode: FuncCodeDiagnostics,
+		Data:         append(dataBlock(subFunction), data...),
+	}
+	response, err := mb.send(ctx, &request)
+	if err != nil {
+		return nil, fmt.Errorf("sending diagnostics: %w", err)
+	}
+	if len(response.Data) < 2 {
+		return nil, fmt.Errorf("%w: response data size '%v' is less than expected '%v'", ErrInvalidResponse, len(response.Data), 2)
+	}
+	respValue := binary.BigEndian.Uint16(response.Data)
+	if subFunction != respValue {
+		return nil, fmt.Errorf("%w: response sub-function '%v' does not match request '%v'", ErrInvalidResponse, respValue, subFunction)
+	}
+	return response.Data[2:], nil
+}
+
+// ReadDiagnosticRegister returns the device's 16-bit diagnostic register
+// (Return Diagnostic Register sub-function). The meaning of its bits is
+// device specific.
+func ReadDiagnosticRegister(ctx context.Context, client Client) (uint16, error) {
+	results, err := client.Diagnostics(ctx, DiagnosticReturnDiagnosticRegister, dataBlock(0))
+	if err != nil {
+		return 0, fmt.Errorf("reading diagnostic register: %w", err)
+	}
+	if len(results) != 2 {
+		return 0, fmt.Errorf("%w: response data size '%v' does not match expected '%v'", ErrInvalidResponse, len(results), 2)
+	}
+	return binary.BigEndian.Uint16(results), nil
+}
+
+// ForceListenOnly sends the Force Listen Only Mode diagnostic. The device
+// never answers this request, so ForceListenOnly returns once the request
+// is sent instead of waiting for a response. Until RestartCommunications
+// is called, the device does not respond to any request; timeouts in the
+// meantime are expected. Clients other than those of NewClient and
+// NewResilientClient, and transporters that are not a NoResponseSender,
+// can't send it and fail with ErrNotSupported.
+func ForceListenOnly(ctx context.Context, client Client) error {
+	err := sendUnanswered(ctx, client, &ProtocolDataUnit{
+		FunctionCode: FuncCodeDiagnostics,
+		Data:         dataBlock(DiagnosticForceListenOnlyMode, 0),
+	})
+	if err != nil {
+		return fmt.Errorf("forcing listen only mode: %w", err)
+	}
+	if mb := clientOf(client); mb != nil {
+		mb.listenOnly.Store(true)
+	}
+	return nil
+}
+
+// RestartCommunications sends the Restart Communications Option diagnostic,
+// which brings the device out of listen only mode and restarts its serial
+// line port, clearing the communications event log if clearLog is set. A
+// device in listen only mode does not answer; after ForceListenOnly on this
+// client the request is therefore sent without waiting for a response.
+// Otherwise the device echoes the request.
+func RestartCommunications(ctx context.Context, client Client, clearLog bool) error {
+	var value uint16 = restartKeepLog
+	if clearLog {
+		value = restartClearLog
+	}
+	mb := clientOf(client)
+	if mb != nil && mb.listenOnly.Load() {
+		err := sendUnanswered(ctx, client, &ProtocolDataUnit{
+			FunctionCode: FuncCodeDiagnostics,
+			Data:         dataBlock(DiagnosticRestartCommunications, value),
+		})
+		if err != nil {
+			return fmt.Errorf("restarting communications: %w", err)
+		}
+		mb.listenOnly.Store(false)
+		return nil
+	}
+	results, err := client.Diagnostics(ctx, DiagnosticRestartCommunications, dataBlock(value))
+	if err != nil {
+		return fmt.Errorf("restarting communications: %w", err)
+	}
+	if len(results) != 2 || binary.BigEndian.Uint16(results) != value {
+		return fmt.Errorf("%w: response data '% x' does not match request '%v'", ErrInvalidResponse, results, value)
+	}
+	if mb != nil {
+		mb.listenOnly.Store(false)
+	}
+	return nil
+}
+
+// ReadExceptionStatus reads the eight exception status outputs of a device
+// (serial line only). It fails with ErrNotSupported for clients other than
+// those of NewClient and NewResilientClient.
+//
+// Request:
+//
+//	Function code         : 1 byte (0x07)
+//
+// Response:
+//
+//	Function code         : 1 byte (0x07)
+//	Output data           : 1 byte
+func ReadExceptionStatus(ctx context.Context, client Client) (status byte, err error) {
+	request := ProtocolDataUnit{
+		FunctionCode: FuncCodeReadExceptionStatus,
+	}
+	response, err := sendRequest(ctx, client, &request)
+	if err != nil {
+		return 0, fmt.Errorf("reading exception status: %w", err)
+	}
+	if len(response.Data) != 1 {
+		return 0, fmt.Errorf("%w: response data size '%v' does not match expected '%v'", ErrInvalidResponse, len(response.Data), 1)
+	}
+	return response.Data[0], nil
+}
+
+// GetCommEventCounter returns the device's status word and the count of
+// messages it completed successfully (serial line only). It fails with
+// ErrNotSupported for clients other than those of NewClient and
+// NewResilientClient.
+//
+// Request:
+//
+//	Function code         : 1 byte (0x0B)
+//
+// Response:
+//
+//	Function code         : 1 byte (0x0B)
+//	Status                : 2 bytes
+//	Event count           : 2 bytes
+func GetCommEventCounter(ctx context.Context, client Client) (status, eventCount uint16, err error) {
+	request := ProtocolDataUnit{
+		FunctionCode: FuncCodeGetCommEventCounter,
+	}
+	response, err := sendRequest(ctx, client, &request)
+	if err != nil {
+		return 0, 0, fmt.Errorf("getting comm event counter: %w", err)
+	}
+	if len(response.Data) != 4 {
+		return 0, 0, fmt.Errorf("%w: response data size '%v' does not match expected '%v'", ErrInvalidResponse, len(response.Data), 4)
+	}
+	return binary.BigEndian.Uint16(response.Data), binary.BigEndian.Uint16(response.Data[2:]), nil
+}
+
+// noResponseSender sends requests the device does not answer. The client
+// of NewClient and a ResilientClient implement it.
+type noResponseSender interface {
+	sendNoResponse(ctx context.Context, request *ProtocolDataUnit) error
+}
+
+// sendUnanswered sends request with client without waiting for a response,
+// failing with ErrNotSupported if it is not a noResponseSender.
+func sendUnanswered(ctx context.Context, client Client, request *ProtocolDataUnit) error {
+	sender, ok := client.(noResponseSender)
+	if !ok {
+		return fmt.Errorf("%w: client '%T' cannot send a request without a response", ErrNotSupported, client)
+	}
+	return sender.sendNoResponse(ctx, request)
+}
+
+// sendNoResponse encodes and sends a request the device does not answer.
+func (mb *client) sendNoResponse(ctx context.Context, request *ProtocolDataUnit) error {
+	sender, ok := mb.transporter.(NoResponseSender)
+	if !ok {
+		return fmt.Errorf("%w: transporter cannot send a request without a response", ErrNotSupported)
+	}
+	aduRequest, err := mb.packager.Encode(request)
+	if err != nil {
+		return fmt.Errorf("encoding PDU: %w", err)
+	}
+	if err = sender.SendNoResponse(ctx, aduRequest); err != nil {
+		return fmt.Errorf("sending request: %w", err)
+	}
+	return nil
+}
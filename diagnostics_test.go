@@ -0,0 +1,210 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// noResponseTransporter records requests sent without a response.
+type noResponseTransporter struct {
+	mockTransporter
+	written [][]byte
+}
+
+func (m *noResponseTransporter) SendNoResponse(_ context.Context, aduRequest []byte) error {
+	m.written = append(m.written, aduRequest)
+	return nil
+}
+
+func TestDiagnostics(t *testing.T) {
+	client := NewClientWithPackagerTransporter(&mockPackager{}, &mockTransporter{})
+
+	// The default mock echoes the request
+	results, err := client.Diagnostics(context.Background(), DiagnosticReturnQueryData, []byte{0xA5, 0x37})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(results, []byte{0xA5, 0x37}) {
+		t.Errorf("expected echoed data, got % x", results)
+	}
+
+	client = NewClientWithPackagerTransporter(&mockPackager{}, &mockTransporter{
+		sendFunc: func(_ context.Context, _ []byte) ([]byte, error) {
+			return []byte{FuncCodeDiagnostics, 0x00, 0x02, 0xA5, 0x37}, nil
+		},
+	})
+	if _, err = client.Diagnostics(context.Background(), DiagnosticReturnQueryData, []byte{0xA5, 0x37}); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("expected ErrInvalidResponse for mismatched sub-function, got %v", err)
+	}
+}
+
+func TestDiagnosticsClearOverrunCounter(t *testing.T) {
+	// The device echoes the request, which carries no data besides 0x0000
+	client := NewClientWithPackagerTransporter(&mockPackager{}, &mockTransporter{})
+	results, err := client.Diagnostics(context.Background(), DiagnosticClearOverrunCounter, dataBlock(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(results, []byte{0x00, 0x00}) {
+		t.Errorf("expected echoed data, got % x", results)
+	}
+}
+
+func TestReadDiagnosticRegister(t *testing.T) {
+	client := NewClientWithPackagerTransporter(&mockPackager{}, &mockTransporter{
+		sendFunc: func(_ context.Context, req []byte) ([]byte, error) {
+			if !bytes.Equal(req, []byte{FuncCodeDiagnostics, 0x00, 0x02, 0x00, 0x00}) {
+				t.Errorf("unexpected request % x", req)
+			}
+			return []byte{FuncCodeDiagnostics, 0x00, 0x02, 0x80, 0x01}, nil
+		},
+	})
+	value, err := ReadDiagnosticRegister(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != 0x8001 {
+		t.Errorf("expected 0x8001, got 0x%04x", value)
+	}
+
+	// The sub-function must be echoed
+	client = NewClientWithPackagerTransporter(&mockPackager{}, &mockTransporter{
+		sendFunc: func(_ context.Context, _ []byte) ([]byte, error) {
+			return []byte{FuncCodeDiagnostics, 0x00, 0x00, 0x80, 0x01}, nil
+		},
+	})
+	if _, err = ReadDiagnosticRegister(context.Background(), client); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("expected ErrInvalidResponse, got %v", err)
+	}
+}
+
+func TestReadExceptionStatus(t *testing.T) {
+	client := NewClientWithPackagerTransporter(&mockPackager{}, &mockTransporter{
+		sendFunc: func(_ context.Context, req []byte) ([]byte, error) {
+			if !bytes.Equal(req, []byte{FuncCodeReadExceptionStatus}) {
+				t.Errorf("unexpected request % x", req)
+			}
+			return []byte{FuncCodeReadExceptionStatus, 0x6D}, nil
+		},
+	})
+	status, err := ReadExceptionStatus(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != 0x6D {
+		t.Errorf("expected 0x6d, got 0x%02x", status)
+	}
+
+	// The default mock echoes the request, which has no data
+	client = NewClientWithPackagerTransporter(&mockPackager{}, &mockTransporter{})
+	if _, err = ReadExceptionStatus(context.Background(), client); err == nil {
+		t.Error("expected an error for a response without data")
+	}
+}
+
+func TestGetCommEventCounter(t *testing.T) {
+	client := NewClientWithPackagerTransporter(&mockPackager{}, &mockTransporter{
+		sendFunc: func(_ context.Context, req []byte) ([]byte, error) {
+			if !bytes.Equal(req, []byte{FuncCodeGetCommEventCounter}) {
+				t.Errorf("unexpected request % x", req)
+			}
+			return []byte{FuncCodeGetCommEventCounter, 0xFF, 0xFF, 0x01, 0x08}, nil
+		},
+	})
+	status, count, err := GetCommEventCounter(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != 0xFFFF || count != 0x0108 {
+		t.Errorf("expected status 0xffff and count 264, got 0x%04x and %d", status, count)
+	}
+
+	client = NewClientWithPackagerTransporter(&mockPackager{}, &mockTransporter{
+		sendFunc: func(_ context.Context, _ []byte) ([]byte, error) {
+			return []byte{FuncCodeGetCommEventCounter, 0x00, 0x00}, nil
+		},
+	})
+	if _, _, err = GetCommEventCounter(context.Background(), client); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("expected ErrInvalidResponse, got %v", err)
+	}
+}
+
+func TestForceListenOnly(t *testing.T) {
+	transporter := &noResponseTransporter{}
+	transporter.sendFunc = func(_ context.Context, _ []byte) ([]byte, error) {
+		t.Error("unexpected request waiting for a response")
+		return nil, errors.New("unexpected")
+	}
+	client := NewClientWithPackagerTransporter(&mockPackager{}, transporter)
+
+	if err := ForceListenOnly(context.Background(), client); err != nil {
+		t.Fatal(err)
+	}
+	// The device is in listen only mode, so the restart is not answered
+	if err := RestartCommunications(context.Background(), client, true); err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]byte{
+		{FuncCodeDiagnostics, 0x00, 0x04, 0x00, 0x00},
+		{FuncCodeDiagnostics, 0x00, 0x01, 0xFF, 0x00},
+	}
+	if len(transporter.written) != len(expected) {
+		t.Fatalf("expected %d requests, got %d", len(expected), len(transporter.written))
+	}
+	for i := range expected {
+		if !bytes.Equal(transporter.written[i], expected[i]) {
+			t.Errorf("request %d: expected % x, actual % x", i, expected[i], transporter.written[i])
+		}
+	}
+
+	// Once back online the device echoes the restart request
+	transporter.sendFunc = nil
+	if err := RestartCommunications(context.Background(), client, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(transporter.written) != len(expected) {
+		t.Errorf("expected the restart to wait for a response")
+	}
+
+	// Transporters that always wait for a response can't force listen only
+	client = NewClientWithPackagerTransporter(&mockPackager{}, &mockTransporter{})
+	if err := ForceListenOnly(context.Background(), client); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+}
+
+func TestForceListenOnlyResilient(t *testing.T) {
+	transporter := &noResponseTransporter{}
+	resilient := NewResilientClient(NewClientWithPackagerTransporter(&mockPackager{}, transporter), 1, time.Minute)
+
+	if err := ForceListenOnly(context.Background(), resilient); err != nil {
+		t.Fatal(err)
+	}
+	transporter.sendFunc = func(_ context.Context, _ []byte) ([]byte, error) {
+		t.Error("unexpected request waiting for a response")
+		return nil, errors.New("unexpected")
+	}
+	if err := RestartCommunications(context.Background(), resilient, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(transporter.written) != 2 {
+		t.Errorf("expected 2 requests without a response, got %d", len(transporter.written))
+	}
+
+	// Other implementations can't send a request without a response, which
+	// does not open the circuit
+	other := NewResilientClient(otherClient{NewClientWithPackagerTransporter(&mockPackager{}, transporter)}, 1, time.Minute)
+	if err := ForceListenOnly(context.Background(), other); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+	if state := other.State(); state != CircuitClosed {
+		t.Errorf("expected the circuit to stay closed, got %v", state)
+	}
+}
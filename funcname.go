@@ -0,0 +1,47 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import "fmt"
+
+// functionCodeNames are the names the specification gives the function
+// codes.
+var functionCodeNames = map[byte]string{
+	FuncCodeReadCoils:                  "Read Coils",
+	FuncCodeReadDiscreteInputs:         "Read Discrete Inputs",
+	FuncCodeReadHoldingRegisters:       "Read Holding Registers",
+	FuncCodeReadInputRegisters:         "Read Input Registers",
+	FuncCodeWriteSingleCoil:            "Write Single Coil",
+	FuncCodeWriteSingleRegister:        "Write Single Register",
+	FuncCodeReadExceptionStatus:        "Read Exception Status",
+	FuncCodeDiagnostics:                "Diagnostics",
+	FuncCodeGetCommEventCounter:        "Get Comm Event Counter",
+	FuncCodeGetCommEventLog:            "Get Comm Event Log",
+	FuncCodeWriteMultipleCoils:         "Write Multiple Coils",
+	FuncCodeWriteMultipleRegisters:     "Write Multiple Registers",
+	FuncCodeReadFileRecord:             "Read File Record",
+	FuncCodeWriteFileRecord:            "Write File Record",
+	FuncCodeMaskWriteRegister:          "Mask Write Register",
+	FuncCodeReadWriteMultipleRegisters: "Read/Write Multiple Registers",
+	FuncCodeReadFIFOQueue:              "Read FIFO Queue",
+	FuncCodeEncapsulatedInterface:      "Encapsulated Interface Transport",
+}
+
+// FunctionCodeName returns the human-readable name of a function code, such
+// as "Read Holding Registers" for 3. The function code of an exception
+// response, with the high bit set, is named after the function followed by
+// "(exception)". Codes without a name are returned as "Function <code>".
+func FunctionCodeName(code byte) string {
+	var suffix string
+	if code&0x80 != 0 {
+		code &^= 0x80
+		suffix = " (exception)"
+	}
+	name, ok := functionCodeNames[code]
+	if !ok {
+		name = fmt.Sprintf("Function %d", code)
+	}
+	return name + suffix
+}
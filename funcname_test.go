@@ -0,0 +1,26 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import "testing"
+
+func TestFunctionCodeName(t *testing.T) {
+	tests := []struct {
+		code byte
+		want string
+	}{
+		{FuncCodeReadHoldingRegisters, "Read Holding Registers"},
+		{FuncCodeWriteMultipleCoils, "Write Multiple Coils"},
+		{FuncCodeReadWriteMultipleRegisters, "Read/Write Multiple Registers"},
+		{FuncCodeReadHoldingRegisters | 0x80, "Read Holding Registers (exception)"},
+		{100, "Function 100"},
+		{100 | 0x80, "Function 100 (exception)"},
+	}
+	for _, tt := range tests {
+		if got := FunctionCodeName(tt.code); got != tt.want {
+			t.Errorf("FunctionCodeName(%d) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
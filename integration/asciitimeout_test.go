@@ -0,0 +1,90 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license.  See the LICENSE file for details.
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lumberbarons/modbus"
+	"github.com/lumberbarons/modbus/internal/testutil"
+)
+
+// startStallingASCIIDevice answers the first request on an in-memory line
+// with the bytes of response written every interval, then stalls, and
+// returns a client handler connected to it.
+func startStallingASCIIDevice(t *testing.T, response []byte, chunk int, interval time.Duration) *modbus.ASCIIClientHandler {
+	t.Helper()
+	line := testutil.NewSerialLine()
+	device := line.Device()
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		device.Close()
+		<-done
+	})
+
+	go func() {
+		defer close(done)
+		var request []byte
+		buf := make([]byte, 64)
+		for !bytes.HasSuffix(request, []byte("\r\n")) {
+			n, err := device.Read(buf)
+			if err != nil {
+				return
+			}
+			request = append(request, buf[:n]...)
+		}
+		for len(response) > 0 {
+			n := min(chunk, len(response))
+			if _, err := device.Write(response[:n]); err != nil {
+				return
+			}
+			response = response[n:]
+			time.Sleep(interval)
+		}
+	}()
+
+	handler := modbus.NewASCIIClientHandler("line")
+	handler.SlaveID = 1
+	handler.OpenPort = line.Open
+	t.Cleanup(func() { handler.Close() })
+	return handler
+}
+
+func TestASCIIPartialFrameTimeout(t *testing.T) {
+	const timeout = 300 * time.Millisecond
+	tests := []struct {
+		name     string
+		response []byte
+		chunk    int
+		interval time.Duration
+	}{
+		// The device stalls after half of the frame
+		{"stall", []byte(":0103021234"), 11, 0},
+		// The device trickles the frame out a byte at a time, each one
+		// within the read timeout but the whole far beyond it
+		{"trickle", []byte(":0103021234B4\r\n"), 1, timeout / 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := startStallingASCIIDevice(t, tt.response, tt.chunk, tt.interval)
+			handler.Timeout = timeout
+			client := modbus.NewClient(handler)
+
+			start := time.Now()
+			_, err := client.ReadHoldingRegisters(context.Background(), 10, 1)
+			elapsed := time.Since(start)
+			if !errors.Is(err, modbus.ErrResponseTimeout) {
+				t.Fatalf("expected ErrResponseTimeout, got: %v", err)
+			}
+			if elapsed > 2*timeout {
+				t.Errorf("expected timeout after about %v, took %v", timeout, elapsed)
+			}
+		})
+	}
+}
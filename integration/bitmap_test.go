@@ -0,0 +1,71 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license.  See the LICENSE file for details.
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/lumberbarons/modbus"
+	"github.com/lumberbarons/modbus/internal/simulator"
+	"github.com/lumberbarons/modbus/internal/testutil"
+)
+
+// TestReadBitmapUnalignedStart reads coils and discrete inputs starting at
+// addresses that are not multiples of 8. The device packs the bits from the
+// requested start, so bit i of the result must be the value at start+i
+// whatever the start offset.
+func TestReadBitmapUnalignedStart(t *testing.T) {
+	// A pattern without period 8, so that a shifted bit layout shows.
+	value := func(address uint16) bool { return address%3 == 0 || address%7 == 0 }
+	config := &simulator.DataStoreConfig{
+		Coils:          map[uint16]bool{},
+		DiscreteInputs: map[uint16]bool{},
+	}
+	for address := uint16(0); address < 64; address++ {
+		config.Coils[address] = value(address)
+		config.DiscreteInputs[address] = !value(address)
+	}
+	cleanup, address := testutil.StartTCPSimulator(t, testutil.WithTCPDataStoreConfig(config))
+	defer cleanup()
+
+	client := modbus.TCPClient(address)
+	ctx := context.Background()
+	for _, tt := range []struct{ start, quantity uint16 }{
+		{3, 10},
+		{1, 8},
+		{7, 1},
+		{5, 17},
+		{13, 24},
+	} {
+		t.Run(fmt.Sprintf("%d+%d", tt.start, tt.quantity), func(t *testing.T) {
+			coils, err := modbus.ReadCoilsBitmap(ctx, client, tt.start, tt.quantity)
+			if err != nil {
+				t.Fatal(err)
+			}
+			inputs, err := modbus.ReadDiscreteInputsBitmap(ctx, client, tt.start, tt.quantity)
+			if err != nil {
+				t.Fatal(err)
+			}
+			AssertEquals(t, int(tt.quantity), coils.Count())
+			AssertEquals(t, int(tt.quantity), inputs.Count())
+			for i, bit := range coils.Bools() {
+				if expected := value(tt.start + uint16(i)); bit != expected {
+					t.Errorf("coil %d: expected %v, actual %v", tt.start+uint16(i), expected, bit)
+				}
+			}
+			for i, bit := range inputs.Bools() {
+				if expected := !value(tt.start + uint16(i)); bit != expected {
+					t.Errorf("discrete input %d: expected %v, actual %v", tt.start+uint16(i), expected, bit)
+				}
+			}
+			// Bits past the quantity are padding and read as false.
+			if coils.Get(int(tt.quantity)) || inputs.Get(int(tt.quantity)) {
+				t.Error("expected bits past the quantity to read as false")
+			}
+		})
+	}
+}
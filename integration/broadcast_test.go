@@ -0,0 +1,109 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license.  See the LICENSE file for details.
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lumberbarons/modbus"
+	"github.com/lumberbarons/modbus/internal/simulator"
+	"github.com/lumberbarons/modbus/internal/testutil"
+)
+
+func TestBroadcastWriteNotAnswered(t *testing.T) {
+	for _, transport := range []string{"TCP", "RTU", "ASCII"} {
+		t.Run(transport, func(t *testing.T) {
+			cleanup, client, setSlaveID := testutil.StartSimulatorClient(t, transport, nil, 300*time.Millisecond)
+			defer cleanup()
+			ctx := context.Background()
+
+			// The write is executed, but no response comes back
+			setSlaveID(0)
+			_, err := client.WriteSingleRegister(ctx, 10, 0x1234)
+			if !errors.Is(err, modbus.ErrResponseTimeout) {
+				t.Fatalf("expected no response to a broadcast, got: %v", err)
+			}
+
+			setSlaveID(1)
+			results, err := client.ReadHoldingRegisters(ctx, 10, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal([]byte{0x12, 0x34}, results) {
+				t.Errorf("expected the broadcast write to be executed, got % x", results)
+			}
+		})
+	}
+}
+
+func TestTCPRespondToBroadcastReads(t *testing.T) {
+	config := &simulator.DataStoreConfig{HoldingRegs: map[uint16]uint16{10: 0x1234}}
+	server, err := simulator.NewTCPServer(simulator.NewDataStore(config), &simulator.TCPServerConfig{
+		Address:                 "localhost:0",
+		RespondToBroadcastReads: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	handler := modbus.NewTCPClientHandler(server.ConnectAddress())
+	handler.SlaveID = 0
+	handler.Timeout = 300 * time.Millisecond
+	defer handler.Close()
+	clientTestBroadcastReads(t, modbus.NewClient(handler))
+}
+
+func TestRTURespondToBroadcastReads(t *testing.T) {
+	config := &simulator.DataStoreConfig{HoldingRegs: map[uint16]uint16{10: 0x1234}}
+	line := testutil.NewSerialLine()
+	server := simulator.NewRTUServerWithConn(simulator.NewHandler(simulator.NewDataStore(config)), line.Device(), &simulator.RTUServerConfig{
+		RespondToBroadcastReads: true,
+	})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	handler := modbus.NewRTUClientHandler("line")
+	handler.OpenPort = line.Open
+	handler.SlaveID = 0
+	handler.Timeout = 300 * time.Millisecond
+	defer handler.Close()
+	clientTestBroadcastReads(t, modbus.NewClient(handler))
+}
+
+// clientTestBroadcastReads checks that a client sending to unit 0 is
+// answered when reading holding register 10, set to 0x1234, and that its
+// writes are still executed without answer.
+func clientTestBroadcastReads(t *testing.T, client modbus.Client) {
+	ctx := context.Background()
+	results, err := client.ReadHoldingRegisters(ctx, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal([]byte{0x12, 0x34}, results) {
+		t.Errorf("expected the broadcast read to be answered, got % x", results)
+	}
+
+	// Writes are still executed without answer
+	if _, err = client.WriteSingleRegister(ctx, 10, 0x5678); !errors.Is(err, modbus.ErrResponseTimeout) {
+		t.Fatalf("expected no response to a broadcast write, got: %v", err)
+	}
+	results, err = client.ReadHoldingRegisters(ctx, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal([]byte{0x56, 0x78}, results) {
+		t.Errorf("expected the broadcast write to be executed, got % x", results)
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license.  See the LICENSE file for details.
+
+package integration
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/lumberbarons/modbus"
+	"github.com/lumberbarons/modbus/internal/simulator"
+	"github.com/lumberbarons/modbus/internal/testutil"
+)
+
+func TestReadHoldingRegistersChunked(t *testing.T) {
+	const address, quantity = 100, 300
+	config := &simulator.DataStoreConfig{HoldingRegs: map[uint16]uint16{}}
+	for i := uint16(0); i < quantity; i++ {
+		config.HoldingRegs[address+i] = 0x1000 + i
+	}
+
+	// Pipelined over TCP, sequential over RTU
+	for _, transport := range []string{"TCP", "RTU"} {
+		t.Run(transport, func(t *testing.T) {
+			cleanup, client, _ := testutil.StartSimulatorClient(t, transport, config, 0)
+			defer cleanup()
+
+			results, err := modbus.ReadHoldingRegistersChunked(context.Background(), client, address, quantity)
+			if err != nil {
+				t.Fatal(err)
+			}
+			AssertEquals(t, 2*quantity, len(results))
+			for i := 0; i < quantity; i++ {
+				if value := binary.BigEndian.Uint16(results[2*i:]); value != 0x1000+uint16(i) {
+					t.Fatalf("register %d: expected 0x%04x, got 0x%04x", address+i, 0x1000+i, value)
+				}
+			}
+		})
+	}
+}
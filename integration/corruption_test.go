@@ -0,0 +1,107 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license.  See the LICENSE file for details.
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/lumberbarons/modbus"
+	"github.com/lumberbarons/modbus/internal/simulator"
+	"github.com/lumberbarons/modbus/internal/testutil"
+)
+
+// corruptingDevice is a client of a serial simulator corrupting responses,
+// and the framing error count of its handler.
+type corruptingDevice struct {
+	client        modbus.Client
+	framingErrors func() uint64
+}
+
+func TestCorruptionProbability(t *testing.T) {
+	const reads = 40
+	config := &simulator.DataStoreConfig{HoldingRegs: map[uint16]uint16{0: 0x1234, 1: 0x5678}}
+	tests := []struct {
+		name  string
+		start func(t *testing.T, seed uint64) corruptingDevice
+	}{
+		{"RTU", func(t *testing.T, seed uint64) corruptingDevice {
+			line := testutil.NewSerialLine()
+			server := simulator.NewRTUServerWithConn(simulator.NewHandlerWithOptions(simulator.NewDataStore(config), true), line.Device(), &simulator.RTUServerConfig{
+				CorruptionProbability: 0.5,
+				Rand:                  rand.New(rand.NewPCG(seed, seed)),
+			})
+			if err := server.Start(); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { server.Stop() })
+			handler := modbus.NewRTUClientHandler("line")
+			handler.SlaveID = 1
+			handler.OpenPort = line.Open
+			t.Cleanup(func() { handler.Close() })
+			return corruptingDevice{modbus.NewClient(handler), handler.FramingErrorCount}
+		}},
+		{"ASCII", func(t *testing.T, seed uint64) corruptingDevice {
+			line := testutil.NewSerialLine()
+			server := simulator.NewASCIIServerWithConn(simulator.NewHandlerWithOptions(simulator.NewDataStore(config), true), line.Device(), &simulator.ASCIIServerConfig{
+				CorruptionProbability: 0.5,
+				Rand:                  rand.New(rand.NewPCG(seed, seed)),
+			})
+			if err := server.Start(); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { server.Stop() })
+			handler := modbus.NewASCIIClientHandler("line")
+			handler.SlaveID = 1
+			handler.OpenPort = line.Open
+			t.Cleanup(func() { handler.Close() })
+			return corruptingDevice{modbus.NewClient(handler), handler.FramingErrorCount}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// outcomes reads from a device seeded with seed and returns
+			// which reads failed
+			outcomes := func(seed uint64) []bool {
+				device := tt.start(t, seed)
+				failed := make([]bool, reads)
+				var failures uint64
+				for i := range failed {
+					results, err := device.client.ReadHoldingRegisters(context.Background(), 0, 2)
+					if err != nil {
+						if !errors.Is(err, modbus.ErrProtocolError) {
+							t.Fatalf("read %d: expected a checksum mismatch, got %v", i, err)
+						}
+						failed[i] = true
+						failures++
+						continue
+					}
+					if !bytes.Equal(results, []byte{0x12, 0x34, 0x56, 0x78}) {
+						t.Fatalf("read %d: corrupted response passed the checksum: % x", i, results)
+					}
+				}
+				if failures == 0 || failures == reads {
+					t.Errorf("expected some of %d reads to fail, %d did", reads, failures)
+				}
+				if count := device.framingErrors(); count != failures {
+					t.Errorf("expected %d framing errors, got %d", failures, count)
+				}
+				return failed
+			}
+
+			// The same seed corrupts the same responses
+			first, second := outcomes(1), outcomes(1)
+			for i := range first {
+				if first[i] != second[i] {
+					t.Fatalf("read %d: outcome differs between runs with the same seed", i)
+				}
+			}
+		})
+	}
+}
@@ -770,3 +770,79 @@ func TestClientWithAddressOverride(t *testing.T) {
 
 	t.Logf("Address override test: register 0 and 100 had different delays as expected")
 }
+
+func TestClientTimeoutErrors(t *testing.T) {
+	// The device answers too late, the error tells whether the context
+	// deadline or the handler read timeout ran out first. The serial
+	// simulators ignore TimeoutProbability, so a delay is used instead.
+	config := &simulator.DataStoreConfig{
+		NamedHoldingRegs: map[uint16]simulator.RegisterConfig{
+			0: {Name: "SLOW_REG", Value: 1},
+		},
+		Delays: &simulator.DelayConfigSet{
+			HoldingRegs: map[uint16]simulator.DelayConfig{
+				0: {Delay: "600ms"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		start func(t *testing.T, timeout time.Duration) (modbus.Client, func())
+	}{
+		{"TCP", func(t *testing.T, timeout time.Duration) (modbus.Client, func()) {
+			cleanup, address := testutil.StartTCPSimulator(t, testutil.WithTCPDataStoreConfig(config))
+			handler := modbus.NewTCPClientHandler(address)
+			handler.Timeout = timeout
+			handler.SlaveID = 1
+			return modbus.NewClient(handler), func() { handler.Close(); cleanup() }
+		}},
+		{"RTU", func(t *testing.T, timeout time.Duration) (modbus.Client, func()) {
+			cleanup, devicePath := testutil.StartRTUSimulator(t, testutil.WithDataStoreConfig(config))
+			handler := modbus.NewRTUClientHandler(devicePath)
+			handler.Timeout = timeout
+			handler.SlaveID = 1
+			return modbus.NewClient(handler), func() { handler.Close(); cleanup() }
+		}},
+		{"ASCII", func(t *testing.T, timeout time.Duration) (modbus.Client, func()) {
+			cleanup, devicePath := testutil.StartASCIISimulator(t, testutil.WithASCIIDataStoreConfig(config))
+			handler := modbus.NewASCIIClientHandler(devicePath)
+			handler.Timeout = timeout
+			handler.SlaveID = 1
+			return modbus.NewClient(handler), func() { handler.Close(); cleanup() }
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+"/ResponseTimeout", func(t *testing.T) {
+			client, cleanup := tt.start(t, 200*time.Millisecond)
+			defer cleanup()
+
+			_, err := client.ReadHoldingRegisters(context.Background(), 0, 1)
+			if !errors.Is(err, modbus.ErrResponseTimeout) {
+				t.Fatalf("expected ErrResponseTimeout, got: %v", err)
+			}
+			if errors.Is(err, modbus.ErrContextDeadline) {
+				t.Errorf("expected no ErrContextDeadline, got: %v", err)
+			}
+		})
+		t.Run(tt.name+"/ContextDeadline", func(t *testing.T) {
+			client, cleanup := tt.start(t, 5*time.Second)
+			defer cleanup()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			start := time.Now()
+			_, err := client.ReadHoldingRegisters(ctx, 0, 1)
+			if !errors.Is(err, modbus.ErrContextDeadline) {
+				t.Fatalf("expected ErrContextDeadline, got: %v", err)
+			}
+			if errors.Is(err, modbus.ErrResponseTimeout) {
+				t.Errorf("expected no ErrResponseTimeout, got: %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("expected the context deadline to end the read, took %v", elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license.  See the LICENSE file for details.
+
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lumberbarons/modbus"
+	"github.com/lumberbarons/modbus/internal/simulator"
+	"github.com/lumberbarons/modbus/internal/testutil"
+)
+
+func TestReadDeviceIdentification(t *testing.T) {
+	objects := map[byte]string{0x00: "Acme", 0x01: "PX-1", 0x02: "1.2", 0x80: string(make([]byte, 200))}
+	config := &simulator.DataStoreConfig{DeviceIdentification: objects}
+
+	for _, transport := range []string{"RTU", "TCP"} {
+		t.Run(transport, func(t *testing.T) {
+			cleanup, client, _ := testutil.StartSimulatorClient(t, transport, config, time.Second)
+			defer cleanup()
+			ctx := context.Background()
+
+			// The extended object doesn't fit with the basic ones and
+			// follows in a second response
+			all, err := modbus.ReadDeviceIdentificationAll(ctx, client, modbus.ReadDeviceIDExtended)
+			if err != nil {
+				t.Fatal(err)
+			}
+			AssertEquals(t, len(objects), len(all))
+			for id, value := range objects {
+				AssertEquals(t, value, string(all[id]))
+			}
+
+			id, err := modbus.ReadDeviceIdentification(ctx, client, modbus.ReadDeviceIDSpecific, 0x01)
+			if err != nil {
+				t.Fatal(err)
+			}
+			AssertEquals(t, byte(0x83), id.ConformityLevel)
+			AssertEquals(t, "PX-1", string(id.Objects[0x01]))
+		})
+	}
+}
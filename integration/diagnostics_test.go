@@ -0,0 +1,94 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license.  See the LICENSE file for details.
+
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lumberbarons/modbus"
+	"github.com/lumberbarons/modbus/internal/simulator"
+	"github.com/lumberbarons/modbus/internal/testutil"
+)
+
+func TestRTUClientListenOnly(t *testing.T) {
+	cleanup, rtuDevice := testutil.StartRTUSimulator(t,
+		testutil.WithSlaveID(5),
+		testutil.WithDataStoreConfig(&simulator.DataStoreConfig{
+			HoldingRegs: map[uint16]uint16{10: 0x1234},
+		}))
+	defer cleanup()
+
+	handler := modbus.NewRTUClientHandler(rtuDevice)
+	handler.SlaveID = 5
+	handler.Timeout = 300 * time.Millisecond
+	defer handler.Close()
+	client := modbus.NewClient(handler)
+	ctx := context.Background()
+
+	if err := modbus.RestartCommunications(ctx, client, false); err != nil {
+		t.Fatalf("restart while online: %v", err)
+	}
+	if err := modbus.ForceListenOnly(ctx, client); err != nil {
+		t.Fatal(err)
+	}
+	// The device now ignores requests
+	if _, err := client.ReadHoldingRegisters(ctx, 10, 1); err == nil {
+		t.Fatal("expected no response in listen only mode")
+	}
+	if err := modbus.RestartCommunications(ctx, client, true); err != nil {
+		t.Fatal(err)
+	}
+	results, err := client.ReadHoldingRegisters(ctx, 10, 1)
+	if err != nil {
+		t.Fatalf("read after restart: %v", err)
+	}
+	AssertEquals(t, 2, len(results))
+	AssertEquals(t, byte(0x12), results[0])
+	AssertEquals(t, byte(0x34), results[1])
+}
+
+func TestSerialExceptionStatusAndCommEventCounter(t *testing.T) {
+	config := &simulator.DataStoreConfig{ExceptionStatus: 0x6D, CommStatus: 0xFFFF}
+
+	for _, transport := range []string{"RTU", "ASCII"} {
+		t.Run(transport, func(t *testing.T) {
+			cleanup, client, _ := testutil.StartSimulatorClient(t, transport, config, 300*time.Millisecond)
+			defer cleanup()
+			ctx := context.Background()
+
+			status, err := modbus.ReadExceptionStatus(ctx, client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			AssertEquals(t, byte(0x6D), status)
+
+			// Exceptions are not counted
+			if _, err = client.ReadHoldingRegisters(ctx, 0, 1); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = client.ReadHoldingRegisters(ctx, 0xFFFF, 2); err == nil {
+				t.Fatal("expected an exception reading past the address space")
+			}
+
+			commStatus, count, err := modbus.GetCommEventCounter(ctx, client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			AssertEquals(t, uint16(0xFFFF), commStatus)
+			AssertEquals(t, uint16(2), count)
+
+			// Restart Communications clears the counter and counts itself
+			if err = modbus.RestartCommunications(ctx, client, false); err != nil {
+				t.Fatal(err)
+			}
+			if _, count, err = modbus.GetCommEventCounter(ctx, client); err != nil {
+				t.Fatal(err)
+			}
+			AssertEquals(t, uint16(1), count)
+		})
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license.  See the LICENSE file for details.
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lumberbarons/modbus"
+	"github.com/lumberbarons/modbus/internal/simulator"
+	"github.com/lumberbarons/modbus/internal/testutil"
+)
+
+func TestGateway(t *testing.T) {
+	cleanup, rtuDevice := testutil.StartRTUSimulator(t,
+		testutil.WithSlaveID(17),
+		testutil.WithDataStoreConfig(&simulator.DataStoreConfig{
+			HoldingRegs: map[uint16]uint16{100: 0x1234, 101: 0x5678},
+		}))
+	defer cleanup()
+
+	rtu := modbus.NewRTUClientHandler(rtuDevice)
+	rtu.Timeout = 500 * time.Millisecond
+	gateway, err := simulator.NewGateway(&simulator.GatewayConfig{
+		Address:  "localhost:0",
+		RTU:      rtu,
+		SlaveMap: map[byte]byte{1: 17, 2: 18},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = gateway.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer gateway.Stop()
+
+	handler := modbus.NewTCPClientHandler(gateway.ConnectAddress())
+	handler.SlaveID = 1
+	defer handler.Close()
+	client := modbus.NewClient(handler)
+	ctx := context.Background()
+
+	results, err := client.ReadHoldingRegisters(ctx, 100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal([]byte{0x12, 0x34, 0x56, 0x78}, results) {
+		t.Fatalf("unexpected results: % x", results)
+	}
+
+	// Exceptions from the device are passed through
+	_, err = client.ReadHoldingRegisters(ctx, 65535, 2)
+	var modbusErr *modbus.ModbusError
+	if !errors.As(err, &modbusErr) || modbusErr.ExceptionCode != modbus.ExceptionCodeIllegalDataAddress {
+		t.Fatalf("expected illegal data address, got %v", err)
+	}
+
+	// Slave 18 does not exist on the serial line
+	handler.SlaveID = 2
+	_, err = client.ReadHoldingRegisters(ctx, 100, 2)
+	if !errors.As(err, &modbusErr) || modbusErr.ExceptionCode != modbus.ExceptionCodeGatewayTargetDeviceFailedToRespond {
+		t.Fatalf("expected gateway target failed to respond, got %v", err)
+	}
+
+	// Unit 3 is not mapped
+	handler.SlaveID = 3
+	_, err = client.ReadHoldingRegisters(ctx, 100, 2)
+	if !errors.As(err, &modbusErr) || modbusErr.ExceptionCode != modbus.ExceptionCodeGatewayPathUnavailable {
+		t.Fatalf("expected gateway path unavailable, got %v", err)
+	}
+}
+
+func TestGatewayBroadcast(t *testing.T) {
+	cleanup, rtuDevice := testutil.StartRTUSimulator(t)
+	defer cleanup()
+
+	// A broadcast waiting out this timeout would hold up the read after it
+	rtu := modbus.NewRTUClientHandler(rtuDevice)
+	rtu.Timeout = 2 * time.Second
+	gateway, err := simulator.NewGateway(&simulator.GatewayConfig{
+		Address: "localhost:0",
+		RTU:     rtu,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = gateway.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer gateway.Stop()
+
+	handler := modbus.NewTCPClientHandler(gateway.ConnectAddress())
+	handler.Timeout = 300 * time.Millisecond
+	defer handler.Close()
+	client := modbus.NewClient(handler)
+	ctx := context.Background()
+
+	// The write is forwarded, but neither the device nor the gateway answers
+	handler.SlaveID = 0
+	if _, err = client.WriteSingleRegister(ctx, 10, 0x1234); !errors.Is(err, modbus.ErrResponseTimeout) {
+		t.Fatalf("expected no response to a broadcast, got: %v", err)
+	}
+
+	handler.SlaveID = 1
+	results, err := client.ReadHoldingRegisters(ctx, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal([]byte{0x12, 0x34}, results) {
+		t.Errorf("expected the broadcast write to be executed, got % x", results)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license.  See the LICENSE file for details.
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lumberbarons/modbus"
+	"github.com/lumberbarons/modbus/internal/simulator"
+	"github.com/lumberbarons/modbus/internal/testutil"
+)
+
+func TestSupportsFunction(t *testing.T) {
+	config := &simulator.DataStoreConfig{
+		Coils:       map[uint16]bool{0: true},
+		HoldingRegs: map[uint16]uint16{0: 0x1234},
+	}
+	supported := []byte{
+		modbus.FuncCodeReadCoils,
+		modbus.FuncCodeReadDiscreteInputs,
+		modbus.FuncCodeReadHoldingRegisters,
+		modbus.FuncCodeReadInputRegisters,
+		modbus.FuncCodeWriteSingleCoil,
+		modbus.FuncCodeWriteMultipleCoils,
+		modbus.FuncCodeWriteMultipleRegisters,
+		modbus.FuncCodeReadWriteMultipleRegisters,
+		modbus.FuncCodeMaskWriteRegister,
+		modbus.FuncCodeReadFileRecord,
+		modbus.FuncCodeWriteFileRecord,
+		modbus.FuncCodeDiagnostics,
+	}
+
+	for _, transport := range []string{"TCP", "RTU"} {
+		t.Run(transport, func(t *testing.T) {
+			cleanup, client, _ := testutil.StartSimulatorClient(t, transport, config, 500*time.Millisecond)
+			defer cleanup()
+			ctx := context.Background()
+
+			for _, functionCode := range supported {
+				ok, err := modbus.SupportsFunction(ctx, client, functionCode)
+				if err != nil {
+					t.Fatalf("function %v: %v", functionCode, err)
+				}
+				if !ok {
+					t.Errorf("function %v: expected to be supported", functionCode)
+				}
+			}
+			if _, err := modbus.SupportsFunction(ctx, client, modbus.FuncCodeWriteSingleRegister); !errors.Is(err, modbus.ErrNotProbeable) {
+				t.Errorf("Write Single Register: expected ErrNotProbeable, got %v", err)
+			}
+			// The simulator answers Read FIFO Queue with IllegalFunction
+			ok, err := modbus.SupportsFunction(ctx, client, modbus.FuncCodeReadFIFOQueue)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok {
+				t.Error("Read FIFO Queue: expected not to be supported")
+			}
+
+			// Probing the write functions doesn't change any data
+			registers, err := client.ReadHoldingRegisters(ctx, 0, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal([]byte{0x12, 0x34}, registers) {
+				t.Errorf("holding register 0: expected 12 34, got % x", registers)
+			}
+			coils, err := client.ReadCoils(ctx, 0, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal([]byte{0x01}, coils) {
+				t.Errorf("coil 0: expected 01, got % x", coils)
+			}
+		})
+	}
+}
@@ -51,3 +51,24 @@ func TestRTUClientAdvancedUsage(t *testing.T) {
 		t.Fatal(err, results)
 	}
 }
+
+func TestRTUClientWarm(t *testing.T) {
+	cleanup, rtuDevice := testutil.StartRTUSimulator(t)
+	defer cleanup()
+
+	handler := modbus.NewRTUClientHandler(rtuDevice)
+	handler.SlaveID = 1
+	defer handler.Close()
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := handler.Warm(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := modbus.NewClient(handler).ReadHoldingRegisters(ctx, 0, 1); err != nil {
+		t.Fatal(err)
+	}
+	// The port opened by Warm is reused
+	AssertEquals(t, uint64(0), handler.Stats().Reconnects)
+}
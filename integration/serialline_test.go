@@ -0,0 +1,122 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license.  See the LICENSE file for details.
+
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lumberbarons/modbus"
+	"github.com/lumberbarons/modbus/internal/simulator"
+	"github.com/lumberbarons/modbus/internal/testutil"
+)
+
+func TestRTUClientSerialLine(t *testing.T) {
+	cleanup, client, handler := testutil.StartRTULineSimulator(t, testutil.WithSlaveID(17))
+	defer cleanup()
+
+	ClientTestAll(t, client)
+
+	// The handler reopens the line after closing it
+	if err := handler.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ReadHoldingRegisters(context.Background(), 0, 2); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestASCIIClientSerialLine(t *testing.T) {
+	line := testutil.NewSerialLine()
+	ds := simulator.NewDataStore(nil)
+	server := simulator.NewASCIIServerWithConn(simulator.NewHandlerWithOptions(ds, true), line.Device(), &simulator.ASCIIServerConfig{SlaveID: 17})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	handler := modbus.NewASCIIClientHandler("line")
+	handler.SlaveID = 17
+	handler.OpenPort = line.Open
+	defer handler.Close()
+	ClientTestAll(t, modbus.NewClient(handler))
+}
+
+// blockingHandler holds every request until its context is done, or
+// ignoring the context until release is closed if it is set.
+type blockingHandler struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (h *blockingHandler) Handle(unitID byte, pdu *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
+	return h.HandleContext(context.Background(), unitID, pdu)
+}
+
+func (h *blockingHandler) HandleContext(ctx context.Context, _ byte, _ *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
+	close(h.started)
+	if h.release != nil {
+		<-h.release
+	} else {
+		<-ctx.Done()
+	}
+	return nil
+}
+
+func TestSerialServerStopCancelsRequest(t *testing.T) {
+	type server interface {
+		Start() error
+		Stop() error
+	}
+	tests := []struct {
+		name  string
+		start func(handler simulator.RequestHandler, line *testutil.SerialLine) (server, modbus.Client, func() error)
+	}{
+		{"RTU", func(handler simulator.RequestHandler, line *testutil.SerialLine) (server, modbus.Client, func() error) {
+			clientHandler := modbus.NewRTUClientHandler("line")
+			clientHandler.OpenPort = line.Open
+			clientHandler.Timeout = 5 * time.Second
+			return simulator.NewRTUServerWithConn(handler, line.Device(), nil), modbus.NewClient(clientHandler), clientHandler.Close
+		}},
+		{"ASCII", func(handler simulator.RequestHandler, line *testutil.SerialLine) (server, modbus.Client, func() error) {
+			clientHandler := modbus.NewASCIIClientHandler("line")
+			clientHandler.OpenPort = line.Open
+			clientHandler.Timeout = 5 * time.Second
+			return simulator.NewASCIIServerWithConn(handler, line.Device(), nil), modbus.NewClient(clientHandler), clientHandler.Close
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, ignoresContext := range []bool{false, true} {
+				handler := &blockingHandler{started: make(chan struct{})}
+				if ignoresContext {
+					handler.release = make(chan struct{})
+				}
+				s, client, closeClient := tt.start(handler, testutil.NewSerialLine())
+				if err := s.Start(); err != nil {
+					t.Fatal(err)
+				}
+				go client.ReadHoldingRegisters(context.Background(), 0, 1)
+				<-handler.started
+
+				start := time.Now()
+				err := s.Stop()
+				elapsed := time.Since(start)
+				if ignoresContext {
+					// The wait for the handler is bounded
+					if err == nil {
+						t.Error("expected an error for a handler that doesn't return")
+					}
+					close(handler.release)
+				} else if err != nil || elapsed > 500*time.Millisecond {
+					t.Errorf("expected the request to be cancelled, got %v after %v", err, elapsed)
+				}
+				closeClient()
+			}
+		})
+	}
+}
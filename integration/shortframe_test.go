@@ -0,0 +1,110 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license.  See the LICENSE file for details.
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lumberbarons/modbus"
+	"github.com/lumberbarons/modbus/internal/simulator"
+)
+
+// startTruncatingDevice answers the first request of requestLength bytes
+// on a pty with a truncated copy of response, then after gap with the full
+// response, and returns the device path for clients.
+func startTruncatingDevice(t *testing.T, requestLength int, response []byte, truncateAt int, gap time.Duration) string {
+	t.Helper()
+	pty, err := simulator.CreatePtyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		pty.Close()
+		<-done
+	})
+
+	go func() {
+		defer close(done)
+		if err := pty.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			return
+		}
+		request := make([]byte, 0, requestLength)
+		buf := make([]byte, requestLength)
+		for len(request) < requestLength {
+			n, err := pty.Read(buf[:requestLength-len(request)])
+			if err != nil {
+				return
+			}
+			request = append(request, buf[:n]...)
+		}
+		pty.Write(response[:truncateAt])
+		time.Sleep(gap)
+		pty.Write(response)
+	}()
+	return pty.SlavePath
+}
+
+func TestShortFrameRetries(t *testing.T) {
+	// The device needs longer than the read timeout to follow up a
+	// truncated response with the full one
+	const (
+		timeout = 300 * time.Millisecond
+		gap     = 450 * time.Millisecond
+	)
+	tests := []struct {
+		name string
+		// start returns a client of a truncating device with the given
+		// number of short frame retries, and a cleanup func
+		start func(t *testing.T, retries int) (modbus.Client, func())
+		// shortFrameErr is the error without retries
+		shortFrameErr error
+	}{
+		{"RTU", func(t *testing.T, retries int) (modbus.Client, func()) {
+			response := []byte{0x01, 0x03, 0x02, 0x12, 0x34, 0xB5, 0x33}
+			handler := modbus.NewRTUClientHandler(startTruncatingDevice(t, 8, response, 5, gap))
+			handler.SlaveID = 1
+			handler.Timeout = timeout
+			handler.ShortFrameRetries = retries
+			return modbus.NewClient(handler), func() { handler.Close() }
+		}, modbus.ErrResponseTimeout},
+		{"ASCII", func(t *testing.T, retries int) (modbus.Client, func()) {
+			response := []byte(":0103021234B4\r\n")
+			handler := modbus.NewASCIIClientHandler(startTruncatingDevice(t, 17, response, 5, gap))
+			handler.SlaveID = 1
+			handler.Timeout = timeout
+			handler.ShortFrameRetries = retries
+			return modbus.NewClient(handler), func() { handler.Close() }
+		}, modbus.ErrShortFrame},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+"/NoRetries", func(t *testing.T) {
+			client, cleanup := tt.start(t, 0)
+			defer cleanup()
+
+			_, err := client.ReadHoldingRegisters(context.Background(), 10, 1)
+			if !errors.Is(err, tt.shortFrameErr) {
+				t.Fatalf("expected %v, got: %v", tt.shortFrameErr, err)
+			}
+		})
+		t.Run(tt.name+"/Retry", func(t *testing.T) {
+			client, cleanup := tt.start(t, 1)
+			defer cleanup()
+
+			results, err := client.ReadHoldingRegisters(context.Background(), 10, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal([]byte{0x12, 0x34}, results) {
+				t.Errorf("expected 12 34, got % x", results)
+			}
+		})
+	}
+}
@@ -5,13 +5,16 @@
 package integration
 
 import (
+	"bytes"
 	"context"
 	"log"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/lumberbarons/modbus"
+	"github.com/lumberbarons/modbus/internal/simulator"
 	"github.com/lumberbarons/modbus/internal/testutil"
 )
 
@@ -49,3 +52,63 @@ func TestTCPClientAdvancedUsage(t *testing.T) {
 		t.Fatal(err, results)
 	}
 }
+
+func TestTCPClientReadMaxCoils(t *testing.T) {
+	const quantity = 2000
+	coils := make(map[uint16]bool)
+	for i := uint16(0); i < quantity; i += 3 {
+		coils[100+i] = true
+	}
+	cleanup, address := testutil.StartTCPSimulator(t, testutil.WithTCPDataStoreConfig(&simulator.DataStoreConfig{
+		Coils: coils,
+	}))
+	defer cleanup()
+
+	client := modbus.TCPClient(address)
+	results, err := client.ReadCoils(context.Background(), 100, quantity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertEquals(t, quantity/8, len(results))
+	for i := 0; i < quantity; i++ {
+		bit := results[i/8]&(1<<uint(i%8)) != 0
+		if bit != (i%3 == 0) {
+			t.Fatalf("coil %d: expected %v, actual %v", 100+i, i%3 == 0, bit)
+		}
+	}
+}
+
+// busyHandler answers the first busy requests with ServerDeviceBusy and
+// the following ones with a register holding 42.
+type busyHandler struct {
+	mu   sync.Mutex
+	busy int
+}
+
+func (h *busyHandler) Handle(_ byte, pdu *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.busy > 0 {
+		h.busy--
+		return modbus.NewExceptionResponse(pdu.FunctionCode, modbus.ExceptionCodeServerDeviceBusy)
+	}
+	return modbus.NewRegisterResponse([]uint16{42})
+}
+
+func TestTCPClientCustomHandler(t *testing.T) {
+	cleanup, address := testutil.StartTCPSimulator(t, testutil.WithTCPHandler(&busyHandler{busy: 2}))
+	defer cleanup()
+
+	handler := modbus.NewTCPClientHandler(address)
+	handler.SlaveID = 1
+	defer handler.Close()
+	client := modbus.NewClientWithBusyRetries(handler, 2, 10*time.Millisecond)
+
+	results, err := client.ReadHoldingRegisters(context.Background(), 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal([]byte{0x00, 0x2A}, results) {
+		t.Errorf("expected 00 2a, got % x", results)
+	}
+}
@@ -6,10 +6,13 @@ package simulator
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math/rand/v2"
 	"os"
 	"strings"
 	"time"
@@ -20,19 +23,34 @@ import (
 const (
 	asciiStart   = ":"
 	asciiEnd     = "\r\n"
-	asciiMinSize = 11 // :AAFFDD..LRC\r\n minimum (1+2+2+2+2+2 = 11)
+	asciiMinSize = 9 // :AAFFLL\r\n minimum, a request without data (1+2+2+2+2 = 9)
 	asciiMaxSize = 513
 )
 
 // ASCIIServer implements a Modbus ASCII server.
 type ASCIIServer struct {
-	handler  *Handler
-	pty      *PtyPair
-	slaveID  byte
-	baudRate int
-	logger   *log.Logger
-	stopChan chan struct{}
-	doneChan chan struct{}
+	handler RequestHandler
+	conn    ServerConn
+	// pty is the pseudo-terminal whose master side is conn, nil when
+	// serving a connection passed to NewASCIIServerWithConn
+	pty        *PtyPair
+	slaveID    byte
+	baudRate   int
+	logger     *log.Logger
+	requestLog *requestLogger
+	stopChan   chan struct{}
+	doneChan   chan struct{}
+	// ctx is passed to the handler and cancelled by Stop, so that the
+	// request in flight is abandoned
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// respondToBroadcastReads answers read requests sent to unit 0
+	respondToBroadcastReads bool
+	// logLevel is the verbosity of the log
+	logLevel LogLevel
+	// corrupter alters responses with CorruptionProbability
+	corrupter *corrupter
 }
 
 // ASCIIServerConfig holds configuration for the ASCII server.
@@ -40,10 +58,47 @@ type ASCIIServerConfig struct {
 	SlaveID  byte
 	BaudRate int
 	Logger   *log.Logger
+	// RequestLog, if set, receives one JSON line per handled request
+	RequestLog io.Writer
+	// RespondToBroadcastReads answers read requests sent to unit 0, the
+	// broadcast address, like nonconforming gateways treating it as any
+	// device. Other broadcast requests are still executed without answer.
+	RespondToBroadcastReads bool
+	// LogLevel selects the verbosity of the log. LogLevelDebug logs a
+	// decoded summary of every request and response.
+	LogLevel LogLevel
+	// CorruptionProbability is the probability, from 0 to 1, that a byte
+	// of the data or LRC of a response is altered before it is sent, to
+	// exercise the LRC handling of clients. The default 0 sends every
+	// response intact.
+	CorruptionProbability float64
+	// Rand is the random source of CorruptionProbability, nil for a
+	// randomly seeded one. Tests set a seeded one to be reproducible.
+	Rand *rand.Rand
 }
 
 // NewASCIIServer creates a new ASCII server with the given data store and configuration.
 func NewASCIIServer(ds *DataStore, config *ASCIIServerConfig) (*ASCIIServer, error) {
+	// Disable timeout simulation for ASCII (PTYs don't support it)
+	return NewASCIIServerWithHandler(NewHandlerWithOptions(ds, true), config)
+}
+
+// NewASCIIServerWithHandler creates a new ASCII server dispatching requests to
+// handler.
+func NewASCIIServerWithHandler(handler RequestHandler, config *ASCIIServerConfig) (*ASCIIServer, error) {
+	pty, err := CreatePtyPair()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pty: %w", err)
+	}
+	s := NewASCIIServerWithConn(handler, pty, config)
+	s.pty = pty
+	return s, nil
+}
+
+// NewASCIIServerWithConn creates a new ASCII server dispatching requests read
+// from conn, the device end of a serial line such as an in-memory one, to
+// handler. The server has no client device path; Stop closes conn.
+func NewASCIIServerWithConn(handler RequestHandler, conn ServerConn, config *ASCIIServerConfig) *ASCIIServer {
 	if config == nil {
 		config = &ASCIIServerConfig{}
 	}
@@ -57,61 +112,75 @@ func NewASCIIServer(ds *DataStore, config *ASCIIServerConfig) (*ASCIIServer, err
 		config.Logger = log.New(os.Stdout, "ascii-server: ", log.LstdFlags)
 	}
 
-	pty, err := CreatePtyPair()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create pty: %w", err)
-	}
-
+	ctx, cancel := context.WithCancel(context.Background())
 	return &ASCIIServer{
-		handler:  NewHandlerWithOptions(ds, true), // Disable timeout simulation for ASCII (PTYs don't support it)
-		pty:      pty,
-		slaveID:  config.SlaveID,
-		baudRate: config.BaudRate,
-		logger:   config.Logger,
-		stopChan: make(chan struct{}),
-		doneChan: make(chan struct{}),
-	}, nil
+		// Timeout simulation doesn't work over serial lines
+		handler:                 serverHandler(handler, true),
+		conn:                    conn,
+		slaveID:                 config.SlaveID,
+		baudRate:                config.BaudRate,
+		logger:                  config.Logger,
+		requestLog:              newRequestLogger(config.RequestLog),
+		stopChan:                make(chan struct{}),
+		doneChan:                make(chan struct{}),
+		ctx:                     ctx,
+		cancel:                  cancel,
+		respondToBroadcastReads: config.RespondToBroadcastReads,
+		logLevel:                config.LogLevel,
+		corrupter:               newCorrupter(config.CorruptionProbability, config.Rand),
+	}
 }
 
-// ClientDevicePath returns the device path that clients should connect to.
+// ClientDevicePath returns the device path that clients should connect to,
+// or "" for a server created with NewASCIIServerWithConn.
 func (s *ASCIIServer) ClientDevicePath() string {
+	if s.pty == nil {
+		return ""
+	}
 	return s.pty.SlavePath
 }
 
 // Start starts the ASCII server in a goroutine.
 func (s *ASCIIServer) Start() error {
 	go s.serve()
-	// Give the server and pty time to fully initialize
-	time.Sleep(200 * time.Millisecond)
+	if s.pty != nil {
+		// Give the server and pty time to fully initialize
+		time.Sleep(200 * time.Millisecond)
+	}
 	return nil
 }
 
-// Stop stops the ASCII server and waits for it to finish.
+// Stop stops the ASCII server and waits for it to finish. The request in
+// flight, if any, is cancelled; an error is returned if its handler
+// doesn't return within serverStopTimeout.
 func (s *ASCIIServer) Stop() error {
 	close(s.stopChan)
+	s.cancel()
 
 	// Close the pty to unblock any pending reads
-	if err := s.pty.Close(); err != nil {
+	if err := s.conn.Close(); err != nil {
 		s.logger.Printf("error closing pty: %v", err)
 	}
 
-	// Wait for server goroutine to finish with a timeout
+	// Closing the non-blocking pty interrupts any pending read, so serve
+	// returns as soon as the request in flight, if any, is abandoned
 	select {
 	case <-s.doneChan:
-		// Clean shutdown
-	case <-time.After(1 * time.Second):
-		// Timeout - the goroutine is stuck in a blocking read
-		s.logger.Printf("ASCII server stop timed out (goroutine may still be reading)")
+		return nil
+	case <-time.After(serverStopTimeout):
+		return fmt.Errorf("ASCII server still handling a request after %v", serverStopTimeout)
 	}
-
-	return nil
 }
 
 // serve is the main server loop that reads requests and sends responses.
 func (s *ASCIIServer) serve() {
 	defer close(s.doneChan)
 
-	s.logger.Printf("ASCII server listening - server pty: %s, client pty: %s (slave ID: %d)", s.pty.MasterPath, s.pty.SlavePath, s.slaveID)
+	if s.pty != nil {
+		s.logger.Printf("ASCII server listening - server pty: %s, client pty: %s (slave ID: %d)", s.pty.MasterPath, s.pty.SlavePath, s.slaveID)
+	} else {
+		s.logger.Printf("ASCII server listening (slave ID: %d)", s.slaveID)
+	}
 
 	for {
 		select {
@@ -134,7 +203,7 @@ func (s *ASCIIServer) serve() {
 // handleRequest reads a single request frame and sends a response.
 func (s *ASCIIServer) handleRequest() error {
 	// Set read timeout to allow checking stopChan periodically
-	if err := s.pty.SetReadDeadline(time.Now().Add(500 * time.Millisecond)); err != nil {
+	if err := s.conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond)); err != nil {
 		// Ignore deadline errors - not critical (ptys don't support deadlines)
 		s.logger.Printf("warning: failed to set read deadline: %v", err)
 	}
@@ -147,7 +216,7 @@ func (s *ASCIIServer) handleRequest() error {
 			return nil
 		}
 		// Check if error is due to closed file
-		if err == io.EOF || err == os.ErrClosed {
+		if err == io.EOF || errors.Is(err, os.ErrClosed) {
 			return io.EOF
 		}
 		s.logger.Printf("error reading frame: %v", err)
@@ -173,25 +242,42 @@ func (s *ASCIIServer) handleRequest() error {
 	}
 
 	// Handle the request
-	responsePDU := s.handler.HandleRequest(pdu)
+	unitID := s.slaveID
+	if string(slaveID) == "00" {
+		unitID = broadcastAddress
+	}
+	responsePDU := handleContext(s.handler)(s.ctx, unitID, pdu)
+	if !answersRequest(unitID, pdu, s.respondToBroadcastReads) {
+		responsePDU = nil
+	}
+	s.requestLog.log(unitID, pdu, responsePDU)
+	logExchange(s.logger, s.logLevel, unitID, pdu, responsePDU)
 
-	// Check if timeout simulation (no response)
+	// Check if no response should be sent (timeout simulation, listen only
+	// mode or broadcast)
 	if responsePDU == nil {
 		// Don't send any response - simulate timeout
 		return nil
 	}
 
-	// Encode the response
+	// Encode the response, from unit 0 for an answered broadcast read
+	packager.SlaveID = unitID
 	responseADU, err := packager.Encode(responsePDU)
 	if err != nil {
 		s.logger.Printf("failed to encode response: %v", err)
 		return nil
 	}
 
+	// Alter a hex digit of the data or LRC, keeping the slave ID,
+	// function code and line ending
+	if s.corrupter.flipHex(responseADU, 5, len(responseADU)-2) {
+		s.logger.Printf("corrupting response")
+	}
+
 	s.logger.Printf("sending: %s", strings.TrimSpace(string(responseADU)))
 
 	// Send the response
-	n, err := s.pty.Write(responseADU)
+	n, err := s.conn.Write(responseADU)
 	if err != nil {
 		return fmt.Errorf("failed to write response: %w", err)
 	}
@@ -208,7 +294,7 @@ func (s *ASCIIServer) readFrame() ([]byte, error) {
 
 	// Read until we find the start character ':'
 	for {
-		n, err := s.pty.Read(tmpBuf)
+		n, err := s.conn.Read(tmpBuf)
 		if err != nil {
 			return nil, err
 		}
@@ -220,7 +306,7 @@ func (s *ASCIIServer) readFrame() ([]byte, error) {
 
 	// Read until we find CRLF
 	for {
-		n, err := s.pty.Read(tmpBuf)
+		n, err := s.conn.Read(tmpBuf)
 		if err != nil {
 			return nil, err
 		}
@@ -233,6 +319,9 @@ func (s *ASCIIServer) readFrame() ([]byte, error) {
 			}
 			// Safety check to prevent reading too much
 			if buffer.Len() > asciiMaxSize {
+				if ds := dataStoreOf(s.handler); ds != nil {
+					ds.CountOverrun()
+				}
 				return nil, fmt.Errorf("frame too large: %d bytes", buffer.Len())
 			}
 		}
@@ -273,7 +362,7 @@ func (p *asciiPackager) Encode(pdu *modbus.ProtocolDataUnit) ([]byte, error) {
 
 // Decode decodes an ASCII frame into a PDU and verifies the LRC.
 func (p *asciiPackager) Decode(adu []byte) (*modbus.ProtocolDataUnit, error) {
-	// Check minimum length: :<2 hex chars for ID><2 hex chars for FC><2 hex chars for LRC>\r\n = 11 chars
+	// Check minimum length: :<2 hex chars for ID><2 hex chars for FC><2 hex chars for LRC>\r\n = 9 chars
 	if len(adu) < asciiMinSize {
 		return nil, fmt.Errorf("frame too short: %d bytes", len(adu))
 	}
@@ -0,0 +1,23 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package simulator
+
+import (
+	"io"
+	"time"
+)
+
+// ServerConn is the device end of a serial line, from which the RTU and
+// ASCII servers read requests and to which they write responses. Reads past
+// the read deadline fail with an error satisfying os.IsTimeout, and reads
+// after Close with io.EOF or os.ErrClosed. The master side of a PtyPair is
+// one.
+type ServerConn interface {
+	io.ReadWriteCloser
+	SetReadDeadline(t time.Time) error
+	Sync() error
+}
+
+var _ ServerConn = (*PtyPair)(nil)
@@ -0,0 +1,72 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package simulator
+
+import (
+	"math/rand/v2"
+	"sync"
+)
+
+// hexDigits are the characters of an ASCII frame between its start and
+// line ending.
+const hexDigits = "0123456789ABCDEF"
+
+// corrupter alters encoded responses with a probability, to exercise the
+// checksum handling of clients. A nil corrupter alters nothing.
+type corrupter struct {
+	mu          sync.Mutex
+	probability float64
+	rng         *rand.Rand
+}
+
+// newCorrupter returns a corrupter drawing from rng, or from a randomly
+// seeded source if rng is nil. It returns nil if probability is not
+// positive.
+func newCorrupter(probability float64, rng *rand.Rand) *corrupter {
+	if probability <= 0 {
+		return nil
+	}
+	if rng == nil {
+		rng = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+	return &corrupter{probability: probability, rng: rng}
+}
+
+// flip flips the bits of a random byte of frame[start:end] with the
+// corrupter's probability and reports whether it did.
+func (c *corrupter) flip(frame []byte, start, end int) bool {
+	if c == nil || end <= start {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rng.Float64() >= c.probability {
+		return false
+	}
+	// A nonzero mask always changes the byte
+	frame[start+c.rng.IntN(end-start)] ^= byte(1 + c.rng.IntN(255))
+	return true
+}
+
+// flipHex replaces a random character of the hex encoded frame[start:end]
+// with another hex digit, so that the frame still decodes but fails its
+// LRC, with the corrupter's probability, and reports whether it did.
+func (c *corrupter) flipHex(frame []byte, start, end int) bool {
+	if c == nil || end <= start {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rng.Float64() >= c.probability {
+		return false
+	}
+	i := start + c.rng.IntN(end-start)
+	digit := c.rng.IntN(len(hexDigits) - 1)
+	if hexDigits[digit] == frame[i] {
+		digit = len(hexDigits) - 1
+	}
+	frame[i] = hexDigits[digit]
+	return true
+}
@@ -5,10 +5,16 @@
 package simulator
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"maps"
 	"math/rand/v2"
+	"slices"
 	"sync"
 	"time"
+
+	"github.com/lumberbarons/modbus"
 )
 
 const (
@@ -22,7 +28,10 @@ const (
 // - Discrete Inputs: read-only single bits (function code 2)
 // - Holding Registers: read/write 16-bit registers (function codes 3, 6, 16, 22, 23)
 // - Input Registers: read-only 16-bit registers (function code 4)
+//
+// It also holds file records accessed with function codes 20 and 21.
 type DataStore struct {
+	// mu guards everything but the register values
 	mu sync.RWMutex
 
 	coils          []bool
@@ -30,17 +39,82 @@ type DataStore struct {
 	holdingRegs    []uint16
 	inputRegs      []uint16
 
+	// Register values are guarded per address range, so reads of one
+	// range don't wait for writes to another
+	coilLocks          rangeLock
+	discreteInputLocks rangeLock
+	holdingRegLocks    rangeLock
+	inputRegLocks      rangeLock
+
 	// Register names for logging/debugging
 	coilNames          map[uint16]string
 	discreteInputNames map[uint16]string
 	holdingRegNames    map[uint16]string
 	inputRegNames      map[uint16]string
 
+	// File records, keyed by file number then record number
+	files map[uint16]map[uint16][]uint16
+
 	// Delay and timeout configuration
 	delayConfig *DelayConfigSet
+	// Delays by function code, taking precedence over delayConfig
+	functionDelays map[byte]DelayConfig
 
 	// Random number generator for delay/timeout simulation
 	rng *rand.Rand
+	// Clock timing the delays
+	clock modbus.Clock
+
+	// listenOnly is set by the Force Listen Only Mode diagnostic and cleared
+	// by Restart Communications Option. While set, no responses are sent.
+	listenOnly bool
+
+	// overrunCount counts received frames that overflowed the receive
+	// buffer, until cleared by the Clear Overrun Counter and Flag diagnostic
+	overrunCount uint16
+
+	// Behavior for unsupported function codes
+	defaultException byte
+	silentOnUnknown  bool
+
+	// Reject Write Multiple Coils requests with set padding bits
+	strictCoilPadding bool
+
+	// Accept zero-quantity Write Multiple Coils/Registers requests as no-ops
+	allowEmptyWrites bool
+
+	// Exception codes for out of range quantities, by register type
+	quantityExceptionCodes map[RegisterType]byte
+
+	// Value returned by the Return Diagnostic Register diagnostic
+	diagnosticRegister uint16
+
+	// Values returned by Read Exception Status, Get Comm Event Counter and
+	// Get Comm Event Log
+	exceptionStatus uint8
+	commStatus      uint16
+
+	// commEventCount counts successfully completed requests, until
+	// cleared by Restart Communications Option
+	commEventCount uint16
+	// messageCount counts received requests and commEventLog holds their
+	// function codes, most recent first, for Get Comm Event Log
+	messageCount uint16
+	commEventLog []byte
+
+	// Canned response data replacing normal handling of matching requests
+	rawResponses map[rawResponseKey][]byte
+
+	// Objects served by Read Device Identification, by object id, and the
+	// handlers of other MEI types of Encapsulated Interface Transport
+	deviceIdentification map[byte][]byte
+	meiHandlers          map[byte]func(data []byte) []byte
+}
+
+// rawResponseKey identifies the requests a raw response is returned for.
+type rawResponseKey struct {
+	functionCode byte
+	address      uint16
 }
 
 // RegisterConfig represents a named register with an initial value.
@@ -65,6 +139,31 @@ type DelayConfig struct {
 	// TimeoutProbability (0.0-1.0) is the probability of not responding at all
 	// e.g., 0.3 means 30% of requests will timeout
 	TimeoutProbability float64 `json:"timeoutProbability,omitempty"`
+
+	// delay is Delay parsed by NewDataStore, zero if it is invalid
+	delay time.Duration
+}
+
+// parsed returns c with Delay parsed.
+func (c DelayConfig) parsed() DelayConfig {
+	c.delay = 0
+	if d, err := time.ParseDuration(c.Delay); err == nil {
+		c.delay = d
+	}
+	return c
+}
+
+// parseDelays returns a copy of configs with the delays parsed, so that
+// requests don't parse them again.
+func parseDelays[K comparable](configs map[K]DelayConfig) map[K]DelayConfig {
+	if configs == nil {
+		return nil
+	}
+	parsed := make(map[K]DelayConfig, len(configs))
+	for key, cfg := range configs {
+		parsed[key] = cfg.parsed()
+	}
+	return parsed
 }
 
 // RegisterType identifies one of the four Modbus register types.
@@ -106,8 +205,118 @@ type DataStoreConfig struct {
 	NamedHoldingRegs    map[uint16]RegisterConfig `json:"NamedHoldingRegs,omitempty"`
 	NamedInputRegs      map[uint16]RegisterConfig `json:"NamedInputRegs,omitempty"`
 
+	// Files holds the file records served by Read/Write File Record,
+	// keyed by file number then record number. Each record is a sequence
+	// of registers; writes can't grow a record or create new ones.
+	Files map[uint16]map[uint16][]uint16 `json:"files,omitempty"`
+
 	// Delay and timeout configuration
 	Delays *DelayConfigSet `json:"delays,omitempty"`
+	// FunctionDelays configures delays by function code, applied to every
+	// request with that function code instead of the per-address and
+	// global delays, e.g. to make all writes slow like flash commits.
+	FunctionDelays map[byte]DelayConfig `json:"functionDelays,omitempty"`
+
+	// DefaultException is the exception code returned for unsupported
+	// function codes. Defaults to IllegalFunction (0x01).
+	DefaultException byte `json:"defaultException,omitempty"`
+	// SilentOnUnknown drops requests with unsupported function codes
+	// without responding, overriding DefaultException.
+	SilentOnUnknown bool `json:"silentOnUnknown,omitempty"`
+	// StrictCoilPadding rejects Write Multiple Coils requests whose last
+	// byte has bits set beyond the quantity with IllegalDataValue, as
+	// required by conformance test suites.
+	StrictCoilPadding bool `json:"strictCoilPadding,omitempty"`
+	// AllowEmptyWrites accepts Write Multiple Coils and Write Multiple
+	// Registers requests with a quantity of 0, echoing the address and
+	// quantity without writing anything, like some lenient firmware. By
+	// default they are rejected with IllegalDataValue.
+	AllowEmptyWrites bool `json:"allowEmptyWrites,omitempty"`
+	// QuantityExceptionCodes are the exception codes returned, by register
+	// type, for requests whose quantity is out of range, e.g.
+	// IllegalDataAddress (0x02) for devices reporting oversized reads that
+	// way. Register types not listed use IllegalDataValue (0x03).
+	QuantityExceptionCodes map[RegisterType]byte `json:"quantityExceptionCodes,omitempty"`
+	// DiagnosticRegister is the value returned by the Return Diagnostic
+	// Register diagnostic (sub-function 0x0002).
+	DiagnosticRegister uint16 `json:"diagnosticRegister,omitempty"`
+	// ExceptionStatus is the value of the eight exception status outputs
+	// returned by Read Exception Status (function code 0x07).
+	ExceptionStatus uint8 `json:"exceptionStatus,omitempty"`
+	// CommStatus is the status word returned by Get Comm Event Counter
+	// (function code 0x0B) and Get Comm Event Log (function code 0x0C):
+	// 0xFFFF while busy, 0x0000 otherwise.
+	CommStatus uint16 `json:"commStatus,omitempty"`
+	// CommEventCount and MessageCount are the initial values of the event
+	// count and message count returned by Get Comm Event Log, as if that
+	// many requests had been handled before the simulator started.
+	CommEventCount uint16 `json:"commEventCount,omitempty"`
+	MessageCount   uint16 `json:"messageCount,omitempty"`
+	// DeviceIdentification holds the objects returned by Read Device
+	// Identification (MEI type 0x0E), keyed by object id: 0x00-0x02 are
+	// the basic vendor name, product code and revision, 0x03-0x7F the
+	// regular and 0x80-0xFF the extended objects. Values longer than fit
+	// in a response are truncated. Without it the request is handled like
+	// an unsupported function code.
+	DeviceIdentification map[byte]string `json:"deviceIdentification,omitempty"`
+}
+
+// Validate checks the delay configuration: every delay must be a valid
+// duration, jitter must be within 0-100 and timeout probability within
+// 0.0-1.0. All problems found are returned together.
+func (c *DataStoreConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	var errs []error
+	for functionCode, cfg := range c.FunctionDelays {
+		if err := cfg.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("functionDelays.%d: %w", functionCode, err))
+		}
+	}
+	if c.Delays == nil {
+		return errors.Join(errs...)
+	}
+	for regType, cfg := range c.Delays.Global {
+		if err := cfg.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("delays.global.%s: %w", regType, err))
+		}
+	}
+	for _, set := range []struct {
+		name    string
+		configs map[uint16]DelayConfig
+	}{
+		{"coils", c.Delays.Coils},
+		{"discreteInputs", c.Delays.DiscreteInputs},
+		{"holdingRegs", c.Delays.HoldingRegs},
+		{"inputRegs", c.Delays.InputRegs},
+	} {
+		for addr, cfg := range set.configs {
+			if err := cfg.validate(); err != nil {
+				errs = append(errs, fmt.Errorf("delays.%s.%d: %w", set.name, addr, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validate checks a single delay configuration.
+func (c DelayConfig) validate() error {
+	var errs []error
+	if c.Delay != "" {
+		if d, err := time.ParseDuration(c.Delay); err != nil {
+			errs = append(errs, fmt.Errorf("invalid delay %q: %w", c.Delay, err))
+		} else if d < 0 {
+			errs = append(errs, fmt.Errorf("delay %q must not be negative", c.Delay))
+		}
+	}
+	if c.Jitter < 0 || c.Jitter > 100 {
+		errs = append(errs, fmt.Errorf("jitter %d must be between 0 and 100", c.Jitter))
+	}
+	if c.TimeoutProbability < 0 || c.TimeoutProbability > 1 {
+		errs = append(errs, fmt.Errorf("timeout probability %v must be between 0.0 and 1.0", c.TimeoutProbability))
+	}
+	return errors.Join(errs...)
 }
 
 // NewDataStore creates a new DataStore with optional initial configuration.
@@ -121,12 +330,48 @@ func NewDataStore(config *DataStoreConfig) *DataStore {
 		discreteInputNames: make(map[uint16]string),
 		holdingRegNames:    make(map[uint16]string),
 		inputRegNames:      make(map[uint16]string),
+		files:              make(map[uint16]map[uint16][]uint16),
 		rng:                rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())),
+		defaultException:   modbus.ExceptionCodeIllegalFunction,
+		clock:              modbus.SystemClock{},
 	}
 
 	if config != nil {
+		if config.DefaultException != 0 {
+			ds.defaultException = config.DefaultException
+		}
+		ds.silentOnUnknown = config.SilentOnUnknown
+		ds.strictCoilPadding = config.StrictCoilPadding
+		ds.allowEmptyWrites = config.AllowEmptyWrites
+		ds.quantityExceptionCodes = maps.Clone(config.QuantityExceptionCodes)
+		ds.diagnosticRegister = config.DiagnosticRegister
+		ds.exceptionStatus = config.ExceptionStatus
+		ds.commStatus = config.CommStatus
+		ds.commEventCount = config.CommEventCount
+		ds.messageCount = config.MessageCount
+		for id, value := range config.DeviceIdentification {
+			if ds.deviceIdentification == nil {
+				ds.deviceIdentification = make(map[byte][]byte, len(config.DeviceIdentification))
+			}
+			ds.deviceIdentification[id] = []byte(value[:min(len(value), maxDeviceIDObjectSize)])
+		}
 		// Store delay configuration
-		ds.delayConfig = config.Delays
+		if delays := config.Delays; delays != nil {
+			ds.delayConfig = &DelayConfigSet{
+				Global:         parseDelays(delays.Global),
+				Coils:          parseDelays(delays.Coils),
+				DiscreteInputs: parseDelays(delays.DiscreteInputs),
+				HoldingRegs:    parseDelays(delays.HoldingRegs),
+				InputRegs:      parseDelays(delays.InputRegs),
+			}
+		}
+		ds.functionDelays = parseDelays(config.FunctionDelays)
+		for file, records := range config.Files {
+			ds.files[file] = make(map[uint16][]uint16, len(records))
+			for record, values := range records {
+				ds.files[file][record] = append([]uint16(nil), values...)
+			}
+		}
 		// Legacy format (backward compatibility)
 		for addr, val := range config.Coils {
 			ds.coils[addr] = val
@@ -173,13 +418,13 @@ func NewDataStore(config *DataStoreConfig) *DataStore {
 
 // ReadCoils reads quantity coils starting at address.
 func (ds *DataStore) ReadCoils(address, quantity uint16) ([]bool, error) {
-	ds.mu.RLock()
-	defer ds.mu.RUnlock()
-
 	if err := ds.validateRange(address, quantity); err != nil {
 		return nil, err
 	}
 
+	ds.coilLocks.rlock(address, quantity)
+	defer ds.coilLocks.runlock(address, quantity)
+
 	result := make([]bool, quantity)
 	for i := uint16(0); i < quantity; i++ {
 		result[i] = ds.coils[address+i]
@@ -189,13 +434,13 @@ func (ds *DataStore) ReadCoils(address, quantity uint16) ([]bool, error) {
 
 // ReadDiscreteInputs reads quantity discrete inputs starting at address.
 func (ds *DataStore) ReadDiscreteInputs(address, quantity uint16) ([]bool, error) {
-	ds.mu.RLock()
-	defer ds.mu.RUnlock()
-
 	if err := ds.validateRange(address, quantity); err != nil {
 		return nil, err
 	}
 
+	ds.discreteInputLocks.rlock(address, quantity)
+	defer ds.discreteInputLocks.runlock(address, quantity)
+
 	result := make([]bool, quantity)
 	for i := uint16(0); i < quantity; i++ {
 		result[i] = ds.discreteInputs[address+i]
@@ -205,13 +450,13 @@ func (ds *DataStore) ReadDiscreteInputs(address, quantity uint16) ([]bool, error
 
 // ReadHoldingRegisters reads quantity holding registers starting at address.
 func (ds *DataStore) ReadHoldingRegisters(address, quantity uint16) ([]uint16, error) {
-	ds.mu.RLock()
-	defer ds.mu.RUnlock()
-
 	if err := ds.validateRange(address, quantity); err != nil {
 		return nil, err
 	}
 
+	ds.holdingRegLocks.rlock(address, quantity)
+	defer ds.holdingRegLocks.runlock(address, quantity)
+
 	result := make([]uint16, quantity)
 	for i := uint16(0); i < quantity; i++ {
 		result[i] = ds.holdingRegs[address+i]
@@ -221,13 +466,13 @@ func (ds *DataStore) ReadHoldingRegisters(address, quantity uint16) ([]uint16, e
 
 // ReadInputRegisters reads quantity input registers starting at address.
 func (ds *DataStore) ReadInputRegisters(address, quantity uint16) ([]uint16, error) {
-	ds.mu.RLock()
-	defer ds.mu.RUnlock()
-
 	if err := ds.validateRange(address, quantity); err != nil {
 		return nil, err
 	}
 
+	ds.inputRegLocks.rlock(address, quantity)
+	defer ds.inputRegLocks.runlock(address, quantity)
+
 	result := make([]uint16, quantity)
 	for i := uint16(0); i < quantity; i++ {
 		result[i] = ds.inputRegs[address+i]
@@ -237,8 +482,12 @@ func (ds *DataStore) ReadInputRegisters(address, quantity uint16) ([]uint16, err
 
 // WriteSingleCoil writes a single coil at address.
 func (ds *DataStore) WriteSingleCoil(address uint16, value bool) error {
-	ds.mu.Lock()
-	defer ds.mu.Unlock()
+	if err := ds.validateAddress(address); err != nil {
+		return err
+	}
+
+	ds.coilLocks.lock(address, 1)
+	defer ds.coilLocks.unlock(address, 1)
 
 	ds.coils[address] = value
 	return nil
@@ -246,14 +495,14 @@ func (ds *DataStore) WriteSingleCoil(address uint16, value bool) error {
 
 // WriteMultipleCoils writes multiple coils starting at address.
 func (ds *DataStore) WriteMultipleCoils(address uint16, values []bool) error {
-	ds.mu.Lock()
-	defer ds.mu.Unlock()
-
 	quantity := uint16(len(values))
 	if err := ds.validateRange(address, quantity); err != nil {
 		return err
 	}
 
+	ds.coilLocks.lock(address, quantity)
+	defer ds.coilLocks.unlock(address, quantity)
+
 	for i := uint16(0); i < quantity; i++ {
 		ds.coils[address+i] = values[i]
 	}
@@ -262,8 +511,12 @@ func (ds *DataStore) WriteMultipleCoils(address uint16, values []bool) error {
 
 // WriteSingleRegister writes a single holding register at address.
 func (ds *DataStore) WriteSingleRegister(address, value uint16) error {
-	ds.mu.Lock()
-	defer ds.mu.Unlock()
+	if err := ds.validateAddress(address); err != nil {
+		return err
+	}
+
+	ds.holdingRegLocks.lock(address, 1)
+	defer ds.holdingRegLocks.unlock(address, 1)
 
 	ds.holdingRegs[address] = value
 	return nil
@@ -271,14 +524,14 @@ func (ds *DataStore) WriteSingleRegister(address, value uint16) error {
 
 // WriteMultipleRegisters writes multiple holding registers starting at address.
 func (ds *DataStore) WriteMultipleRegisters(address uint16, values []uint16) error {
-	ds.mu.Lock()
-	defer ds.mu.Unlock()
-
 	quantity := uint16(len(values))
 	if err := ds.validateRange(address, quantity); err != nil {
 		return err
 	}
 
+	ds.holdingRegLocks.lock(address, quantity)
+	defer ds.holdingRegLocks.unlock(address, quantity)
+
 	for i := uint16(0); i < quantity; i++ {
 		ds.holdingRegs[address+i] = values[i]
 	}
@@ -287,8 +540,12 @@ func (ds *DataStore) WriteMultipleRegisters(address uint16, values []uint16) err
 
 // MaskWriteRegister performs an AND/OR mask write on a holding register.
 func (ds *DataStore) MaskWriteRegister(address, andMask, orMask uint16) error {
-	ds.mu.Lock()
-	defer ds.mu.Unlock()
+	if err := ds.validateAddress(address); err != nil {
+		return err
+	}
+
+	ds.holdingRegLocks.lock(address, 1)
+	defer ds.holdingRegLocks.unlock(address, 1)
 
 	// result = (current AND andMask) OR (orMask AND (NOT andMask))
 	current := ds.holdingRegs[address]
@@ -297,6 +554,48 @@ func (ds *DataStore) MaskWriteRegister(address, andMask, orMask uint16) error {
 	return nil
 }
 
+// ReadFileRecord reads length registers from the start of a file record.
+func (ds *DataStore) ReadFileRecord(file, record, length uint16) ([]uint16, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	values, err := ds.fileRecord(file, record, length)
+	if err != nil {
+		return nil, err
+	}
+	return append([]uint16(nil), values[:length]...), nil
+}
+
+// WriteFileRecord overwrites the start of a file record with values.
+func (ds *DataStore) WriteFileRecord(file, record uint16, values []uint16) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	stored, err := ds.fileRecord(file, record, uint16(len(values)))
+	if err != nil {
+		return err
+	}
+	copy(stored, values)
+	return nil
+}
+
+// fileRecord returns a file record holding at least length registers.
+// Caller must hold the mutex.
+func (ds *DataStore) fileRecord(file, record, length uint16) ([]uint16, error) {
+	records, ok := ds.files[file]
+	if !ok {
+		return nil, fmt.Errorf("file %d does not exist", file)
+	}
+	values, ok := records[record]
+	if !ok {
+		return nil, fmt.Errorf("record %d of file %d does not exist", record, file)
+	}
+	if int(length) > len(values) {
+		return nil, fmt.Errorf("record %d of file %d has %d registers, %d requested", record, file, len(values), length)
+	}
+	return values, nil
+}
+
 // validateRange checks if address + quantity is within bounds.
 func (ds *DataStore) validateRange(address, quantity uint16) error {
 	if quantity == 0 {
@@ -308,6 +607,223 @@ func (ds *DataStore) validateRange(address, quantity uint16) error {
 	return nil
 }
 
+// validateAddress checks a single address like validateRange, so that the
+// single writes share the bounds checks of the multiple ones.
+func (ds *DataStore) validateAddress(address uint16) error {
+	return ds.validateRange(address, 1)
+}
+
+// SetClock replaces the clock timing the configured delays, by default the
+// system clock, for example with a fake one in tests.
+func (ds *DataStore) SetClock(clock modbus.Clock) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.clock = clock
+}
+
+// getClock returns the clock timing the delays.
+func (ds *DataStore) getClock() modbus.Clock {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return ds.clock
+}
+
+// SetListenOnly enables or disables listen only mode.
+func (ds *DataStore) SetListenOnly(enabled bool) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.listenOnly = enabled
+}
+
+// CountOverrun records a received frame that overflowed the receive buffer.
+func (ds *DataStore) CountOverrun() {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.overrunCount++
+}
+
+// OverrunCount returns the number of overruns since the counter was last
+// cleared.
+func (ds *DataStore) OverrunCount() uint16 {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return ds.overrunCount
+}
+
+// ClearOverrunCount resets the overrun counter.
+func (ds *DataStore) ClearOverrunCount() {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.overrunCount = 0
+}
+
+// CountCommEvent records a successfully completed request.
+func (ds *DataStore) CountCommEvent() {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.commEventCount++
+}
+
+// CommEventCounter returns the status word and the number of successfully
+// completed requests since the counter was last cleared.
+func (ds *DataStore) CommEventCounter() (status, eventCount uint16) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return ds.commStatus, ds.commEventCount
+}
+
+// ClearCommEventCount resets the comm event counter and the message count.
+func (ds *DataStore) ClearCommEventCount() {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.commEventCount = 0
+	ds.messageCount = 0
+}
+
+// maxCommEvents is the number of events kept in the comm event log.
+const maxCommEvents = 64
+
+// RecordMessage counts a received request and adds its function code to
+// the comm event log, dropping the oldest events beyond 64.
+func (ds *DataStore) RecordMessage(functionCode byte) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.messageCount++
+	if len(ds.commEventLog) < maxCommEvents {
+		ds.commEventLog = append(ds.commEventLog, 0)
+	}
+	copy(ds.commEventLog[1:], ds.commEventLog)
+	ds.commEventLog[0] = functionCode
+}
+
+// CommEventLog returns the status word, the comm event count, the message
+// count and a copy of the recorded events, most recent first.
+func (ds *DataStore) CommEventLog() (status, eventCount, messageCount uint16, events []byte) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return ds.commStatus, ds.commEventCount, ds.messageCount, slices.Clone(ds.commEventLog)
+}
+
+// ClearCommEventLog empties the comm event log.
+func (ds *DataStore) ClearCommEventLog() {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.commEventLog = nil
+}
+
+// SetRawResponse makes the handler answer requests with functionCode and
+// address with exactly response as the PDU data, regardless of the stored
+// values, to replay a captured exchange. address is the first 16-bit field
+// of the request data: the start address for the coil and register
+// functions, the sub-function for Diagnostics. Requests with less data
+// match address 0.
+func (ds *DataStore) SetRawResponse(functionCode byte, address uint16, response []byte) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	if ds.rawResponses == nil {
+		ds.rawResponses = make(map[rawResponseKey][]byte)
+	}
+	ds.rawResponses[rawResponseKey{functionCode, address}] = slices.Clone(response)
+}
+
+// ClearRawResponse removes the raw response set for functionCode and
+// address, if any, restoring normal handling.
+func (ds *DataStore) ClearRawResponse(functionCode byte, address uint16) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	delete(ds.rawResponses, rawResponseKey{functionCode, address})
+}
+
+// SetMEIHandler makes the handler answer Encapsulated Interface Transport
+// requests of meiType with fn, which takes the request data following the
+// MEI type and returns the response data following it, or nil to reject
+// the request with IllegalDataValue. A handler for MEI type 0x0E replaces
+// the built-in Read Device Identification. A nil fn removes the handler.
+func (ds *DataStore) SetMEIHandler(meiType byte, fn func(data []byte) []byte) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	if fn == nil {
+		delete(ds.meiHandlers, meiType)
+		return
+	}
+	if ds.meiHandlers == nil {
+		ds.meiHandlers = make(map[byte]func(data []byte) []byte)
+	}
+	ds.meiHandlers[meiType] = fn
+}
+
+// MEIHandler returns the handler set for meiType, and whether there is one.
+func (ds *DataStore) MEIHandler(meiType byte) (func(data []byte) []byte, bool) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	fn, ok := ds.meiHandlers[meiType]
+	return fn, ok
+}
+
+// DeviceIdentification returns the configured device identification
+// objects, nil if there are none.
+func (ds *DataStore) DeviceIdentification() map[byte][]byte {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return maps.Clone(ds.deviceIdentification)
+}
+
+// RawResponse returns a copy of the raw response set for functionCode and
+// address, and whether there is one.
+func (ds *DataStore) RawResponse(functionCode byte, address uint16) ([]byte, bool) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	response, ok := ds.rawResponses[rawResponseKey{functionCode, address}]
+	if !ok {
+		return nil, false
+	}
+	return slices.Clone(response), true
+}
+
+// ListenOnly reports whether the data store is in listen only mode.
+func (ds *DataStore) ListenOnly() bool {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return ds.listenOnly
+}
+
+// UnknownFunctionResponse returns how unsupported function codes are
+// answered: with the given exception code, or not at all if silent is set.
+func (ds *DataStore) UnknownFunctionResponse() (exception byte, silent bool) {
+	return ds.defaultException, ds.silentOnUnknown
+}
+
+// StrictCoilPadding reports whether padding bits of Write Multiple Coils
+// requests must be zero.
+func (ds *DataStore) StrictCoilPadding() bool {
+	return ds.strictCoilPadding
+}
+
+// AllowEmptyWrites reports whether zero-quantity Write Multiple Coils and
+// Write Multiple Registers requests are accepted.
+func (ds *DataStore) AllowEmptyWrites() bool {
+	return ds.allowEmptyWrites
+}
+
+// QuantityExceptionCode returns the exception code for requests of the
+// register type with an out of range quantity.
+func (ds *DataStore) QuantityExceptionCode(regType RegisterType) byte {
+	if code, ok := ds.quantityExceptionCodes[regType]; ok {
+		return code
+	}
+	return modbus.ExceptionCodeIllegalDataValue
+}
+
+// DiagnosticRegister returns the value of the diagnostic register.
+func (ds *DataStore) DiagnosticRegister() uint16 {
+	return ds.diagnosticRegister
+}
+
+// ExceptionStatus returns the value of the exception status outputs.
+func (ds *DataStore) ExceptionStatus() uint8 {
+	return ds.exceptionStatus
+}
+
 // GetCoilName returns the name of a coil at the given address, if configured.
 func (ds *DataStore) GetCoilName(address uint16) string {
 	ds.mu.RLock()
@@ -340,63 +856,95 @@ func (ds *DataStore) GetInputRegName(address uint16) string {
 // It checks for address-specific overrides first, then falls back to global defaults.
 // Returns nil if no delay configuration is found.
 func (ds *DataStore) GetDelayConfig(regType RegisterType, address uint16) *DelayConfig {
+	if cfg, ok := ds.lookupDelay(regType, address); ok {
+		return &cfg
+	}
+	return nil
+}
+
+// lookupDelay is GetDelayConfig returning the configuration by value, so
+// that requests don't allocate it.
+func (ds *DataStore) lookupDelay(regType RegisterType, address uint16) (DelayConfig, bool) {
 	ds.mu.RLock()
 	defer ds.mu.RUnlock()
 
 	if ds.delayConfig == nil {
-		return nil
+		return DelayConfig{}, false
 	}
 
 	// Check for address-specific override first
-	var addressConfig *DelayConfig
+	var addressConfigs map[uint16]DelayConfig
 	switch regType {
 	case RegisterTypeCoil:
-		if cfg, ok := ds.delayConfig.Coils[address]; ok {
-			addressConfig = &cfg
-		}
+		addressConfigs = ds.delayConfig.Coils
 	case RegisterTypeDiscreteInput:
-		if cfg, ok := ds.delayConfig.DiscreteInputs[address]; ok {
-			addressConfig = &cfg
-		}
+		addressConfigs = ds.delayConfig.DiscreteInputs
 	case RegisterTypeHoldingReg:
-		if cfg, ok := ds.delayConfig.HoldingRegs[address]; ok {
-			addressConfig = &cfg
-		}
+		addressConfigs = ds.delayConfig.HoldingRegs
 	case RegisterTypeInputReg:
-		if cfg, ok := ds.delayConfig.InputRegs[address]; ok {
-			addressConfig = &cfg
-		}
+		addressConfigs = ds.delayConfig.InputRegs
 	}
-
-	// If address-specific config exists, return it
-	if addressConfig != nil {
-		return addressConfig
+	if cfg, ok := addressConfigs[address]; ok {
+		return cfg, true
 	}
 
 	// Fall back to global default for this register type
-	if ds.delayConfig.Global != nil {
-		if cfg, ok := ds.delayConfig.Global[regType]; ok {
-			return &cfg
-		}
-	}
-
-	return nil
+	cfg, ok := ds.delayConfig.Global[regType]
+	return cfg, ok
 }
 
 // ApplyDelay applies the configured delay and checks for timeout simulation.
 // Returns true if the request should proceed, false if it should timeout (no response).
-func (ds *DataStore) ApplyDelay(regType RegisterType, address uint16) bool {
-	return ds.ApplyDelayWithOptions(regType, address, false)
+// The delay is cut short if ctx is done, in which case false is returned.
+func (ds *DataStore) ApplyDelay(ctx context.Context, regType RegisterType, address uint16) bool {
+	return ds.ApplyDelayWithOptions(ctx, regType, address, false)
 }
 
 // ApplyDelayWithOptions applies the configured delay and optionally checks for timeout simulation.
 // Returns true if the request should proceed, false if it should timeout (no response).
 // If disableTimeout is true, timeout probability is ignored (useful for RTU/ASCII where timeouts don't work with PTYs).
-func (ds *DataStore) ApplyDelayWithOptions(regType RegisterType, address uint16, disableTimeout bool) bool {
-	cfg := ds.GetDelayConfig(regType, address)
-	if cfg == nil {
+// The delay is cut short if ctx is done, for example when the client has
+// gone away, in which case false is returned.
+func (ds *DataStore) ApplyDelayWithOptions(ctx context.Context, regType RegisterType, address uint16, disableTimeout bool) bool {
+	cfg, ok := ds.lookupDelay(regType, address)
+	if !ok {
 		return true // No delay configured, proceed normally
 	}
+	return ds.applyDelayConfig(ctx, &cfg, disableTimeout)
+}
+
+// FunctionDelayConfig returns the delay configuration for requests with the
+// given function code, or nil if there is none.
+func (ds *DataStore) FunctionDelayConfig(functionCode byte) *DelayConfig {
+	if cfg, ok := ds.lookupFunctionDelay(functionCode); ok {
+		return &cfg
+	}
+	return nil
+}
+
+// lookupFunctionDelay is FunctionDelayConfig returning the configuration
+// by value.
+func (ds *DataStore) lookupFunctionDelay(functionCode byte) (DelayConfig, bool) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	cfg, ok := ds.functionDelays[functionCode]
+	return cfg, ok
+}
+
+// ApplyFunctionDelay applies the delay configured for functionCode like
+// ApplyDelayWithOptions.
+func (ds *DataStore) ApplyFunctionDelay(ctx context.Context, functionCode byte, disableTimeout bool) bool {
+	cfg, ok := ds.lookupFunctionDelay(functionCode)
+	if !ok {
+		return true
+	}
+	return ds.applyDelayConfig(ctx, &cfg, disableTimeout)
+}
+
+// applyDelayConfig applies cfg and reports whether the request should
+// proceed.
+func (ds *DataStore) applyDelayConfig(ctx context.Context, cfg *DelayConfig, disableTimeout bool) bool {
 
 	// Check timeout probability first (unless disabled)
 	if !disableTimeout && cfg.TimeoutProbability > 0 {
@@ -406,14 +954,8 @@ func (ds *DataStore) ApplyDelayWithOptions(regType RegisterType, address uint16,
 		}
 	}
 
-	// Parse and apply delay if configured
-	if cfg.Delay != "" {
-		baseDuration, err := time.ParseDuration(cfg.Delay)
-		if err != nil {
-			// Invalid duration, skip delay
-			return true
-		}
-
+	// Apply the delay parsed by NewDataStore, an invalid one is skipped
+	if baseDuration := cfg.delay; baseDuration > 0 {
 		// Apply jitter if configured
 		delay := baseDuration
 		if cfg.Jitter > 0 && cfg.Jitter <= 100 {
@@ -430,7 +972,11 @@ func (ds *DataStore) ApplyDelayWithOptions(regType RegisterType, address uint16,
 		}
 
 		if delay > 0 {
-			time.Sleep(delay)
+			select {
+			case <-ds.getClock().After(delay):
+			case <-ctx.Done():
+				return false
+			}
 		}
 	}
 
@@ -5,8 +5,13 @@
 package simulator
 
 import (
+	"context"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/lumberbarons/modbus"
+	"github.com/lumberbarons/modbus/modbustest"
 )
 
 func TestDelayConfig_Lookup(t *testing.T) {
@@ -101,7 +106,7 @@ func TestApplyDelay_NoConfig(t *testing.T) {
 	ds := NewDataStore(nil)
 
 	start := time.Now()
-	shouldProceed := ds.ApplyDelay(RegisterTypeHoldingReg, 100)
+	shouldProceed := ds.ApplyDelay(context.Background(), RegisterTypeHoldingReg, 100)
 	elapsed := time.Since(start)
 
 	if !shouldProceed {
@@ -127,7 +132,7 @@ func TestApplyDelay_FixedDelay(t *testing.T) {
 	ds := NewDataStore(config)
 
 	start := time.Now()
-	shouldProceed := ds.ApplyDelay(RegisterTypeHoldingReg, 100)
+	shouldProceed := ds.ApplyDelay(context.Background(), RegisterTypeHoldingReg, 100)
 	elapsed := time.Since(start)
 
 	if !shouldProceed {
@@ -141,6 +146,68 @@ func TestApplyDelay_FixedDelay(t *testing.T) {
 	}
 }
 
+func TestApplyDelay_FakeClock(t *testing.T) {
+	config := &DataStoreConfig{
+		Delays: &DelayConfigSet{
+			HoldingRegs: map[uint16]DelayConfig{
+				100: {Delay: "100ms", Jitter: 20},
+			},
+		},
+	}
+	ds := NewDataStore(config)
+	clock := modbustest.NewFakeClock(time.Now())
+	ds.SetClock(clock)
+
+	for i := 0; i < 20; i++ {
+		done := make(chan bool, 1)
+		go func() {
+			done <- ds.ApplyDelay(context.Background(), RegisterTypeHoldingReg, 100)
+		}()
+		for clock.Waiters() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		durations := clock.Durations()
+		if delay := durations[len(durations)-1]; delay < 80*time.Millisecond || delay > 120*time.Millisecond {
+			t.Errorf("expected delay within 100ms ±20%%, got %v", delay)
+		}
+		select {
+		case <-done:
+			t.Fatal("expected the delay to wait for the clock")
+		default:
+		}
+		clock.Advance(120 * time.Millisecond)
+		if !<-done {
+			t.Error("expected to proceed once the delay has passed")
+		}
+	}
+}
+
+func TestApplyDelay_Cancelled(t *testing.T) {
+	config := &DataStoreConfig{
+		Delays: &DelayConfigSet{
+			HoldingRegs: map[uint16]DelayConfig{
+				100: {Delay: "5s"},
+			},
+		},
+	}
+
+	ds := NewDataStore(config)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	shouldProceed := ds.ApplyDelay(ctx, RegisterTypeHoldingReg, 100)
+	elapsed := time.Since(start)
+
+	if shouldProceed {
+		t.Error("expected not to proceed when the context is done")
+	}
+	if elapsed > time.Second {
+		t.Errorf("expected the delay to be cut short, took %v", elapsed)
+	}
+}
+
 func TestApplyDelay_WithJitter(t *testing.T) {
 	config := &DataStoreConfig{
 		Delays: &DelayConfigSet{
@@ -161,7 +228,7 @@ func TestApplyDelay_WithJitter(t *testing.T) {
 
 	for i := 0; i < 20; i++ {
 		start := time.Now()
-		shouldProceed := ds.ApplyDelay(RegisterTypeHoldingReg, 100)
+		shouldProceed := ds.ApplyDelay(context.Background(), RegisterTypeHoldingReg, 100)
 		elapsed := time.Since(start)
 
 		if !shouldProceed {
@@ -206,7 +273,7 @@ func TestApplyDelay_TimeoutProbability(t *testing.T) {
 	iterations := 100
 
 	for i := 0; i < iterations; i++ {
-		shouldProceed := ds.ApplyDelay(RegisterTypeHoldingReg, 100)
+		shouldProceed := ds.ApplyDelay(context.Background(), RegisterTypeHoldingReg, 100)
 		if !shouldProceed {
 			timeoutCount++
 		}
@@ -233,7 +300,7 @@ func TestApplyDelay_AlwaysTimeout(t *testing.T) {
 	ds := NewDataStore(config)
 
 	for i := 0; i < 10; i++ {
-		shouldProceed := ds.ApplyDelay(RegisterTypeHoldingReg, 100)
+		shouldProceed := ds.ApplyDelay(context.Background(), RegisterTypeHoldingReg, 100)
 		if shouldProceed {
 			t.Error("expected timeout with probability 1.0")
 		}
@@ -255,7 +322,7 @@ func TestApplyDelay_NeverTimeout(t *testing.T) {
 	ds := NewDataStore(config)
 
 	for i := 0; i < 10; i++ {
-		shouldProceed := ds.ApplyDelay(RegisterTypeHoldingReg, 100)
+		shouldProceed := ds.ApplyDelay(context.Background(), RegisterTypeHoldingReg, 100)
 		if !shouldProceed {
 			t.Error("expected no timeout with probability 0.0")
 		}
@@ -276,7 +343,7 @@ func TestApplyDelay_InvalidDuration(t *testing.T) {
 	ds := NewDataStore(config)
 
 	start := time.Now()
-	shouldProceed := ds.ApplyDelay(RegisterTypeHoldingReg, 100)
+	shouldProceed := ds.ApplyDelay(context.Background(), RegisterTypeHoldingReg, 100)
 	elapsed := time.Since(start)
 
 	if !shouldProceed {
@@ -314,7 +381,7 @@ func TestApplyDelay_AllRegisterTypes(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(string(tt.regType), func(t *testing.T) {
 			start := time.Now()
-			shouldProceed := ds.ApplyDelay(tt.regType, 0)
+			shouldProceed := ds.ApplyDelay(context.Background(), tt.regType, 0)
 			elapsed := time.Since(start)
 
 			if !shouldProceed {
@@ -328,3 +395,101 @@ func TestApplyDelay_AllRegisterTypes(t *testing.T) {
 		})
 	}
 }
+
+func TestFunctionDelays(t *testing.T) {
+	config := &DataStoreConfig{
+		Delays: &DelayConfigSet{
+			HoldingRegs: map[uint16]DelayConfig{
+				0: {Delay: "500ms"},
+			},
+		},
+		FunctionDelays: map[byte]DelayConfig{
+			modbus.FuncCodeWriteMultipleRegisters: {Delay: "100ms"},
+		},
+	}
+	h := NewHandler(NewDataStore(config))
+
+	timed := func(req *modbus.ProtocolDataUnit) time.Duration {
+		start := time.Now()
+		if resp := h.HandleRequest(req); resp == nil || resp.FunctionCode != req.FunctionCode {
+			t.Fatalf("function %d: unexpected response %+v", req.FunctionCode, resp)
+		}
+		return time.Since(start)
+	}
+
+	// The function delay replaces the delay of register 0
+	elapsed := timed(&modbus.ProtocolDataUnit{
+		FunctionCode: modbus.FuncCodeWriteMultipleRegisters,
+		Data:         []byte{0x00, 0x00, 0x00, 0x01, 0x02, 0x00, 0x2A},
+	})
+	if elapsed < 80*time.Millisecond || elapsed > 300*time.Millisecond {
+		t.Errorf("expected write delay around 100ms, got %v", elapsed)
+	}
+
+	// Other function codes keep the register delays
+	elapsed = timed(&modbus.ProtocolDataUnit{
+		FunctionCode: modbus.FuncCodeReadHoldingRegisters,
+		Data:         []byte{0x00, 0x01, 0x00, 0x01},
+	})
+	if elapsed > 50*time.Millisecond {
+		t.Errorf("expected no delay for register 1, got %v", elapsed)
+	}
+}
+
+func TestDataStoreConfig_Validate(t *testing.T) {
+	valid := &DataStoreConfig{
+		Delays: &DelayConfigSet{
+			Global: map[RegisterType]DelayConfig{
+				RegisterTypeHoldingReg: {Delay: "10ms", Jitter: 20, TimeoutProbability: 0.5},
+			},
+		},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("expected valid config, got %v", err)
+	}
+
+	var empty *DataStoreConfig
+	if err := empty.Validate(); err != nil {
+		t.Errorf("expected nil config to be valid, got %v", err)
+	}
+
+	invalid := &DataStoreConfig{
+		Delays: &DelayConfigSet{
+			Global: map[RegisterType]DelayConfig{
+				RegisterTypeCoil: {Jitter: 150},
+			},
+			HoldingRegs: map[uint16]DelayConfig{
+				100: {Delay: "invalid", TimeoutProbability: 1.5},
+			},
+		},
+		FunctionDelays: map[byte]DelayConfig{
+			modbus.FuncCodeWriteMultipleRegisters: {Delay: "-1s"},
+		},
+	}
+	err := invalid.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{"functionDelays.16", "delays.global.coils", "jitter 150", "delays.holdingRegs.100", "invalid delay", "timeout probability 1.5"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to mention %q, got %v", want, err)
+		}
+	}
+}
+
+// BenchmarkApplyDelay measures the per-request cost of a configured delay.
+// The delay is zero so that the lookup is measured rather than the sleep.
+func BenchmarkApplyDelay(b *testing.B) {
+	ds := NewDataStore(&DataStoreConfig{
+		Delays: &DelayConfigSet{
+			HoldingRegs: map[uint16]DelayConfig{
+				100: {Delay: "0ms", Jitter: 20},
+			},
+		},
+	})
+	ctx := context.Background()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ds.ApplyDelay(ctx, RegisterTypeHoldingReg, 100)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package simulator
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/lumberbarons/modbus"
+)
+
+// LogLevel is the verbosity of a server's log.
+type LogLevel int
+
+const (
+	// LogLevelInfo logs server events and errors only.
+	LogLevelInfo LogLevel = iota
+	// LogLevelDebug also logs a decoded summary of every handled request
+	// and its response.
+	LogLevelDebug
+)
+
+// requestFields returns the starting address and quantity of a request,
+// nil for the ones its function code does not carry.
+func requestFields(request *modbus.ProtocolDataUnit) (address, quantity *uint16) {
+	data := request.Data
+	switch request.FunctionCode {
+	case modbus.FuncCodeReadCoils, modbus.FuncCodeReadDiscreteInputs,
+		modbus.FuncCodeReadHoldingRegisters, modbus.FuncCodeReadInputRegisters,
+		modbus.FuncCodeWriteMultipleCoils, modbus.FuncCodeWriteMultipleRegisters,
+		modbus.FuncCodeReadWriteMultipleRegisters:
+		if len(data) >= 4 {
+			a := binary.BigEndian.Uint16(data[0:2])
+			q := binary.BigEndian.Uint16(data[2:4])
+			address, quantity = &a, &q
+		}
+	case modbus.FuncCodeWriteSingleCoil, modbus.FuncCodeWriteSingleRegister,
+		modbus.FuncCodeMaskWriteRegister, modbus.FuncCodeReadFIFOQueue:
+		if len(data) >= 2 {
+			a := binary.BigEndian.Uint16(data[0:2])
+			address = &a
+		}
+	}
+	return address, quantity
+}
+
+// describeExchange returns a one-line summary of a handled request and its
+// response, which may be nil, such as
+//
+//	unit 1 Read Holding Registers address 100 quantity 2 -> values [1 2]
+func describeExchange(unitID byte, request, response *modbus.ProtocolDataUnit) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "unit %d %s", unitID, modbus.FunctionCodeName(request.FunctionCode))
+	address, quantity := requestFields(request)
+	if address != nil {
+		fmt.Fprintf(&b, " address %d", *address)
+	}
+	if quantity != nil {
+		fmt.Fprintf(&b, " quantity %d", *quantity)
+	}
+	if values := requestValues(request); values != "" {
+		fmt.Fprintf(&b, " values %s", values)
+	}
+
+	switch {
+	case response == nil:
+		b.WriteString(" -> no response")
+	case response.FunctionCode&0x80 != 0 && len(response.Data) > 0:
+		fmt.Fprintf(&b, " -> exception %d", response.Data[0])
+	default:
+		if values := responseValues(request.FunctionCode, response.Data); values != "" {
+			fmt.Fprintf(&b, " -> values %s", values)
+		} else {
+			fmt.Fprintf(&b, " -> % x", response.Data)
+		}
+	}
+	return b.String()
+}
+
+// requestValues formats the values written by a request, or returns ""
+// if it writes none.
+func requestValues(request *modbus.ProtocolDataUnit) string {
+	data := request.Data
+	switch request.FunctionCode {
+	case modbus.FuncCodeWriteSingleCoil, modbus.FuncCodeWriteSingleRegister:
+		if len(data) >= 4 {
+			return fmt.Sprint([]uint16{binary.BigEndian.Uint16(data[2:4])})
+		}
+	case modbus.FuncCodeWriteMultipleCoils:
+		if len(data) >= 5 {
+			return fmt.Sprintf("% x", data[5:])
+		}
+	case modbus.FuncCodeWriteMultipleRegisters:
+		if len(data) >= 5 {
+			return fmt.Sprint(registerValues(data[5:]))
+		}
+	case modbus.FuncCodeReadWriteMultipleRegisters:
+		if len(data) >= 9 {
+			return fmt.Sprint(registerValues(data[9:]))
+		}
+	}
+	return ""
+}
+
+// responseValues formats the values returned by a read, or returns "" if
+// the function code does not read any.
+func responseValues(functionCode byte, data []byte) string {
+	if len(data) < 1 {
+		return ""
+	}
+	switch functionCode {
+	case modbus.FuncCodeReadCoils, modbus.FuncCodeReadDiscreteInputs:
+		return fmt.Sprintf("% x", data[1:])
+	case modbus.FuncCodeReadHoldingRegisters, modbus.FuncCodeReadInputRegisters,
+		modbus.FuncCodeReadWriteMultipleRegisters:
+		return fmt.Sprint(registerValues(data[1:]))
+	}
+	return ""
+}
+
+// registerValues decodes big-endian registers, ignoring a trailing odd byte.
+func registerValues(data []byte) []uint16 {
+	values := make([]uint16, len(data)/2)
+	for i := range values {
+		values[i] = binary.BigEndian.Uint16(data[2*i:])
+	}
+	return values
+}
+
+// logExchange logs the summary of a handled request at LogLevelDebug.
+func logExchange(logger *log.Logger, level LogLevel, unitID byte, request, response *modbus.ProtocolDataUnit) {
+	if level < LogLevelDebug {
+		return
+	}
+	logger.Printf("decoded: %s", describeExchange(unitID, request, response))
+}
@@ -0,0 +1,159 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lumberbarons/modbus"
+)
+
+// Gateway bridges Modbus TCP to Modbus RTU. It accepts TCP connections,
+// forwards each request to the RTU slave addressed by the unit ID and
+// wraps the RTU response back into an MBAP frame.
+type Gateway struct {
+	server   *TCPServer
+	rtu      *modbus.RTUClientHandler
+	slaveMap map[byte]byte
+	timeout  time.Duration
+	logger   *log.Logger
+
+	// mu serializes use of the RTU handler, whose slave ID is changed per
+	// request
+	mu sync.Mutex
+}
+
+// GatewayConfig holds configuration for the gateway.
+type GatewayConfig struct {
+	Address string // TCP listen address, e.g. ":502"
+	// RTU is the serial handler requests are forwarded to.
+	RTU *modbus.RTUClientHandler
+	// SlaveMap maps TCP unit IDs to RTU slave addresses. If nil, the unit
+	// ID is used as the slave address. If set, unit IDs not in the map are
+	// answered with Gateway Path Unavailable.
+	SlaveMap map[byte]byte
+	// Timeout bounds each forwarded request. Defaults to the RTU handler
+	// timeout.
+	Timeout time.Duration
+	Logger  *log.Logger
+	// RequestLog, if set, receives one JSON line per handled request
+	RequestLog io.Writer
+	// LogLevel selects the verbosity of the log, see TCPServerConfig
+	LogLevel LogLevel
+}
+
+// NewGateway creates a new TCP to RTU gateway.
+func NewGateway(config *GatewayConfig) (*Gateway, error) {
+	if config == nil || config.RTU == nil {
+		return nil, fmt.Errorf("gateway requires an RTU handler")
+	}
+	if config.Logger == nil {
+		config.Logger = log.New(os.Stdout, "gateway: ", log.LstdFlags)
+	}
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = config.RTU.Timeout
+	}
+
+	g := &Gateway{
+		rtu:      config.RTU,
+		slaveMap: config.SlaveMap,
+		timeout:  timeout,
+		logger:   config.Logger,
+	}
+	g.server = newTCPServer(&TCPServerConfig{
+		Address:    config.Address,
+		Logger:     config.Logger,
+		RequestLog: config.RequestLog,
+		LogLevel:   config.LogLevel,
+	}, g.forward)
+	return g, nil
+}
+
+// Address returns the address the gateway is listening on.
+func (g *Gateway) Address() string {
+	return g.server.Address()
+}
+
+// ConnectAddress returns an address clients can connect to, see
+// TCPServer.ConnectAddress.
+func (g *Gateway) ConnectAddress() string {
+	return g.server.ConnectAddress()
+}
+
+// Start starts accepting TCP connections.
+func (g *Gateway) Start() error {
+	return g.server.Start()
+}
+
+// Stop stops the TCP server and closes the serial port.
+func (g *Gateway) Stop() error {
+	err := g.server.Stop()
+	if closeErr := g.rtu.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// forward sends req to the RTU slave mapped from unitID and returns its
+// response, or a gateway exception if the slave can't be reached. Broadcast
+// requests and requests never answered, like Force Listen Only Mode, are
+// sent without waiting for a response and nil is returned. The RTU request
+// is abandoned once ctx is done.
+func (g *Gateway) forward(ctx context.Context, unitID byte, req *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
+	slaveID := unitID
+	if g.slaveMap != nil {
+		var ok bool
+		if slaveID, ok = g.slaveMap[unitID]; !ok {
+			g.logger.Printf("no RTU slave mapped for unit %d", unitID)
+			return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeGatewayPathUnavailable)
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+
+	g.rtu.SlaveID = slaveID
+	aduRequest, err := g.rtu.Encode(req)
+	if err != nil {
+		g.logger.Printf("failed to encode request for slave %d: %v", slaveID, err)
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeGatewayPathUnavailable)
+	}
+	if length, ok := modbus.ExpectedResponseLength(req.FunctionCode, req.Data); slaveID == 0 || ok && length == 0 {
+		if err = g.rtu.SendNoResponse(ctx, aduRequest); err != nil {
+			g.logger.Printf("failed to send request to slave %d: %v", slaveID, err)
+		}
+		return nil
+	}
+	aduResponse, err := g.rtu.Send(ctx, aduRequest)
+	if err == nil {
+		err = g.rtu.Verify(aduRequest, aduResponse)
+	}
+	var resp *modbus.ProtocolDataUnit
+	if err == nil {
+		resp, err = g.rtu.Decode(aduResponse)
+	}
+	if err != nil {
+		g.logger.Printf("slave %d failed to respond: %v", slaveID, err)
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeGatewayTargetDeviceFailedToRespond)
+	}
+	// The RTU buffer is reused by later requests
+	return &modbus.ProtocolDataUnit{
+		FunctionCode: resp.FunctionCode,
+		Data:         append([]byte(nil), resp.Data...),
+	}
+}
@@ -5,6 +5,7 @@
 package simulator
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"log"
@@ -13,6 +14,34 @@ import (
 	"github.com/lumberbarons/modbus"
 )
 
+// broadcastAddress is the unit/slave ID addressing every device. Servers
+// execute broadcast requests but never answer them, unless configured to
+// answer broadcast reads.
+const broadcastAddress byte = 0
+
+// answersRequest reports whether a server answers a request for unitID:
+// always unless it is a broadcast, and broadcast reads too if
+// respondToBroadcastReads is set, like gateways treating unit 0 as any
+// device do.
+func answersRequest(unitID byte, req *modbus.ProtocolDataUnit, respondToBroadcastReads bool) bool {
+	if unitID != broadcastAddress {
+		return true
+	}
+	if !respondToBroadcastReads {
+		return false
+	}
+	switch req.FunctionCode {
+	case modbus.FuncCodeReadCoils,
+		modbus.FuncCodeReadDiscreteInputs,
+		modbus.FuncCodeReadHoldingRegisters,
+		modbus.FuncCodeReadInputRegisters,
+		modbus.FuncCodeReadFIFOQueue,
+		modbus.FuncCodeReadFileRecord:
+		return true
+	}
+	return false
+}
+
 // Handler processes Modbus function codes and interacts with the DataStore.
 type Handler struct {
 	dataStore                *DataStore
@@ -33,14 +62,64 @@ func NewHandlerWithOptions(ds *DataStore, disableTimeoutSimulation bool) *Handle
 }
 
 // HandleRequest processes a Modbus PDU request and returns a response PDU.
+// It returns nil when no response should be sent.
 func (h *Handler) HandleRequest(req *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
+	return h.HandleRequestContext(context.Background(), req)
+}
+
+// HandleRequestContext is HandleRequest with a context that cuts short a
+// configured delay when done, in which case no response is returned.
+func (h *Handler) HandleRequestContext(ctx context.Context, req *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
+	h.dataStore.RecordMessage(req.FunctionCode)
+
+	// In listen only mode the device monitors the line but never responds.
+	// Only Restart Communications Option can bring it back online.
+	if h.dataStore.ListenOnly() {
+		if isDiagnostic(req, modbus.DiagnosticRestartCommunications) {
+			h.dataStore.SetListenOnly(false)
+			h.restartCommunications(req)
+			log.Printf("DIAGNOSTICS: restart communications, leaving listen only mode")
+		} else {
+			log.Printf("LISTEN ONLY mode: ignoring function code %d", req.FunctionCode)
+		}
+		return nil
+	}
+
 	// Apply delay/timeout simulation before processing request
-	if shouldTimeout := h.applyRequestDelay(req); !shouldTimeout {
+	if shouldTimeout := h.applyRequestDelay(ctx, req); !shouldTimeout {
+		if ctx.Err() != nil {
+			log.Printf("DELAY cancelled for function code %d: %v", req.FunctionCode, ctx.Err())
+			return nil
+		}
 		// Timeout simulation - return nil to indicate no response
 		log.Printf("TIMEOUT simulation for function code %d", req.FunctionCode)
 		return nil
 	}
 
+	// Replay a raw response in place of normal handling
+	if response, ok := h.dataStore.RawResponse(req.FunctionCode, rawResponseAddress(req)); ok {
+		log.Printf("RAW response for function code %d: % x", req.FunctionCode, response)
+		return &modbus.ProtocolDataUnit{FunctionCode: req.FunctionCode, Data: response}
+	}
+
+	response := h.handleFunction(req)
+	if countsCommEvent(req, response) {
+		h.dataStore.CountCommEvent()
+	}
+	return response
+}
+
+// countsCommEvent reports whether the exchange increments the comm event
+// counter: every successfully completed request except the comm event
+// counter and log fetches themselves.
+func countsCommEvent(req, response *modbus.ProtocolDataUnit) bool {
+	return response != nil && response.FunctionCode&0x80 == 0 &&
+		req.FunctionCode != modbus.FuncCodeGetCommEventCounter &&
+		req.FunctionCode != modbus.FuncCodeGetCommEventLog
+}
+
+// handleFunction dispatches a request to the handler of its function code.
+func (h *Handler) handleFunction(req *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
 	switch req.FunctionCode {
 	case modbus.FuncCodeReadCoils:
 		return h.handleReadCoils(req)
@@ -64,14 +143,42 @@ func (h *Handler) HandleRequest(req *modbus.ProtocolDataUnit) *modbus.ProtocolDa
 		return h.handleReadWriteMultipleRegisters(req)
 	case modbus.FuncCodeReadFIFOQueue:
 		return h.handleReadFIFOQueue(req)
+	case modbus.FuncCodeReadFileRecord:
+		return h.handleReadFileRecord(req)
+	case modbus.FuncCodeWriteFileRecord:
+		return h.handleWriteFileRecord(req)
+	case modbus.FuncCodeReadExceptionStatus:
+		return h.handleReadExceptionStatus(req)
+	case modbus.FuncCodeDiagnostics:
+		return h.handleDiagnostics(req)
+	case modbus.FuncCodeGetCommEventCounter:
+		return h.handleGetCommEventCounter(req)
+	case modbus.FuncCodeGetCommEventLog:
+		return h.handleGetCommEventLog(req)
+	case modbus.FuncCodeEncapsulatedInterface:
+		return h.handleEncapsulatedInterface(req)
 	default:
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalFunction)
+		return h.handleUnsupportedFunction(req)
+	}
+}
+
+// rawResponseAddress returns the address raw responses are matched on, the
+// first 16-bit field of the request data.
+func rawResponseAddress(req *modbus.ProtocolDataUnit) uint16 {
+	if len(req.Data) < 2 {
+		return 0
 	}
+	return binary.BigEndian.Uint16(req.Data)
 }
 
 // applyRequestDelay applies configured delay/timeout simulation based on the request.
 // Returns true if request should proceed, false if it should timeout.
-func (h *Handler) applyRequestDelay(req *modbus.ProtocolDataUnit) bool {
+func (h *Handler) applyRequestDelay(ctx context.Context, req *modbus.ProtocolDataUnit) bool {
+	// A delay for the function code replaces the register delays
+	if _, ok := h.dataStore.lookupFunctionDelay(req.FunctionCode); ok {
+		return h.dataStore.ApplyFunctionDelay(ctx, req.FunctionCode, h.disableTimeoutSimulation)
+	}
+
 	// Determine register type and address from PDU
 	regType, address := h.getRegisterTypeAndAddress(req)
 	if regType == "" {
@@ -80,7 +187,7 @@ func (h *Handler) applyRequestDelay(req *modbus.ProtocolDataUnit) bool {
 	}
 
 	// Apply delay and check for timeout (but skip timeout check if disabled)
-	return h.dataStore.ApplyDelayWithOptions(regType, address, h.disableTimeoutSimulation)
+	return h.dataStore.ApplyDelayWithOptions(ctx, regType, address, h.disableTimeoutSimulation)
 }
 
 // getRegisterTypeAndAddress extracts the register type and address from a PDU.
@@ -113,19 +220,19 @@ func (h *Handler) getRegisterTypeAndAddress(req *modbus.ProtocolDataUnit) (regTy
 
 func (h *Handler) handleReadCoils(req *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
 	if len(req.Data) < 4 {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
 	}
 
 	address := binary.BigEndian.Uint16(req.Data[0:2])
 	quantity := binary.BigEndian.Uint16(req.Data[2:4])
 
 	if quantity < 1 || quantity > 2000 {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		return h.quantityException(req, RegisterTypeCoil)
 	}
 
 	coils, err := h.dataStore.ReadCoils(address, quantity)
 	if err != nil {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress)
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress)
 	}
 
 	// Log the operation with register names
@@ -139,19 +246,19 @@ func (h *Handler) handleReadCoils(req *modbus.ProtocolDataUnit) *modbus.Protocol
 
 func (h *Handler) handleReadDiscreteInputs(req *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
 	if len(req.Data) < 4 {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
 	}
 
 	address := binary.BigEndian.Uint16(req.Data[0:2])
 	quantity := binary.BigEndian.Uint16(req.Data[2:4])
 
 	if quantity < 1 || quantity > 2000 {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		return h.quantityException(req, RegisterTypeDiscreteInput)
 	}
 
 	inputs, err := h.dataStore.ReadDiscreteInputs(address, quantity)
 	if err != nil {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress)
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress)
 	}
 
 	// Log the operation with register names
@@ -165,19 +272,19 @@ func (h *Handler) handleReadDiscreteInputs(req *modbus.ProtocolDataUnit) *modbus
 
 func (h *Handler) handleReadHoldingRegisters(req *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
 	if len(req.Data) < 4 {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
 	}
 
 	address := binary.BigEndian.Uint16(req.Data[0:2])
 	quantity := binary.BigEndian.Uint16(req.Data[2:4])
 
 	if quantity < 1 || quantity > 125 {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		return h.quantityException(req, RegisterTypeHoldingReg)
 	}
 
 	registers, err := h.dataStore.ReadHoldingRegisters(address, quantity)
 	if err != nil {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress)
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress)
 	}
 
 	// Log the operation with register names
@@ -191,19 +298,19 @@ func (h *Handler) handleReadHoldingRegisters(req *modbus.ProtocolDataUnit) *modb
 
 func (h *Handler) handleReadInputRegisters(req *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
 	if len(req.Data) < 4 {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
 	}
 
 	address := binary.BigEndian.Uint16(req.Data[0:2])
 	quantity := binary.BigEndian.Uint16(req.Data[2:4])
 
 	if quantity < 1 || quantity > 125 {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		return h.quantityException(req, RegisterTypeInputReg)
 	}
 
 	registers, err := h.dataStore.ReadInputRegisters(address, quantity)
 	if err != nil {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress)
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress)
 	}
 
 	// Log the operation with register names
@@ -217,19 +324,19 @@ func (h *Handler) handleReadInputRegisters(req *modbus.ProtocolDataUnit) *modbus
 
 func (h *Handler) handleWriteSingleCoil(req *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
 	if len(req.Data) < 4 {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
 	}
 
 	address := binary.BigEndian.Uint16(req.Data[0:2])
 	value := binary.BigEndian.Uint16(req.Data[2:4])
 
 	if value != 0x0000 && value != 0xFF00 {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
 	}
 
 	boolValue := value == 0xFF00
 	if err := h.dataStore.WriteSingleCoil(address, boolValue); err != nil {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress)
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress)
 	}
 
 	// Log the operation with register names
@@ -249,14 +356,14 @@ func (h *Handler) handleWriteSingleCoil(req *modbus.ProtocolDataUnit) *modbus.Pr
 
 func (h *Handler) handleWriteSingleRegister(req *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
 	if len(req.Data) < 4 {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
 	}
 
 	address := binary.BigEndian.Uint16(req.Data[0:2])
 	value := binary.BigEndian.Uint16(req.Data[2:4])
 
 	if err := h.dataStore.WriteSingleRegister(address, value); err != nil {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress)
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress)
 	}
 
 	// Log the operation with register names
@@ -276,25 +383,35 @@ func (h *Handler) handleWriteSingleRegister(req *modbus.ProtocolDataUnit) *modbu
 
 func (h *Handler) handleWriteMultipleCoils(req *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
 	if len(req.Data) < 5 {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
 	}
 
 	address := binary.BigEndian.Uint16(req.Data[0:2])
 	quantity := binary.BigEndian.Uint16(req.Data[2:4])
 	byteCount := req.Data[4]
 
+	if quantity == 0 && h.dataStore.AllowEmptyWrites() {
+		return emptyWriteResponse(req.FunctionCode, address)
+	}
 	if quantity < 1 || quantity > 1968 {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		return h.quantityException(req, RegisterTypeCoil)
 	}
 
 	expectedByteCount := (quantity + 7) / 8
 	if uint16(byteCount) != expectedByteCount || len(req.Data) < int(5+byteCount) {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+	}
+
+	// Bits beyond quantity in the last byte must be zero
+	if padding := quantity % 8; padding != 0 && h.dataStore.StrictCoilPadding() {
+		if req.Data[4+byteCount]>>padding != 0 {
+			return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		}
 	}
 
 	coils := bytesToBools(req.Data[5:5+byteCount], quantity)
 	if err := h.dataStore.WriteMultipleCoils(address, coils); err != nil {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress)
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress)
 	}
 
 	// Response contains address and quantity
@@ -310,24 +427,27 @@ func (h *Handler) handleWriteMultipleCoils(req *modbus.ProtocolDataUnit) *modbus
 
 func (h *Handler) handleWriteMultipleRegisters(req *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
 	if len(req.Data) < 5 {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
 	}
 
 	address := binary.BigEndian.Uint16(req.Data[0:2])
 	quantity := binary.BigEndian.Uint16(req.Data[2:4])
 	byteCount := req.Data[4]
 
+	if quantity == 0 && h.dataStore.AllowEmptyWrites() {
+		return emptyWriteResponse(req.FunctionCode, address)
+	}
 	if quantity < 1 || quantity > 123 {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		return h.quantityException(req, RegisterTypeHoldingReg)
 	}
 
 	if byteCount != byte(quantity*2) || len(req.Data) < int(5+byteCount) {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
 	}
 
 	registers := bytesToRegisters(req.Data[5 : 5+byteCount])
 	if err := h.dataStore.WriteMultipleRegisters(address, registers); err != nil {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress)
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress)
 	}
 
 	// Response contains address and quantity
@@ -341,9 +461,26 @@ func (h *Handler) handleWriteMultipleRegisters(req *modbus.ProtocolDataUnit) *mo
 	}
 }
 
+// quantityException returns the exception response configured for a
+// request of the register type with an out of range quantity.
+func (h *Handler) quantityException(req *modbus.ProtocolDataUnit, regType RegisterType) *modbus.ProtocolDataUnit {
+	return modbus.NewExceptionResponse(req.FunctionCode, h.dataStore.QuantityExceptionCode(regType))
+}
+
+// emptyWriteResponse echoes a zero-quantity write that was accepted without
+// writing anything.
+func emptyWriteResponse(functionCode byte, address uint16) *modbus.ProtocolDataUnit {
+	response := make([]byte, 4)
+	binary.BigEndian.PutUint16(response[0:2], address)
+	return &modbus.ProtocolDataUnit{
+		FunctionCode: functionCode,
+		Data:         response,
+	}
+}
+
 func (h *Handler) handleMaskWriteRegister(req *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
 	if len(req.Data) < 6 {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
 	}
 
 	address := binary.BigEndian.Uint16(req.Data[0:2])
@@ -351,7 +488,7 @@ func (h *Handler) handleMaskWriteRegister(req *modbus.ProtocolDataUnit) *modbus.
 	orMask := binary.BigEndian.Uint16(req.Data[4:6])
 
 	if err := h.dataStore.MaskWriteRegister(address, andMask, orMask); err != nil {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress)
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress)
 	}
 
 	// Echo back the request
@@ -363,7 +500,7 @@ func (h *Handler) handleMaskWriteRegister(req *modbus.ProtocolDataUnit) *modbus.
 
 func (h *Handler) handleReadWriteMultipleRegisters(req *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
 	if len(req.Data) < 9 {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
 	}
 
 	readAddress := binary.BigEndian.Uint16(req.Data[0:2])
@@ -373,25 +510,25 @@ func (h *Handler) handleReadWriteMultipleRegisters(req *modbus.ProtocolDataUnit)
 	writeByteCount := req.Data[8]
 
 	if readQuantity < 1 || readQuantity > 125 {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		return h.quantityException(req, RegisterTypeHoldingReg)
 	}
 	if writeQuantity < 1 || writeQuantity > 121 {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		return h.quantityException(req, RegisterTypeHoldingReg)
 	}
 	if writeByteCount != byte(writeQuantity*2) || len(req.Data) < int(9+writeByteCount) {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
 	}
 
 	// Write first
 	writeRegisters := bytesToRegisters(req.Data[9 : 9+writeByteCount])
 	if err := h.dataStore.WriteMultipleRegisters(writeAddress, writeRegisters); err != nil {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress)
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress)
 	}
 
 	// Then read
 	readRegisters, err := h.dataStore.ReadHoldingRegisters(readAddress, readQuantity)
 	if err != nil {
-		return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress)
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress)
 	}
 
 	return &modbus.ProtocolDataUnit{
@@ -401,34 +538,266 @@ func (h *Handler) handleReadWriteMultipleRegisters(req *modbus.ProtocolDataUnit)
 }
 
 func (h *Handler) handleReadFIFOQueue(req *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
-	// FIFO queue not implemented - return illegal function exception
-	return newExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalFunction)
+	// FIFO queue not implemented - answer as an unsupported function
+	return h.handleUnsupportedFunction(req)
 }
 
-// Helper functions
+const (
+	// fileRecordReferenceType is the only reference type defined for file
+	// record sub-requests
+	fileRecordReferenceType = 6
+	// maxFileRecordNumber is the highest record number in a file
+	maxFileRecordNumber = 0x270F
+)
+
+// fileRecordRequest is one sub-request of a Read/Write File Record request.
+type fileRecordRequest struct {
+	file, record, length uint16
+}
+
+// parseFileRecordRequest parses a sub-request header:
+//
+//	Reference type : 1 byte (6)
+//	File number    : 2 bytes
+//	Record number  : 2 bytes
+//	Record length  : 2 bytes
+//
+// It returns an exception code if the sub-request is invalid.
+func parseFileRecordRequest(data []byte) (fileRecordRequest, byte) {
+	sub := fileRecordRequest{
+		file:   binary.BigEndian.Uint16(data[1:3]),
+		record: binary.BigEndian.Uint16(data[3:5]),
+		length: binary.BigEndian.Uint16(data[5:7]),
+	}
+	if data[0] != fileRecordReferenceType || sub.file == 0 || sub.record > maxFileRecordNumber {
+		return sub, modbus.ExceptionCodeIllegalDataAddress
+	}
+	return sub, 0
+}
+
+// handleReadFileRecord reads one or more groups of file records. The
+// request is a byte count followed by 7 byte sub-requests; the response
+// holds, for each sub-request, its length, the reference type and the
+// record registers.
+func (h *Handler) handleReadFileRecord(req *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
+	if len(req.Data) < 1 {
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+	}
+	byteCount := int(req.Data[0])
+	if byteCount < 0x07 || byteCount > 0xF5 || byteCount%7 != 0 || len(req.Data) != 1+byteCount {
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+	}
+
+	response := []byte{0}
+	for offset := 1; offset < len(req.Data); offset += 7 {
+		sub, exception := parseFileRecordRequest(req.Data[offset : offset+7])
+		if exception != 0 {
+			return modbus.NewExceptionResponse(req.FunctionCode, exception)
+		}
+		values, err := h.dataStore.ReadFileRecord(sub.file, sub.record, sub.length)
+		if err != nil {
+			return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress)
+		}
+		log.Printf("READ File Record: file %d, record %d, length %d", sub.file, sub.record, sub.length)
+
+		response = append(response, byte(1+2*len(values)), fileRecordReferenceType)
+		for _, v := range values {
+			response = binary.BigEndian.AppendUint16(response, v)
+		}
+		// The response must fit in a PDU
+		if len(response)-1 > 0xF5 {
+			return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		}
+	}
+	response[0] = byte(len(response) - 1)
+
+	return &modbus.ProtocolDataUnit{
+		FunctionCode: req.FunctionCode,
+		Data:         response,
+	}
+}
+
+// handleWriteFileRecord writes one or more groups of file records. The
+// request is a byte count followed by sub-requests, each a 7 byte header
+// and the record registers. The response echoes the request.
+func (h *Handler) handleWriteFileRecord(req *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
+	if len(req.Data) < 1 {
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+	}
+	byteCount := int(req.Data[0])
+	if byteCount < 0x09 || byteCount > 0xFB || len(req.Data) != 1+byteCount {
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+	}
+
+	// Validate all sub-requests before writing any of them
+	var subs []fileRecordRequest
+	var values [][]uint16
+	for offset := 1; offset < len(req.Data); {
+		if len(req.Data)-offset < 7 {
+			return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		}
+		sub, exception := parseFileRecordRequest(req.Data[offset : offset+7])
+		if exception != 0 {
+			return modbus.NewExceptionResponse(req.FunctionCode, exception)
+		}
+		offset += 7
+		end := offset + 2*int(sub.length)
+		if sub.length == 0 || end > len(req.Data) {
+			return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		}
+		if _, err := h.dataStore.ReadFileRecord(sub.file, sub.record, sub.length); err != nil {
+			return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress)
+		}
+		subs = append(subs, sub)
+		values = append(values, bytesToRegisters(req.Data[offset:end]))
+		offset = end
+	}
+
+	for i, sub := range subs {
+		if err := h.dataStore.WriteFileRecord(sub.file, sub.record, values[i]); err != nil {
+			return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress)
+		}
+		log.Printf("WRITE File Record: file %d, record %d, length %d", sub.file, sub.record, sub.length)
+	}
 
-func newExceptionResponse(functionCode, exceptionCode byte) *modbus.ProtocolDataUnit {
+	// Echo back the request
 	return &modbus.ProtocolDataUnit{
-		FunctionCode: functionCode | 0x80, // Set high bit for exception
-		Data:         []byte{exceptionCode},
+		FunctionCode: req.FunctionCode,
+		Data:         req.Data,
 	}
 }
 
+// handleUnsupportedFunction answers a function code the simulator does not
+// implement with the configured exception, or not at all.
+func (h *Handler) handleUnsupportedFunction(req *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
+	exception, silent := h.dataStore.UnknownFunctionResponse()
+	if silent {
+		log.Printf("UNSUPPORTED function code %d: not responding", req.FunctionCode)
+		return nil
+	}
+	return modbus.NewExceptionResponse(req.FunctionCode, exception)
+}
+
+func (h *Handler) handleReadExceptionStatus(req *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
+	if len(req.Data) != 0 {
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+	}
+	status := h.dataStore.ExceptionStatus()
+	log.Printf("READ exception status: 0x%02X", status)
+	return &modbus.ProtocolDataUnit{
+		FunctionCode: req.FunctionCode,
+		Data:         []byte{status},
+	}
+}
+
+func (h *Handler) handleGetCommEventCounter(req *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
+	if len(req.Data) != 0 {
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+	}
+	status, eventCount := h.dataStore.CommEventCounter()
+	log.Printf("GET comm event counter: status 0x%04X, count %d", status, eventCount)
+	return &modbus.ProtocolDataUnit{
+		FunctionCode: req.FunctionCode,
+		Data:         []byte{byte(status >> 8), byte(status), byte(eventCount >> 8), byte(eventCount)},
+	}
+}
+
+func (h *Handler) handleGetCommEventLog(req *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
+	if len(req.Data) != 0 {
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+	}
+	status, eventCount, messageCount, events := h.dataStore.CommEventLog()
+	log.Printf("GET comm event log: status 0x%04X, event count %d, message count %d, %d events", status, eventCount, messageCount, len(events))
+	data := make([]byte, 7, 7+len(events))
+	data[0] = byte(6 + len(events))
+	binary.BigEndian.PutUint16(data[1:], status)
+	binary.BigEndian.PutUint16(data[3:], eventCount)
+	binary.BigEndian.PutUint16(data[5:], messageCount)
+	return &modbus.ProtocolDataUnit{
+		FunctionCode: req.FunctionCode,
+		Data:         append(data, events...),
+	}
+}
+
+// restartCommunications clears the counters for a Restart Communications
+// Option request, and the comm event log too if it asks for it (0xFF00).
+func (h *Handler) restartCommunications(req *modbus.ProtocolDataUnit) {
+	h.dataStore.ClearCommEventCount()
+	if len(req.Data) >= 4 && binary.BigEndian.Uint16(req.Data[2:4]) == 0xFF00 {
+		h.dataStore.ClearCommEventLog()
+	}
+}
+
+func (h *Handler) handleDiagnostics(req *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
+	if len(req.Data) < 4 {
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+	}
+
+	subFunction := binary.BigEndian.Uint16(req.Data[0:2])
+
+	switch subFunction {
+	case modbus.DiagnosticReturnQueryData:
+		// Echo back the request
+		return &modbus.ProtocolDataUnit{
+			FunctionCode: req.FunctionCode,
+			Data:         req.Data,
+		}
+	case modbus.DiagnosticRestartCommunications:
+		value := binary.BigEndian.Uint16(req.Data[2:4])
+		if value != 0x0000 && value != 0xFF00 {
+			return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		}
+		h.restartCommunications(req)
+		log.Printf("DIAGNOSTICS: restart communications")
+		// Echo back the request
+		return &modbus.ProtocolDataUnit{
+			FunctionCode: req.FunctionCode,
+			Data:         req.Data,
+		}
+	case modbus.DiagnosticReturnDiagnosticRegister:
+		if binary.BigEndian.Uint16(req.Data[2:4]) != 0x0000 {
+			return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		}
+		value := h.dataStore.DiagnosticRegister()
+		log.Printf("DIAGNOSTICS: return diagnostic register 0x%04X", value)
+		return &modbus.ProtocolDataUnit{
+			FunctionCode: req.FunctionCode,
+			Data:         []byte{req.Data[0], req.Data[1], byte(value >> 8), byte(value)},
+		}
+	case modbus.DiagnosticClearOverrunCounter:
+		if binary.BigEndian.Uint16(req.Data[2:4]) != 0x0000 {
+			return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		}
+		h.dataStore.ClearOverrunCount()
+		log.Printf("DIAGNOSTICS: clear overrun counter and flag")
+		// Echo back the request
+		return &modbus.ProtocolDataUnit{
+			FunctionCode: req.FunctionCode,
+			Data:         req.Data,
+		}
+	case modbus.DiagnosticForceListenOnlyMode:
+		// No response is returned for this sub-function
+		h.dataStore.SetListenOnly(true)
+		log.Printf("DIAGNOSTICS: entering listen only mode")
+		return nil
+	default:
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalFunction)
+	}
+}
+
+// Helper functions
+
+// isDiagnostic reports whether req is a Diagnostics request for the given sub-function.
+func isDiagnostic(req *modbus.ProtocolDataUnit, subFunction uint16) bool {
+	return req.FunctionCode == modbus.FuncCodeDiagnostics &&
+		len(req.Data) >= 2 &&
+		binary.BigEndian.Uint16(req.Data[0:2]) == subFunction
+}
+
 // boolsToBytes converts a slice of bools to Modbus byte format.
 // The byte count is prepended, and bits are packed LSB first.
 func boolsToBytes(values []bool) []byte {
-	byteCount := (len(values) + 7) / 8
-	result := make([]byte, 1+byteCount)
-	result[0] = byte(byteCount)
-
-	for i, val := range values {
-		if val {
-			byteIndex := i/8 + 1
-			bitIndex := uint(i % 8)
-			result[byteIndex] |= 1 << bitIndex
-		}
-	}
-	return result
+	return modbus.NewCoilResponse(values).Data
 }
 
 // bytesToBools converts Modbus byte format to a slice of bools.
@@ -446,14 +815,7 @@ func bytesToBools(data []byte, quantity uint16) []bool {
 // registersToBytes converts a slice of uint16 registers to Modbus byte format.
 // The byte count is prepended, and each register is encoded big-endian.
 func registersToBytes(registers []uint16) []byte {
-	byteCount := len(registers) * 2
-	result := make([]byte, 1+byteCount)
-	result[0] = byte(byteCount)
-
-	for i, reg := range registers {
-		binary.BigEndian.PutUint16(result[1+i*2:], reg)
-	}
-	return result
+	return modbus.NewRegisterResponse(registers).Data
 }
 
 // bytesToRegisters converts Modbus byte format to a slice of uint16 registers.
@@ -469,70 +831,54 @@ func bytesToRegisters(data []byte) []uint16 {
 
 // Helper functions for formatting register names in logs
 
-func (h *Handler) formatCoilRange(address, quantity uint16) string {
-	var parts []string
-	for i := uint16(0); i < quantity; i++ {
-		addr := address + i
-		name := h.dataStore.GetCoilName(addr)
-		if name != "" {
-			parts = append(parts, fmt.Sprintf("%s (0x%04X)", name, addr))
-		} else {
-			parts = append(parts, fmt.Sprintf("0x%04X", addr))
-		}
+// formatRange joins the formatted entries of a range. Ranges of more than
+// five entries are abbreviated to the first and last one, so only those
+// are formatted.
+func formatRange(quantity uint16, format func(i uint16) string) string {
+	if quantity > 5 {
+		return fmt.Sprintf("%s ... %s (%d total)", format(0), format(quantity-1), quantity)
 	}
-	if len(parts) > 5 {
-		return fmt.Sprintf("%s ... %s (%d total)", parts[0], parts[len(parts)-1], quantity)
+	parts := make([]string, quantity)
+	for i := range parts {
+		parts[i] = format(uint16(i))
 	}
 	return strings.Join(parts, ", ")
 }
 
-func (h *Handler) formatDiscreteInputRange(address, quantity uint16) string {
-	var parts []string
-	for i := uint16(0); i < quantity; i++ {
-		addr := address + i
-		name := h.dataStore.GetDiscreteInputName(addr)
-		if name != "" {
-			parts = append(parts, fmt.Sprintf("%s (0x%04X)", name, addr))
-		} else {
-			parts = append(parts, fmt.Sprintf("0x%04X", addr))
-		}
+func formatBit(name string, addr uint16) string {
+	if name != "" {
+		return fmt.Sprintf("%s (0x%04X)", name, addr)
 	}
-	if len(parts) > 5 {
-		return fmt.Sprintf("%s ... %s (%d total)", parts[0], parts[len(parts)-1], quantity)
+	return fmt.Sprintf("0x%04X", addr)
+}
+
+func formatRegister(name string, addr, value uint16) string {
+	if name != "" {
+		return fmt.Sprintf("%s (0x%04X)=%d", name, addr, value)
 	}
-	return strings.Join(parts, ", ")
+	return fmt.Sprintf("0x%04X=%d", addr, value)
+}
+
+func (h *Handler) formatCoilRange(address, quantity uint16) string {
+	return formatRange(quantity, func(i uint16) string {
+		return formatBit(h.dataStore.GetCoilName(address+i), address+i)
+	})
+}
+
+func (h *Handler) formatDiscreteInputRange(address, quantity uint16) string {
+	return formatRange(quantity, func(i uint16) string {
+		return formatBit(h.dataStore.GetDiscreteInputName(address+i), address+i)
+	})
 }
 
 func (h *Handler) formatHoldingRegRange(address, quantity uint16, values []uint16) string {
-	var parts []string
-	for i := uint16(0); i < quantity; i++ {
-		addr := address + i
-		name := h.dataStore.GetHoldingRegName(addr)
-		if name != "" {
-			parts = append(parts, fmt.Sprintf("%s (0x%04X)=%d", name, addr, values[i]))
-		} else {
-			parts = append(parts, fmt.Sprintf("0x%04X=%d", addr, values[i]))
-		}
-	}
-	if len(parts) > 5 {
-		return fmt.Sprintf("%s ... %s (%d total)", parts[0], parts[len(parts)-1], quantity)
-	}
-	return strings.Join(parts, ", ")
+	return formatRange(quantity, func(i uint16) string {
+		return formatRegister(h.dataStore.GetHoldingRegName(address+i), address+i, values[i])
+	})
 }
 
 func (h *Handler) formatInputRegRange(address, quantity uint16, values []uint16) string {
-	var parts []string
-	for i := uint16(0); i < quantity; i++ {
-		addr := address + i
-		name := h.dataStore.GetInputRegName(addr)
-		if name != "" {
-			parts = append(parts, fmt.Sprintf("%s (0x%04X)=%d", name, addr, values[i]))
-		} else {
-			parts = append(parts, fmt.Sprintf("0x%04X=%d", addr, values[i]))
-		}
-	}
-	if len(parts) > 5 {
-		return fmt.Sprintf("%s ... %s (%d total)", parts[0], parts[len(parts)-1], quantity)
-	}
-	return strings.Join(parts, ", ")
+	return formatRange(quantity, func(i uint16) string {
+		return formatRegister(h.dataStore.GetInputRegName(address+i), address+i, values[i])
+	})
 }
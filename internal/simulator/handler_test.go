@@ -0,0 +1,528 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package simulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/lumberbarons/modbus"
+)
+
+func diagnosticRequest(subFunction, value uint16) *modbus.ProtocolDataUnit {
+	return &modbus.ProtocolDataUnit{
+		FunctionCode: modbus.FuncCodeDiagnostics,
+		Data:         []byte{byte(subFunction >> 8), byte(subFunction), byte(value >> 8), byte(value)},
+	}
+}
+
+func TestHandleDiagnostics_ReturnQueryData(t *testing.T) {
+	h := NewHandler(NewDataStore(nil))
+
+	req := diagnosticRequest(modbus.DiagnosticReturnQueryData, 0xA537)
+	resp := h.HandleRequest(req)
+	if resp == nil {
+		t.Fatal("expected response, got nil")
+	}
+	if resp.FunctionCode != modbus.FuncCodeDiagnostics {
+		t.Errorf("expected function code %d, got %d", modbus.FuncCodeDiagnostics, resp.FunctionCode)
+	}
+	if !bytes.Equal(resp.Data, req.Data) {
+		t.Errorf("expected echo %x, got %x", req.Data, resp.Data)
+	}
+}
+
+func TestHandleDiagnostics_ListenOnlyMode(t *testing.T) {
+	ds := NewDataStore(nil)
+	h := NewHandler(ds)
+
+	// Force listen only mode never responds
+	if resp := h.HandleRequest(diagnosticRequest(modbus.DiagnosticForceListenOnlyMode, 0)); resp != nil {
+		t.Fatalf("expected no response to force listen only, got %+v", resp)
+	}
+	if !ds.ListenOnly() {
+		t.Fatal("expected data store to be in listen only mode")
+	}
+
+	// Regular requests are ignored while in listen only mode
+	read := &modbus.ProtocolDataUnit{
+		FunctionCode: modbus.FuncCodeReadHoldingRegisters,
+		Data:         []byte{0x00, 0x00, 0x00, 0x01},
+	}
+	if resp := h.HandleRequest(read); resp != nil {
+		t.Fatalf("expected no response in listen only mode, got %+v", resp)
+	}
+
+	// Restart brings the device back online without responding
+	if resp := h.HandleRequest(diagnosticRequest(modbus.DiagnosticRestartCommunications, 0)); resp != nil {
+		t.Fatalf("expected no response to restart in listen only mode, got %+v", resp)
+	}
+	if ds.ListenOnly() {
+		t.Fatal("expected listen only mode to be cleared after restart")
+	}
+
+	if resp := h.HandleRequest(read); resp == nil || resp.FunctionCode != modbus.FuncCodeReadHoldingRegisters {
+		t.Fatalf("expected normal response after restart, got %+v", resp)
+	}
+}
+
+func TestHandleDiagnostics_RestartCommunications(t *testing.T) {
+	h := NewHandler(NewDataStore(nil))
+
+	req := diagnosticRequest(modbus.DiagnosticRestartCommunications, 0xFF00)
+	resp := h.HandleRequest(req)
+	if resp == nil {
+		t.Fatal("expected response, got nil")
+	}
+	if !bytes.Equal(resp.Data, req.Data) {
+		t.Errorf("expected echo %x, got %x", req.Data, resp.Data)
+	}
+
+	resp = h.HandleRequest(diagnosticRequest(modbus.DiagnosticRestartCommunications, 0x1234))
+	if resp == nil || resp.FunctionCode != modbus.FuncCodeDiagnostics|0x80 {
+		t.Fatalf("expected exception response, got %+v", resp)
+	}
+	if resp.Data[0] != modbus.ExceptionCodeIllegalDataValue {
+		t.Errorf("expected illegal data value, got %d", resp.Data[0])
+	}
+}
+
+func TestHandleDiagnostics_ReturnDiagnosticRegister(t *testing.T) {
+	h := NewHandler(NewDataStore(&DataStoreConfig{DiagnosticRegister: 0x8001}))
+
+	resp := h.HandleRequest(diagnosticRequest(modbus.DiagnosticReturnDiagnosticRegister, 0))
+	if resp == nil {
+		t.Fatal("expected response, got nil")
+	}
+	expected := []byte{0x00, 0x02, 0x80, 0x01}
+	if !bytes.Equal(resp.Data, expected) {
+		t.Errorf("expected %x, got %x", expected, resp.Data)
+	}
+
+	resp = h.HandleRequest(diagnosticRequest(modbus.DiagnosticReturnDiagnosticRegister, 0x0001))
+	if resp == nil || resp.FunctionCode != modbus.FuncCodeDiagnostics|0x80 {
+		t.Fatalf("expected exception response, got %+v", resp)
+	}
+}
+
+func TestHandleReadExceptionStatus(t *testing.T) {
+	h := NewHandler(NewDataStore(&DataStoreConfig{ExceptionStatus: 0x6D}))
+
+	resp := h.HandleRequest(&modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadExceptionStatus})
+	if resp == nil {
+		t.Fatal("expected response, got nil")
+	}
+	if !bytes.Equal(resp.Data, []byte{0x6D}) {
+		t.Errorf("expected 6d, got %x", resp.Data)
+	}
+}
+
+func TestHandleGetCommEventCounter(t *testing.T) {
+	h := NewHandler(NewDataStore(&DataStoreConfig{CommStatus: 0xFFFF}))
+	counter := &modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeGetCommEventCounter}
+
+	// Two successful requests and an exception
+	h.HandleRequest(&modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadHoldingRegisters, Data: []byte{0x00, 0x00, 0x00, 0x01}})
+	h.HandleRequest(&modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadExceptionStatus})
+	h.HandleRequest(&modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadHoldingRegisters, Data: []byte{0x00, 0x00, 0x00, 0x00}})
+
+	resp := h.HandleRequest(counter)
+	if resp == nil {
+		t.Fatal("expected response, got nil")
+	}
+	expected := []byte{0xFF, 0xFF, 0x00, 0x02}
+	if !bytes.Equal(resp.Data, expected) {
+		t.Errorf("expected %x, got %x", expected, resp.Data)
+	}
+
+	// Fetching the counter does not count
+	resp = h.HandleRequest(counter)
+	if !bytes.Equal(resp.Data, expected) {
+		t.Errorf("expected %x, got %x", expected, resp.Data)
+	}
+}
+
+func TestHandleGetCommEventLog(t *testing.T) {
+	h := NewHandler(NewDataStore(&DataStoreConfig{CommStatus: 0xFFFF, CommEventCount: 10, MessageCount: 20}))
+	eventLog := &modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeGetCommEventLog}
+
+	// A successful request and an exception
+	h.HandleRequest(&modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadHoldingRegisters, Data: []byte{0x00, 0x00, 0x00, 0x01}})
+	h.HandleRequest(&modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadCoils, Data: []byte{0x00, 0x00, 0x00, 0x00}})
+
+	resp := h.HandleRequest(eventLog)
+	if resp == nil {
+		t.Fatal("expected response, got nil")
+	}
+	// Every request is a message and logged, most recent first, the fetch
+	// included; only the successful one is an event.
+	expected := []byte{0x09, 0xFF, 0xFF, 0x00, 0x0B, 0x00, 0x17,
+		modbus.FuncCodeGetCommEventLog, modbus.FuncCodeReadCoils, modbus.FuncCodeReadHoldingRegisters}
+	if !bytes.Equal(resp.Data, expected) {
+		t.Errorf("expected %x, got %x", expected, resp.Data)
+	}
+
+	// The log keeps the 64 most recent events
+	for i := 0; i < 100; i++ {
+		h.HandleRequest(&modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadExceptionStatus})
+	}
+	resp = h.HandleRequest(eventLog)
+	if len(resp.Data) != 7+64 || resp.Data[0] != 6+64 {
+		t.Fatalf("expected 64 events, got %x", resp.Data)
+	}
+	if resp.Data[7] != modbus.FuncCodeGetCommEventLog || resp.Data[8] != modbus.FuncCodeReadExceptionStatus {
+		t.Errorf("expected the most recent events first, got %x", resp.Data[7:])
+	}
+	if count := binary.BigEndian.Uint16(resp.Data[5:]); count != 20+104 {
+		t.Errorf("expected message count %d, got %d", 20+104, count)
+	}
+
+	// Restart Communications Option with 0xFF00 clears the log as well; the
+	// restart itself then counts as an event.
+	h.HandleRequest(diagnosticRequest(modbus.DiagnosticRestartCommunications, 0xFF00))
+	resp = h.HandleRequest(eventLog)
+	expected = []byte{0x07, 0xFF, 0xFF, 0x00, 0x01, 0x00, 0x01, modbus.FuncCodeGetCommEventLog}
+	if !bytes.Equal(resp.Data, expected) {
+		t.Errorf("after restart: expected %x, got %x", expected, resp.Data)
+	}
+}
+
+func TestHandleDiagnostics_ClearOverrunCounter(t *testing.T) {
+	ds := NewDataStore(nil)
+	h := NewHandler(ds)
+	ds.CountOverrun()
+	ds.CountOverrun()
+
+	req := diagnosticRequest(modbus.DiagnosticClearOverrunCounter, 0)
+	resp := h.HandleRequest(req)
+	if resp == nil {
+		t.Fatal("expected response, got nil")
+	}
+	if !bytes.Equal(resp.Data, req.Data) {
+		t.Errorf("expected echo %x, got %x", req.Data, resp.Data)
+	}
+	if count := ds.OverrunCount(); count != 0 {
+		t.Errorf("expected overrun count cleared, got %d", count)
+	}
+}
+
+func TestHandleUnsupportedFunction(t *testing.T) {
+	req := &modbus.ProtocolDataUnit{FunctionCode: 0x41, Data: []byte{0x00}}
+
+	tests := []struct {
+		name     string
+		config   *DataStoreConfig
+		expected byte
+		silent   bool
+	}{
+		{"default", nil, modbus.ExceptionCodeIllegalFunction, false},
+		{"custom exception", &DataStoreConfig{DefaultException: modbus.ExceptionCodeIllegalDataValue}, modbus.ExceptionCodeIllegalDataValue, false},
+		{"silent", &DataStoreConfig{DefaultException: modbus.ExceptionCodeIllegalDataValue, SilentOnUnknown: true}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(NewDataStore(tt.config))
+			resp := h.HandleRequest(req)
+			if tt.silent {
+				if resp != nil {
+					t.Fatalf("expected no response, got %+v", resp)
+				}
+				return
+			}
+			if resp == nil || resp.FunctionCode != req.FunctionCode|0x80 {
+				t.Fatalf("expected exception response, got %+v", resp)
+			}
+			if resp.Data[0] != tt.expected {
+				t.Errorf("expected exception %d, got %d", tt.expected, resp.Data[0])
+			}
+		})
+	}
+}
+
+func TestHandleFileRecord(t *testing.T) {
+	ds := NewDataStore(&DataStoreConfig{
+		Files: map[uint16]map[uint16][]uint16{
+			4: {1: {0x0DFE, 0x0020}},
+			3: {9: {0x06AF, 0x04BE, 0x100D}},
+		},
+	})
+	h := NewHandler(ds)
+
+	// Two groups, as in the example of the specification
+	read := &modbus.ProtocolDataUnit{
+		FunctionCode: modbus.FuncCodeReadFileRecord,
+		Data: []byte{0x0E,
+			0x06, 0x00, 0x04, 0x00, 0x01, 0x00, 0x02,
+			0x06, 0x00, 0x03, 0x00, 0x09, 0x00, 0x02},
+	}
+	resp := h.HandleRequest(read)
+	expected := []byte{0x0C,
+		0x05, 0x06, 0x0D, 0xFE, 0x00, 0x20,
+		0x05, 0x06, 0x06, 0xAF, 0x04, 0xBE}
+	if resp == nil || resp.FunctionCode != modbus.FuncCodeReadFileRecord || !bytes.Equal(resp.Data, expected) {
+		t.Fatalf("read: expected % x, got %+v", expected, resp)
+	}
+
+	write := &modbus.ProtocolDataUnit{
+		FunctionCode: modbus.FuncCodeWriteFileRecord,
+		Data: []byte{0x0D,
+			0x06, 0x00, 0x03, 0x00, 0x09, 0x00, 0x03, 0x06, 0xAF, 0x04, 0xBE, 0x10, 0x0E},
+	}
+	resp = h.HandleRequest(write)
+	if resp == nil || !bytes.Equal(resp.Data, write.Data) {
+		t.Fatalf("write: expected echo % x, got %+v", write.Data, resp)
+	}
+	if values, err := ds.ReadFileRecord(3, 9, 3); err != nil || values[2] != 0x100E {
+		t.Errorf("expected written record, got %v, %v", values, err)
+	}
+
+	tests := []struct {
+		name      string
+		req       *modbus.ProtocolDataUnit
+		exception byte
+	}{
+		{"unknown file", &modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadFileRecord,
+			Data: []byte{0x07, 0x06, 0x00, 0x05, 0x00, 0x01, 0x00, 0x01}}, modbus.ExceptionCodeIllegalDataAddress},
+		{"unknown record", &modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadFileRecord,
+			Data: []byte{0x07, 0x06, 0x00, 0x04, 0x00, 0x02, 0x00, 0x01}}, modbus.ExceptionCodeIllegalDataAddress},
+		{"record too short", &modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadFileRecord,
+			Data: []byte{0x07, 0x06, 0x00, 0x04, 0x00, 0x01, 0x00, 0x03}}, modbus.ExceptionCodeIllegalDataAddress},
+		{"bad reference type", &modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadFileRecord,
+			Data: []byte{0x07, 0x05, 0x00, 0x04, 0x00, 0x01, 0x00, 0x01}}, modbus.ExceptionCodeIllegalDataAddress},
+		{"bad byte count", &modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadFileRecord,
+			Data: []byte{0x08, 0x06, 0x00, 0x04, 0x00, 0x01, 0x00, 0x01, 0x00}}, modbus.ExceptionCodeIllegalDataValue},
+		{"write unknown record", &modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeWriteFileRecord,
+			Data: []byte{0x09, 0x06, 0x00, 0x04, 0x00, 0x07, 0x00, 0x01, 0x12, 0x34}}, modbus.ExceptionCodeIllegalDataAddress},
+		{"write truncated data", &modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeWriteFileRecord,
+			Data: []byte{0x09, 0x06, 0x00, 0x04, 0x00, 0x01, 0x00, 0x02, 0x12, 0x34}}, modbus.ExceptionCodeIllegalDataValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := h.HandleRequest(tt.req)
+			if resp == nil || resp.FunctionCode != tt.req.FunctionCode|0x80 || len(resp.Data) != 1 || resp.Data[0] != tt.exception {
+				t.Errorf("expected exception %d, got %+v", tt.exception, resp)
+			}
+		})
+	}
+}
+
+func TestHandleWriteMultipleCoils_StrictPadding(t *testing.T) {
+	// 10 coils, bit 2 of the last byte is padding and set
+	req := &modbus.ProtocolDataUnit{
+		FunctionCode: modbus.FuncCodeWriteMultipleCoils,
+		Data:         []byte{0x00, 0x00, 0x00, 0x0A, 0x02, 0xCD, 0x05},
+	}
+
+	if resp := NewHandler(NewDataStore(nil)).HandleRequest(req); resp == nil || resp.FunctionCode != modbus.FuncCodeWriteMultipleCoils {
+		t.Fatalf("expected padding to be ignored by default, got %+v", resp)
+	}
+
+	h := NewHandler(NewDataStore(&DataStoreConfig{StrictCoilPadding: true}))
+	resp := h.HandleRequest(req)
+	if resp == nil || resp.FunctionCode != modbus.FuncCodeWriteMultipleCoils|0x80 || resp.Data[0] != modbus.ExceptionCodeIllegalDataValue {
+		t.Fatalf("expected IllegalDataValue, got %+v", resp)
+	}
+
+	req.Data[6] = 0x01
+	if resp := h.HandleRequest(req); resp == nil || resp.FunctionCode != modbus.FuncCodeWriteMultipleCoils {
+		t.Fatalf("expected zero padding to be accepted, got %+v", resp)
+	}
+}
+
+func TestHandleMaskWriteRegister_LastAddress(t *testing.T) {
+	ds := NewDataStore(&DataStoreConfig{HoldingRegs: map[uint16]uint16{0xFFFF: 0x0012}})
+	h := NewHandler(ds)
+
+	// Example of the specification: AND 0x00F2, OR 0x0025 on 0x0012
+	req := &modbus.ProtocolDataUnit{
+		FunctionCode: modbus.FuncCodeMaskWriteRegister,
+		Data:         []byte{0xFF, 0xFF, 0x00, 0xF2, 0x00, 0x25},
+	}
+	resp := h.HandleRequest(req)
+	if resp == nil || resp.FunctionCode != modbus.FuncCodeMaskWriteRegister {
+		t.Fatalf("expected mask write of address 65535 to succeed, got %+v", resp)
+	}
+	if !bytes.Equal(resp.Data, req.Data) {
+		t.Errorf("expected echo %x, got %x", req.Data, resp.Data)
+	}
+	values, err := ds.ReadHoldingRegisters(0xFFFF, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values[0] != 0x0017 {
+		t.Errorf("expected register 65535 = 0x0017, got 0x%04X", values[0])
+	}
+}
+
+func TestHandleRequest_AllowEmptyWrites(t *testing.T) {
+	for _, functionCode := range []byte{modbus.FuncCodeWriteMultipleCoils, modbus.FuncCodeWriteMultipleRegisters} {
+		req := &modbus.ProtocolDataUnit{
+			FunctionCode: functionCode,
+			Data:         []byte{0x00, 0x05, 0x00, 0x00, 0x00},
+		}
+
+		resp := NewHandler(NewDataStore(nil)).HandleRequest(req)
+		if resp == nil || resp.FunctionCode != functionCode|0x80 || resp.Data[0] != modbus.ExceptionCodeIllegalDataValue {
+			t.Errorf("function %#x: expected IllegalDataValue by default, got %+v", functionCode, resp)
+		}
+
+		h := NewHandler(NewDataStore(&DataStoreConfig{AllowEmptyWrites: true}))
+		resp = h.HandleRequest(req)
+		if resp == nil || resp.FunctionCode != functionCode || !bytes.Equal(resp.Data, []byte{0x00, 0x05, 0x00, 0x00}) {
+			t.Errorf("function %#x: expected address and quantity 0 to be echoed, got %+v", functionCode, resp)
+		}
+	}
+}
+
+func TestHandleRequest_QuantityExceptionCodes(t *testing.T) {
+	h := NewHandler(NewDataStore(&DataStoreConfig{
+		QuantityExceptionCodes: map[RegisterType]byte{RegisterTypeHoldingReg: modbus.ExceptionCodeIllegalDataAddress},
+	}))
+	tests := []struct {
+		name     string
+		req      *modbus.ProtocolDataUnit
+		expected byte
+	}{
+		{"read holding registers", &modbus.ProtocolDataUnit{
+			FunctionCode: modbus.FuncCodeReadHoldingRegisters,
+			Data:         []byte{0x00, 0x00, 0x00, 0x7E},
+		}, modbus.ExceptionCodeIllegalDataAddress},
+		{"write multiple registers", &modbus.ProtocolDataUnit{
+			FunctionCode: modbus.FuncCodeWriteMultipleRegisters,
+			Data:         []byte{0x00, 0x00, 0x00, 0x00, 0x00},
+		}, modbus.ExceptionCodeIllegalDataAddress},
+		{"read input registers", &modbus.ProtocolDataUnit{
+			FunctionCode: modbus.FuncCodeReadInputRegisters,
+			Data:         []byte{0x00, 0x00, 0x00, 0x7E},
+		}, modbus.ExceptionCodeIllegalDataValue},
+		{"read coils", &modbus.ProtocolDataUnit{
+			FunctionCode: modbus.FuncCodeReadCoils,
+			Data:         []byte{0x00, 0x00, 0x07, 0xD1},
+		}, modbus.ExceptionCodeIllegalDataValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := h.HandleRequest(tt.req)
+			if resp == nil || resp.FunctionCode != tt.req.FunctionCode|0x80 || resp.Data[0] != tt.expected {
+				t.Errorf("expected exception %#x, got %+v", tt.expected, resp)
+			}
+		})
+	}
+}
+
+func TestHandleRequest_RawResponse(t *testing.T) {
+	ds := NewDataStore(nil)
+	h := NewHandler(ds)
+
+	// A quirky response whose byte count doesn't match its data
+	raw := []byte{0x04, 0x00, 0x2A}
+	ds.SetRawResponse(modbus.FuncCodeReadHoldingRegisters, 10, raw)
+	raw[0] = 0xFF // SetRawResponse keeps a copy
+
+	readRequest := func(functionCode byte, address uint16) *modbus.ProtocolDataUnit {
+		return &modbus.ProtocolDataUnit{
+			FunctionCode: functionCode,
+			Data:         []byte{byte(address >> 8), byte(address), 0x00, 0x02},
+		}
+	}
+
+	resp := h.HandleRequest(readRequest(modbus.FuncCodeReadHoldingRegisters, 10))
+	if resp == nil || resp.FunctionCode != modbus.FuncCodeReadHoldingRegisters || !bytes.Equal(resp.Data, []byte{0x04, 0x00, 0x2A}) {
+		t.Fatalf("expected the raw response, got %+v", resp)
+	}
+
+	// Other addresses and functions are handled normally
+	resp = h.HandleRequest(readRequest(modbus.FuncCodeReadHoldingRegisters, 11))
+	if resp == nil || !bytes.Equal(resp.Data, []byte{0x04, 0x00, 0x00, 0x00, 0x00}) {
+		t.Errorf("address 11: expected stored values, got %+v", resp)
+	}
+	resp = h.HandleRequest(readRequest(modbus.FuncCodeReadInputRegisters, 10))
+	if resp == nil || !bytes.Equal(resp.Data, []byte{0x04, 0x00, 0x00, 0x00, 0x00}) {
+		t.Errorf("input registers: expected stored values, got %+v", resp)
+	}
+
+	ds.ClearRawResponse(modbus.FuncCodeReadHoldingRegisters, 10)
+	resp = h.HandleRequest(readRequest(modbus.FuncCodeReadHoldingRegisters, 10))
+	if resp == nil || !bytes.Equal(resp.Data, []byte{0x04, 0x00, 0x00, 0x00, 0x00}) {
+		t.Errorf("after clearing: expected stored values, got %+v", resp)
+	}
+}
+
+func TestHandleEncapsulatedInterface(t *testing.T) {
+	ds := NewDataStore(&DataStoreConfig{
+		DeviceIdentification: map[byte]string{0x00: "Acme", 0x01: "PX-1", 0x02: "1.2", 0x05: "Pump"},
+	})
+	h := NewHandler(ds)
+	request := func(data ...byte) *modbus.ProtocolDataUnit {
+		return &modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeEncapsulatedInterface, Data: data}
+	}
+
+	// Basic stream access skips the regular object
+	resp := h.HandleRequest(request(modbus.MEITypeReadDeviceIdentification, modbus.ReadDeviceIDBasic, 0x00))
+	expected := []byte{0x0E, 0x01, 0x82, 0x00, 0x00, 0x03,
+		0x00, 0x04, 'A', 'c', 'm', 'e', 0x01, 0x04, 'P', 'X', '-', '1', 0x02, 0x03, '1', '.', '2'}
+	if resp == nil || !bytes.Equal(resp.Data, expected) {
+		t.Fatalf("basic: expected %x, got %+v", expected, resp)
+	}
+	resp = h.HandleRequest(request(modbus.MEITypeReadDeviceIdentification, modbus.ReadDeviceIDSpecific, 0x05))
+	expected = []byte{0x0E, 0x04, 0x82, 0x00, 0x00, 0x01, 0x05, 0x04, 'P', 'u', 'm', 'p'}
+	if resp == nil || !bytes.Equal(resp.Data, expected) {
+		t.Fatalf("specific: expected %x, got %+v", expected, resp)
+	}
+	resp = h.HandleRequest(request(modbus.MEITypeReadDeviceIdentification, modbus.ReadDeviceIDSpecific, 0x06))
+	if resp == nil || !bytes.Equal(resp.Data, []byte{modbus.ExceptionCodeIllegalDataAddress}) {
+		t.Errorf("unknown object: expected IllegalDataAddress, got %+v", resp)
+	}
+	resp = h.HandleRequest(request(modbus.MEITypeReadDeviceIdentification, 0x05, 0x00))
+	if resp == nil || !bytes.Equal(resp.Data, []byte{modbus.ExceptionCodeIllegalDataValue}) {
+		t.Errorf("invalid code: expected IllegalDataValue, got %+v", resp)
+	}
+
+	// Other MEI types are unsupported until a handler is set
+	resp = h.HandleRequest(request(0x0D, 0x01, 0x02))
+	if resp == nil || !bytes.Equal(resp.Data, []byte{modbus.ExceptionCodeIllegalFunction}) {
+		t.Fatalf("unhandled MEI type: expected IllegalFunction, got %+v", resp)
+	}
+	ds.SetMEIHandler(0x0D, func(data []byte) []byte {
+		if len(data) == 0 {
+			return nil
+		}
+		return append([]byte{0x2A}, data...)
+	})
+	resp = h.HandleRequest(request(0x0D, 0x01, 0x02))
+	if resp == nil || resp.FunctionCode != modbus.FuncCodeEncapsulatedInterface || !bytes.Equal(resp.Data, []byte{0x0D, 0x2A, 0x01, 0x02}) {
+		t.Errorf("handled MEI type: expected the handler's response, got %+v", resp)
+	}
+	resp = h.HandleRequest(request(0x0D))
+	if resp == nil || !bytes.Equal(resp.Data, []byte{modbus.ExceptionCodeIllegalDataValue}) {
+		t.Errorf("rejected request: expected IllegalDataValue, got %+v", resp)
+	}
+	ds.SetMEIHandler(0x0D, nil)
+	resp = h.HandleRequest(request(0x0D, 0x01, 0x02))
+	if resp == nil || !bytes.Equal(resp.Data, []byte{modbus.ExceptionCodeIllegalFunction}) {
+		t.Errorf("removed handler: expected IllegalFunction, got %+v", resp)
+	}
+}
+
+func TestHandleReadDeviceIdentification_MoreFollows(t *testing.T) {
+	objects := make(map[byte]string)
+	for id := byte(0x80); id < 0x84; id++ {
+		objects[id] = string(bytes.Repeat([]byte{id}, 100))
+	}
+	h := NewHandler(NewDataStore(&DataStoreConfig{DeviceIdentification: objects}))
+
+	// Two 102-byte objects fit in a response, the third follows
+	resp := h.HandleRequest(&modbus.ProtocolDataUnit{
+		FunctionCode: modbus.FuncCodeEncapsulatedInterface,
+		Data:         []byte{modbus.MEITypeReadDeviceIdentification, modbus.ReadDeviceIDExtended, 0x00},
+	})
+	if resp == nil || len(resp.Data) != 6+2*102 {
+		t.Fatalf("expected two objects, got %+v", resp)
+	}
+	if !bytes.Equal(resp.Data[:6], []byte{0x0E, 0x03, 0x83, 0xFF, 0x82, 0x02}) {
+		t.Errorf("expected more follows from object 0x82, got header %x", resp.Data[:6])
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package simulator
+
+import (
+	"log"
+
+	"github.com/lumberbarons/modbus"
+)
+
+const (
+	// maxDeviceIDData is the size of the Read Device Identification
+	// response data: a PDU without its function code.
+	maxDeviceIDData = 252
+	// deviceIDHeaderSize covers the MEI type, read device id code,
+	// conformity level, more follows, next object id and number of objects.
+	deviceIDHeaderSize = 6
+	// maxDeviceIDObjectSize is the longest object value fitting in a
+	// response on its own.
+	maxDeviceIDObjectSize = maxDeviceIDData - deviceIDHeaderSize - 2
+)
+
+// handleEncapsulatedInterface dispatches an Encapsulated Interface Transport
+// request to the handler set for its MEI type, or to the built-in Read
+// Device Identification.
+func (h *Handler) handleEncapsulatedInterface(req *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
+	if len(req.Data) < 1 {
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+	}
+	meiType := req.Data[0]
+	if fn, ok := h.dataStore.MEIHandler(meiType); ok {
+		data := fn(append([]byte(nil), req.Data[1:]...))
+		if data == nil {
+			return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+		}
+		log.Printf("MEI type 0x%02X: % x -> % x", meiType, req.Data[1:], data)
+		return &modbus.ProtocolDataUnit{
+			FunctionCode: req.FunctionCode,
+			Data:         append([]byte{meiType}, data...),
+		}
+	}
+	if meiType == modbus.MEITypeReadDeviceIdentification {
+		if objects := h.dataStore.DeviceIdentification(); objects != nil {
+			return h.handleReadDeviceIdentification(req, objects)
+		}
+	}
+	return h.handleUnsupportedFunction(req)
+}
+
+// handleReadDeviceIdentification serves objects for a Read Device
+// Identification request, streaming the objects of the requested category
+// from the object id on, over as many responses as they need, or reading
+// the one object requested.
+func (h *Handler) handleReadDeviceIdentification(req *modbus.ProtocolDataUnit, objects map[byte][]byte) *modbus.ProtocolDataUnit {
+	if len(req.Data) != 3 {
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+	}
+	code, objectID := req.Data[1], req.Data[2]
+
+	var last byte
+	switch code {
+	case modbus.ReadDeviceIDBasic:
+		last = 0x02
+	case modbus.ReadDeviceIDRegular:
+		last = 0x7F
+	case modbus.ReadDeviceIDExtended:
+		last = 0xFF
+	case modbus.ReadDeviceIDSpecific:
+		if _, ok := objects[objectID]; !ok {
+			return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataAddress)
+		}
+	default:
+		return modbus.NewExceptionResponse(req.FunctionCode, modbus.ExceptionCodeIllegalDataValue)
+	}
+
+	data := []byte{modbus.MEITypeReadDeviceIdentification, code, conformityLevel(objects), 0x00, 0x00, 0x00}
+	if code == modbus.ReadDeviceIDSpecific {
+		data = appendDeviceIDObject(data, objectID, objects[objectID])
+		log.Printf("READ device identification: object 0x%02X", objectID)
+		return &modbus.ProtocolDataUnit{FunctionCode: req.FunctionCode, Data: data}
+	}
+
+	// Streaming restarts at the first object when the object id is not
+	// one of the category, as the specification requires.
+	if _, ok := objects[objectID]; !ok || objectID > last {
+		objectID = 0
+	}
+	for id := int(objectID); id <= int(last); id++ {
+		value, ok := objects[byte(id)]
+		if !ok {
+			continue
+		}
+		if len(data)+2+len(value) > maxDeviceIDData {
+			data[3], data[4] = 0xFF, byte(id)
+			break
+		}
+		data = appendDeviceIDObject(data, byte(id), value)
+	}
+	log.Printf("READ device identification: code %d from object 0x%02X, %d objects, more follows %v",
+		code, objectID, data[5], data[3] == 0xFF)
+	return &modbus.ProtocolDataUnit{FunctionCode: req.FunctionCode, Data: data}
+}
+
+// appendDeviceIDObject appends an object to a Read Device Identification
+// response and counts it.
+func appendDeviceIDObject(data []byte, id byte, value []byte) []byte {
+	data[5]++
+	data = append(data, id, byte(len(value)))
+	return append(data, value...)
+}
+
+// conformityLevel returns the conformity level matching the categories of
+// objects: stream and individual access to the basic, regular or extended
+// objects.
+func conformityLevel(objects map[byte][]byte) byte {
+	level := byte(0x81)
+	for id := range objects {
+		switch {
+		case id >= 0x80:
+			return 0x83
+		case id > 0x02:
+			level = 0x82
+		}
+	}
+	return level
+}
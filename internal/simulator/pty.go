@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"os"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/creack/pty"
@@ -104,6 +105,15 @@ func CreatePtyPair() (*PtyPair, error) {
 		return nil, fmt.Errorf("failed to open pty: %w", err)
 	}
 
+	// pty.Open leaves the master in blocking mode, where Close does not
+	// interrupt a pending Read and a server goroutine could block forever.
+	// Replace it with a non-blocking duplicate registered with the runtime
+	// poller, so that deadlines work and Close unblocks readers.
+	if master, err = nonblocking(master); err != nil {
+		slave.Close()
+		return nil, fmt.Errorf("failed to make pty master non-blocking: %w", err)
+	}
+
 	// The slave.Name() gives us the device path
 	slaveName := slave.Name()
 
@@ -114,3 +124,29 @@ func CreatePtyPair() (*PtyPair, error) {
 		SlavePath:  slaveName,
 	}, nil
 }
+
+// nonblocking returns a non-blocking duplicate of f and closes f.
+func nonblocking(f *os.File) (*os.File, error) {
+	defer f.Close()
+
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	fd := -1
+	var dupErr error
+	if err = conn.Control(func(sysfd uintptr) {
+		fd, dupErr = syscall.Dup(int(sysfd))
+	}); err != nil {
+		return nil, err
+	}
+	if dupErr != nil {
+		return nil, dupErr
+	}
+	syscall.CloseOnExec(fd)
+	if err = syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), f.Name()), nil
+}
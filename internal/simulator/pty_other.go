@@ -0,0 +1,55 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris)
+
+package simulator
+
+import (
+	"errors"
+	"time"
+)
+
+// errNoPty is returned on platforms without pseudo-terminals, where the
+// serial servers are created with NewRTUServerWithConn or
+// NewASCIIServerWithConn instead.
+var errNoPty = errors.New("pseudo-terminals are not supported on this platform")
+
+// PtyPair represents a pseudo-terminal pair with master and slave sides.
+// It can't be created on this platform.
+type PtyPair struct {
+	MasterPath string
+	SlavePath  string
+}
+
+// CreatePtyPair fails: pseudo-terminals are not supported on this platform.
+func CreatePtyPair() (*PtyPair, error) {
+	return nil, errNoPty
+}
+
+// Close fails as pseudo-terminals are not supported on this platform.
+func (p *PtyPair) Close() error {
+	return errNoPty
+}
+
+// Read fails as pseudo-terminals are not supported on this platform.
+func (p *PtyPair) Read(_ []byte) (int, error) {
+	return 0, errNoPty
+}
+
+// Write fails as pseudo-terminals are not supported on this platform.
+func (p *PtyPair) Write(_ []byte) (int, error) {
+	return 0, errNoPty
+}
+
+// SetReadDeadline fails as pseudo-terminals are not supported on this
+// platform.
+func (p *PtyPair) SetReadDeadline(_ time.Time) error {
+	return errNoPty
+}
+
+// Sync fails as pseudo-terminals are not supported on this platform.
+func (p *PtyPair) Sync() error {
+	return errNoPty
+}
@@ -0,0 +1,61 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package simulator
+
+import (
+	"sync"
+)
+
+const (
+	// Number of addresses covered by one lock shard
+	lockShardSize = 4096
+	lockShards    = maxAddress / lockShardSize
+)
+
+// rangeLock guards one address space with a lock per block of
+// lockShardSize addresses, so accesses to unrelated address ranges don't
+// contend. Ranges spanning several shards lock them in ascending order,
+// which keeps concurrent range locks deadlock free.
+type rangeLock struct {
+	shards [lockShards]sync.RWMutex
+}
+
+// shardSpan returns the first and last shard covering quantity addresses
+// starting at address. The range must have been validated.
+func shardSpan(address, quantity uint16) (first, last int) {
+	end := int(address) + int(quantity) - 1
+	if quantity == 0 {
+		end = int(address)
+	}
+	return int(address) / lockShardSize, end / lockShardSize
+}
+
+func (l *rangeLock) rlock(address, quantity uint16) {
+	first, last := shardSpan(address, quantity)
+	for i := first; i <= last; i++ {
+		l.shards[i].RLock()
+	}
+}
+
+func (l *rangeLock) runlock(address, quantity uint16) {
+	first, last := shardSpan(address, quantity)
+	for i := last; i >= first; i-- {
+		l.shards[i].RUnlock()
+	}
+}
+
+func (l *rangeLock) lock(address, quantity uint16) {
+	first, last := shardSpan(address, quantity)
+	for i := first; i <= last; i++ {
+		l.shards[i].Lock()
+	}
+}
+
+func (l *rangeLock) unlock(address, quantity uint16) {
+	first, last := shardSpan(address, quantity)
+	for i := last; i >= first; i-- {
+		l.shards[i].Unlock()
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package simulator
+
+import (
+	"context"
+
+	"github.com/lumberbarons/modbus"
+)
+
+// RequestHandler processes the requests a server receives, independently
+// of framing and transport. Implement it to serve requests from a backend
+// other than a DataStore, such as real hardware or a database. Handler is
+// the default, DataStore backed implementation.
+type RequestHandler interface {
+	// Handle processes a request addressed to unitID and returns the
+	// response, or nil if no response should be sent.
+	Handle(unitID byte, pdu *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit
+}
+
+// ContextRequestHandler is a RequestHandler that can abandon a request once
+// its response is no longer needed, e.g. because the TCP client closed the
+// connection. Servers use HandleContext when a handler implements it.
+type ContextRequestHandler interface {
+	RequestHandler
+	HandleContext(ctx context.Context, unitID byte, pdu *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit
+}
+
+// Handle implements RequestHandler. The data store serves every unit ID.
+func (h *Handler) Handle(_ byte, pdu *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
+	return h.HandleRequest(pdu)
+}
+
+// HandleContext implements ContextRequestHandler.
+func (h *Handler) HandleContext(ctx context.Context, _ byte, pdu *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
+	return h.HandleRequestContext(ctx, pdu)
+}
+
+// Handle implements RequestHandler with a Handler for the data store, so
+// that a DataStore can be passed to the servers as is. The servers wrap
+// it in a Handler of their own when created; Handle serves direct calls.
+func (ds *DataStore) Handle(unitID byte, pdu *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
+	return NewHandler(ds).Handle(unitID, pdu)
+}
+
+// HandleContext implements ContextRequestHandler like Handle.
+func (ds *DataStore) HandleContext(ctx context.Context, unitID byte, pdu *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
+	return NewHandler(ds).HandleContext(ctx, unitID, pdu)
+}
+
+// serverHandler returns the handler a server dispatches to: a DataStore
+// is wrapped once in a Handler with the server's timeout simulation
+// option, other handlers are used as is.
+func serverHandler(handler RequestHandler, disableTimeoutSimulation bool) RequestHandler {
+	if ds, ok := handler.(*DataStore); ok {
+		return NewHandlerWithOptions(ds, disableTimeoutSimulation)
+	}
+	return handler
+}
+
+// dataStoreOf returns the DataStore behind handler, or nil for custom
+// handlers.
+func dataStoreOf(handler RequestHandler) *DataStore {
+	switch h := handler.(type) {
+	case *Handler:
+		return h.dataStore
+	case *DataStore:
+		return h
+	default:
+		return nil
+	}
+}
+
+// handleContext returns the handler as a function taking a context.
+func handleContext(handler RequestHandler) func(context.Context, byte, *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
+	if h, ok := handler.(ContextRequestHandler); ok {
+		return h.HandleContext
+	}
+	return func(_ context.Context, unitID byte, pdu *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
+		return handler.Handle(unitID, pdu)
+	}
+}
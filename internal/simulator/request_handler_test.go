@@ -0,0 +1,102 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package simulator
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/lumberbarons/modbus"
+)
+
+var (
+	_ ContextRequestHandler = (*Handler)(nil)
+	_ ContextRequestHandler = (*DataStore)(nil)
+)
+
+// unitEchoHandler answers every read with one register holding the unit ID.
+type unitEchoHandler struct{}
+
+func (unitEchoHandler) Handle(unitID byte, pdu *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
+	if pdu.FunctionCode != modbus.FuncCodeReadHoldingRegisters {
+		return modbus.NewExceptionResponse(pdu.FunctionCode, modbus.ExceptionCodeIllegalFunction)
+	}
+	return modbus.NewRegisterResponse([]uint16{uint16(unitID)})
+}
+
+func TestTCPServer_RequestHandler(t *testing.T) {
+	server, err := NewTCPServerWithHandler(unitEchoHandler{}, &TCPServerConfig{
+		Address: "127.0.0.1:0",
+		Logger:  log.New(io.Discard, "", 0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	handler := modbus.NewTCPClientHandler(server.ConnectAddress())
+	handler.SlaveID = 7
+	defer handler.Close()
+	client := modbus.NewClient(handler)
+
+	results, err := client.ReadHoldingRegisters(context.Background(), 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal([]byte{0x00, 0x07}, results) {
+		t.Errorf("expected the unit ID, got % x", results)
+	}
+	if _, err = client.WriteSingleRegister(context.Background(), 0, 1); err == nil {
+		t.Error("expected the handler's exception")
+	}
+}
+
+func TestDataStore_Handle(t *testing.T) {
+	ds := NewDataStore(&DataStoreConfig{HoldingRegs: map[uint16]uint16{3: 0xBEEF}})
+	resp := ds.Handle(1, &modbus.ProtocolDataUnit{
+		FunctionCode: modbus.FuncCodeReadHoldingRegisters,
+		Data:         []byte{0x00, 0x03, 0x00, 0x01},
+	})
+	if resp == nil || !bytes.Equal([]byte{0x02, 0xBE, 0xEF}, resp.Data) {
+		t.Errorf("expected the stored value, got %+v", resp)
+	}
+}
+
+func TestServerHandler_DataStore(t *testing.T) {
+	ds := NewDataStore(nil)
+	tests := []struct {
+		name    string
+		handler RequestHandler
+		// disableTimeoutSimulation is the option expected of the Handler
+		disableTimeoutSimulation bool
+	}{
+		{"RTU", NewRTUServerWithConn(ds, nil, &RTUServerConfig{Logger: log.New(io.Discard, "", 0)}).handler, true},
+		{"ASCII", NewASCIIServerWithConn(ds, nil, &ASCIIServerConfig{Logger: log.New(io.Discard, "", 0)}).handler, true},
+		{"TCP", serverHandler(ds, false), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, ok := tt.handler.(*Handler)
+			if !ok {
+				t.Fatalf("expected the data store wrapped in a Handler, got %T", tt.handler)
+			}
+			if h.dataStore != ds || h.disableTimeoutSimulation != tt.disableTimeoutSimulation {
+				t.Errorf("expected a Handler for the data store with disableTimeoutSimulation %v, got %+v",
+					tt.disableTimeoutSimulation, h)
+			}
+		})
+	}
+
+	// Other handlers are used as is
+	if h := serverHandler(unitEchoHandler{}, true); h != (unitEchoHandler{}) {
+		t.Errorf("expected the handler unchanged, got %T", h)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package simulator
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lumberbarons/modbus"
+)
+
+// RequestLogEntry is one line of the structured request log.
+type RequestLogEntry struct {
+	Time         time.Time `json:"time"`
+	UnitID       byte      `json:"unitId"`
+	FunctionCode byte      `json:"functionCode"`
+	Address      *uint16   `json:"address,omitempty"`
+	Quantity     *uint16   `json:"quantity,omitempty"`
+	// Response holds the response data in hex, empty for exceptions
+	Response string `json:"response,omitempty"`
+	// Exception holds the exception code if the request was rejected
+	Exception byte `json:"exception,omitempty"`
+	// NoResponse is set when no response was sent (timeout simulation,
+	// listen only mode or a broadcast request)
+	NoResponse bool `json:"noResponse,omitempty"`
+}
+
+// requestLogger writes RequestLogEntry values as JSON lines. A nil
+// requestLogger discards all entries.
+type requestLogger struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// newRequestLogger returns a requestLogger writing to w, or nil if w is nil.
+func newRequestLogger(w io.Writer) *requestLogger {
+	if w == nil {
+		return nil
+	}
+	return &requestLogger{enc: json.NewEncoder(w)}
+}
+
+// log records a handled request and its response, which may be nil.
+func (l *requestLogger) log(unitID byte, request, response *modbus.ProtocolDataUnit) {
+	if l == nil {
+		return
+	}
+	entry := RequestLogEntry{
+		Time:         time.Now(),
+		UnitID:       unitID,
+		FunctionCode: request.FunctionCode,
+	}
+	entry.Address, entry.Quantity = requestFields(request)
+	switch {
+	case response == nil:
+		entry.NoResponse = true
+	case response.FunctionCode&0x80 != 0 && len(response.Data) > 0:
+		entry.Exception = response.Data[0]
+	default:
+		entry.Response = hex.EncodeToString(response.Data)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.enc.Encode(&entry); err != nil {
+		log.Printf("failed to write request log: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package simulator
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/lumberbarons/modbus"
+)
+
+func TestRequestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := newRequestLogger(&buf)
+	handler := NewHandler(NewDataStore(&DataStoreConfig{HoldingRegs: map[uint16]uint16{10: 0x1234}}))
+
+	requests := []*modbus.ProtocolDataUnit{
+		{FunctionCode: modbus.FuncCodeReadHoldingRegisters, Data: []byte{0x00, 0x0A, 0x00, 0x01}},
+		{FunctionCode: modbus.FuncCodeReadHoldingRegisters, Data: []byte{0xFF, 0xFF, 0x00, 0x02}},
+	}
+	for _, req := range requests {
+		l.log(1, req, handler.HandleRequest(req))
+	}
+
+	dec := json.NewDecoder(&buf)
+	var entries []RequestLogEntry
+	for dec.More() {
+		var entry RequestLogEntry
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 log entries, got %d", len(entries))
+	}
+	first := entries[0]
+	if first.UnitID != 1 || first.FunctionCode != modbus.FuncCodeReadHoldingRegisters ||
+		first.Address == nil || *first.Address != 10 || first.Quantity == nil || *first.Quantity != 1 {
+		t.Errorf("unexpected request fields: %+v", first)
+	}
+	if first.Response != "021234" || first.Exception != 0 {
+		t.Errorf("unexpected response fields: %+v", first)
+	}
+	if entries[1].Exception != modbus.ExceptionCodeIllegalDataAddress {
+		t.Errorf("expected illegal data address exception, got %+v", entries[1])
+	}
+
+	// A nil logger discards entries
+	newRequestLogger(nil).log(1, requests[0], nil)
+}
+
+func TestDescribeExchange(t *testing.T) {
+	handler := NewHandler(NewDataStore(&DataStoreConfig{HoldingRegs: map[uint16]uint16{10: 0x1234, 11: 7}}))
+
+	tests := []struct {
+		req  *modbus.ProtocolDataUnit
+		want string
+	}{
+		{
+			&modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadHoldingRegisters, Data: []byte{0x00, 0x0A, 0x00, 0x02}},
+			"unit 1 Read Holding Registers address 10 quantity 2 -> values [4660 7]",
+		},
+		{
+			&modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeWriteSingleRegister, Data: []byte{0x00, 0x05, 0x00, 0x2A}},
+			"unit 1 Write Single Register address 5 values [42] -> 00 05 00 2a",
+		},
+		{
+			&modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeWriteMultipleRegisters, Data: []byte{0x00, 0x01, 0x00, 0x02, 0x04, 0x00, 0x01, 0x00, 0x02}},
+			"unit 1 Write Multiple Registers address 1 quantity 2 values [1 2] -> 00 01 00 02",
+		},
+		{
+			&modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadHoldingRegisters, Data: []byte{0xFF, 0xFF, 0x00, 0x02}},
+			"unit 1 Read Holding Registers address 65535 quantity 2 -> exception 2",
+		},
+	}
+	for _, tt := range tests {
+		if got := describeExchange(1, tt.req, handler.HandleRequest(tt.req)); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+
+	req := &modbus.ProtocolDataUnit{FunctionCode: 0x64}
+	if got, want := describeExchange(0, req, nil), "unit 0 Function 100 -> no response"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
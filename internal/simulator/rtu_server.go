@@ -5,9 +5,12 @@
 package simulator
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math/rand/v2"
 	"os"
 	"time"
 
@@ -17,17 +20,36 @@ import (
 const (
 	rtuMinSize = 4
 	rtuMaxSize = 256
+
+	// serverStopTimeout is how long Stop waits for a serial server's serve
+	// goroutine before reporting that it is still handling a request
+	serverStopTimeout = time.Second
 )
 
 // RTUServer implements a Modbus RTU server.
 type RTUServer struct {
-	handler  *Handler
-	pty      *PtyPair
-	slaveID  byte
-	baudRate int
-	logger   *log.Logger
-	stopChan chan struct{}
-	doneChan chan struct{}
+	handler RequestHandler
+	conn    ServerConn
+	// pty is the pseudo-terminal whose master side is conn, nil when
+	// serving a connection passed to NewRTUServerWithConn
+	pty        *PtyPair
+	slaveID    byte
+	baudRate   int
+	logger     *log.Logger
+	requestLog *requestLogger
+	stopChan   chan struct{}
+	doneChan   chan struct{}
+	// ctx is passed to the handler and cancelled by Stop, so that the
+	// request in flight is abandoned
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// respondToBroadcastReads answers read requests sent to unit 0
+	respondToBroadcastReads bool
+	// logLevel is the verbosity of the log
+	logLevel LogLevel
+	// corrupter alters responses with CorruptionProbability
+	corrupter *corrupter
 }
 
 // RTUServerConfig holds configuration for the RTU server.
@@ -35,10 +57,47 @@ type RTUServerConfig struct {
 	SlaveID  byte
 	BaudRate int
 	Logger   *log.Logger
+	// RequestLog, if set, receives one JSON line per handled request
+	RequestLog io.Writer
+	// RespondToBroadcastReads answers read requests sent to unit 0, the
+	// broadcast address, like nonconforming gateways treating it as any
+	// device. Other broadcast requests are still executed without answer.
+	RespondToBroadcastReads bool
+	// LogLevel selects the verbosity of the log. LogLevelDebug logs a
+	// decoded summary of every request and response.
+	LogLevel LogLevel
+	// CorruptionProbability is the probability, from 0 to 1, that a byte
+	// of the data or CRC of a response is altered before it is sent, to
+	// exercise the CRC handling of clients. The default 0 sends every
+	// response intact.
+	CorruptionProbability float64
+	// Rand is the random source of CorruptionProbability, nil for a
+	// randomly seeded one. Tests set a seeded one to be reproducible.
+	Rand *rand.Rand
 }
 
 // NewRTUServer creates a new RTU server with the given data store and configuration.
 func NewRTUServer(ds *DataStore, config *RTUServerConfig) (*RTUServer, error) {
+	// Disable timeout simulation for RTU (PTYs don't support it)
+	return NewRTUServerWithHandler(NewHandlerWithOptions(ds, true), config)
+}
+
+// NewRTUServerWithHandler creates a new RTU server dispatching requests to
+// handler.
+func NewRTUServerWithHandler(handler RequestHandler, config *RTUServerConfig) (*RTUServer, error) {
+	pty, err := CreatePtyPair()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pty: %w", err)
+	}
+	s := NewRTUServerWithConn(handler, pty, config)
+	s.pty = pty
+	return s, nil
+}
+
+// NewRTUServerWithConn creates a new RTU server dispatching requests read
+// from conn, the device end of a serial line such as an in-memory one, to
+// handler. The server has no client device path; Stop closes conn.
+func NewRTUServerWithConn(handler RequestHandler, conn ServerConn, config *RTUServerConfig) *RTUServer {
 	if config == nil {
 		config = &RTUServerConfig{}
 	}
@@ -52,62 +111,75 @@ func NewRTUServer(ds *DataStore, config *RTUServerConfig) (*RTUServer, error) {
 		config.Logger = log.New(os.Stdout, "rtu-server: ", log.LstdFlags)
 	}
 
-	pty, err := CreatePtyPair()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create pty: %w", err)
-	}
-
+	ctx, cancel := context.WithCancel(context.Background())
 	return &RTUServer{
-		handler:  NewHandlerWithOptions(ds, true), // Disable timeout simulation for RTU (PTYs don't support it)
-		pty:      pty,
-		slaveID:  config.SlaveID,
-		baudRate: config.BaudRate,
-		logger:   config.Logger,
-		stopChan: make(chan struct{}),
-		doneChan: make(chan struct{}),
-	}, nil
+		// Timeout simulation doesn't work over serial lines
+		handler:                 serverHandler(handler, true),
+		conn:                    conn,
+		slaveID:                 config.SlaveID,
+		baudRate:                config.BaudRate,
+		logger:                  config.Logger,
+		requestLog:              newRequestLogger(config.RequestLog),
+		stopChan:                make(chan struct{}),
+		doneChan:                make(chan struct{}),
+		ctx:                     ctx,
+		cancel:                  cancel,
+		respondToBroadcastReads: config.RespondToBroadcastReads,
+		logLevel:                config.LogLevel,
+		corrupter:               newCorrupter(config.CorruptionProbability, config.Rand),
+	}
 }
 
-// ClientDevicePath returns the device path that clients should connect to.
+// ClientDevicePath returns the device path that clients should connect to,
+// or "" for a server created with NewRTUServerWithConn.
 func (s *RTUServer) ClientDevicePath() string {
+	if s.pty == nil {
+		return ""
+	}
 	return s.pty.SlavePath
 }
 
 // Start starts the RTU server in a goroutine.
 func (s *RTUServer) Start() error {
 	go s.serve()
-	// Give the server and socat time to fully initialize
-	time.Sleep(200 * time.Millisecond)
+	if s.pty != nil {
+		// Give the server and socat time to fully initialize
+		time.Sleep(200 * time.Millisecond)
+	}
 	return nil
 }
 
-// Stop stops the RTU server and waits for it to finish.
+// Stop stops the RTU server and waits for it to finish. The request in
+// flight, if any, is cancelled; an error is returned if its handler
+// doesn't return within serverStopTimeout.
 func (s *RTUServer) Stop() error {
 	close(s.stopChan)
+	s.cancel()
 
 	// Close the pty to unblock any pending reads
-	if err := s.pty.Close(); err != nil {
+	if err := s.conn.Close(); err != nil {
 		s.logger.Printf("error closing pty: %v", err)
 	}
 
-	// Wait for server goroutine to finish with a timeout
+	// Closing the non-blocking pty interrupts any pending read, so serve
+	// returns as soon as the request in flight, if any, is abandoned
 	select {
 	case <-s.doneChan:
-		// Clean shutdown
-	case <-time.After(1 * time.Second):
-		// Timeout - the goroutine is stuck in a blocking read
-		// This is OK, it will be garbage collected
-		s.logger.Printf("RTU server stop timed out (goroutine may still be reading)")
+		return nil
+	case <-time.After(serverStopTimeout):
+		return fmt.Errorf("RTU server still handling a request after %v", serverStopTimeout)
 	}
-
-	return nil
 }
 
 // serve is the main server loop that reads requests and sends responses.
 func (s *RTUServer) serve() {
 	defer close(s.doneChan)
 
-	s.logger.Printf("RTU server listening - server pty: %s, client pty: %s (slave ID: %d)", s.pty.MasterPath, s.pty.SlavePath, s.slaveID)
+	if s.pty != nil {
+		s.logger.Printf("RTU server listening - server pty: %s, client pty: %s (slave ID: %d)", s.pty.MasterPath, s.pty.SlavePath, s.slaveID)
+	} else {
+		s.logger.Printf("RTU server listening (slave ID: %d)", s.slaveID)
+	}
 
 	for {
 		select {
@@ -130,7 +202,7 @@ func (s *RTUServer) serve() {
 // handleRequest reads a single request frame and sends a response.
 func (s *RTUServer) handleRequest() error {
 	// Set read timeout to allow checking stopChan periodically
-	if err := s.pty.SetReadDeadline(time.Now().Add(500 * time.Millisecond)); err != nil {
+	if err := s.conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond)); err != nil {
 		// Ignore deadline errors - not critical
 		s.logger.Printf("warning: failed to set read deadline: %v", err)
 	}
@@ -143,7 +215,7 @@ func (s *RTUServer) handleRequest() error {
 			return nil
 		}
 		// Check if error is due to closed file (EOF or bad file descriptor)
-		if err == io.EOF || err == os.ErrClosed {
+		if err == io.EOF || errors.Is(err, os.ErrClosed) {
 			return io.EOF // Signal to stop serving
 		}
 		s.logger.Printf("error reading frame: %v", err)
@@ -161,41 +233,54 @@ func (s *RTUServer) handleRequest() error {
 	}
 
 	// Check slave ID
-	if adu[0] != s.slaveID && adu[0] != 0 { // 0 is broadcast
+	if adu[0] != s.slaveID && adu[0] != broadcastAddress {
 		// Not for us, ignore
 		return nil
 	}
 
 	// Handle the request
-	responsePDU := s.handler.HandleRequest(pdu)
+	responsePDU := handleContext(s.handler)(s.ctx, adu[0], pdu)
+	if !answersRequest(adu[0], pdu, s.respondToBroadcastReads) {
+		responsePDU = nil
+	}
+	s.requestLog.log(adu[0], pdu, responsePDU)
+	logExchange(s.logger, s.logLevel, adu[0], pdu, responsePDU)
 
-	// Check if timeout simulation (no response)
+	// Check if no response should be sent (timeout simulation, listen only
+	// mode or broadcast)
 	if responsePDU == nil {
 		// Don't send any response - simulate timeout
 		return nil
 	}
 
-	// Encode the response
+	// Encode the response, from unit 0 for an answered broadcast read
+	packager.SlaveID = adu[0]
 	responseADU, err := packager.Encode(responsePDU)
 	if err != nil {
 		s.logger.Printf("failed to encode response: %v", err)
 		return nil
 	}
 
+	// Alter the data or CRC, keeping the slave ID and function code the
+	// client sizes the response from
+	if s.corrupter.flip(responseADU, 2, len(responseADU)) {
+		s.logger.Printf("corrupting response")
+	}
+
 	// Add frame delay (3.5 character times)
 	delay := s.calculateDelay(len(adu))
 	time.Sleep(delay)
 
 	// Send the response
 	s.logger.Printf("sending: % x", responseADU)
-	n, err := s.pty.Write(responseADU)
+	n, err := s.conn.Write(responseADU)
 	if err != nil {
 		return fmt.Errorf("failed to write response: %w", err)
 	}
 	s.logger.Printf("wrote %d bytes", n)
 
 	// Sync to ensure data is flushed
-	if err := s.pty.Sync(); err != nil {
+	if err := s.conn.Sync(); err != nil {
 		s.logger.Printf("warning: failed to sync: %v", err)
 	}
 
@@ -207,7 +292,7 @@ func (s *RTUServer) readFrame() ([]byte, error) {
 	var buffer [rtuMaxSize]byte
 
 	// Read minimum frame size first
-	n, err := io.ReadAtLeast(s.pty, buffer[:], rtuMinSize)
+	n, err := io.ReadAtLeast(s.conn, buffer[:], rtuMinSize)
 	if err != nil {
 		return nil, err
 	}
@@ -217,7 +302,7 @@ func (s *RTUServer) readFrame() ([]byte, error) {
 
 	// Read remaining bytes if needed
 	if expectedLength > n && expectedLength <= rtuMaxSize {
-		n2, err := io.ReadFull(s.pty, buffer[n:expectedLength])
+		n2, err := io.ReadFull(s.conn, buffer[n:expectedLength])
 		if err != nil {
 			return nil, err
 		}
@@ -242,11 +327,22 @@ func (s *RTUServer) calculateExpectedLength(data []byte) int {
 			byteCount := int(data[6])
 			return 7 + byteCount + 2 // address(2) + quantity(2) + func(1) + slave(1) + byteCount(1) + data + crc(2)
 		}
+	case modbus.FuncCodeReadFileRecord, modbus.FuncCodeWriteFileRecord:
+		if len(data) >= 3 {
+			byteCount := int(data[2])
+			return 3 + byteCount + 2 // slave(1) + func(1) + byteCount(1) + sub-requests + crc(2)
+		}
 	case modbus.FuncCodeReadWriteMultipleRegisters:
 		if len(data) >= 11 {
 			byteCount := int(data[10])
 			return 11 + byteCount + 2 // fixed header + data + crc
 		}
+	case modbus.FuncCodeEncapsulatedInterface:
+		// Only Read Device Identification has a known size; the requests
+		// of other MEI types carry no length to delimit them by.
+		if len(data) >= 3 && data[2] == modbus.MEITypeReadDeviceIdentification {
+			return 7 // slave(1) + func(1) + MEI type(1) + read device id code(1) + object id(1) + crc(2)
+		}
 	}
 
 	// For most functions, the request is fixed size
@@ -261,12 +357,15 @@ func (s *RTUServer) getFixedRequestLength(functionCode byte) int {
 		modbus.FuncCodeReadHoldingRegisters,
 		modbus.FuncCodeReadInputRegisters,
 		modbus.FuncCodeWriteSingleCoil,
-		modbus.FuncCodeWriteSingleRegister:
-		return 8 // slave(1) + func(1) + address(2) + value(2) + crc(2)
+		modbus.FuncCodeWriteSingleRegister,
+		modbus.FuncCodeDiagnostics:
+		return 8 // slave(1) + func(1) + address/sub-function(2) + value(2) + crc(2)
 	case modbus.FuncCodeMaskWriteRegister:
 		return 10 // slave(1) + func(1) + address(2) + andMask(2) + orMask(2) + crc(2)
 	case modbus.FuncCodeReadFIFOQueue:
 		return 6 // slave(1) + func(1) + address(2) + crc(2)
+	case modbus.FuncCodeReadExceptionStatus, modbus.FuncCodeGetCommEventCounter, modbus.FuncCodeGetCommEventLog:
+		return rtuMinSize // slave(1) + func(1) + crc(2)
 	default:
 		return rtuMaxSize // Unknown function, read maximum
 	}
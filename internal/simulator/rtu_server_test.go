@@ -0,0 +1,50 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package simulator
+
+import (
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestRTUServer_StopDoesNotLeakGoroutines(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+
+	for i := 0; i < 10; i++ {
+		server, err := NewRTUServer(NewDataStore(nil), &RTUServerConfig{
+			Logger: log.New(io.Discard, "", 0),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// A connected client keeps the pty open, so the server's pending
+		// read is only interrupted by Stop itself
+		client, err := os.OpenFile(server.ClientDevicePath(), os.O_RDWR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = server.Start(); err != nil {
+			t.Fatal(err)
+		}
+		err = server.Stop()
+		client.Close()
+		if err != nil {
+			t.Fatalf("iteration %d: %v", i, err)
+		}
+	}
+
+	// Goroutines of the runtime poller may take a moment to wind down
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > baseline {
+		t.Errorf("expected at most %d goroutines after stop, got %d", baseline, n)
+	}
+}
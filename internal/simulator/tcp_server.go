@@ -5,10 +5,12 @@
 package simulator
 
 import (
-	"encoding/binary"
+	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"log"
+	"math/rand/v2"
 	"net"
 	"os"
 	"sync"
@@ -25,22 +27,64 @@ const (
 
 // TCPServer implements a Modbus TCP server.
 type TCPServer struct {
-	handler  *Handler
-	listener net.Listener
-	address  string
-	logger   *log.Logger
-	stopChan chan struct{}
-	wg       sync.WaitGroup
+	// handle processes a request for a unit and returns the response, or
+	// nil if no response should be sent. ctx is done once the client has
+	// closed the connection or the server is stopping.
+	handle     func(ctx context.Context, unitID byte, req *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit
+	listener   net.Listener
+	address    string
+	logger     *log.Logger
+	requestLog *requestLogger
+	stopChan   chan struct{}
+	// ctx is cancelled by Stop to abort requests in progress
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// respondToBroadcastReads answers read requests sent to unit 0
+	respondToBroadcastReads bool
+	// logLevel is the verbosity of the log
+	logLevel LogLevel
+	// corrupter alters responses with CorruptionProbability
+	corrupter *corrupter
 }
 
 // TCPServerConfig holds configuration for the TCP server.
 type TCPServerConfig struct {
 	Address string // e.g., "localhost:5020" or ":502"
 	Logger  *log.Logger
+	// RequestLog, if set, receives one JSON line per handled request
+	RequestLog io.Writer
+	// RespondToBroadcastReads answers read requests sent to unit 0, the
+	// broadcast address, like nonconforming gateways treating it as any
+	// device. Other broadcast requests are still executed without answer.
+	RespondToBroadcastReads bool
+	// LogLevel selects the verbosity of the log. LogLevelDebug logs a
+	// decoded summary of every request and response.
+	LogLevel LogLevel
+	// CorruptionProbability is the probability, from 0 to 1, that a byte
+	// of the data of a response is altered before it is sent, to
+	// exercise the response handling of clients. The default 0 sends every
+	// response intact.
+	CorruptionProbability float64
+	// Rand is the random source of CorruptionProbability, nil for a
+	// randomly seeded one. Tests set a seeded one to be reproducible.
+	Rand *rand.Rand
 }
 
 // NewTCPServer creates a new TCP server with the given data store and configuration.
 func NewTCPServer(ds *DataStore, config *TCPServerConfig) (*TCPServer, error) {
+	return NewTCPServerWithHandler(NewHandler(ds), config)
+}
+
+// NewTCPServerWithHandler creates a new TCP server dispatching requests to
+// handler.
+func NewTCPServerWithHandler(handler RequestHandler, config *TCPServerConfig) (*TCPServer, error) {
+	return newTCPServer(config, handleContext(serverHandler(handler, false))), nil
+}
+
+// newTCPServer creates a TCP server dispatching requests to handle.
+func newTCPServer(config *TCPServerConfig, handle func(context.Context, byte, *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit) *TCPServer {
 	if config == nil {
 		config = &TCPServerConfig{}
 	}
@@ -51,12 +95,19 @@ func NewTCPServer(ds *DataStore, config *TCPServerConfig) (*TCPServer, error) {
 		config.Logger = log.New(os.Stdout, "tcp-server: ", log.LstdFlags)
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	return &TCPServer{
-		handler:  NewHandler(ds),
-		address:  config.Address,
-		logger:   config.Logger,
-		stopChan: make(chan struct{}),
-	}, nil
+		handle:                  handle,
+		address:                 config.Address,
+		logger:                  config.Logger,
+		requestLog:              newRequestLogger(config.RequestLog),
+		stopChan:                make(chan struct{}),
+		ctx:                     ctx,
+		cancel:                  cancel,
+		respondToBroadcastReads: config.RespondToBroadcastReads,
+		logLevel:                config.LogLevel,
+		corrupter:               newCorrupter(config.CorruptionProbability, config.Rand),
+	}
 }
 
 // Address returns the address the server is listening on.
@@ -67,6 +118,25 @@ func (s *TCPServer) Address() string {
 	return s.address
 }
 
+// ConnectAddress returns an address clients can connect to: Address with a
+// wildcard host, such as ":502" or "[::]:502", replaced by 127.0.0.1.
+func (s *TCPServer) ConnectAddress() string {
+	return connectAddress(s.Address())
+}
+
+// connectAddress replaces a missing or unspecified host in address by the
+// IPv4 loopback address.
+func connectAddress(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
+
 // Start starts the TCP server and begins accepting connections.
 func (s *TCPServer) Start() error {
 	listener, err := net.Listen("tcp", s.address)
@@ -88,6 +158,7 @@ func (s *TCPServer) Start() error {
 // Stop stops the TCP server and waits for all connections to close.
 func (s *TCPServer) Stop() error {
 	close(s.stopChan)
+	s.cancel()
 
 	if s.listener != nil {
 		s.listener.Close()
@@ -137,6 +208,40 @@ func (s *TCPServer) acceptLoop() {
 	}
 }
 
+// handleRequest passes a request to the handler with a context that is
+// cancelled if the client closes the connection or the server stops in the
+// meantime, so that delays are cut short. It returns the context error in
+// that case, as there is no one left to respond to.
+func (s *TCPServer) handleRequest(conn net.Conn, reader *bufio.Reader, unitID byte, pdu *modbus.ProtocolDataUnit) (*modbus.ProtocolDataUnit, error) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+
+	// Wait for more data without a deadline. Peek leaves a pipelined
+	// request in the buffer, any other error means the connection is gone.
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, fmt.Errorf("clearing read deadline: %w", err)
+	}
+	watchDone := make(chan struct{})
+	go func() {
+		defer close(watchDone)
+		if _, err := reader.Peek(1); err != nil && !os.IsTimeout(err) {
+			cancel()
+		}
+	}()
+
+	responsePDU := s.handle(ctx, unitID, pdu)
+
+	// Stop the watcher before the connection is read again
+	if err := conn.SetReadDeadline(time.Now()); err != nil {
+		s.logger.Printf("warning: failed to set read deadline: %v", err)
+	}
+	<-watchDone
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return responsePDU, nil
+}
+
 // handleConnection handles a single client connection.
 func (s *TCPServer) handleConnection(conn net.Conn) {
 	defer s.wg.Done()
@@ -144,6 +249,9 @@ func (s *TCPServer) handleConnection(conn net.Conn) {
 
 	s.logger.Printf("handling connection from %s", conn.RemoteAddr())
 
+	// Buffered so that the next request can be peeked at to detect the
+	// client closing the connection while a request is handled
+	reader := bufio.NewReader(conn)
 	for {
 		select {
 		case <-s.stopChan:
@@ -158,7 +266,7 @@ func (s *TCPServer) handleConnection(conn net.Conn) {
 
 			// Read MBAP header (7 bytes)
 			header := make([]byte, tcpHeaderSize)
-			_, err := io.ReadFull(conn, header)
+			_, err := io.ReadFull(reader, header)
 			if err != nil {
 				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
 					// Timeout is expected, allows checking stopChan
@@ -173,10 +281,12 @@ func (s *TCPServer) handleConnection(conn net.Conn) {
 			}
 
 			// Parse MBAP header
-			transactionID := binary.BigEndian.Uint16(header[0:2])
-			protocolID := binary.BigEndian.Uint16(header[2:4])
-			length := binary.BigEndian.Uint16(header[4:6])
-			unitID := header[6]
+			mbap, err := modbus.DecodeMBAP(header)
+			if err != nil {
+				s.logger.Printf("invalid header from %s: %v", conn.RemoteAddr(), err)
+				return
+			}
+			protocolID, length, unitID := mbap.ProtocolID, mbap.Length, mbap.UnitID
 
 			// Verify protocol ID
 			if protocolID != tcpProtocolIdentifier {
@@ -193,7 +303,7 @@ func (s *TCPServer) handleConnection(conn net.Conn) {
 			// Read PDU (length - 1 byte for unit ID)
 			pduLength := int(length) - 1
 			pduData := make([]byte, pduLength)
-			_, err = io.ReadFull(conn, pduData)
+			_, err = io.ReadFull(reader, pduData)
 			if err != nil {
 				s.logger.Printf("error reading PDU from %s: %v", conn.RemoteAddr(), err)
 				return
@@ -216,9 +326,19 @@ func (s *TCPServer) handleConnection(conn net.Conn) {
 			}
 
 			// Handle the request
-			responsePDU := s.handler.HandleRequest(pdu)
+			responsePDU, err := s.handleRequest(conn, reader, unitID, pdu)
+			if err != nil {
+				s.logger.Printf("dropping response to %s: %v", conn.RemoteAddr(), err)
+				return
+			}
+			if !answersRequest(unitID, pdu, s.respondToBroadcastReads) {
+				responsePDU = nil
+			}
+			s.requestLog.log(unitID, pdu, responsePDU)
+			logExchange(s.logger, s.logLevel, unitID, pdu, responsePDU)
 
-			// Check if timeout simulation (no response)
+			// Check if no response should be sent (timeout simulation, listen
+			// only mode or broadcast)
 			if responsePDU == nil {
 				// Don't send any response - simulate timeout
 				// Keep connection open but don't respond to this request
@@ -226,12 +346,12 @@ func (s *TCPServer) handleConnection(conn net.Conn) {
 			}
 
 			// Build response MBAP header
-			responseLength := uint16(1 + 1 + len(responsePDU.Data)) // unit ID + function code + data
-			responseHeader := make([]byte, tcpHeaderSize)
-			binary.BigEndian.PutUint16(responseHeader[0:2], transactionID)
-			binary.BigEndian.PutUint16(responseHeader[2:4], protocolID)
-			binary.BigEndian.PutUint16(responseHeader[4:6], responseLength)
-			responseHeader[6] = unitID
+			responseHeader := modbus.MBAPHeader{
+				TransactionID: mbap.TransactionID,
+				ProtocolID:    protocolID,
+				Length:        uint16(1 + 1 + len(responsePDU.Data)), // unit ID + function code + data
+				UnitID:        unitID,
+			}.Encode()
 
 			// Build response PDU
 			response := make([]byte, 0, len(responseHeader)+1+len(responsePDU.Data))
@@ -239,6 +359,12 @@ func (s *TCPServer) handleConnection(conn net.Conn) {
 			response = append(response, responsePDU.FunctionCode)
 			response = append(response, responsePDU.Data...)
 
+			// Alter the data, keeping the header framing the response
+			// and the function code
+			if s.corrupter.flip(response, int(tcpHeaderSize)+1, len(response)) {
+				s.logger.Printf("corrupting response to %s", conn.RemoteAddr())
+			}
+
 			s.logger.Printf("sending to %s: % x", conn.RemoteAddr(), response)
 
 			// Send response
@@ -0,0 +1,101 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package simulator
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lumberbarons/modbus"
+)
+
+func TestConnectAddress(t *testing.T) {
+	tests := []struct {
+		address  string
+		expected string
+	}{
+		{":502", "127.0.0.1:502"},
+		{"0.0.0.0:502", "127.0.0.1:502"},
+		{"[::]:502", "127.0.0.1:502"},
+		{"192.168.1.10:502", "192.168.1.10:502"},
+		{"[fe80::1]:502", "[fe80::1]:502"},
+		{"localhost:502", "localhost:502"},
+	}
+	for _, tt := range tests {
+		if actual := connectAddress(tt.address); actual != tt.expected {
+			t.Errorf("%s: expected %s, actual %s", tt.address, tt.expected, actual)
+		}
+	}
+}
+
+func TestTCPServer_ConnectAddress(t *testing.T) {
+	server, err := NewTCPServer(NewDataStore(nil), &TCPServerConfig{
+		Address: ":0",
+		Logger:  log.New(io.Discard, "", 0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	address := server.ConnectAddress()
+	if !strings.HasPrefix(address, "127.0.0.1:") {
+		t.Fatalf("expected a loopback address, got %s (listening on %s)", address, server.Address())
+	}
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
+
+func TestTCPServer_ClientCloseCancelsRequest(t *testing.T) {
+	cancelled := make(chan time.Duration, 1)
+	server := newTCPServer(&TCPServerConfig{
+		Address: "127.0.0.1:0",
+		Logger:  log.New(io.Discard, "", 0),
+	}, func(ctx context.Context, _ byte, req *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
+		start := time.Now()
+		select {
+		case <-ctx.Done():
+			cancelled <- time.Since(start)
+			return nil
+		case <-time.After(5 * time.Second):
+			return req
+		}
+	})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	conn, err := net.Dial("tcp", server.ConnectAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Read Holding Registers, address 0, quantity 1
+	if _, err = conn.Write([]byte{0, 1, 0, 0, 0, 6, 1, 3, 0, 0, 0, 1}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	conn.Close()
+
+	select {
+	case elapsed := <-cancelled:
+		if elapsed > time.Second {
+			t.Errorf("expected the request to be cancelled promptly, took %v", elapsed)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("request context not cancelled after the client closed the connection")
+	}
+}
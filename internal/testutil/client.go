@@ -0,0 +1,65 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package testutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lumberbarons/modbus"
+	"github.com/lumberbarons/modbus/internal/simulator"
+)
+
+// StartSimulatorClient starts a simulator with slave ID 1 serving config
+// over transport, "TCP", "RTU" or "ASCII", for tests run against each of
+// them. It returns a cleanup function that should be deferred, a client
+// of the simulator with the given timeout, 0 for the handler's default,
+// and a function changing the unit or slave ID of the client's requests.
+//
+// Example usage:
+//
+//	for _, transport := range []string{"TCP", "RTU"} {
+//	    t.Run(transport, func(t *testing.T) {
+//	        cleanup, client, _ := testutil.StartSimulatorClient(t, transport, config, 0)
+//	        defer cleanup()
+//	        // ... use client ...
+//	    })
+//	}
+func StartSimulatorClient(t *testing.T, transport string, config *simulator.DataStoreConfig, timeout time.Duration) (cleanup func(), client modbus.Client, setSlaveID func(id byte)) {
+	t.Helper()
+
+	switch transport {
+	case "TCP":
+		stop, address := StartTCPSimulator(t, WithTCPDataStoreConfig(config))
+		handler := modbus.NewTCPClientHandler(address)
+		handler.SlaveID = 1
+		if timeout > 0 {
+			handler.Timeout = timeout
+		}
+		cleanup = func() { handler.Close(); stop() }
+		return cleanup, modbus.NewClient(handler), func(id byte) { handler.SlaveID = id }
+	case "RTU":
+		stop, devicePath := StartRTUSimulator(t, WithDataStoreConfig(config))
+		handler := modbus.NewRTUClientHandler(devicePath)
+		handler.SlaveID = 1
+		if timeout > 0 {
+			handler.Timeout = timeout
+		}
+		cleanup = func() { handler.Close(); stop() }
+		return cleanup, modbus.NewClient(handler), func(id byte) { handler.SlaveID = id }
+	case "ASCII":
+		stop, devicePath := StartASCIISimulator(t, WithASCIIDataStoreConfig(config))
+		handler := modbus.NewASCIIClientHandler(devicePath)
+		handler.SlaveID = 1
+		if timeout > 0 {
+			handler.Timeout = timeout
+		}
+		cleanup = func() { handler.Close(); stop() }
+		return cleanup, modbus.NewClient(handler), func(id byte) { handler.SlaveID = id }
+	default:
+		t.Fatalf("unknown transport %q", transport)
+		return nil, nil, nil
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package testutil
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"go.bug.st/serial"
+
+	"github.com/lumberbarons/modbus/internal/simulator"
+)
+
+// SerialLine is an in-memory serial line between a client and a simulated
+// device, so that serial framing can be tested without pseudo-terminals.
+// Bytes written by one end are read by the other in order; nothing is lost,
+// whatever the timing.
+type SerialLine struct {
+	toDevice *byteQueue
+	toClient *byteQueue
+}
+
+// NewSerialLine creates a serial line with both ends idle.
+func NewSerialLine() *SerialLine {
+	return &SerialLine{toDevice: newByteQueue(), toClient: newByteQueue()}
+}
+
+// Open opens a port on the client end of the line. It has the signature of
+// serial.Open, ignoring its arguments, to be set as the OpenPort of a
+// serial client handler. Each call returns a new port on the same line, so
+// the handler can close and reopen it like a real one.
+func (l *SerialLine) Open(_ string, _ *serial.Mode) (serial.Port, error) {
+	return &linePort{line: l, readTimeout: serial.NoTimeout, done: make(chan struct{})}, nil
+}
+
+// Device returns the device end of the line, to be served by
+// simulator.NewRTUServerWithConn or simulator.NewASCIIServerWithConn.
+// Closing it hangs up the line: the client end then reads io.EOF.
+func (l *SerialLine) Device() simulator.ServerConn {
+	return &lineDevice{line: l}
+}
+
+// byteQueue is one direction of a SerialLine.
+type byteQueue struct {
+	mu     sync.Mutex
+	data   []byte
+	closed bool
+	// ready is closed, and replaced, whenever data are written or the
+	// queue is closed, to wake up a waiting reader
+	ready chan struct{}
+}
+
+func newByteQueue() *byteQueue {
+	return &byteQueue{ready: make(chan struct{})}
+}
+
+// read reads the queued bytes into p, waiting for some to be written until
+// the queue is closed (io.EOF), timeout fires (0 bytes, timedOut) or done is
+// closed (os.ErrClosed). A nil channel never fires.
+func (q *byteQueue) read(p []byte, timeout <-chan time.Time, done <-chan struct{}) (n int, timedOut bool, err error) {
+	for {
+		q.mu.Lock()
+		if len(q.data) > 0 {
+			n = copy(p, q.data)
+			q.data = q.data[n:]
+			q.mu.Unlock()
+			return n, false, nil
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return 0, false, io.EOF
+		}
+		ready := q.ready
+		q.mu.Unlock()
+
+		select {
+		case <-ready:
+		case <-timeout:
+			return 0, true, nil
+		case <-done:
+			return 0, false, os.ErrClosed
+		}
+	}
+}
+
+func (q *byteQueue) write(p []byte) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return 0, io.ErrClosedPipe
+	}
+	q.data = append(q.data, p...)
+	q.wake()
+	return len(p), nil
+}
+
+// reset discards the queued bytes.
+func (q *byteQueue) reset() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.data = nil
+}
+
+func (q *byteQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed {
+		q.closed = true
+		q.wake()
+	}
+}
+
+// wake wakes up a waiting reader. The caller must hold the mutex.
+func (q *byteQueue) wake() {
+	close(q.ready)
+	q.ready = make(chan struct{})
+}
+
+// linePort is a serial.Port on the client end of a SerialLine. Like a real
+// port, a read that times out returns 0 bytes and no error.
+type linePort struct {
+	line *SerialLine
+
+	mu          sync.Mutex
+	readTimeout time.Duration
+	closeOnce   sync.Once
+	done        chan struct{}
+}
+
+func (p *linePort) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	readTimeout := p.readTimeout
+	p.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if readTimeout != serial.NoTimeout {
+		timer := time.NewTimer(readTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	n, _, err := p.line.toClient.read(b, timeout, p.done)
+	return n, err
+}
+
+func (p *linePort) Write(b []byte) (int, error) {
+	select {
+	case <-p.done:
+		return 0, os.ErrClosed
+	default:
+	}
+	return p.line.toDevice.write(b)
+}
+
+func (p *linePort) SetReadTimeout(t time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.readTimeout = t
+	return nil
+}
+
+func (p *linePort) ResetInputBuffer() error {
+	p.line.toClient.reset()
+	return nil
+}
+
+func (p *linePort) Close() error {
+	p.closeOnce.Do(func() { close(p.done) })
+	return nil
+}
+
+// Writes reach the device at once, so there is no output to wait for or
+// discard, and the line has no modem control lines.
+
+func (p *linePort) SetMode(_ *serial.Mode) error { return nil }
+func (p *linePort) Drain() error                 { return nil }
+func (p *linePort) ResetOutputBuffer() error     { return nil }
+func (p *linePort) SetDTR(_ bool) error          { return nil }
+func (p *linePort) SetRTS(_ bool) error          { return nil }
+func (p *linePort) Break(_ time.Duration) error  { return nil }
+
+func (p *linePort) GetModemStatusBits() (*serial.ModemStatusBits, error) {
+	return &serial.ModemStatusBits{}, nil
+}
+
+// lineDevice is the device end of a SerialLine.
+type lineDevice struct {
+	line *SerialLine
+
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+func (d *lineDevice) Read(b []byte) (int, error) {
+	d.mu.Lock()
+	deadline := d.deadline
+	d.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	n, timedOut, err := d.line.toDevice.read(b, timeout, nil)
+	if timedOut {
+		return 0, os.ErrDeadlineExceeded
+	}
+	return n, err
+}
+
+func (d *lineDevice) Write(b []byte) (int, error) {
+	return d.line.toClient.write(b)
+}
+
+func (d *lineDevice) SetReadDeadline(t time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.deadline = t
+	return nil
+}
+
+func (d *lineDevice) Sync() error {
+	return nil
+}
+
+func (d *lineDevice) Close() error {
+	d.line.toDevice.close()
+	d.line.toClient.close()
+	return nil
+}
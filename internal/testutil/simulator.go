@@ -7,6 +7,7 @@ package testutil
 import (
 	"testing"
 
+	"github.com/lumberbarons/modbus"
 	"github.com/lumberbarons/modbus/internal/simulator"
 )
 
@@ -95,6 +96,63 @@ func StartRTUSimulator(t *testing.T, opts ...RTUSimulatorOption) (cleanup func()
 	return cleanup, devicePath
 }
 
+// StartRTULineSimulator starts an RTU Modbus simulator on an in-memory
+// SerialLine, needing no pseudo-terminal, and returns a client connected to
+// it through an RTU handler using the options' slave ID and baud rate. It
+// also returns a cleanup function that should be deferred, and the handler
+// for tests to adjust.
+//
+// Example usage:
+//
+//	cleanup, client, _ := testutil.StartRTULineSimulator(t)
+//	defer cleanup()
+//
+//	results, err := client.ReadHoldingRegisters(ctx, 0, 2)
+func StartRTULineSimulator(t *testing.T, opts ...RTUSimulatorOption) (cleanup func(), client modbus.Client, handler *modbus.RTUClientHandler) {
+	t.Helper()
+
+	// Apply options
+	config := &rtuSimulatorConfig{
+		slaveID:  1,
+		baudRate: 19200,
+	}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	// Serve the device end of the line, without timeout simulation like
+	// the PTY simulator
+	line := NewSerialLine()
+	ds := simulator.NewDataStore(config.config)
+	server := simulator.NewRTUServerWithConn(simulator.NewHandlerWithOptions(ds, true), line.Device(), &simulator.RTUServerConfig{
+		SlaveID:  config.slaveID,
+		BaudRate: config.baudRate,
+	})
+	if err := server.Start(); err != nil {
+		t.Fatalf("failed to start RTU simulator: %v", err)
+	}
+
+	handler = modbus.NewRTUClientHandler("line")
+	handler.SlaveID = config.slaveID
+	handler.BaudRate = config.baudRate
+	handler.OpenPort = line.Open
+	if err := handler.Connect(); err != nil {
+		server.Stop()
+		t.Fatalf("failed to connect to RTU simulator: %v", err)
+	}
+	t.Logf("RTU simulator started on an in-memory line (slave ID: %d)", config.slaveID)
+
+	cleanup = func() {
+		handler.Close()
+		if err := server.Stop(); err != nil {
+			t.Errorf("failed to stop RTU simulator: %v", err)
+		}
+		t.Logf("RTU simulator stopped")
+	}
+
+	return cleanup, modbus.NewClient(handler), handler
+}
+
 // ASCIISimulatorOption configures an ASCII simulator.
 type ASCIISimulatorOption func(*asciiSimulatorConfig)
 
@@ -176,6 +234,7 @@ type TCPSimulatorOption func(*tcpSimulatorConfig)
 type tcpSimulatorConfig struct {
 	address string
 	config  *simulator.DataStoreConfig
+	handler simulator.RequestHandler
 }
 
 // WithTCPAddress sets the TCP address for the simulator.
@@ -192,6 +251,15 @@ func WithTCPDataStoreConfig(config *simulator.DataStoreConfig) TCPSimulatorOptio
 	}
 }
 
+// WithTCPHandler makes the TCP simulator dispatch requests to h, e.g. to
+// script exceptions or raw responses. It takes precedence over
+// WithTCPDataStoreConfig.
+func WithTCPHandler(h simulator.RequestHandler) TCPSimulatorOption {
+	return func(c *tcpSimulatorConfig) {
+		c.handler = h
+	}
+}
+
 // StartTCPSimulator creates and starts a TCP Modbus simulator for testing.
 // It returns a cleanup function that should be deferred, and the address
 // that clients should use to connect.
@@ -206,11 +274,14 @@ func StartTCPSimulator(t *testing.T, opts ...TCPSimulatorOption) (cleanup func()
 		opt(config)
 	}
 
-	// Create data store
-	ds := simulator.NewDataStore(config.config)
+	// Serve from a data store unless a handler is given
+	handler := config.handler
+	if handler == nil {
+		handler = simulator.NewHandler(simulator.NewDataStore(config.config))
+	}
 
 	// Create TCP server
-	server, err := simulator.NewTCPServer(ds, &simulator.TCPServerConfig{
+	server, err := simulator.NewTCPServerWithHandler(handler, &simulator.TCPServerConfig{
 		Address: config.address,
 	})
 	if err != nil {
@@ -222,7 +293,7 @@ func StartTCPSimulator(t *testing.T, opts ...TCPSimulatorOption) (cleanup func()
 		t.Fatalf("failed to start TCP simulator: %v", err)
 	}
 
-	address = server.Address()
+	address = server.ConnectAddress()
 	t.Logf("TCP simulator started on %s", address)
 
 	cleanup = func() {
@@ -0,0 +1,47 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// repeatLimiter collapses a message logged again and again, such as the
+// same error while a device is down, into one line with a count.
+type repeatLimiter struct {
+	mu sync.Mutex
+	// last is the last message written and at when it was written
+	last string
+	at   time.Time
+	// repeats counts the times last was suppressed since
+	repeats int
+}
+
+// logf writes the message to logger unless it is the last one written and
+// window has not elapsed since, in which case it is only counted. The count
+// is written before the next message that is. A window of 0 or less writes
+// every message.
+func (l *repeatLimiter) logf(logger *log.Logger, window time.Duration, now time.Time, format string, v ...interface{}) {
+	if window <= 0 {
+		logger.Printf(format, v...)
+		return
+	}
+	msg := fmt.Sprintf(format, v...)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if msg == l.last && now.Sub(l.at) < window {
+		l.repeats++
+		return
+	}
+	if l.repeats > 0 {
+		logger.Printf("modbus: last message repeated %d times", l.repeats)
+	}
+	logger.Print(msg)
+	l.last, l.at, l.repeats = msg, now, 0
+}
@@ -0,0 +1,65 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRepeatLimiter(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(&buf, "", 0)
+	var l repeatLimiter
+	start := time.Unix(0, 0)
+
+	for i := 0; i < 1000; i++ {
+		l.logf(logger, time.Second, start.Add(time.Duration(i)*time.Millisecond/2), "modbus: opening %s failed", "/dev/ttyUSB0")
+	}
+	// Still repeated, but the window has elapsed
+	l.logf(logger, time.Second, start.Add(time.Second), "modbus: opening %s failed", "/dev/ttyUSB0")
+	l.logf(logger, time.Second, start.Add(time.Second), "modbus: opening %s failed", "/dev/ttyUSB0")
+	l.logf(logger, time.Second, start.Add(time.Second), "modbus: connected")
+
+	want := []string{
+		"modbus: opening /dev/ttyUSB0 failed",
+		"modbus: last message repeated 999 times",
+		"modbus: opening /dev/ttyUSB0 failed",
+		"modbus: last message repeated 1 times",
+		"modbus: connected",
+	}
+	if got := strings.Split(strings.TrimSpace(buf.String()), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got lines\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Without a window every message is written
+	buf.Reset()
+	var unlimited repeatLimiter
+	for i := 0; i < 3; i++ {
+		unlimited.logf(logger, 0, start, "modbus: same")
+	}
+	if n := strings.Count(buf.String(), "modbus: same"); n != 3 {
+		t.Errorf("expected 3 lines without a window, got %d", n)
+	}
+}
+
+func TestSerialLogRepeatWindow(t *testing.T) {
+	var buf bytes.Buffer
+	mb := &serialPort{Logger: log.New(&buf, "", 0), LogRepeatWindow: time.Minute}
+	for i := 0; i < 5; i++ {
+		mb.logf("modbus: discarding short frame: %v", "unexpected EOF")
+	}
+	mb.logf("modbus: received % x", []byte{1, 3})
+
+	if got := strings.Count(buf.String(), "\n"); got != 3 {
+		t.Errorf("expected 3 lines, got %d:\n%s", got, buf.String())
+	}
+	if !strings.Contains(buf.String(), "last message repeated 4 times") {
+		t.Errorf("expected repeat count, got:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// MBAPHeaderSize is the size of the Modbus Application Protocol header that
+// precedes the PDU in Modbus TCP frames.
+const MBAPHeaderSize = tcpHeaderSize
+
+// MBAPHeader is the Modbus Application Protocol header of a Modbus TCP
+// frame. Length counts the bytes following it: the unit id and the PDU.
+type MBAPHeader struct {
+	TransactionID uint16
+	ProtocolID    uint16
+	Length        uint16
+	UnitID        byte
+}
+
+// DecodeMBAP decodes the MBAP header at the start of a Modbus TCP frame,
+// such as one taken from a capture. The fields are not validated.
+func DecodeMBAP(frame []byte) (MBAPHeader, error) {
+	if len(frame) < MBAPHeaderSize {
+		return MBAPHeader{}, fmt.Errorf("%w: frame length '%v' does not meet minimum '%v'", ErrShortFrame, len(frame), MBAPHeaderSize)
+	}
+	return decodeMBAP(frame), nil
+}
+
+// decodeMBAP decodes the MBAP header of frame, which the caller has checked
+// is long enough.
+func decodeMBAP(frame []byte) MBAPHeader {
+	return MBAPHeader{
+		TransactionID: binary.BigEndian.Uint16(frame),
+		ProtocolID:    binary.BigEndian.Uint16(frame[2:]),
+		Length:        binary.BigEndian.Uint16(frame[4:]),
+		UnitID:        frame[6],
+	}
+}
+
+// Encode returns the header in its wire format.
+func (h MBAPHeader) Encode() []byte {
+	frame := make([]byte, MBAPHeaderSize)
+	h.put(frame)
+	return frame
+}
+
+// put writes the header to the start of frame, which must have room for it.
+func (h MBAPHeader) put(frame []byte) {
+	binary.BigEndian.PutUint16(frame, h.TransactionID)
+	binary.BigEndian.PutUint16(frame[2:], h.ProtocolID)
+	binary.BigEndian.PutUint16(frame[4:], h.Length)
+	frame[6] = h.UnitID
+}
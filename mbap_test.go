@@ -0,0 +1,40 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestMBAPHeader(t *testing.T) {
+	header := MBAPHeader{TransactionID: 0xBEEF, ProtocolID: 0, Length: 6, UnitID: 0x11}
+	frame := header.Encode()
+	if expected := []byte{0xBE, 0xEF, 0x00, 0x00, 0x00, 0x06, 0x11}; !bytes.Equal(frame, expected) {
+		t.Errorf("encoded: expected % x, actual % x", expected, frame)
+	}
+	decoded, err := DecodeMBAP(append(frame, 0x03, 0x00, 0x6B, 0x00, 0x03))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded != header {
+		t.Errorf("decoded: expected %+v, actual %+v", header, decoded)
+	}
+
+	// Matches the header written by the TCP packager
+	packager := &tcpPackager{SlaveID: 0x11, transactionID: 0xBEEE}
+	adu, err := packager.Encode(&ProtocolDataUnit{FunctionCode: FuncCodeReadHoldingRegisters, Data: []byte{0x00, 0x6B, 0x00, 0x03}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded, _ = DecodeMBAP(adu); decoded != header {
+		t.Errorf("packager header: expected %+v, actual %+v", header, decoded)
+	}
+
+	if _, err = DecodeMBAP(frame[:6]); !errors.Is(err, ErrShortFrame) {
+		t.Errorf("expected ErrShortFrame for a truncated header, got %v", err)
+	}
+}
@@ -28,6 +28,47 @@ const (
 	FuncCodeReadWriteMultipleRegisters = 23
 	FuncCodeMaskWriteRegister          = 22
 	FuncCodeReadFIFOQueue              = 24
+
+	// File record access
+	FuncCodeReadFileRecord  = 20
+	FuncCodeWriteFileRecord = 21
+
+	// Diagnostics (serial line only)
+	FuncCodeReadExceptionStatus = 7
+	FuncCodeDiagnostics         = 8
+	FuncCodeGetCommEventCounter = 11
+	FuncCodeGetCommEventLog     = 12
+
+	// Encapsulated interface transport
+	FuncCodeEncapsulatedInterface = 43
+)
+
+// MEI types of the encapsulated interface transport (function code 0x2B).
+const (
+	MEITypeReadDeviceIdentification = 0x0E
+)
+
+// Read device ID codes of Read Device Identification, selecting the objects
+// returned.
+const (
+	// ReadDeviceIDBasic streams the basic objects: vendor name, product
+	// code and revision.
+	ReadDeviceIDBasic = 0x01
+	// ReadDeviceIDRegular streams the basic and regular objects.
+	ReadDeviceIDRegular = 0x02
+	// ReadDeviceIDExtended streams the basic, regular and extended objects.
+	ReadDeviceIDExtended = 0x03
+	// ReadDeviceIDSpecific reads one object.
+	ReadDeviceIDSpecific = 0x04
+)
+
+// Diagnostics sub-function codes (function code 0x08).
+const (
+	DiagnosticReturnQueryData          = 0x0000
+	DiagnosticRestartCommunications    = 0x0001
+	DiagnosticReturnDiagnosticRegister = 0x0002
+	DiagnosticForceListenOnlyMode      = 0x0004
+	DiagnosticClearOverrunCounter      = 0x0014
 )
 
 // Common errors returned by the modbus package.
@@ -48,8 +89,53 @@ var (
 	ErrShortFrame = errors.New("modbus: response frame too short")
 	// ErrProtocolError is returned for protocol-level violations.
 	ErrProtocolError = errors.New("modbus: protocol error")
+	// ErrVerifyFailed is returned when a value read back after a write does not match.
+	ErrVerifyFailed = errors.New("modbus: write verification failed")
+	// ErrContextDeadline is returned when the context deadline passes before
+	// the response is complete.
+	ErrContextDeadline = errors.New("modbus: context deadline exceeded")
+	// ErrResponseTimeout is returned when the device does not respond within
+	// the read timeout.
+	ErrResponseTimeout = errors.New("modbus: response timeout")
+	// ErrCircuitOpen is returned by a ResilientClient without sending the
+	// request while the device is considered down.
+	ErrCircuitOpen = errors.New("modbus: circuit open")
+	// ErrNotProbeable is returned by SupportsFunction for a function that
+	// can't be probed without changing data on the device.
+	ErrNotProbeable = errors.New("modbus: function not probeable")
+	// ErrNotSupported is returned for a request that the client or its
+	// transporter can't send, such as one the device does not answer.
+	ErrNotSupported = errors.New("modbus: not supported")
 )
 
+// verboseFrameSize is the number of frame bytes included in verbose errors.
+const verboseFrameSize = 64
+
+// truncateFrame returns at most verboseFrameSize bytes of adu for an error
+// message, and "..." if bytes were cut.
+func truncateFrame(adu []byte) ([]byte, string) {
+	if len(adu) > verboseFrameSize {
+		return adu[:verboseFrameSize], "..."
+	}
+	return adu, ""
+}
+
+// timeoutError returns the error for a read that ended before the response
+// was complete because of cause, a read timeout or ctx.Err(). Transporters
+// bound their reads by the context deadline if there is one and by their
+// Timeout otherwise, so cause is wrapped with ErrContextDeadline if ctx has
+// a deadline and with ErrResponseTimeout if not. Cancellation is returned
+// unchanged.
+func timeoutError(ctx context.Context, cause error) error {
+	if errors.Is(cause, context.Canceled) {
+		return cause
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return fmt.Errorf("%w: %w", ErrContextDeadline, cause)
+	}
+	return fmt.Errorf("%w: %w", ErrResponseTimeout, cause)
+}
+
 const (
 	ExceptionCodeIllegalFunction                    = 1
 	ExceptionCodeIllegalDataAddress                 = 2
@@ -82,6 +168,10 @@ const (
 	EvenParity Parity = "E"
 	// OddParity represents odd parity checking.
 	OddParity Parity = "O"
+	// MarkParity represents a parity bit that is always 1.
+	MarkParity Parity = "M"
+	// SpaceParity represents a parity bit that is always 0.
+	SpaceParity Parity = "S"
 )
 
 // ModbusError implements error interface.
@@ -137,3 +227,16 @@ type Packager interface {
 type Transporter interface {
 	Send(ctx context.Context, aduRequest []byte) (aduResponse []byte, err error)
 }
+
+// NoResponseSender is implemented by transporters that can send a request
+// without waiting for a response, for requests a device never answers.
+type NoResponseSender interface {
+	SendNoResponse(ctx context.Context, aduRequest []byte) (err error)
+}
+
+// PipelineSender is implemented by transporters that can have several
+// requests outstanding at once. The responses are returned in request
+// order.
+type PipelineSender interface {
+	SendPipelined(ctx context.Context, aduRequests [][]byte) (aduResponses [][]byte, err error)
+}
@@ -0,0 +1,102 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbustest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lumberbarons/modbus"
+)
+
+// FakeClock is a modbus.Clock whose time only moves when Sleep or Advance
+// is called, so that delays are tested without waiting and without timing
+// tolerances. It records every duration slept or waited for. It is safe
+// for concurrent use.
+type FakeClock struct {
+	mu        sync.Mutex
+	now       time.Time
+	waiters   []fakeWaiter
+	durations []time.Duration
+}
+
+// fakeWaiter is a channel returned by After, sent the time once it is at.
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+var _ modbus.Clock = (*FakeClock)(nil)
+
+// NewFakeClock returns a FakeClock starting at start.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+// Now returns the current fake time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Sleep advances the clock by d without blocking.
+func (c *FakeClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.durations = append(c.durations, d)
+	c.advance(d)
+}
+
+// After returns a channel that is sent the time once the clock has been
+// advanced by d.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.durations = append(c.durations, d)
+	w := fakeWaiter{at: c.now.Add(d), ch: make(chan time.Time, 1)}
+	if d <= 0 {
+		w.ch <- c.now
+		return w.ch
+	}
+	c.waiters = append(c.waiters, w)
+	return w.ch
+}
+
+// Advance moves the clock forward by d, firing the After channels due.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advance(d)
+}
+
+// Waiters returns the number of After channels not fired yet, so that a
+// test can wait for the code under test to block before advancing.
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// Durations returns the durations passed to Sleep and After so far.
+func (c *FakeClock) Durations() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Duration(nil), c.durations...)
+}
+
+// advance moves the clock forward. The caller must hold the mutex.
+func (c *FakeClock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			pending = append(pending, w)
+		} else {
+			w.ch <- c.now
+		}
+	}
+	c.waiters = pending
+}
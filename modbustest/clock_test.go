@@ -0,0 +1,46 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbustest
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+
+	clock.Sleep(time.Second)
+	if got := clock.Now(); !got.Equal(start.Add(time.Second)) {
+		t.Errorf("expected Sleep to advance the clock, got %v", got)
+	}
+
+	ch := clock.After(100 * time.Millisecond)
+	if clock.Waiters() != 1 {
+		t.Fatalf("expected one waiter, got %d", clock.Waiters())
+	}
+	clock.Advance(99 * time.Millisecond)
+	select {
+	case <-ch:
+		t.Fatal("expected After not to fire early")
+	default:
+	}
+	clock.Advance(time.Millisecond)
+	select {
+	case <-ch:
+	default:
+		t.Fatal("expected After to fire once due")
+	}
+	if clock.Waiters() != 0 {
+		t.Errorf("expected no waiters left, got %d", clock.Waiters())
+	}
+
+	<-clock.After(0)
+	if expected := []time.Duration{time.Second, 100 * time.Millisecond, 0}; !slices.Equal(clock.Durations(), expected) {
+		t.Errorf("durations: expected %v, got %v", expected, clock.Durations())
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+/*
+Package modbustest provides a fake modbus.ClientHandler for unit testing
+code that uses a modbus.Client without a device or simulator.
+
+A MockHandler frames each PDU as its function code followed by its data,
+so canned responses are easy to build with the Reply helpers:
+
+	handler := &modbustest.MockHandler{
+		SendFunc: modbustest.Sequence(
+			modbustest.RegisterReply(modbus.FuncCodeReadHoldingRegisters, 0x1234),
+		),
+	}
+	client := modbus.NewClient(handler)
+*/
+package modbustest
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/lumberbarons/modbus"
+)
+
+// MockHandler implements modbus.ClientHandler. Each func field, if set,
+// replaces the default behavior of the corresponding method. By default a
+// PDU is encoded as its function code followed by its data, responses are
+// not verified and Send echoes the request, like a device acknowledging a
+// single write.
+type MockHandler struct {
+	EncodeFunc func(pdu *modbus.ProtocolDataUnit) (adu []byte, err error)
+	DecodeFunc func(adu []byte) (pdu *modbus.ProtocolDataUnit, err error)
+	VerifyFunc func(aduRequest, aduResponse []byte) (err error)
+	SendFunc   func(ctx context.Context, aduRequest []byte) (aduResponse []byte, err error)
+
+	mu       sync.Mutex
+	requests [][]byte
+}
+
+// Encode encodes a PDU with EncodeFunc or the default framing.
+func (m *MockHandler) Encode(pdu *modbus.ProtocolDataUnit) ([]byte, error) {
+	if m.EncodeFunc != nil {
+		return m.EncodeFunc(pdu)
+	}
+	return Reply(pdu.FunctionCode, pdu.Data...), nil
+}
+
+// Decode decodes an ADU with DecodeFunc or the default framing.
+func (m *MockHandler) Decode(adu []byte) (*modbus.ProtocolDataUnit, error) {
+	if m.DecodeFunc != nil {
+		return m.DecodeFunc(adu)
+	}
+	if len(adu) < 1 {
+		return nil, fmt.Errorf("%w: response is empty", modbus.ErrShortFrame)
+	}
+	return &modbus.ProtocolDataUnit{FunctionCode: adu[0], Data: adu[1:]}, nil
+}
+
+// Verify checks a response with VerifyFunc, accepting it if none is set.
+func (m *MockHandler) Verify(aduRequest, aduResponse []byte) error {
+	if m.VerifyFunc != nil {
+		return m.VerifyFunc(aduRequest, aduResponse)
+	}
+	return nil
+}
+
+// Send records the request and returns the response of SendFunc, or
+// echoes the request if none is set.
+func (m *MockHandler) Send(ctx context.Context, aduRequest []byte) ([]byte, error) {
+	m.mu.Lock()
+	m.requests = append(m.requests, append([]byte(nil), aduRequest...))
+	m.mu.Unlock()
+
+	if m.SendFunc != nil {
+		return m.SendFunc(ctx, aduRequest)
+	}
+	return aduRequest, nil
+}
+
+// Requests returns the requests sent so far, oldest first.
+func (m *MockHandler) Requests() [][]byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	requests := make([][]byte, len(m.requests))
+	copy(requests, m.requests)
+	return requests
+}
+
+// Sequence returns a SendFunc that answers successive requests with the
+// given responses and fails once they run out.
+func Sequence(responses ...[]byte) func(ctx context.Context, aduRequest []byte) ([]byte, error) {
+	var mu sync.Mutex
+	return func(_ context.Context, aduRequest []byte) ([]byte, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if len(responses) == 0 {
+			return nil, fmt.Errorf("%w: no response left for request % x", modbus.ErrTimeout, aduRequest)
+		}
+		response := responses[0]
+		responses = responses[1:]
+		return response, nil
+	}
+}
+
+// Reply builds a response ADU in the default framing.
+func Reply(functionCode byte, data ...byte) []byte {
+	adu := make([]byte, 1+len(data))
+	adu[0] = functionCode
+	copy(adu[1:], data)
+	return adu
+}
+
+// RegisterReply builds a register read response: the byte count followed
+// by the big-endian register values.
+func RegisterReply(functionCode byte, values ...uint16) []byte {
+	data := make([]byte, 1+2*len(values))
+	data[0] = byte(2 * len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint16(data[1+2*i:], v)
+	}
+	return Reply(functionCode, data...)
+}
+
+// BitReply builds a coil or discrete input read response: the byte count
+// followed by the values packed least significant bit first.
+func BitReply(functionCode byte, values ...bool) []byte {
+	data := make([]byte, 1+(len(values)+7)/8)
+	data[0] = byte(len(data) - 1)
+	for i, v := range values {
+		if v {
+			data[1+i/8] |= 1 << (i % 8)
+		}
+	}
+	return Reply(functionCode, data...)
+}
+
+// ExceptionReply builds an exception response for functionCode.
+func ExceptionReply(functionCode, exceptionCode byte) []byte {
+	return Reply(functionCode|0x80, exceptionCode)
+}
@@ -0,0 +1,72 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbustest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lumberbarons/modbus"
+)
+
+func TestMockHandler(t *testing.T) {
+	handler := &MockHandler{
+		SendFunc: Sequence(
+			RegisterReply(modbus.FuncCodeReadHoldingRegisters, 0x1234, 0x5678),
+			BitReply(modbus.FuncCodeReadCoils, true, false, true, true, false, false, false, false, true),
+			ExceptionReply(modbus.FuncCodeWriteSingleRegister, modbus.ExceptionCodeIllegalDataAddress),
+		),
+	}
+	client := modbus.NewClient(handler)
+	ctx := context.Background()
+
+	results, err := client.ReadHoldingRegisters(ctx, 100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(results, []byte{0x12, 0x34, 0x56, 0x78}) {
+		t.Errorf("registers: unexpected % x", results)
+	}
+
+	results, err = client.ReadCoils(ctx, 0, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(results, []byte{0x0D, 0x01}) {
+		t.Errorf("coils: unexpected % x", results)
+	}
+
+	_, err = client.WriteSingleRegister(ctx, 1, 2)
+	var mbErr *modbus.ModbusError
+	if !errors.As(err, &mbErr) || mbErr.ExceptionCode != modbus.ExceptionCodeIllegalDataAddress {
+		t.Errorf("expected illegal data address exception, got %v", err)
+	}
+
+	if _, err = client.ReadHoldingRegisters(ctx, 0, 1); !errors.Is(err, modbus.ErrTimeout) {
+		t.Errorf("expected ErrTimeout once responses run out, got %v", err)
+	}
+
+	requests := handler.Requests()
+	if len(requests) != 4 {
+		t.Fatalf("expected 4 requests, got %d", len(requests))
+	}
+	expected := []byte{modbus.FuncCodeReadHoldingRegisters, 0x00, 0x64, 0x00, 0x02}
+	if !bytes.Equal(requests[0], expected) {
+		t.Errorf("request: expected % x, actual % x", expected, requests[0])
+	}
+}
+
+func TestMockHandlerEcho(t *testing.T) {
+	client := modbus.NewClient(&MockHandler{})
+	results, err := client.WriteSingleRegister(context.Background(), 7, 0xBEEF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(results, []byte{0xBE, 0xEF}) {
+		t.Errorf("unexpected % x", results)
+	}
+}
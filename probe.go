@@ -0,0 +1,118 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// SupportsFunction probes whether the device implements functionCode by
+// sending a minimal request for it. Any response other than an
+// IllegalFunction exception counts as support. Write functions are probed
+// with requests a device must reject with IllegalDataValue, such as a
+// quantity of zero, so that nothing is written. Write Single Register has
+// no such request, as any value is valid, so it returns ErrNotProbeable
+// without sending anything. Clients other than those of NewClient and
+// NewResilientClient can't send such requests and fail with
+// ErrNotSupported.
+func SupportsFunction(ctx context.Context, client Client, functionCode byte) (bool, error) {
+	if functionCode == FuncCodeWriteSingleRegister {
+		return false, fmt.Errorf("%w: function '%v' accepts any value and would write it", ErrNotProbeable, functionCode)
+	}
+	request := ProtocolDataUnit{
+		FunctionCode: functionCode,
+		Data:         probeRequestData(functionCode),
+	}
+	_, err := sendRequest(ctx, client, &request)
+	if err == nil {
+		return true, nil
+	}
+	var mbErr *ModbusError
+	if errors.As(err, &mbErr) {
+		return mbErr.ExceptionCode != ExceptionCodeIllegalFunction, nil
+	}
+	return false, fmt.Errorf("probing function %v: %w", functionCode, err)
+}
+
+// requestSender sends requests of any function code and data, unlike the
+// Client methods which check their arguments. The client of NewClient and
+// a ResilientClient implement it.
+type requestSender interface {
+	send(ctx context.Context, request *ProtocolDataUnit) (*ProtocolDataUnit, error)
+}
+
+// sendRequest sends request with client, failing with ErrNotSupported if
+// it is not a requestSender.
+func sendRequest(ctx context.Context, client Client, request *ProtocolDataUnit) (*ProtocolDataUnit, error) {
+	sender, ok := client.(requestSender)
+	if !ok {
+		return nil, fmt.Errorf("%w: client '%T' can't send requests of any function code", ErrNotSupported, client)
+	}
+	return sender.send(ctx, request)
+}
+
+// ProbeMaxReadQuantity finds the largest number of holding registers the
+// device returns in one read starting at address, for devices whose limit
+// is not documented. It first reads the client's limit, 125 registers
+// unless set lower with WithMaxReadQuantity, then binary-searches below it,
+// halving the quantity on each rejection. A read is rejected by an
+// IllegalDataValue exception, or an IllegalDataAddress one as some devices
+// answer an excessive quantity with; other errors end the probe. The
+// result can be passed to WithMaxReadQuantity.
+func ProbeMaxReadQuantity(ctx context.Context, client Client, address uint16) (uint16, error) {
+	// accepted is the largest quantity read, rejected the smallest refused
+	accepted, rejected := uint16(0), readLimitOf(client)+1
+	for quantity := rejected - 1; quantity > accepted; quantity = accepted + (rejected-accepted)/2 {
+		_, err := client.ReadHoldingRegisters(ctx, address, quantity)
+		var mbErr *ModbusError
+		switch {
+		case err == nil:
+			accepted = quantity
+		case errors.As(err, &mbErr) && (mbErr.ExceptionCode == ExceptionCodeIllegalDataValue ||
+			mbErr.ExceptionCode == ExceptionCodeIllegalDataAddress):
+			rejected = quantity
+		default:
+			return 0, fmt.Errorf("probing maximum read quantity: %w", err)
+		}
+	}
+	if accepted == 0 {
+		return 0, fmt.Errorf("%w: no quantity of registers at address '%v' is readable", ErrInvalidResponse, address)
+	}
+	return accepted, nil
+}
+
+// probeRequestData returns the request data SupportsFunction sends for
+// functionCode. Functions not listed are sent without data.
+func probeRequestData(functionCode byte) []byte {
+	switch functionCode {
+	case FuncCodeReadCoils, FuncCodeReadDiscreteInputs,
+		FuncCodeReadHoldingRegisters, FuncCodeReadInputRegisters:
+		return dataBlock(0, 1)
+	case FuncCodeWriteSingleCoil:
+		// Neither 0x0000 nor 0xFF00
+		return dataBlock(0, 0x0001)
+	case FuncCodeWriteMultipleCoils, FuncCodeWriteMultipleRegisters:
+		return dataBlockSuffix(nil, 0, 0)
+	case FuncCodeReadWriteMultipleRegisters:
+		return dataBlockSuffix(nil, 0, 1, 0, 0)
+	case FuncCodeMaskWriteRegister:
+		// (current AND 0xFFFF) OR 0x0000 leaves the register unchanged
+		return dataBlock(0, 0xFFFF, 0x0000)
+	case FuncCodeReadFIFOQueue:
+		return dataBlock(0)
+	case FuncCodeReadFileRecord:
+		// One sub-request for record 0 of file 1
+		return []byte{7, 6, 0, 1, 0, 0, 0, 1}
+	case FuncCodeWriteFileRecord:
+		// A byte count of zero is out of range
+		return []byte{0}
+	case FuncCodeDiagnostics:
+		return dataBlock(DiagnosticReturnQueryData, 0)
+	default:
+		return nil
+	}
+}
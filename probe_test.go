@@ -0,0 +1,124 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestSupportsFunction(t *testing.T) {
+	transportErr := errors.New("connection reset")
+	tests := []struct {
+		name      string
+		send      func(context.Context, []byte) ([]byte, error)
+		supported bool
+		err       error
+	}{
+		{"valid response", nil, true, nil},
+		{"illegal function", func(_ context.Context, req []byte) ([]byte, error) {
+			return []byte{req[0] | 0x80, ExceptionCodeIllegalFunction}, nil
+		}, false, nil},
+		{"other exception", func(_ context.Context, req []byte) ([]byte, error) {
+			return []byte{req[0] | 0x80, ExceptionCodeIllegalDataValue}, nil
+		}, true, nil},
+		{"transport failure", func(_ context.Context, _ []byte) ([]byte, error) {
+			return nil, transportErr
+		}, false, transportErr},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClientWithPackagerTransporter(&mockPackager{}, &mockTransporter{sendFunc: tt.send})
+			supported, err := SupportsFunction(context.Background(), client, FuncCodeReadFIFOQueue)
+			if !errors.Is(err, tt.err) || (tt.err == nil && err != nil) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if supported != tt.supported {
+				t.Errorf("expected supported %v, got %v", tt.supported, supported)
+			}
+		})
+	}
+}
+
+func TestSupportsFunctionWriteSingleRegister(t *testing.T) {
+	var requests int
+	client := NewClientWithPackagerTransporter(&mockPackager{}, &mockTransporter{
+		sendFunc: func(_ context.Context, req []byte) ([]byte, error) {
+			requests++
+			return req, nil
+		},
+	})
+	if _, err := SupportsFunction(context.Background(), client, FuncCodeWriteSingleRegister); !errors.Is(err, ErrNotProbeable) {
+		t.Errorf("expected ErrNotProbeable, got %v", err)
+	}
+	if requests != 0 {
+		t.Errorf("expected no request, got %d", requests)
+	}
+}
+
+// limitedDevice answers reads of up to max holding registers and rejects
+// larger ones with exceptionCode, counting the requests.
+func limitedDevice(max uint16, exceptionCode byte, requests *int) func(context.Context, []byte) ([]byte, error) {
+	return func(_ context.Context, req []byte) ([]byte, error) {
+		*requests++
+		quantity := binary.BigEndian.Uint16(req[3:])
+		if quantity > max {
+			return []byte{req[0] | 0x80, exceptionCode}, nil
+		}
+		return append([]byte{req[0], byte(2 * quantity)}, make([]byte, 2*quantity)...), nil
+	}
+}
+
+func TestProbeMaxReadQuantity(t *testing.T) {
+	tests := []struct {
+		name          string
+		max           uint16
+		exceptionCode byte
+		opts          []ClientOption
+		want          uint16
+	}{
+		{"protocol limit", 125, ExceptionCodeIllegalDataValue, nil, 125},
+		{"halved", 62, ExceptionCodeIllegalDataValue, nil, 62},
+		{"odd limit", 100, ExceptionCodeIllegalDataValue, nil, 100},
+		{"single register", 1, ExceptionCodeIllegalDataValue, nil, 1},
+		{"illegal data address", 32, ExceptionCodeIllegalDataAddress, nil, 32},
+		{"client limit", 100, ExceptionCodeIllegalDataValue, []ClientOption{WithMaxReadQuantity(50)}, 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+			mockT := &mockTransporter{sendFunc: limitedDevice(tt.max, tt.exceptionCode, &requests)}
+			client := NewClientWithPackagerTransporter(&mockPackager{}, mockT, tt.opts...)
+			got, err := ProbeMaxReadQuantity(context.Background(), client, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, got)
+			}
+			// The read of 125 and a binary search below it take at
+			// most 8 reads
+			if requests > 8 {
+				t.Errorf("expected at most 8 requests, got %d", requests)
+			}
+		})
+	}
+
+	var requests int
+	client := NewClientWithPackagerTransporter(&mockPackager{}, &mockTransporter{sendFunc: limitedDevice(0, ExceptionCodeIllegalDataAddress, &requests)})
+	if _, err := ProbeMaxReadQuantity(context.Background(), client, 0); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("expected ErrInvalidResponse for an unreadable address, got %v", err)
+	}
+
+	client = NewClientWithPackagerTransporter(&mockPackager{}, &mockTransporter{sendFunc: func(_ context.Context, req []byte) ([]byte, error) {
+		return []byte{req[0] | 0x80, ExceptionCodeServerDeviceFailure}, nil
+	}})
+	var mbErr *ModbusError
+	if _, err := ProbeMaxReadQuantity(context.Background(), client, 0); !errors.As(err, &mbErr) || mbErr.ExceptionCode != ExceptionCodeServerDeviceFailure {
+		t.Errorf("expected server device failure to end the probe, got %v", err)
+	}
+}
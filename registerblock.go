@@ -0,0 +1,62 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"context"
+	"encoding/binary"
+)
+
+// RegisterBlock is a contiguous run of registers as read from a device,
+// together with the address of the first one, so that values can be looked
+// up by their absolute address.
+type RegisterBlock struct {
+	// StartAddress is the address of the first register in Raw.
+	StartAddress uint16
+	// Raw holds the big-endian register values as transferred.
+	Raw []byte
+}
+
+// Len returns the number of registers in the block.
+func (b RegisterBlock) Len() int {
+	return len(b.Raw) / 2
+}
+
+// Uint16 returns register i of the block, counted from StartAddress.
+// Registers outside the block read as 0.
+func (b RegisterBlock) Uint16(i int) uint16 {
+	if i < 0 || i >= b.Len() {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b.Raw[i*2:])
+}
+
+// Float32 decodes registers i and i+1 of the block as a float32 in the given
+// order. Values not entirely inside the block read as 0.
+func (b RegisterBlock) Float32(i int, order ByteOrder) float32 {
+	if i < 0 || i+1 >= b.Len() {
+		return 0
+	}
+	return order.Float32(b.Raw[i*2:])
+}
+
+// At returns the value of the register at an absolute address, and whether
+// the block contains it.
+func (b RegisterBlock) At(address uint16) (uint16, bool) {
+	if address < b.StartAddress || int(address-b.StartAddress) >= b.Len() {
+		return 0, false
+	}
+	return b.Uint16(int(address - b.StartAddress)), true
+}
+
+// ReadHoldingRegisterBlock reads quantity holding registers starting at
+// address and returns them as a RegisterBlock.
+func ReadHoldingRegisterBlock(ctx context.Context, client Client, address, quantity uint16) (RegisterBlock, error) {
+	results, err := client.ReadHoldingRegisters(ctx, address, quantity)
+	if err != nil {
+		return RegisterBlock{}, err
+	}
+	return RegisterBlock{StartAddress: address, Raw: results}, nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRegisterBlock(t *testing.T) {
+	b := RegisterBlock{StartAddress: 100, Raw: []byte{0x12, 0x34, 0x3F, 0xC0, 0x00, 0x00}}
+	if b.Len() != 3 {
+		t.Fatalf("Len() = %d, want 3", b.Len())
+	}
+	if v := b.Uint16(0); v != 0x1234 {
+		t.Errorf("Uint16(0) = %#x, want 0x1234", v)
+	}
+	if v := b.Uint16(3); v != 0 {
+		t.Errorf("Uint16(3) = %#x, want 0 outside the block", v)
+	}
+	if v := b.Float32(1, BigEndian); v != 1.5 {
+		t.Errorf("Float32(1) = %v, want 1.5", v)
+	}
+	if v := b.Float32(2, BigEndian); v != 0 {
+		t.Errorf("Float32(2) = %v, want 0 past the end of the block", v)
+	}
+	if v, ok := b.At(100); !ok || v != 0x1234 {
+		t.Errorf("At(100) = %#x, %v, want 0x1234, true", v, ok)
+	}
+	if v, ok := b.At(101); !ok || v != 0x3FC0 {
+		t.Errorf("At(101) = %#x, %v, want 0x3fc0, true", v, ok)
+	}
+	for _, address := range []uint16{99, 103} {
+		if _, ok := b.At(address); ok {
+			t.Errorf("At(%d): expected address outside the block", address)
+		}
+	}
+}
+
+func TestReadHoldingRegisterBlock(t *testing.T) {
+	mockT := &mockTransporter{
+		sendFunc: func(_ context.Context, _ []byte) ([]byte, error) {
+			return []byte{FuncCodeReadHoldingRegisters, 0x04, 0x00, 0x0A, 0x00, 0x0B}, nil
+		},
+	}
+	client := NewClientWithPackagerTransporter(&mockPackager{}, mockT)
+
+	b, err := ReadHoldingRegisterBlock(context.Background(), client, 40, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.StartAddress != 40 || b.Len() != 2 {
+		t.Fatalf("got block at %d of %d registers, want 40 and 2", b.StartAddress, b.Len())
+	}
+	if v, ok := b.At(41); !ok || v != 0x0B {
+		t.Errorf("At(41) = %#x, %v, want 0xb, true", v, ok)
+	}
+
+	if _, err := ReadHoldingRegisterBlock(context.Background(), client, 0, 0); err == nil {
+		t.Error("expected error for zero quantity")
+	}
+}
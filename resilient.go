@@ -0,0 +1,252 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of a ResilientClient's circuit breaker.
+type CircuitState int
+
+const (
+	// CircuitClosed passes requests through to the device.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails requests with ErrCircuitOpen until the cooldown
+	// has passed.
+	CircuitOpen
+	// CircuitHalfOpen lets one request through to probe whether the device
+	// has recovered, failing the others.
+	CircuitHalfOpen
+)
+
+// String returns the name of the state.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("CircuitState(%d)", int(s))
+	}
+}
+
+// ResilientClient wraps a Client with a circuit breaker, so that a dead
+// device fails requests at once instead of piling up slow timeouts in a
+// polling loop. After FailureThreshold consecutive failed requests the
+// circuit opens and requests fail with ErrCircuitOpen without being sent.
+// Once the cooldown has passed the next request is sent as a probe: if it
+// succeeds the circuit closes, otherwise it opens for another cooldown.
+//
+// Exception responses count as successes, as the device answered, except
+// the gateway exceptions reporting that the device behind the gateway
+// can't be reached. Invalid arguments and cancelled contexts count as
+// neither. Helpers such as ReadHoldingRegistersChunked pass each of their
+// requests through the breaker. A ResilientClient is safe for concurrent
+// use.
+type ResilientClient struct {
+	client           Client
+	failureThreshold int
+	cooldown         time.Duration
+
+	mu sync.Mutex
+	// Clock timing the cooldown
+	clock    Clock
+	state    CircuitState
+	failures int
+	openedAt time.Time
+}
+
+var _ Client = (*ResilientClient)(nil)
+
+// NewResilientClient returns client wrapped in a circuit breaker that opens
+// after failureThreshold consecutive failures, at least 1, and probes the
+// device again after cooldown.
+func NewResilientClient(client Client, failureThreshold int, cooldown time.Duration) *ResilientClient {
+	return &ResilientClient{
+		client:           client,
+		failureThreshold: max(failureThreshold, 1),
+		cooldown:         cooldown,
+		clock:            SystemClock{},
+	}
+}
+
+// SetClock replaces the clock timing the cooldown, by default the system
+// clock, for example with a fake one in tests.
+func (c *ResilientClient) SetClock(clock Clock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clock = clock
+}
+
+// FailureThreshold returns the number of consecutive failures that open the
+// circuit.
+func (c *ResilientClient) FailureThreshold() int {
+	return c.failureThreshold
+}
+
+// Cooldown returns the time the circuit stays open before a probe request.
+func (c *ResilientClient) Cooldown() time.Duration {
+	return c.cooldown
+}
+
+// State returns the current state of the circuit. An open circuit whose
+// cooldown has passed is reported open until the probe request is sent.
+func (c *ResilientClient) State() CircuitState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// allow reports with an error whether a request may be sent, making it the
+// probe if the cooldown of an open circuit has passed.
+func (c *ResilientClient) allow() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch c.state {
+	case CircuitOpen:
+		if wait := c.cooldown - c.clock.Now().Sub(c.openedAt); wait > 0 {
+			return fmt.Errorf("%w: '%v' consecutive failures, retrying in '%v'", ErrCircuitOpen, c.failures, wait.Round(time.Millisecond))
+		}
+		c.state = CircuitHalfOpen
+	case CircuitHalfOpen:
+		return fmt.Errorf("%w: probing whether the device has recovered", ErrCircuitOpen)
+	}
+	return nil
+}
+
+// record updates the circuit with the outcome of a request sent.
+func (c *ResilientClient) record(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case err == nil || deviceResponded(err):
+		c.state = CircuitClosed
+		c.failures = 0
+	case isCallerError(err):
+		// Says nothing about the device, let the next request probe
+		if c.state == CircuitHalfOpen {
+			c.state = CircuitOpen
+		}
+	default:
+		c.failures++
+		if c.state == CircuitHalfOpen || c.failures >= c.failureThreshold {
+			c.state = CircuitOpen
+			c.openedAt = c.clock.Now()
+		}
+	}
+}
+
+// deviceResponded reports whether err shows that the device answered.
+func deviceResponded(err error) bool {
+	var modbusErr *ModbusError
+	if errors.As(err, &modbusErr) {
+		return modbusErr.ExceptionCode != ExceptionCodeGatewayPathUnavailable &&
+			modbusErr.ExceptionCode != ExceptionCodeGatewayTargetDeviceFailedToRespond
+	}
+	return errors.Is(err, ErrVerifyFailed)
+}
+
+// isCallerError reports whether err is caused by the caller rather than
+// the device: invalid arguments, a request the client can't send or a
+// cancelled context.
+func isCallerError(err error) bool {
+	return errors.Is(err, ErrInvalidQuantity) || errors.Is(err, ErrInvalidAddress) ||
+		errors.Is(err, ErrInvalidData) || errors.Is(err, ErrNotProbeable) ||
+		errors.Is(err, ErrNotSupported) || errors.Is(err, context.Canceled)
+}
+
+// guard sends a request returning a result through the circuit breaker.
+func guard[T any](c *ResilientClient, request func() (T, error)) (T, error) {
+	if err := c.allow(); err != nil {
+		var zero T
+		return zero, err
+	}
+	result, err := request()
+	c.record(err)
+	return result, err
+}
+
+// do sends a request returning only an error through the circuit breaker.
+func (c *ResilientClient) do(request func() error) error {
+	if err := c.allow(); err != nil {
+		return err
+	}
+	err := request()
+	c.record(err)
+	return err
+}
+
+func (c *ResilientClient) ReadCoils(ctx context.Context, address, quantity uint16) ([]byte, error) {
+	return guard(c, func() ([]byte, error) { return c.client.ReadCoils(ctx, address, quantity) })
+}
+
+func (c *ResilientClient) ReadDiscreteInputs(ctx context.Context, address, quantity uint16) ([]byte, error) {
+	return guard(c, func() ([]byte, error) { return c.client.ReadDiscreteInputs(ctx, address, quantity) })
+}
+
+func (c *ResilientClient) WriteSingleCoil(ctx context.Context, address, value uint16) ([]byte, error) {
+	return guard(c, func() ([]byte, error) { return c.client.WriteSingleCoil(ctx, address, value) })
+}
+
+func (c *ResilientClient) WriteMultipleCoils(ctx context.Context, address, quantity uint16, value []byte) ([]byte, error) {
+	return guard(c, func() ([]byte, error) { return c.client.WriteMultipleCoils(ctx, address, quantity, value) })
+}
+
+func (c *ResilientClient) ReadInputRegisters(ctx context.Context, address, quantity uint16) ([]byte, error) {
+	return guard(c, func() ([]byte, error) { return c.client.ReadInputRegisters(ctx, address, quantity) })
+}
+
+func (c *ResilientClient) ReadHoldingRegisters(ctx context.Context, address, quantity uint16) ([]byte, error) {
+	return guard(c, func() ([]byte, error) { return c.client.ReadHoldingRegisters(ctx, address, quantity) })
+}
+
+func (c *ResilientClient) WriteSingleRegister(ctx context.Context, address, value uint16) ([]byte, error) {
+	return guard(c, func() ([]byte, error) { return c.client.WriteSingleRegister(ctx, address, value) })
+}
+
+func (c *ResilientClient) WriteMultipleRegisters(ctx context.Context, address, quantity uint16, value []byte) ([]byte, error) {
+	return guard(c, func() ([]byte, error) { return c.client.WriteMultipleRegisters(ctx, address, quantity, value) })
+}
+
+func (c *ResilientClient) ReadWriteMultipleRegisters(ctx context.Context, readAddress, readQuantity, writeAddress, writeQuantity uint16, value []byte) ([]byte, error) {
+	return guard(c, func() ([]byte, error) {
+		return c.client.ReadWriteMultipleRegisters(ctx, readAddress, readQuantity, writeAddress, writeQuantity, value)
+	})
+}
+
+func (c *ResilientClient) MaskWriteRegister(ctx context.Context, address, andMask, orMask uint16) ([]byte, error) {
+	return guard(c, func() ([]byte, error) { return c.client.MaskWriteRegister(ctx, address, andMask, orMask) })
+}
+
+func (c *ResilientClient) ReadFIFOQueue(ctx context.Context, address uint16) ([]byte, error) {
+	return guard(c, func() ([]byte, error) { return c.client.ReadFIFOQueue(ctx, address) })
+}
+
+func (c *ResilientClient) Diagnostics(ctx context.Context, subFunction uint16, data []byte) ([]byte, error) {
+	return guard(c, func() ([]byte, error) { return c.client.Diagnostics(ctx, subFunction, data) })
+}
+
+// send sends a request of any function code through the breaker, for
+// SupportsFunction, ReadExceptionStatus, GetCommEventCounter and
+// ReadDeviceIdentification.
+func (c *ResilientClient) send(ctx context.Context, request *ProtocolDataUnit) (*ProtocolDataUnit, error) {
+	return guard(c, func() (*ProtocolDataUnit, error) { return sendRequest(ctx, c.client, request) })
+}
+
+// sendNoResponse sends a request the device does not answer through the
+// breaker, for ForceListenOnly and RestartCommunications.
+func (c *ResilientClient) sendNoResponse(ctx context.Context, request *ProtocolDataUnit) error {
+	return c.do(func() error { return sendUnanswered(ctx, c.client, request) })
+}
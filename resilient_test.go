@@ -0,0 +1,192 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// manualClock is a Clock whose time only moves when advanced.
+type manualClock struct {
+	SystemClock
+	now time.Time
+}
+
+func (c *manualClock) Now() time.Time { return c.now }
+
+func TestResilientClient(t *testing.T) {
+	var sent int
+	var deviceErr error
+	var onSend func()
+	inner := NewClientWithPackagerTransporter(&mockPackager{}, &mockTransporter{
+		sendFunc: func(_ context.Context, aduRequest []byte) ([]byte, error) {
+			sent++
+			if onSend != nil {
+				onSend()
+			}
+			if deviceErr != nil {
+				return nil, deviceErr
+			}
+			return []byte{aduRequest[0], 2, 0x00, 0x2A}, nil
+		},
+	})
+	client := NewResilientClient(inner, 2, 50*time.Millisecond)
+	clock := &manualClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	client.SetClock(clock)
+	if client.FailureThreshold() != 2 || client.Cooldown() != 50*time.Millisecond {
+		t.Errorf("unexpected threshold %v and cooldown %v", client.FailureThreshold(), client.Cooldown())
+	}
+	ctx := context.Background()
+	read := func() error {
+		_, err := client.ReadHoldingRegisters(ctx, 0, 1)
+		return err
+	}
+
+	// Invalid arguments neither count as failures nor reset the count
+	deviceErr = ErrResponseTimeout
+	if err := read(); !errors.Is(err, ErrResponseTimeout) {
+		t.Fatalf("expected the device error, got %v", err)
+	}
+	if _, err := client.ReadHoldingRegisters(ctx, 0, 0); !errors.Is(err, ErrInvalidQuantity) {
+		t.Fatalf("expected ErrInvalidQuantity, got %v", err)
+	}
+	deviceErr = nil
+	if _, err := client.WriteSingleCoil(ctx, 0, 0x1234); !errors.Is(err, ErrInvalidData) {
+		t.Fatalf("expected ErrInvalidData, got %v", err)
+	}
+	if client.State() != CircuitClosed {
+		t.Fatalf("expected the circuit to stay closed, got %v", client.State())
+	}
+
+	// The second consecutive failure opens the circuit
+	deviceErr = ErrResponseTimeout
+	if err := read(); !errors.Is(err, ErrResponseTimeout) {
+		t.Fatalf("expected the device error, got %v", err)
+	}
+	if client.State() != CircuitOpen {
+		t.Fatalf("expected the circuit to open, got %v", client.State())
+	}
+	sent = 0
+	if err := read(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen, got %v", err)
+	}
+	if sent != 0 {
+		t.Errorf("expected no request to be sent while open, got %d", sent)
+	}
+	clock.now = clock.now.Add(49 * time.Millisecond)
+	if err := read(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen until the cooldown has passed, got %v", err)
+	}
+
+	// A failed probe after the cooldown opens the circuit again
+	clock.now = clock.now.Add(time.Millisecond)
+	if err := read(); !errors.Is(err, ErrResponseTimeout) {
+		t.Errorf("expected the probe to be sent, got %v", err)
+	}
+	if err := read(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen after a failed probe, got %v", err)
+	}
+
+	// A successful probe closes it, other requests fail while it is sent
+	clock.now = clock.now.Add(50 * time.Millisecond)
+	deviceErr = nil
+	onSend = func() {
+		onSend = nil
+		if client.State() != CircuitHalfOpen {
+			t.Errorf("expected the circuit to be half-open during the probe, got %v", client.State())
+		}
+		if err := read(); !errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("expected ErrCircuitOpen during the probe, got %v", err)
+		}
+	}
+	if err := read(); err != nil {
+		t.Errorf("expected the probe to succeed, got %v", err)
+	}
+	if client.State() != CircuitClosed {
+		t.Errorf("expected the circuit to close, got %v", client.State())
+	}
+}
+
+func TestResilientClientExceptions(t *testing.T) {
+	for _, tc := range []struct {
+		exceptionCode byte
+		failure       bool
+	}{
+		{ExceptionCodeIllegalDataAddress, false},
+		{ExceptionCodeServerDeviceBusy, false},
+		{ExceptionCodeGatewayTargetDeviceFailedToRespond, true},
+	} {
+		inner := NewClientWithPackagerTransporter(&mockPackager{}, &mockTransporter{
+			sendFunc: func(_ context.Context, aduRequest []byte) ([]byte, error) {
+				return []byte{aduRequest[0] | 0x80, tc.exceptionCode}, nil
+			},
+		})
+		client := NewResilientClient(inner, 1, time.Hour)
+		if _, err := client.ReadInputRegisters(context.Background(), 0, 1); err == nil {
+			t.Fatalf("exception %d: expected an error", tc.exceptionCode)
+		}
+		if open := client.State() == CircuitOpen; open != tc.failure {
+			t.Errorf("exception %d: expected open %v, got state %v", tc.exceptionCode, tc.failure, client.State())
+		}
+	}
+}
+
+// otherClient is a Client implementation of another package, hiding the
+// client it wraps.
+type otherClient struct {
+	Client
+}
+
+func TestHelpersWrappedClient(t *testing.T) {
+	var quantities []uint16
+	inner := NewClientWithPackagerTransporter(&mockPackager{}, &mockTransporter{
+		sendFunc: func(_ context.Context, req []byte) ([]byte, error) {
+			if req[0] != FuncCodeReadHoldingRegisters {
+				return []byte{req[0], 0, 2, 0, 0}, nil
+			}
+			quantity := binary.BigEndian.Uint16(req[3:])
+			quantities = append(quantities, quantity)
+			return append([]byte{req[0], byte(2 * quantity)}, make([]byte, 2*quantity)...), nil
+		},
+	}, WithMaxReadQuantity(10))
+	ctx := context.Background()
+
+	// The options of the client behind a ResilientClient apply, and each
+	// request goes through the breaker
+	resilient := NewResilientClient(inner, 1, time.Minute)
+	if _, err := ReadHoldingRegistersChunked(ctx, resilient, 0, 25); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(quantities) != "[10 10 5]" {
+		t.Errorf("expected reads of [10 10 5], got %v", quantities)
+	}
+	if supported, err := SupportsFunction(ctx, resilient, FuncCodeReadFIFOQueue); err != nil || !supported {
+		t.Errorf("expected the function to be supported, got %v, %v", supported, err)
+	}
+
+	// Other implementations get the protocol limits and can't be probed
+	quantities = nil
+	other := otherClient{NewClientWithPackagerTransporter(&mockPackager{}, inner.(*client).transporter)}
+	if _, err := ReadHoldingRegistersChunked(ctx, other, 0, 130); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(quantities) != "[125 5]" {
+		t.Errorf("expected reads of [125 5], got %v", quantities)
+	}
+	if _, err := SupportsFunction(ctx, other, FuncCodeReadFIFOQueue); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+	if _, err := SupportsFunction(ctx, NewResilientClient(other, 1, time.Minute), FuncCodeReadFIFOQueue); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported through a ResilientClient, got %v", err)
+	}
+	if _, err := ReadExceptionStatus(ctx, other); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported reading exception status, got %v", err)
+	}
+}
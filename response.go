@@ -0,0 +1,108 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import "encoding/binary"
+
+// NewCoilResponse builds a Read Coils response with the byte count and the
+// coil values packed LSB first. values must fit one response (up to 2000
+// coils). Set FunctionCode to FuncCodeReadDiscreteInputs to answer Read
+// Discrete Inputs.
+func NewCoilResponse(values []bool) *ProtocolDataUnit {
+	byteCount := (len(values) + 7) / 8
+	data := make([]byte, 1+byteCount)
+	data[0] = byte(byteCount)
+	for i, value := range values {
+		if value {
+			data[1+i/8] |= 1 << uint(i%8)
+		}
+	}
+	return &ProtocolDataUnit{FunctionCode: FuncCodeReadCoils, Data: data}
+}
+
+// NewRegisterResponse builds a Read Holding Registers response with the
+// byte count and the big-endian register values. values must fit one
+// response (up to 125 registers). Set FunctionCode to answer Read Input
+// Registers or Read/Write Multiple Registers.
+func NewRegisterResponse(values []uint16) *ProtocolDataUnit {
+	data := make([]byte, 1+2*len(values))
+	data[0] = byte(2 * len(values))
+	for i, value := range values {
+		binary.BigEndian.PutUint16(data[1+i*2:], value)
+	}
+	return &ProtocolDataUnit{FunctionCode: FuncCodeReadHoldingRegisters, Data: data}
+}
+
+// NewExceptionResponse builds the exception response to a request with the
+// given function code.
+func NewExceptionResponse(functionCode, exceptionCode byte) *ProtocolDataUnit {
+	return &ProtocolDataUnit{
+		FunctionCode: functionCode | 0x80,
+		Data:         []byte{exceptionCode},
+	}
+}
+
+// ExpectedResponseLength returns the length of the PDU, function code
+// included, of the normal response to a request with the given function
+// code and data, and whether it can be determined from the request. It
+// can't for Read FIFO Queue, whose response length depends on the queue,
+// unknown function codes and malformed requests. The length is 0 for Force
+// Listen Only Mode, which is never answered. Exception responses are
+// always two bytes long.
+func ExpectedResponseLength(functionCode byte, requestData []byte) (int, bool) {
+	switch functionCode {
+	case FuncCodeReadCoils, FuncCodeReadDiscreteInputs:
+		if len(requestData) < 4 {
+			return 0, false
+		}
+		quantity := int(binary.BigEndian.Uint16(requestData[2:]))
+		return 2 + (quantity+7)/8, true
+	case FuncCodeReadHoldingRegisters, FuncCodeReadInputRegisters:
+		if len(requestData) < 4 {
+			return 0, false
+		}
+		quantity := int(binary.BigEndian.Uint16(requestData[2:]))
+		return 2 + 2*quantity, true
+	case FuncCodeReadWriteMultipleRegisters:
+		if len(requestData) < 4 {
+			return 0, false
+		}
+		readQuantity := int(binary.BigEndian.Uint16(requestData[2:]))
+		return 2 + 2*readQuantity, true
+	case FuncCodeWriteSingleCoil, FuncCodeWriteMultipleCoils,
+		FuncCodeWriteSingleRegister, FuncCodeWriteMultipleRegisters:
+		return 5, true
+	case FuncCodeMaskWriteRegister:
+		return 7, true
+	case FuncCodeReadFileRecord:
+		// One response per 7 byte sub-request: length, reference type
+		// and the records
+		if len(requestData) < 1 || int(requestData[0]) != len(requestData)-1 || requestData[0]%7 != 0 {
+			return 0, false
+		}
+		length := 2
+		for sub := requestData[1:]; len(sub) > 0; sub = sub[7:] {
+			length += 2 + 2*int(binary.BigEndian.Uint16(sub[5:]))
+		}
+		return length, true
+	case FuncCodeWriteFileRecord:
+		// The request is echoed
+		return 1 + len(requestData), true
+	case FuncCodeDiagnostics:
+		if len(requestData) < 2 {
+			return 0, false
+		}
+		if binary.BigEndian.Uint16(requestData) == DiagnosticForceListenOnlyMode {
+			return 0, true
+		}
+		return 1 + len(requestData), true
+	case FuncCodeReadExceptionStatus:
+		return 2, true
+	case FuncCodeGetCommEventCounter:
+		return 5, true
+	default:
+		return 0, false
+	}
+}
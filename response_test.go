@@ -0,0 +1,76 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNewCoilResponse(t *testing.T) {
+	pdu := NewCoilResponse([]bool{true, false, true, true, false, false, false, false, true})
+	if pdu.FunctionCode != FuncCodeReadCoils {
+		t.Errorf("function code: expected %v, actual %v", FuncCodeReadCoils, pdu.FunctionCode)
+	}
+	expected := []byte{2, 0x0D, 0x01}
+	if !bytes.Equal(expected, pdu.Data) {
+		t.Errorf("expected % x, actual % x", expected, pdu.Data)
+	}
+}
+
+func TestNewRegisterResponse(t *testing.T) {
+	pdu := NewRegisterResponse([]uint16{0x1234, 0xABCD})
+	if pdu.FunctionCode != FuncCodeReadHoldingRegisters {
+		t.Errorf("function code: expected %v, actual %v", FuncCodeReadHoldingRegisters, pdu.FunctionCode)
+	}
+	expected := []byte{4, 0x12, 0x34, 0xAB, 0xCD}
+	if !bytes.Equal(expected, pdu.Data) {
+		t.Errorf("expected % x, actual % x", expected, pdu.Data)
+	}
+}
+
+func TestNewExceptionResponse(t *testing.T) {
+	pdu := NewExceptionResponse(FuncCodeWriteSingleRegister, ExceptionCodeIllegalDataAddress)
+	err := responseError(pdu)
+	mbErr, ok := err.(*ModbusError)
+	if !ok {
+		t.Fatalf("expected *ModbusError, got %v", err)
+	}
+	if mbErr.FunctionCode != FuncCodeWriteSingleRegister|0x80 || mbErr.ExceptionCode != ExceptionCodeIllegalDataAddress {
+		t.Errorf("unexpected exception %+v", mbErr)
+	}
+}
+
+func TestExpectedResponseLength(t *testing.T) {
+	tests := []struct {
+		name         string
+		functionCode byte
+		data         []byte
+		length       int
+		ok           bool
+	}{
+		{"read coils", FuncCodeReadCoils, []byte{0x00, 0x13, 0x00, 0x13}, 5, true},
+		{"read holding registers", FuncCodeReadHoldingRegisters, []byte{0x00, 0x6B, 0x00, 0x03}, 8, true},
+		{"read/write multiple registers", FuncCodeReadWriteMultipleRegisters, []byte{0x00, 0x03, 0x00, 0x06, 0x00, 0x0E, 0x00, 0x03, 0x06, 0, 0, 0, 0, 0, 0}, 14, true},
+		{"write multiple coils", FuncCodeWriteMultipleCoils, []byte{0x00, 0x13, 0x00, 0x0A, 0x02, 0xCD, 0x01}, 5, true},
+		{"mask write register", FuncCodeMaskWriteRegister, []byte{0x00, 0x04, 0x00, 0xF2, 0x00, 0x25}, 7, true},
+		// Two sub-requests of 2 records each
+		{"read file record", FuncCodeReadFileRecord, []byte{0x0E, 0x06, 0x00, 0x04, 0x00, 0x01, 0x00, 0x02, 0x06, 0x00, 0x03, 0x00, 0x09, 0x00, 0x02}, 14, true},
+		{"read file record malformed", FuncCodeReadFileRecord, []byte{0x0E, 0x06, 0x00, 0x04}, 0, false},
+		{"write file record", FuncCodeWriteFileRecord, []byte{0x0D, 0x06, 0x00, 0x04, 0x00, 0x07, 0x00, 0x03, 0x06, 0xAF, 0x04, 0xBE, 0x10, 0x0D}, 15, true},
+		{"diagnostics", FuncCodeDiagnostics, []byte{0x00, 0x00, 0xA5, 0x37}, 5, true},
+		{"force listen only", FuncCodeDiagnostics, []byte{0x00, 0x04, 0x00, 0x00}, 0, true},
+		{"read exception status", FuncCodeReadExceptionStatus, nil, 2, true},
+		{"read FIFO queue", FuncCodeReadFIFOQueue, []byte{0x04, 0xDE}, 0, false},
+		{"short request", FuncCodeReadInputRegisters, []byte{0x00, 0x08}, 0, false},
+		{"unknown function", 0x41, nil, 0, false},
+	}
+	for _, tt := range tests {
+		length, ok := ExpectedResponseLength(tt.functionCode, tt.data)
+		if length != tt.length || ok != tt.ok {
+			t.Errorf("%s: expected %v, %v, actual %v, %v", tt.name, tt.length, tt.ok, length, ok)
+		}
+	}
+}
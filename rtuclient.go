@@ -5,9 +5,10 @@
 package modbus
 
 import (
+	"bytes"
 	"context"
-	"encoding/binary"
 	"fmt"
+	"sync/atomic"
 	"time"
 )
 
@@ -34,6 +35,9 @@ func NewRTUClientHandler(address string) *RTUClientHandler {
 	handler.Parity = EvenParity
 	handler.Timeout = serialTimeout
 	handler.IdleTimeout = serialIdleTimeout
+	handler.ReconnectBackoff = serialReconnectBackoff
+	handler.MaxReconnectBackoff = serialMaxReconnectBackoff
+	handler.MaxFrameSize = rtuMaxSize
 	return handler
 }
 
@@ -46,6 +50,40 @@ func RTUClient(address string) Client {
 // rtuPackager implements Packager interface.
 type rtuPackager struct {
 	SlaveID byte
+	// SkipSlaveIDCheck accepts responses whose slave id does not match the
+	// request, for gateways that answer with their own id. The CRC and
+	// frame structure are still checked. Leave it disabled unless a device is
+	// known to need it: without the check, replies from another device on the
+	// bus (cross-talk) can no longer be detected.
+	//
+	// Deprecated: Set Compliance to Lenient, which relaxes this check
+	// along with the others of noncompliant devices.
+	SkipSlaveIDCheck bool
+	// VerboseErrors includes the offending frame, truncated to 64 bytes,
+	// in Decode errors for field debugging of malformed frames.
+	VerboseErrors bool
+	// Compliance selects the checks relaxed for noncompliant devices, see
+	// Lenient.
+	Compliance Compliance
+
+	// framingErrors counts responses that failed the CRC check
+	framingErrors atomic.Uint64
+}
+
+func (mb *rtuPackager) copiesPDUData() {}
+
+func (mb *rtuPackager) relaxedChecks() checks {
+	relaxed := mb.Compliance.relaxed()
+	if mb.SkipSlaveIDCheck {
+		relaxed |= checkSlaveID
+	}
+	return relaxed
+}
+
+// FramingErrorCount returns the number of responses rejected by Decode
+// because of a CRC mismatch, an indicator of line quality.
+func (mb *rtuPackager) FramingErrorCount() uint64 {
+	return mb.framingErrors.Load()
 }
 
 // Encode encodes PDU in a RTU frame:
@@ -83,7 +121,7 @@ func (mb *rtuPackager) Verify(aduRequest, aduResponse []byte) (err error) {
 		return fmt.Errorf("%w: response length '%v' does not meet minimum '%v'", ErrShortFrame, length, rtuMinSize)
 	}
 	// Slave address must match
-	if aduResponse[0] != aduRequest[0] {
+	if mb.relaxedChecks()&checkSlaveID == 0 && aduResponse[0] != aduRequest[0] {
 		return fmt.Errorf("%w: response slave id '%v' does not match request '%v'", ErrProtocolError, aduResponse[0], aduRequest[0])
 	}
 	return nil
@@ -91,12 +129,25 @@ func (mb *rtuPackager) Verify(aduRequest, aduResponse []byte) (err error) {
 
 // Decode extracts PDU from RTU frame and verify CRC.
 func (mb *rtuPackager) Decode(adu []byte) (pdu *ProtocolDataUnit, err error) {
+	if mb.VerboseErrors {
+		defer func() {
+			if err != nil {
+				frame, more := truncateFrame(adu)
+				err = fmt.Errorf("%w (frame % x%s)", err, frame, more)
+			}
+		}()
+	}
 	length := len(adu)
+	// Minimum size (including address, function and CRC)
+	if length < rtuMinSize {
+		return nil, fmt.Errorf("%w: response length '%v' does not meet minimum '%v'", ErrShortFrame, length, rtuMinSize)
+	}
 	// Calculate checksum
 	var crc crc
 	crc.reset().pushBytes(adu[0 : length-2])
 	checksum := uint16(adu[length-1])<<8 | uint16(adu[length-2])
 	if checksum != crc.value() {
+		mb.framingErrors.Add(1)
 		return nil, fmt.Errorf("%w: response crc '%v' does not match expected '%v'", ErrProtocolError, checksum, crc.value())
 	}
 	// Function code & data
@@ -109,6 +160,30 @@ func (mb *rtuPackager) Decode(adu []byte) (pdu *ProtocolDataUnit, err error) {
 // rtuSerialTransporter implements Transporter interface.
 type rtuSerialTransporter struct {
 	serialPort
+
+	// RTSEnable asserts RTS while the request is transmitted and releases
+	// it before the response is read, for half-duplex RS-485 adapters that
+	// switch direction on RTS.
+	RTSEnable bool
+	// RTSDelayBeforeSend is the time to wait after asserting RTS before
+	// the request is written.
+	RTSDelayBeforeSend time.Duration
+	// RTSDelayAfterSend is the time to wait after the request is
+	// transmitted before RTS is released.
+	RTSDelayAfterSend time.Duration
+	// MaxFrameSize is the size of the response buffer. Responses longer
+	// than this are rejected with ErrProtocolError. Defaults to the 256
+	// bytes of a standard Modbus RTU frame.
+	MaxFrameSize int
+	// MinReadTimeout is the lower bound of the response read timeout, so
+	// that a Timeout tuned for the short frame times of a high baud rate
+	// still gives slow devices time to respond. It doesn't extend a
+	// context deadline.
+	MinReadTimeout time.Duration
+	// EchoSuppression discards the echo of the request that some
+	// half-duplex RS-485 adapters return on the receive line before the
+	// response. The echo must match the request exactly.
+	EchoSuppression bool
 }
 
 // Send transmits an RTU request and receives the response.
@@ -125,13 +200,16 @@ func (mb *rtuSerialTransporter) Send(ctx context.Context, aduRequest []byte) (ad
 	mb.mu.Lock()
 	defer mb.mu.Unlock()
 
+	mb.stats.requests.Add(1)
+	defer func() { mb.stats.done(aduResponse, err) }()
+
 	// Check context before starting
 	if err = ctx.Err(); err != nil {
 		return nil, fmt.Errorf("context cancelled before send: %w", err)
 	}
 
 	// Make sure port is connected
-	if err = mb.connect(); err != nil {
+	if err = mb.connectContext(ctx); err != nil {
 		return nil, fmt.Errorf("connecting: %w", err)
 	}
 
@@ -146,8 +224,8 @@ func (mb *rtuSerialTransporter) Send(ctx context.Context, aduRequest []byte) (ad
 
 	// Send the request
 	mb.logf("modbus: sending % x\n", aduRequest)
-	if _, err = mb.port.Write(aduRequest); err != nil {
-		return nil, fmt.Errorf("writing request: %w", err)
+	if err = mb.write(aduRequest); err != nil {
+		return nil, err
 	}
 
 	// Check context after write
@@ -155,10 +233,7 @@ func (mb *rtuSerialTransporter) Send(ctx context.Context, aduRequest []byte) (ad
 		return nil, fmt.Errorf("context cancelled: %w", err)
 	}
 
-	function := aduRequest[1]
-	functionFail := aduRequest[1] & 0x80
-	bytesToRead := calculateResponseLength(aduRequest)
-	time.Sleep(mb.calculateDelay(len(aduRequest) + bytesToRead))
+	mb.clock().Sleep(mb.calculateDelay(len(aduRequest) + calculateResponseLength(aduRequest)))
 
 	// Check context after delay
 	if err = ctx.Err(); err != nil {
@@ -166,28 +241,87 @@ func (mb *rtuSerialTransporter) Send(ctx context.Context, aduRequest []byte) (ad
 	}
 
 	// Set read timeout based on context deadline
-	readTimeout := mb.Timeout
+	readTimeout := max(mb.Timeout, mb.MinReadTimeout)
 	if deadline, ok := ctx.Deadline(); ok {
 		timeUntilDeadline := time.Until(deadline)
 		if timeUntilDeadline > 0 {
 			readTimeout = timeUntilDeadline
 		} else {
-			return nil, fmt.Errorf("context deadline exceeded before read")
+			return nil, fmt.Errorf("%w: deadline passed before read", ErrContextDeadline)
 		}
 	}
-	if err = mb.port.SetReadTimeout(readTimeout); err != nil {
+	if err = mb.setReadTimeout(readTimeout); err != nil {
 		return nil, fmt.Errorf("setting read timeout: %w", err)
 	}
 
 	// Restore original timeout after reads complete
 	defer func() {
-		if restoreErr := mb.port.SetReadTimeout(mb.Timeout); restoreErr != nil {
+		if restoreErr := mb.setReadTimeout(mb.Timeout); restoreErr != nil {
 			mb.logf("modbus: warning - failed to restore read timeout: %v\n", restoreErr)
 		}
 	}()
 
+	if mb.EchoSuppression {
+		if err = mb.readEcho(ctx, aduRequest); err != nil {
+			return nil, err
+		}
+	}
+
+	maxSize := mb.MaxFrameSize
+	if maxSize <= 0 {
+		maxSize = rtuMaxSize
+	}
+	data := make([]byte, maxSize)
+	for retries := mb.ShortFrameRetries; ; retries-- {
+		var short bool
+		aduResponse, short, err = mb.readResponse(ctx, aduRequest, data)
+		if !short || retries <= 0 {
+			break
+		}
+		// Discard the rest of the truncated frame and read the next one
+		mb.logf("modbus: discarding short frame: %v\n", err)
+		if flushErr := mb.port.ResetInputBuffer(); flushErr != nil {
+			mb.logf("modbus: warning - failed to flush input buffer: %v\n", flushErr)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	mb.logf("modbus: received % x\n", aduResponse)
+	return aduResponse, nil
+}
+
+// readEcho reads back the echo of aduRequest and checks that it matches.
+func (mb *rtuSerialTransporter) readEcho(ctx context.Context, aduRequest []byte) error {
+	echo := make([]byte, len(aduRequest))
+	for n := 0; n < len(echo); {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("context cancelled during read: %w", timeoutError(ctx, err))
+		}
+		nn, err := mb.port.Read(echo[n:])
+		n += nn
+		if err != nil {
+			return fmt.Errorf("reading echo: %w", err)
+		}
+		if nn == 0 {
+			err = fmt.Errorf("unexpected EOF, got %d bytes, expected %d", n, len(echo))
+			return fmt.Errorf("reading echo: %w", timeoutError(ctx, err))
+		}
+	}
+	if !bytes.Equal(echo, aduRequest) {
+		return fmt.Errorf("%w: echo % x does not match request % x", ErrProtocolError, echo, aduRequest)
+	}
+	return nil
+}
+
+// readResponse reads the response to aduRequest into data. short reports
+// that the line fell silent after part of a frame was received.
+func (mb *rtuSerialTransporter) readResponse(ctx context.Context, aduRequest, data []byte) (aduResponse []byte, short bool, err error) {
+	function := aduRequest[1]
+	functionFail := aduRequest[1] & 0x80
+	bytesToRead := calculateResponseLength(aduRequest)
+	maxSize := len(data)
 	var n int
-	var data [rtuMaxSize]byte
 
 	// Read minimum length with context checks between reads.
 	// We use Read() in a loop instead of ReadAtLeast() to allow
@@ -195,18 +329,19 @@ func (mb *rtuSerialTransporter) Send(ctx context.Context, aduRequest []byte) (ad
 	for n < rtuMinSize {
 		// Check context before each read iteration
 		if err = ctx.Err(); err != nil {
-			return nil, fmt.Errorf("context cancelled during read: %w", err)
+			return nil, false, fmt.Errorf("context cancelled during read: %w", timeoutError(ctx, err))
 		}
 
 		var nn int
 		nn, err = mb.port.Read(data[n:])
 		n += nn
 		if err != nil {
-			return nil, fmt.Errorf("reading response: %w", err)
+			return nil, false, fmt.Errorf("reading response: %w", err)
 		}
 		if nn == 0 && n < rtuMinSize {
 			// No more data available and we haven't reached minimum length
-			return nil, fmt.Errorf("reading response: unexpected EOF, got %d bytes, expected at least %d", n, rtuMinSize)
+			err = fmt.Errorf("unexpected EOF, got %d bytes, expected at least %d", n, rtuMinSize)
+			return nil, n > 0, fmt.Errorf("reading response: %w", timeoutError(ctx, err))
 		}
 	}
 
@@ -221,29 +356,141 @@ func (mb *rtuSerialTransporter) Send(ctx context.Context, aduRequest []byte) (ad
 		targetLength = n // Unknown function, use what we have
 	}
 
-	// Read remaining bytes with context checks between reads
-	if targetLength > rtuMinSize && targetLength <= rtuMaxSize {
+	if targetLength > maxSize {
+		return nil, false, fmt.Errorf("%w: response length '%v' exceeds maximum frame size '%v'", ErrProtocolError, targetLength, maxSize)
+	}
+	if data[1] == function && (function == FuncCodeReadFIFOQueue || function == FuncCodeEncapsulatedInterface ||
+		function == FuncCodeWriteSingleRegister && relaxedChecksOf(ctx)&checkWriteEcho != 0) {
+		// Response length is undetermined, the frame ends on line silence
+		if n, err = mb.readUntilSilence(ctx, data, n); err != nil {
+			return nil, false, fmt.Errorf("reading response body: %w", err)
+		}
+	} else if targetLength > rtuMinSize {
+		// Read remaining bytes with context checks between reads
 		for n < targetLength {
 			// Check context before each read iteration
 			if err = ctx.Err(); err != nil {
-				return nil, fmt.Errorf("context cancelled during read: %w", err)
+				return nil, false, fmt.Errorf("context cancelled during read: %w", timeoutError(ctx, err))
 			}
 
 			var nn int
 			nn, err = mb.port.Read(data[n:targetLength])
 			n += nn
 			if err != nil {
-				return nil, fmt.Errorf("reading response body: %w", err)
+				return nil, false, fmt.Errorf("reading response body: %w", err)
 			}
 			if nn == 0 {
 				// No more data available and we haven't reached target length
-				return nil, fmt.Errorf("reading response body: unexpected EOF, got %d bytes, expected %d", n, targetLength)
+				err = fmt.Errorf("unexpected EOF, got %d bytes, expected %d", n, targetLength)
+				return nil, true, fmt.Errorf("reading response body: %w", timeoutError(ctx, err))
 			}
 		}
 	}
-	aduResponse = data[:n]
-	mb.logf("modbus: received % x\n", aduResponse)
-	return aduResponse, nil
+	return data[:n], false, nil
+}
+
+// SendNoResponse transmits a request without waiting for a response, then
+// waits out the frame delay so that the next request is not sent too soon.
+func (mb *rtuSerialTransporter) SendNoResponse(ctx context.Context, aduRequest []byte) (err error) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.stats.requests.Add(1)
+	defer func() { mb.stats.done(nil, err) }()
+
+	if err = ctx.Err(); err != nil {
+		return fmt.Errorf("context cancelled before send: %w", err)
+	}
+	if err = mb.connectContext(ctx); err != nil {
+		return fmt.Errorf("connecting: %w", err)
+	}
+	mb.lastActivity = time.Now()
+	mb.startCloseTimer()
+
+	mb.logf("modbus: sending % x (no response expected)\n", aduRequest)
+	if err = mb.write(aduRequest); err != nil {
+		return err
+	}
+	mb.clock().Sleep(mb.calculateDelay(len(aduRequest)))
+	if mb.EchoSuppression {
+		// Nothing else follows the echo, drop it
+		if err = mb.port.ResetInputBuffer(); err != nil {
+			return fmt.Errorf("discarding echo: %w", err)
+		}
+	}
+	return nil
+}
+
+// write transmits the request, toggling RTS around it if RTSEnable is set.
+func (mb *rtuSerialTransporter) write(aduRequest []byte) (err error) {
+	if mb.RTSEnable {
+		if err = mb.port.SetRTS(true); err != nil {
+			return fmt.Errorf("asserting RTS: %w", err)
+		}
+		defer func() {
+			if rtsErr := mb.port.SetRTS(false); rtsErr != nil && err == nil {
+				err = fmt.Errorf("releasing RTS: %w", rtsErr)
+			}
+		}()
+		mb.clock().Sleep(mb.RTSDelayBeforeSend)
+	}
+	written, err := mb.port.Write(aduRequest)
+	mb.stats.bytesSent.Add(uint64(written))
+	if err != nil {
+		return fmt.Errorf("writing request: %w", err)
+	}
+	if mb.RTSEnable {
+		// Wait until the request has left the transmit buffer
+		if err = mb.port.Drain(); err != nil {
+			return fmt.Errorf("draining request: %w", err)
+		}
+		mb.clock().Sleep(mb.RTSDelayAfterSend)
+	}
+	return nil
+}
+
+// readUntilSilence reads into data after the first n bytes until no byte
+// arrives within the inter-character timeout (1.5 character times), which
+// marks the end of an RTU frame. It returns the total number of bytes read.
+func (mb *rtuSerialTransporter) readUntilSilence(ctx context.Context, data []byte, n int) (int, error) {
+	if err := mb.setReadTimeout(mb.characterTimeout()); err != nil {
+		return n, fmt.Errorf("setting inter-character timeout: %w", err)
+	}
+	for n < len(data) {
+		// Check context before each read iteration
+		if err := ctx.Err(); err != nil {
+			return n, fmt.Errorf("context cancelled during read: %w", err)
+		}
+
+		nn, err := mb.port.Read(data[n:])
+		n += nn
+		if err != nil {
+			return n, err
+		}
+		if nn == 0 {
+			// Line silent for the inter-character timeout, frame complete
+			return n, nil
+		}
+	}
+	// The buffer is full, the frame must end here
+	var extra [1]byte
+	nn, err := mb.port.Read(extra[:])
+	if err != nil {
+		return n, err
+	}
+	if nn > 0 {
+		return n, fmt.Errorf("%w: response exceeds maximum frame size '%v'", ErrProtocolError, len(data))
+	}
+	return n, nil
+}
+
+// characterTimeout returns the inter-character timeout t1.5.
+// See MODBUS over Serial Line - Specification and Implementation Guide (page 13).
+func (mb *rtuSerialTransporter) characterTimeout() time.Duration {
+	if mb.BaudRate <= 0 || mb.BaudRate > 19200 {
+		return 750 * time.Microsecond
+	}
+	return time.Duration(15000000/mb.BaudRate) * time.Microsecond
 }
 
 // calculateDelay roughly calculates time needed for the next frame.
@@ -261,31 +508,15 @@ func (mb *rtuSerialTransporter) calculateDelay(chars int) time.Duration {
 	return time.Duration(characterDelay*chars+frameDelay) * time.Microsecond
 }
 
+// calculateResponseLength returns the length of the response frame to an
+// RTU request, or the minimum frame size if it can't be determined.
 func calculateResponseLength(adu []byte) int {
-	length := rtuMinSize
-	switch adu[1] {
-	case FuncCodeReadDiscreteInputs,
-		FuncCodeReadCoils:
-		count := int(binary.BigEndian.Uint16(adu[4:]))
-		length += 1 + count/8
-		if count%8 != 0 {
-			length++
-		}
-	case FuncCodeReadInputRegisters,
-		FuncCodeReadHoldingRegisters,
-		FuncCodeReadWriteMultipleRegisters:
-		count := int(binary.BigEndian.Uint16(adu[4:]))
-		length += 1 + count*2
-	case FuncCodeWriteSingleCoil,
-		FuncCodeWriteMultipleCoils,
-		FuncCodeWriteSingleRegister,
-		FuncCodeWriteMultipleRegisters:
-		length += 4
-	case FuncCodeMaskWriteRegister:
-		length += 6
-	case FuncCodeReadFIFOQueue:
-		// undetermined
-	default:
+	if len(adu) < rtuMinSize {
+		return rtuMinSize
+	}
+	if length, ok := ExpectedResponseLength(adu[1], adu[2:len(adu)-2]); ok && length > 0 {
+		// Slave address, PDU and CRC
+		return 1 + length + 2
 	}
-	return length
+	return rtuMinSize
 }
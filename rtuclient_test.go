@@ -6,7 +6,14 @@ package modbus
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestRTUEncoding(t *testing.T) {
@@ -45,6 +52,40 @@ func TestRTUDecoding(t *testing.T) {
 	}
 }
 
+func TestRTUDecodeVerboseErrors(t *testing.T) {
+	adu := []byte{0x01, 0x10, 0x8A, 0x00, 0x00, 0x03, 0xAA, 0x11}
+	decoder := rtuPackager{}
+	_, err := decoder.Decode(adu)
+	if err == nil || strings.Contains(err.Error(), "frame") {
+		t.Fatalf("expected CRC error without the frame, got %v", err)
+	}
+	decoder.VerboseErrors = true
+	_, err = decoder.Decode(adu)
+	if err == nil || !strings.Contains(err.Error(), "(frame 01 10 8a 00 00 03 aa 11)") {
+		t.Fatalf("expected CRC error with the frame, got %v", err)
+	}
+
+	// Long frames are truncated
+	_, err = decoder.Decode(make([]byte, 100))
+	if err == nil || !strings.Contains(err.Error(), "...)") || strings.Count(err.Error(), "00") != 64 {
+		t.Fatalf("expected truncated frame, got %v", err)
+	}
+}
+
+func TestRTUFramingErrorCount(t *testing.T) {
+	handler := NewRTUClientHandler("")
+	handler.Decode([]byte{0x01, 0x10, 0x8A, 0x00, 0x00, 0x03, 0xAA, 0x11})
+	handler.Decode([]byte{0x01, 0x10, 0x8A})
+	if _, err := handler.Decode([]byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x02, 0xC4, 0x0B}); err != nil {
+		t.Fatal(err)
+	}
+	handler.Decode([]byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x02, 0xC4, 0x0C})
+	// Only the CRC mismatches count, not the short frame
+	if count := handler.FramingErrorCount(); count != 2 {
+		t.Errorf("expected 2 framing errors, got %v", count)
+	}
+}
+
 var responseLengthTests = []struct {
 	adu    []byte
 	length int
@@ -68,6 +109,328 @@ func TestCalculateResponseLength(t *testing.T) {
 	}
 }
 
+func TestRTUVerifySkipSlaveIDCheck(t *testing.T) {
+	request := []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01, 0x84, 0x0A}
+	response := []byte{0x02, 0x03, 0x02, 0x00, 0x2A, 0x7D, 0x9B}
+
+	packager := rtuPackager{}
+	if err := packager.Verify(request, response); err == nil {
+		t.Fatal("expected slave id mismatch error")
+	}
+	packager.SkipSlaveIDCheck = true
+	if err := packager.Verify(request, response); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := packager.Decode(response); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// silentReader returns its data in chunks and then reports silence
+// (zero bytes, no error) like a serial port whose read timeout expired.
+type silentReader struct {
+	chunks [][]byte
+}
+
+func (r *silentReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, nil
+	}
+	n := copy(p, r.chunks[0])
+	r.chunks = r.chunks[1:]
+	return n, nil
+}
+
+func TestRTUReadFIFOQueueUntilSilence(t *testing.T) {
+	packager := rtuPackager{SlaveID: 1}
+	response, err := packager.Encode(&ProtocolDataUnit{
+		FunctionCode: FuncCodeReadFIFOQueue,
+		Data:         []byte{0x00, 0x06, 0x00, 0x02, 0x01, 0xB8, 0x12, 0x84},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := &nopCloser{
+		ReadWriter: struct {
+			io.Reader
+			io.Writer
+		}{
+			Reader: &silentReader{chunks: [][]byte{response[:4], response[4:9], response[9:]}},
+			Writer: io.Discard,
+		},
+	}
+	transporter := rtuSerialTransporter{}
+	transporter.BaudRate = 19200
+	transporter.port = port
+
+	request := []byte{0x01, FuncCodeReadFIFOQueue, 0x04, 0xDE, 0x00, 0x00}
+	aduResponse, err := transporter.Send(context.Background(), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(response, aduResponse) {
+		t.Fatalf("response: expected % x, actual % x", response, aduResponse)
+	}
+}
+
+func TestRTULenientWriteEcho(t *testing.T) {
+	// The device echoes only the value written, in a 6 byte frame
+	response, err := (&rtuPackager{SlaveID: 1}).Encode(&ProtocolDataUnit{
+		FunctionCode: FuncCodeWriteSingleRegister,
+		Data:         []byte{0x12, 0x34},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newClient := func(packager *rtuPackager, opts ...ClientOption) Client {
+		transporter := &rtuSerialTransporter{}
+		transporter.BaudRate = 19200
+		transporter.port = &nopCloser{
+			ReadWriter: struct {
+				io.Reader
+				io.Writer
+			}{
+				Reader: &silentReader{chunks: [][]byte{response[:4], response[4:]}},
+				Writer: io.Discard,
+			},
+		}
+		return NewClientWithPackagerTransporter(packager, transporter, opts...)
+	}
+
+	if _, err = newClient(&rtuPackager{SlaveID: 1}).WriteSingleRegister(context.Background(), 100, 0x1234); !errors.Is(err, ErrResponseTimeout) {
+		t.Errorf("strict: expected the short frame to time out, got %v", err)
+	}
+	for name, client := range map[string]Client{
+		"Compliance":           newClient(&rtuPackager{SlaveID: 1, Compliance: Lenient}),
+		"WithLenientWriteEcho": newClient(&rtuPackager{SlaveID: 1}, WithLenientWriteEcho(true)),
+	} {
+		results, err := client.WriteSingleRegister(context.Background(), 100, 0x1234)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(results, []byte{0x12, 0x34}) {
+			t.Errorf("%s: expected the value, got % x", name, results)
+		}
+	}
+}
+
+func TestRTUMaxFrameSize(t *testing.T) {
+	packager := rtuPackager{SlaveID: 1}
+	response, err := packager.Encode(&ProtocolDataUnit{
+		FunctionCode: FuncCodeReadFIFOQueue,
+		Data:         []byte{0x00, 0x06, 0x00, 0x02, 0x01, 0xB8, 0x12, 0x84},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newTransporter := func(chunks ...[]byte) *rtuSerialTransporter {
+		transporter := &rtuSerialTransporter{MaxFrameSize: 8}
+		transporter.BaudRate = 19200
+		transporter.port = &nopCloser{
+			ReadWriter: struct {
+				io.Reader
+				io.Writer
+			}{
+				Reader: &silentReader{chunks: chunks},
+				Writer: io.Discard,
+			},
+		}
+		return transporter
+	}
+
+	// Fixed length response longer than the buffer
+	_, err = newTransporter([]byte{0x01, 0x03, 0x14, 0x00}).Send(context.Background(),
+		[]byte{0x01, FuncCodeReadHoldingRegisters, 0x00, 0x00, 0x00, 0x0A, 0xC5, 0xCD})
+	if !errors.Is(err, ErrProtocolError) {
+		t.Errorf("fixed length: expected ErrProtocolError, got %v", err)
+	}
+
+	// Response ended by silence that overflows the buffer
+	_, err = newTransporter(response[:4], response[4:8], response[8:]).Send(context.Background(),
+		[]byte{0x01, FuncCodeReadFIFOQueue, 0x04, 0xDE, 0x00, 0x00})
+	if !errors.Is(err, ErrProtocolError) {
+		t.Errorf("until silence: expected ErrProtocolError, got %v", err)
+	}
+}
+
+// sleepRecorder is a Clock recording the sleeps instead of sleeping.
+type sleepRecorder struct {
+	SystemClock
+	sleeps []time.Duration
+}
+
+func (c *sleepRecorder) Sleep(d time.Duration) {
+	c.sleeps = append(c.sleeps, d)
+}
+
+func TestRTUClock(t *testing.T) {
+	request := []byte{0x01, FuncCodeWriteSingleRegister, 0x00, 0x01, 0x00, 0x03, 0x98, 0x0B}
+	clock := &sleepRecorder{}
+	transporter := &rtuSerialTransporter{}
+	transporter.BaudRate = 9600
+	transporter.Clock = clock
+	transporter.port = &nopCloser{ReadWriter: &bytes.Buffer{}}
+
+	if err := transporter.SendNoResponse(context.Background(), request); err != nil {
+		t.Fatal(err)
+	}
+	if len(clock.sleeps) != 1 || clock.sleeps[0] != transporter.calculateDelay(len(request)) {
+		t.Errorf("expected the frame delay of %v on the clock, got %v", transporter.calculateDelay(len(request)), clock.sleeps)
+	}
+}
+
+func TestRTUEchoSuppression(t *testing.T) {
+	packager := rtuPackager{SlaveID: 1}
+	request, err := packager.Encode(&ProtocolDataUnit{FunctionCode: FuncCodeWriteSingleRegister, Data: []byte{0x00, 0x01, 0x00, 0x03}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := packager.Encode(&ProtocolDataUnit{FunctionCode: FuncCodeWriteSingleRegister, Data: []byte{0x00, 0x01, 0x00, 0x2A}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := func(echo []byte) ([]byte, error) {
+		transporter := &rtuSerialTransporter{EchoSuppression: true}
+		transporter.BaudRate = 19200
+		transporter.port = &nopCloser{
+			ReadWriter: struct {
+				io.Reader
+				io.Writer
+			}{
+				Reader: &silentReader{chunks: [][]byte{echo[:3], echo[3:], response}},
+				Writer: io.Discard,
+			},
+		}
+		return transporter.Send(context.Background(), request)
+	}
+
+	aduResponse, err := send(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(response, aduResponse) {
+		t.Errorf("response: expected % x, actual % x", response, aduResponse)
+	}
+
+	garbled := append([]byte(nil), request...)
+	garbled[4] ^= 0xFF
+	if _, err = send(garbled); !errors.Is(err, ErrProtocolError) {
+		t.Errorf("expected ErrProtocolError for a garbled echo, got %v", err)
+	}
+}
+
+// slowPort answers with response after delay, or reports silence if the
+// read timeout is shorter than that.
+type slowPort struct {
+	nopCloser
+	response    []byte
+	delay       time.Duration
+	readTimeout time.Duration
+}
+
+func (p *slowPort) SetReadTimeout(timeout time.Duration) error {
+	p.readTimeout = timeout
+	return nil
+}
+
+func (p *slowPort) Read(b []byte) (int, error) {
+	if len(p.response) == 0 {
+		return 0, nil
+	}
+	if p.readTimeout < p.delay {
+		time.Sleep(p.readTimeout)
+		return 0, nil
+	}
+	time.Sleep(p.delay)
+	n := copy(b, p.response)
+	p.response = p.response[n:]
+	p.delay = 0
+	return n, nil
+}
+
+func TestRTUMinReadTimeout(t *testing.T) {
+	packager := rtuPackager{SlaveID: 1}
+	request, err := packager.Encode(&ProtocolDataUnit{FunctionCode: FuncCodeReadHoldingRegisters, Data: []byte{0x00, 0x00, 0x00, 0x01}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := packager.Encode(&ProtocolDataUnit{FunctionCode: FuncCodeReadHoldingRegisters, Data: []byte{0x02, 0x00, 0x2A}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newTransporter := func(minReadTimeout time.Duration) *rtuSerialTransporter {
+		transporter := &rtuSerialTransporter{MinReadTimeout: minReadTimeout}
+		transporter.BaudRate = 115200
+		transporter.Timeout = 10 * time.Millisecond
+		transporter.port = &slowPort{
+			nopCloser: nopCloser{ReadWriter: &bytes.Buffer{}},
+			response:  slices.Clone(response),
+			delay:     50 * time.Millisecond,
+		}
+		return transporter
+	}
+
+	if _, err = newTransporter(0).Send(context.Background(), request); !errors.Is(err, ErrResponseTimeout) {
+		t.Errorf("without floor: expected ErrResponseTimeout, got %v", err)
+	}
+
+	aduResponse, err := newTransporter(200*time.Millisecond).Send(context.Background(), request)
+	if err != nil {
+		t.Fatalf("with floor: %v", err)
+	}
+	if !bytes.Equal(response, aduResponse) {
+		t.Errorf("response: expected % x, actual % x", response, aduResponse)
+	}
+}
+
+// rtsPort records RTS changes and writes in order.
+type rtsPort struct {
+	nopCloser
+	events []string
+}
+
+func (p *rtsPort) SetRTS(rts bool) error {
+	p.events = append(p.events, fmt.Sprintf("rts=%v", rts))
+	return nil
+}
+
+func (p *rtsPort) Write(b []byte) (int, error) {
+	p.events = append(p.events, "write")
+	return len(b), nil
+}
+
+func TestRTUSendRTSToggle(t *testing.T) {
+	packager := rtuPackager{SlaveID: 1}
+	response, err := packager.Encode(&ProtocolDataUnit{FunctionCode: FuncCodeWriteSingleRegister, Data: []byte{0x00, 0x01, 0x00, 0x03}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := &rtsPort{nopCloser: nopCloser{ReadWriter: bytes.NewBuffer(response)}}
+	transporter := rtuSerialTransporter{RTSEnable: true}
+	transporter.BaudRate = 19200
+	transporter.port = port
+
+	if _, err = transporter.Send(context.Background(), response); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"rts=true", "write", "rts=false"}
+	if fmt.Sprint(port.events) != fmt.Sprint(expected) {
+		t.Fatalf("events: expected %v, actual %v", expected, port.events)
+	}
+}
+
+func FuzzRTUDecode(f *testing.F) {
+	f.Add([]byte{0x01, 0x03, 0x02, 0x00, 0x2A, 0x39, 0x9B})
+	f.Add([]byte{0x01, 0x83})
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, adu []byte) {
+		packager := rtuPackager{}
+		request := []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01, 0x84, 0x0A}
+		packager.Verify(request, adu)
+		packager.Decode(adu)
+	})
+}
+
 func BenchmarkRTUEncoder(b *testing.B) {
 	encoder := rtuPackager{
 		SlaveID: 10,
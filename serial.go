@@ -5,6 +5,9 @@
 package modbus
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"sync"
 	"time"
@@ -16,6 +19,9 @@ const (
 	// Default timeout
 	serialTimeout     = 5 * time.Second
 	serialIdleTimeout = 60 * time.Second
+	// Default backoff between failed attempts to open the port
+	serialReconnectBackoff    = 100 * time.Millisecond
+	serialMaxReconnectBackoff = 10 * time.Second
 )
 
 // serialPort has configuration and I/O controller.
@@ -29,12 +35,50 @@ type serialPort struct {
 	Timeout     time.Duration
 	Logger      *log.Logger
 	IdleTimeout time.Duration
+	// After a failed open, the next attempt waits ReconnectBackoff, doubling
+	// with each further failure up to MaxReconnectBackoff. A successful
+	// open resets the delay. A ReconnectBackoff of 0 disables the backoff.
+	ReconnectBackoff    time.Duration
+	MaxReconnectBackoff time.Duration
+	// ShortFrameRetries is the number of times a truncated response frame
+	// is discarded, flushing the input buffer, and another frame read with
+	// the same read timeout before the short frame is reported.
+	ShortFrameRetries int
+	// Clock times the delays between frames and the reconnect backoff;
+	// nil means SystemClock.
+	Clock Clock
+	// DrainOnClose waits for the output buffered by the port to be
+	// transmitted before closing it, so that a frame being written is not
+	// cut short. CloseNow does not wait.
+	DrainOnClose bool
+	// OpenPort opens the serial port at Address; nil means serial.Open.
+	// Tests can replace it to run the client over an in-memory port.
+	OpenPort func(address string, mode *serial.Mode) (serial.Port, error)
+	// LogRepeatWindow collapses a message logged again within the window
+	// of its last write into a count, written as "last message repeated
+	// N times" before the next message written. 0 writes every message.
+	LogRepeatWindow time.Duration
 
 	mu sync.Mutex
 	// port is platform-dependent data structure for serial port.
 	port         serial.Port
 	lastActivity time.Time
 	closeTimer   *time.Timer
+	stats        transportCounters
+	// Reconnect backoff state
+	connectFailures int
+	nextConnect     time.Time
+	// Control line levels set with SetDTR and SetRTS, applied on connect
+	dtr, rts *bool
+	// noReadTimeout is set once the port has reported that it does not
+	// support read timeouts. Reads then only stop between the context
+	// checks of the read loops.
+	noReadTimeout bool
+	// live is port for CloseNow, which must not wait for mu
+	liveMu sync.Mutex
+	live   serial.Port
+	// repeats limits the messages repeated within LogRepeatWindow
+	repeats repeatLimiter
 }
 
 // toSerialStopBits converts modbus StopBits to serial library StopBits.
@@ -47,15 +91,22 @@ func toSerialStopBits(sb StopBits) serial.StopBits {
 	}
 }
 
-// toSerialParity converts modbus Parity to serial library Parity.
-func toSerialParity(p Parity) serial.Parity {
+// toSerialParity converts modbus Parity to serial library Parity. An
+// unset parity is even, the Modbus serial line default.
+func toSerialParity(p Parity) (serial.Parity, error) {
 	switch p {
 	case NoParity:
-		return serial.NoParity
+		return serial.NoParity, nil
+	case EvenParity, "":
+		return serial.EvenParity, nil
 	case OddParity:
-		return serial.OddParity
+		return serial.OddParity, nil
+	case MarkParity:
+		return serial.MarkParity, nil
+	case SpaceParity:
+		return serial.SpaceParity, nil
 	default:
-		return serial.EvenParity
+		return 0, fmt.Errorf("%w: parity '%v' must be one of N, E, O, M or S", ErrInvalidData, p)
 	}
 }
 
@@ -66,31 +117,200 @@ func (mb *serialPort) Connect() (err error) {
 	return mb.connect()
 }
 
+// Warm opens the serial port ahead of the first request, so that the
+// request doesn't pay the cost of opening and configuring it. It does
+// nothing if already connected. The port is closed after IdleTimeout
+// without requests as usual.
+func (mb *serialPort) Warm(ctx context.Context) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	if mb.port != nil {
+		return nil
+	}
+	if err := mb.connectContext(ctx); err != nil {
+		return fmt.Errorf("connecting: %w", err)
+	}
+	mb.lastActivity = time.Now()
+	mb.startCloseTimer()
+	return nil
+}
+
 // connect connects to the serial port if it is not connected. Caller must hold the mutex.
 func (mb *serialPort) connect() error {
-	if mb.port == nil {
-		mode := &serial.Mode{
-			BaudRate: mb.BaudRate,
-			DataBits: mb.DataBits,
-			StopBits: toSerialStopBits(mb.StopBits),
-			Parity:   toSerialParity(mb.Parity),
+	return mb.connectContext(context.Background())
+}
+
+// connectContext connects to the serial port if it is not connected, first
+// waiting out the reconnect backoff after a failed attempt. Caller must
+// hold the mutex, which is released during the wait so that Close, SetDTR,
+// SetRTS and the idle closer are not blocked by it; the port is checked
+// again once the mutex is held back, as another request may have opened it.
+func (mb *serialPort) connectContext(ctx context.Context) error {
+	for {
+		if mb.port != nil {
+			return nil
+		}
+		wait := mb.nextConnect.Sub(mb.clock().Now())
+		if wait <= 0 {
+			break
 		}
-		port, err := serial.Open(mb.Address, mode)
+		mb.mu.Unlock()
+		err := sleepClock(ctx, mb.clock(), wait)
+		mb.mu.Lock()
 		if err != nil {
+			return fmt.Errorf("waiting to reconnect: %w", err)
+		}
+	}
+	if err := mb.open(); err != nil {
+		mb.backoff()
+		return err
+	}
+	mb.connectFailures = 0
+	mb.nextConnect = time.Time{}
+	return nil
+}
+
+// open opens and configures the serial port.
+func (mb *serialPort) open() error {
+	parity, err := toSerialParity(mb.Parity)
+	if err != nil {
+		return err
+	}
+	mode := &serial.Mode{
+		BaudRate: mb.BaudRate,
+		DataBits: mb.DataBits,
+		StopBits: toSerialStopBits(mb.StopBits),
+		Parity:   parity,
+	}
+	openPort := mb.OpenPort
+	if openPort == nil {
+		openPort = serial.Open
+	}
+	port, err := openPort(mb.Address, mode)
+	if err != nil {
+		return err
+	}
+	if err = mb.configure(port); err != nil {
+		port.Close()
+		return err
+	}
+	mb.port = port
+	mb.setLive(port)
+	mb.stats.connect()
+	return nil
+}
+
+// configure applies the read timeout and control lines to a newly opened
+// port. A port that does not support read timeouts is used without them.
+func (mb *serialPort) configure(port serial.Port) error {
+	mb.noReadTimeout = false
+	if mb.Timeout > 0 {
+		if err := mb.setPortReadTimeout(port, mb.Timeout); err != nil {
 			return err
 		}
-		if mb.Timeout > 0 {
-			err = port.SetReadTimeout(mb.Timeout)
-			if err != nil {
-				port.Close()
-				return err
-			}
+	}
+	return mb.applyControlLines(port)
+}
+
+// setReadTimeout sets the read timeout of the open port, doing nothing if
+// the port does not support read timeouts.
+func (mb *serialPort) setReadTimeout(timeout time.Duration) error {
+	return mb.setPortReadTimeout(mb.port, timeout)
+}
+
+func (mb *serialPort) setPortReadTimeout(port serial.Port, timeout time.Duration) error {
+	if mb.noReadTimeout {
+		return nil
+	}
+	err := port.SetReadTimeout(timeout)
+	if err != nil && isUnsupported(err) {
+		mb.logf("modbus: warning - %s does not support read timeouts, relying on context checks: %v\n", mb.Address, err)
+		mb.noReadTimeout = true
+		return nil
+	}
+	return err
+}
+
+// isUnsupported reports whether err means that the port or its driver does
+// not implement an operation.
+func isUnsupported(err error) bool {
+	var portErr *serial.PortError
+	if errors.As(err, &portErr) && portErr.Code() == serial.FunctionNotImplemented {
+		return true
+	}
+	return errors.Is(err, errors.ErrUnsupported)
+}
+
+// SetDTR sets the DTR control line, for devices with power or mode control
+// wired to it. The level is applied immediately if the port is open and
+// again after every (re)connect.
+func (mb *serialPort) SetDTR(dtr bool) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.dtr = &dtr
+	if mb.port == nil {
+		return nil
+	}
+	if err := mb.port.SetDTR(dtr); err != nil {
+		return fmt.Errorf("setting DTR: %w", err)
+	}
+	return nil
+}
+
+// SetRTS sets the RTS control line like SetDTR. With RTSEnable set on an
+// RTU handler, RTS is driven around each request instead and released
+// after it.
+func (mb *serialPort) SetRTS(rts bool) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.rts = &rts
+	if mb.port == nil {
+		return nil
+	}
+	if err := mb.port.SetRTS(rts); err != nil {
+		return fmt.Errorf("setting RTS: %w", err)
+	}
+	return nil
+}
+
+// applyControlLines sets the control lines requested with SetDTR and SetRTS
+// on a newly opened port.
+func (mb *serialPort) applyControlLines(port serial.Port) error {
+	if mb.dtr != nil {
+		if err := port.SetDTR(*mb.dtr); err != nil {
+			return fmt.Errorf("setting DTR: %w", err)
+		}
+	}
+	if mb.rts != nil {
+		if err := port.SetRTS(*mb.rts); err != nil {
+			return fmt.Errorf("setting RTS: %w", err)
 		}
-		mb.port = port
 	}
 	return nil
 }
 
+// backoff schedules the next open attempt after a failure.
+func (mb *serialPort) backoff() {
+	if mb.ReconnectBackoff <= 0 {
+		return
+	}
+	maxDelay := mb.MaxReconnectBackoff
+	if maxDelay <= 0 {
+		maxDelay = serialMaxReconnectBackoff
+	}
+	delay := mb.ReconnectBackoff
+	for i := 0; i < mb.connectFailures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxDelay)
+	mb.connectFailures++
+	mb.nextConnect = mb.clock().Now().Add(delay)
+	mb.logf("modbus: opening %s failed, next attempt in %v", mb.Address, delay)
+}
+
 func (mb *serialPort) Close() (err error) {
 	mb.mu.Lock()
 	defer mb.mu.Unlock()
@@ -98,18 +318,61 @@ func (mb *serialPort) Close() (err error) {
 	return mb.close()
 }
 
+// CloseNow closes the port without waiting for a request in progress,
+// whose read then fails at once, and then cleans up like Close. It is
+// meant for shutting down while a device hangs mid-response.
+func (mb *serialPort) CloseNow() (err error) {
+	mb.liveMu.Lock()
+	port := mb.live
+	mb.live = nil
+	mb.liveMu.Unlock()
+	if port != nil {
+		err = port.Close()
+	}
+
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	if mb.port == port {
+		// Already closed above
+		mb.port = nil
+		return err
+	}
+	return errors.Join(err, mb.close())
+}
+
+// setLive records the port CloseNow closes.
+func (mb *serialPort) setLive(port serial.Port) {
+	mb.liveMu.Lock()
+	mb.live = port
+	mb.liveMu.Unlock()
+}
+
 // close closes the serial port if it is connected. Caller must hold the mutex.
 func (mb *serialPort) close() (err error) {
 	if mb.port != nil {
+		if mb.DrainOnClose {
+			if drainErr := mb.port.Drain(); drainErr != nil {
+				mb.logf("modbus: failed to drain output before close: %v", drainErr)
+			}
+		}
 		err = mb.port.Close()
 		mb.port = nil
+		mb.setLive(nil)
 	}
 	return
 }
 
+// clock returns the Clock timing the frame delays and the backoff.
+func (mb *serialPort) clock() Clock {
+	if mb.Clock == nil {
+		return SystemClock{}
+	}
+	return mb.Clock
+}
+
 func (mb *serialPort) logf(format string, v ...interface{}) {
 	if mb.Logger != nil {
-		mb.Logger.Printf(format, v...)
+		mb.repeats.logf(mb.Logger, mb.LogRepeatWindow, mb.clock().Now(), format, v...)
 	}
 }
 
@@ -0,0 +1,48 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lumberbarons/modbus"
+	"github.com/lumberbarons/modbus/modbustest"
+)
+
+func TestSerialReconnectBackoff(t *testing.T) {
+	clock := modbustest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	handler := modbus.NewRTUClientHandler("/nonexistent/serial/port")
+	handler.ReconnectBackoff = 20 * time.Millisecond
+	handler.MaxReconnectBackoff = 50 * time.Millisecond
+	handler.Clock = clock
+
+	// The first attempt doesn't wait, each next one waits twice as long up
+	// to the maximum
+	if err := handler.Connect(); err == nil {
+		t.Fatal("expected connect to fail")
+	}
+	expected := []time.Duration{20 * time.Millisecond, 40 * time.Millisecond, 50 * time.Millisecond}
+	for i, delay := range expected {
+		done := make(chan error, 1)
+		go func() { done <- handler.Connect() }()
+		for clock.Waiters() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		select {
+		case <-done:
+			t.Fatalf("attempt %d: expected connect to wait for the backoff", i+1)
+		default:
+		}
+		clock.Advance(delay)
+		if err := <-done; err == nil {
+			t.Fatal("expected connect to fail")
+		}
+	}
+	if durations := clock.Durations(); fmt.Sprint(durations) != fmt.Sprint(expected) {
+		t.Errorf("expected waits of %v, got %v", expected, durations)
+	}
+}
@@ -2,6 +2,9 @@ package modbus
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"testing"
 	"time"
@@ -13,6 +16,8 @@ type nopCloser struct {
 	io.ReadWriter
 
 	closed bool
+	// drained is set by Drain while the port is open
+	drained bool
 }
 
 func (n *nopCloser) Close() error {
@@ -25,6 +30,7 @@ func (n *nopCloser) SetMode(_ *serial.Mode) error {
 }
 
 func (n *nopCloser) Drain() error {
+	n.drained = !n.closed
 	return nil
 }
 
@@ -56,6 +62,22 @@ func (n *nopCloser) Break(_ time.Duration) error {
 	return nil
 }
 
+func TestSerialDrainOnClose(t *testing.T) {
+	for _, drainOnClose := range []bool{false, true} {
+		port := &nopCloser{ReadWriter: &bytes.Buffer{}}
+		s := serialPort{port: port, DrainOnClose: drainOnClose}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !port.closed {
+			t.Fatal("expected the port to be closed")
+		}
+		if port.drained != drainOnClose {
+			t.Errorf("DrainOnClose %v: expected drained before close %v, got %v", drainOnClose, drainOnClose, port.drained)
+		}
+	}
+}
+
 func TestSerialCloseIdle(t *testing.T) {
 	port := &nopCloser{
 		ReadWriter: &bytes.Buffer{},
@@ -76,3 +98,235 @@ func TestSerialCloseIdle(t *testing.T) {
 		t.Fatalf("serial port is not closed when inactivity: %+v", port)
 	}
 }
+
+func TestSerialReconnectBackoffCancel(t *testing.T) {
+	s := serialPort{
+		Address:          "/nonexistent/serial/port",
+		ReconnectBackoff: time.Hour,
+	}
+	if err := s.Connect(); err == nil {
+		t.Fatal("expected connect to fail")
+	}
+
+	// A cancelled context stops the wait
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.mu.Lock()
+	err := s.connectContext(ctx)
+	s.mu.Unlock()
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestSerialReconnectBackoffReleasesMutex(t *testing.T) {
+	s := serialPort{
+		Address:          "/nonexistent/serial/port",
+		ReconnectBackoff: 300 * time.Millisecond,
+	}
+	if err := s.Connect(); err == nil {
+		t.Fatal("expected connect to fail")
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.Connect() }()
+	time.Sleep(20 * time.Millisecond)
+
+	// The backoff wait of the connect doesn't hold up the other calls
+	start := time.Now()
+	if err := s.SetDTR(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("expected SetDTR and Close not to wait for the backoff, took %v", elapsed)
+	}
+	if err := <-done; err == nil {
+		t.Error("expected connect to fail")
+	}
+}
+
+// linePort records control line changes.
+type linePort struct {
+	nopCloser
+	lines []string
+}
+
+func (p *linePort) SetDTR(dtr bool) error {
+	p.lines = append(p.lines, fmt.Sprintf("dtr=%v", dtr))
+	return nil
+}
+
+func (p *linePort) SetRTS(rts bool) error {
+	p.lines = append(p.lines, fmt.Sprintf("rts=%v", rts))
+	return nil
+}
+
+func TestSerialControlLines(t *testing.T) {
+	var s serialPort
+	// Not connected yet, the levels are only recorded
+	if err := s.SetDTR(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetRTS(false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Applied once the port is opened
+	port := &linePort{nopCloser: nopCloser{ReadWriter: &bytes.Buffer{}}}
+	if err := s.applyControlLines(port); err != nil {
+		t.Fatal(err)
+	}
+	s.port = port
+
+	// Applied immediately while connected
+	if err := s.SetDTR(false); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"dtr=true", "rts=false", "dtr=false"}
+	if fmt.Sprint(port.lines) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, actual %v", expected, port.lines)
+	}
+}
+
+func TestToSerialParity(t *testing.T) {
+	tests := []struct {
+		parity   Parity
+		expected serial.Parity
+	}{
+		{NoParity, serial.NoParity},
+		{EvenParity, serial.EvenParity},
+		{"", serial.EvenParity},
+		{OddParity, serial.OddParity},
+		{MarkParity, serial.MarkParity},
+		{SpaceParity, serial.SpaceParity},
+	}
+	for _, tt := range tests {
+		actual, err := toSerialParity(tt.parity)
+		if err != nil {
+			t.Errorf("parity %q: %v", tt.parity, err)
+		}
+		if actual != tt.expected {
+			t.Errorf("parity %q: expected %v, actual %v", tt.parity, tt.expected, actual)
+		}
+	}
+}
+
+func TestConnectInvalidParity(t *testing.T) {
+	handler := NewRTUClientHandler("/dev/null")
+	handler.Parity = "even"
+	if err := handler.Connect(); !errors.Is(err, ErrInvalidData) {
+		t.Fatalf("expected ErrInvalidData, got %v", err)
+	}
+}
+
+// noTimeoutPort fails to set read timeouts with err.
+type noTimeoutPort struct {
+	nopCloser
+	err   error
+	calls int
+}
+
+func (p *noTimeoutPort) SetReadTimeout(_ time.Duration) error {
+	p.calls++
+	return p.err
+}
+
+// hangingPort is a port whose reads block until it is closed.
+type hangingPort struct {
+	nopCloser
+	reader *io.PipeReader
+}
+
+func newHangingPort() *hangingPort {
+	reader, _ := io.Pipe()
+	return &hangingPort{
+		nopCloser: nopCloser{ReadWriter: struct {
+			io.Reader
+			io.Writer
+		}{reader, io.Discard}},
+		reader: reader,
+	}
+}
+
+func (p *hangingPort) Close() error {
+	p.nopCloser.Close()
+	return p.reader.Close()
+}
+
+func TestSerialCloseNow(t *testing.T) {
+	packager := rtuPackager{SlaveID: 1}
+	request, err := packager.Encode(&ProtocolDataUnit{FunctionCode: FuncCodeReadHoldingRegisters, Data: []byte{0x00, 0x00, 0x00, 0x01}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := newHangingPort()
+	transporter := &rtuSerialTransporter{}
+	transporter.BaudRate = 19200
+	transporter.Timeout = 10 * time.Second
+	transporter.port = port
+	transporter.setLive(port)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := transporter.Send(context.Background(), request)
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	if err = transporter.CloseNow(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err = <-done:
+		if err == nil {
+			t.Error("expected the interrupted send to fail")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected CloseNow to interrupt the send")
+	}
+	if !port.closed {
+		t.Error("expected the port to be closed")
+	}
+	if transporter.port != nil {
+		t.Error("expected CloseNow to clear the port")
+	}
+}
+
+func TestSerialReadTimeoutUnsupported(t *testing.T) {
+	packager := rtuPackager{SlaveID: 1}
+	request, err := packager.Encode(&ProtocolDataUnit{FunctionCode: FuncCodeWriteSingleRegister, Data: []byte{0x00, 0x01, 0x00, 0x03}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := &noTimeoutPort{
+		nopCloser: nopCloser{ReadWriter: &bytes.Buffer{}},
+		err:       fmt.Errorf("virtual port: %w", errors.ErrUnsupported),
+	}
+	transporter := &rtuSerialTransporter{}
+	transporter.BaudRate = 19200
+	transporter.Timeout = time.Second
+	if err = transporter.configure(port); err != nil {
+		t.Fatalf("expected unsupported read timeout to be ignored, got %v", err)
+	}
+	transporter.port = port
+
+	// The device echoes the write, read without a timeout
+	response, err := transporter.Send(context.Background(), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(request, response) {
+		t.Errorf("response: expected % x, actual % x", request, response)
+	}
+	if port.calls != 1 {
+		t.Errorf("expected the read timeout to be tried once, got %d calls", port.calls)
+	}
+
+	// Other errors still fail the connection
+	port = &noTimeoutPort{err: errors.New("i/o error")}
+	if err = transporter.configure(port); err == nil {
+		t.Error("expected read timeout error to fail the connection")
+	}
+}
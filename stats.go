@@ -0,0 +1,88 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"sync/atomic"
+)
+
+// TransportStats holds cumulative counters of a transporter.
+type TransportStats struct {
+	// Requests is the number of calls to Send.
+	Requests uint64
+	// BytesSent is the number of request bytes written.
+	BytesSent uint64
+	// BytesReceived is the number of response bytes read.
+	BytesReceived uint64
+	// Errors is the number of failed calls to Send.
+	Errors uint64
+	// Reconnects is the number of connections opened after the first one.
+	Reconnects uint64
+}
+
+// transportCounters maintains TransportStats atomically.
+type transportCounters struct {
+	requests      atomic.Uint64
+	bytesSent     atomic.Uint64
+	bytesReceived atomic.Uint64
+	errors        atomic.Uint64
+	reconnects    atomic.Uint64
+	// connected is set once the first connection is opened
+	connected atomic.Bool
+}
+
+func (c *transportCounters) snapshot() TransportStats {
+	return TransportStats{
+		Requests:      c.requests.Load(),
+		BytesSent:     c.bytesSent.Load(),
+		BytesReceived: c.bytesReceived.Load(),
+		Errors:        c.errors.Load(),
+		Reconnects:    c.reconnects.Load(),
+	}
+}
+
+func (c *transportCounters) reset() {
+	c.requests.Store(0)
+	c.bytesSent.Store(0)
+	c.bytesReceived.Store(0)
+	c.errors.Store(0)
+	c.reconnects.Store(0)
+}
+
+// connect records a newly opened connection.
+func (c *transportCounters) connect() {
+	if c.connected.Swap(true) {
+		c.reconnects.Add(1)
+	}
+}
+
+// done records the outcome of a call to Send.
+func (c *transportCounters) done(aduResponse []byte, err error) {
+	if err != nil {
+		c.errors.Add(1)
+		return
+	}
+	c.bytesReceived.Add(uint64(len(aduResponse)))
+}
+
+// Stats returns the cumulative transport counters.
+func (mb *tcpTransporter) Stats() TransportStats {
+	return mb.stats.snapshot()
+}
+
+// ResetStats clears the transport counters.
+func (mb *tcpTransporter) ResetStats() {
+	mb.stats.reset()
+}
+
+// Stats returns the cumulative transport counters.
+func (mb *serialPort) Stats() TransportStats {
+	return mb.stats.snapshot()
+}
+
+// ResetStats clears the transport counters.
+func (mb *serialPort) ResetStats() {
+	mb.stats.reset()
+}
@@ -6,11 +6,13 @@ package modbus
 
 import (
 	"context"
-	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"os"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -22,9 +24,16 @@ const (
 	// Modbus Application Protocol
 	tcpHeaderSize = 7
 	tcpMaxLength  = 260
+	// Default Modbus TCP port used when the address has none
+	tcpDefaultPort = "502"
 	// Default TCP timeout is not set
 	tcpTimeout     = 10 * time.Second
 	tcpIdleTimeout = 60 * time.Second
+	// Read deadline used when probing an idle connection
+	tcpProbeTimeout = 5 * time.Millisecond
+	// Unit id recommended by the Modbus TCP spec for a directly addressed
+	// device, one that is not behind a gateway
+	tcpDefaultUnitID = 0xFF
 )
 
 // TCPClientHandler implements Packager and Transporter interface.
@@ -36,9 +45,11 @@ type TCPClientHandler struct {
 // NewTCPClientHandler allocates a new TCPClientHandler.
 func NewTCPClientHandler(address string) *TCPClientHandler {
 	h := &TCPClientHandler{}
+	h.SlaveID = tcpDefaultUnitID
 	h.Address = address
 	h.Timeout = tcpTimeout
 	h.IdleTimeout = tcpIdleTimeout
+	h.MaxResponseBytes = tcpMaxLength
 	return h
 }
 
@@ -52,8 +63,37 @@ func TCPClient(address string) Client {
 type tcpPackager struct {
 	// For synchronization between messages of server & client
 	transactionID uint32
-	// Broadcast address is 0
+	// Unit id, 0xFF by default for a directly addressed device. Set it to
+	// the slave address of a device behind a gateway. 0 is the broadcast
+	// address, which only makes sense for writes.
 	SlaveID byte
+	// SkipProtocolIDCheck accepts responses whose protocol id does not match
+	// the request, for non-compliant gateways that echo a different value.
+	// Transaction and unit ids are still checked.
+	//
+	// Deprecated: Set Compliance to Lenient, which relaxes this check
+	// along with the others of noncompliant devices.
+	SkipProtocolIDCheck bool
+	// Compliance selects the checks relaxed for noncompliant devices, see
+	// Lenient.
+	Compliance Compliance
+}
+
+func (mb *tcpPackager) copiesPDUData() {}
+
+func (mb *tcpPackager) relaxedChecks() checks {
+	relaxed := mb.Compliance.relaxed()
+	if mb.SkipProtocolIDCheck {
+		relaxed |= checkProtocolID
+	}
+	return relaxed
+}
+
+// SetTransactionID sets the transaction identifier used by the next
+// request. Following requests increment from there.
+func (mb *tcpPackager) SetTransactionID(id uint16) {
+	// Encode increments the counter before using it
+	atomic.StoreUint32(&mb.transactionID, uint32(id-1))
 }
 
 // Encode adds modbus application protocol header:
@@ -66,17 +106,12 @@ type tcpPackager struct {
 //	Data: n bytes
 func (mb *tcpPackager) Encode(pdu *ProtocolDataUnit) (adu []byte, err error) {
 	adu = make([]byte, tcpHeaderSize+1+len(pdu.Data))
-
-	// Transaction identifier
-	transactionID := atomic.AddUint32(&mb.transactionID, 1)
-	binary.BigEndian.PutUint16(adu, uint16(transactionID))
-	// Protocol identifier
-	binary.BigEndian.PutUint16(adu[2:], tcpProtocolIdentifier)
-	// Length
-	length := uint16(1 + 1 + len(pdu.Data))
-	binary.BigEndian.PutUint16(adu[4:], length)
-	// Unit identifier
-	adu[6] = mb.SlaveID
+	MBAPHeader{
+		TransactionID: uint16(atomic.AddUint32(&mb.transactionID, 1)),
+		ProtocolID:    tcpProtocolIdentifier,
+		Length:        uint16(1 + 1 + len(pdu.Data)),
+		UnitID:        mb.SlaveID,
+	}.put(adu)
 
 	// PDU
 	adu[tcpHeaderSize] = pdu.FunctionCode
@@ -86,21 +121,18 @@ func (mb *tcpPackager) Encode(pdu *ProtocolDataUnit) (adu []byte, err error) {
 
 // Verify confirms transaction, protocol and unit id.
 func (mb *tcpPackager) Verify(aduRequest, aduResponse []byte) (err error) {
-	// Transaction id
-	responseVal := binary.BigEndian.Uint16(aduResponse)
-	requestVal := binary.BigEndian.Uint16(aduRequest)
-	if responseVal != requestVal {
-		return fmt.Errorf("%w: response transaction id '%v' does not match request '%v'", ErrProtocolError, responseVal, requestVal)
-	}
-	// Protocol id
-	responseVal = binary.BigEndian.Uint16(aduResponse[2:])
-	requestVal = binary.BigEndian.Uint16(aduRequest[2:])
-	if responseVal != requestVal {
-		return fmt.Errorf("%w: response protocol id '%v' does not match request '%v'", ErrProtocolError, responseVal, requestVal)
-	}
-	// Unit id (1 byte)
-	if aduResponse[6] != aduRequest[6] {
-		return fmt.Errorf("%w: response unit id '%v' does not match request '%v'", ErrProtocolError, aduResponse[6], aduRequest[6])
+	if len(aduResponse) < tcpHeaderSize {
+		return fmt.Errorf("%w: response length '%v' does not meet minimum '%v'", ErrShortFrame, len(aduResponse), tcpHeaderSize)
+	}
+	response, request := decodeMBAP(aduResponse), decodeMBAP(aduRequest)
+	if response.TransactionID != request.TransactionID {
+		return fmt.Errorf("%w: response transaction id '%v' does not match request '%v'", ErrProtocolError, response.TransactionID, request.TransactionID)
+	}
+	if response.ProtocolID != request.ProtocolID && mb.relaxedChecks()&checkProtocolID == 0 {
+		return fmt.Errorf("%w: response protocol id '%v' does not match request '%v'", ErrProtocolError, response.ProtocolID, request.ProtocolID)
+	}
+	if response.UnitID != request.UnitID {
+		return fmt.Errorf("%w: response unit id '%v' does not match request '%v'", ErrProtocolError, response.UnitID, request.UnitID)
 	}
 	return nil
 }
@@ -112,8 +144,12 @@ func (mb *tcpPackager) Verify(aduRequest, aduResponse []byte) (err error) {
 //	Length: 2 bytes
 //	Unit identifier: 1 byte
 func (mb *tcpPackager) Decode(adu []byte) (pdu *ProtocolDataUnit, err error) {
+	// Header and function code
+	if len(adu) < tcpHeaderSize+1 {
+		return nil, fmt.Errorf("%w: response length '%v' does not meet minimum '%v'", ErrShortFrame, len(adu), tcpHeaderSize+1)
+	}
 	// Read length value in the header
-	length := binary.BigEndian.Uint16(adu[4:])
+	length := decodeMBAP(adu).Length
 	pduLength := len(adu) - tcpHeaderSize
 	if pduLength <= 0 || pduLength != int(length-1) {
 		return nil, fmt.Errorf("%w: length in response '%v' does not match pdu data length '%v'", ErrProtocolError, length-1, pduLength)
@@ -127,20 +163,40 @@ func (mb *tcpPackager) Decode(adu []byte) (pdu *ProtocolDataUnit, err error) {
 
 // tcpTransporter implements Transporter interface.
 type tcpTransporter struct {
-	// Connect string
+	// Connect string, host:port; port 502 is used if omitted
 	Address string
 	// Connect & Read timeout
 	Timeout time.Duration
 	// Idle timeout to close the connection
 	IdleTimeout time.Duration
+	// Interval between half-open connection probes while connected,
+	// 0 disables probing
+	HealthCheckInterval time.Duration
 	// Transmission logger
 	Logger *log.Logger
+	// MaxResponseBytes is the largest response ADU accepted, including the
+	// MBAP header. Responses advertising a longer length are rejected
+	// before their body is read. It can be lowered for devices known to
+	// send small responses; 0 or values above the protocol maximum of 260
+	// mean 260.
+	MaxResponseBytes int
+	// LogRepeatWindow collapses a message logged again within the window
+	// of its last write into a count, written as "last message repeated
+	// N times" before the next message written. 0 writes every message.
+	LogRepeatWindow time.Duration
 
 	// TCP connection
 	mu           sync.Mutex
 	conn         net.Conn
 	closeTimer   *time.Timer
+	probeTimer   *time.Timer
 	lastActivity time.Time
+	stats        transportCounters
+	// live is conn for CloseNow, which must not wait for mu
+	liveMu sync.Mutex
+	live   net.Conn
+	// repeats limits the messages repeated within LogRepeatWindow
+	repeats repeatLimiter
 }
 
 // Send sends data to server and ensures response length is greater than header length.
@@ -148,6 +204,9 @@ func (mb *tcpTransporter) Send(ctx context.Context, aduRequest []byte) (aduRespo
 	mb.mu.Lock()
 	defer mb.mu.Unlock()
 
+	mb.stats.requests.Add(1)
+	defer func() { mb.stats.done(aduResponse, err) }()
+
 	// Check context before starting
 	if err = ctx.Err(); err != nil {
 		return nil, fmt.Errorf("context cancelled before send: %w", err)
@@ -160,6 +219,7 @@ func (mb *tcpTransporter) Send(ctx context.Context, aduRequest []byte) (aduRespo
 	// Set timer to close when idle
 	mb.lastActivity = time.Now()
 	mb.startCloseTimer()
+	mb.startProbeTimer()
 	// Set write and read timeout using context deadline or configured timeout
 	var timeout time.Time
 	if deadline, ok := ctx.Deadline(); ok {
@@ -170,36 +230,185 @@ func (mb *tcpTransporter) Send(ctx context.Context, aduRequest []byte) (aduRespo
 	if err = mb.conn.SetDeadline(timeout); err != nil {
 		return nil, fmt.Errorf("setting deadline: %w", err)
 	}
+	if len(aduRequest) > tcpHeaderSize && aduRequest[6] == 0 && isReadFunction(aduRequest[tcpHeaderSize]) {
+		mb.logf("modbus: warning - read function %v sent to broadcast unit id 0", aduRequest[tcpHeaderSize])
+	}
 	// Send data
 	mb.logf("modbus: sending % x", aduRequest)
-	if _, err = mb.conn.Write(aduRequest); err != nil {
+	var written int
+	written, err = mb.conn.Write(aduRequest)
+	mb.stats.bytesSent.Add(uint64(written))
+	if err != nil {
 		return nil, fmt.Errorf("writing request: %w", err)
 	}
+	return mb.readResponse(ctx)
+}
+
+// SendPipelined writes all requests before reading any response, so that
+// they cost about one round trip in total instead of one each. Responses
+// are matched to the requests by transaction ID, which must therefore be
+// distinct, and returned in request order.
+func (mb *tcpTransporter) SendPipelined(ctx context.Context, aduRequests [][]byte) (aduResponses [][]byte, err error) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.stats.requests.Add(uint64(len(aduRequests)))
+	defer func() {
+		if err != nil {
+			mb.stats.done(nil, err)
+			return
+		}
+		for _, aduResponse := range aduResponses {
+			mb.stats.done(aduResponse, nil)
+		}
+	}()
+
+	if err = ctx.Err(); err != nil {
+		return nil, fmt.Errorf("context cancelled before send: %w", err)
+	}
+	pending := make(map[uint16]int, len(aduRequests))
+	var frames []byte
+	for i, aduRequest := range aduRequests {
+		if len(aduRequest) < tcpHeaderSize {
+			return nil, fmt.Errorf("%w: request length '%v' does not meet minimum '%v'", ErrInvalidData, len(aduRequest), tcpHeaderSize)
+		}
+		transactionID := decodeMBAP(aduRequest).TransactionID
+		if _, ok := pending[transactionID]; ok {
+			return nil, fmt.Errorf("%w: transaction id '%v' used by more than one request", ErrInvalidData, transactionID)
+		}
+		pending[transactionID] = i
+		frames = append(frames, aduRequest...)
+	}
+	if err = mb.connectContext(ctx); err != nil {
+		return nil, fmt.Errorf("connecting: %w", err)
+	}
+	mb.lastActivity = time.Now()
+	mb.startCloseTimer()
+	mb.startProbeTimer()
+	var timeout time.Time
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = deadline
+	} else if mb.Timeout > 0 {
+		timeout = mb.lastActivity.Add(mb.Timeout)
+	}
+	if err = mb.conn.SetDeadline(timeout); err != nil {
+		return nil, fmt.Errorf("setting deadline: %w", err)
+	}
+	mb.logf("modbus: sending %d pipelined requests % x", len(aduRequests), frames)
+	written, err := mb.conn.Write(frames)
+	mb.stats.bytesSent.Add(uint64(written))
+	if err != nil {
+		return nil, fmt.Errorf("writing requests: %w", err)
+	}
+	// The responses left on the connection after a failed read would be
+	// taken as the answers to the next requests, so close it instead
+	responses := make([][]byte, len(aduRequests))
+	for range aduRequests {
+		aduResponse, err := mb.readResponse(ctx)
+		if err != nil {
+			mb.close()
+			return nil, err
+		}
+		transactionID := decodeMBAP(aduResponse).TransactionID
+		i, ok := pending[transactionID]
+		if !ok {
+			mb.close()
+			return nil, fmt.Errorf("%w: response transaction id '%v' does not match a pending request", ErrProtocolError, transactionID)
+		}
+		delete(pending, transactionID)
+		responses[i] = aduResponse
+	}
+	return responses, nil
+}
+
+// readResponse reads a response ADU from the connection.
+func (mb *tcpTransporter) readResponse(ctx context.Context) ([]byte, error) {
 	// Read header first
-	var data [tcpMaxLength]byte
-	if _, err = io.ReadFull(mb.conn, data[:tcpHeaderSize]); err != nil {
-		return nil, fmt.Errorf("reading response header: %w", err)
+	data := make([]byte, tcpMaxLength)
+	if _, err := io.ReadFull(mb.conn, data[:tcpHeaderSize]); err != nil {
+		return nil, fmt.Errorf("reading response header: %w", tcpReadError(ctx, err))
 	}
-	// Read length, ignore transaction & protocol id (4 bytes)
-	length := int(binary.BigEndian.Uint16(data[4:]))
+	// Read length, ignore transaction & protocol id
+	length := int(decodeMBAP(data).Length)
 	if length <= 0 {
-		mb.flush(data[:])
+		mb.flush(data)
 		return nil, fmt.Errorf("%w: length in response header '%v' must not be zero", ErrProtocolError, length)
 	}
 	if length > (tcpMaxLength - (tcpHeaderSize - 1)) {
-		mb.flush(data[:])
+		mb.flush(data)
 		return nil, fmt.Errorf("%w: length in response header '%v' must not greater than '%v'", ErrProtocolError, length, tcpMaxLength-tcpHeaderSize+1)
 	}
 	// Skip unit id
 	length += tcpHeaderSize - 1
-	if _, err = io.ReadFull(mb.conn, data[tcpHeaderSize:length]); err != nil {
-		return nil, fmt.Errorf("reading response body: %w", err)
+	if maxBytes := mb.MaxResponseBytes; maxBytes > 0 && length > maxBytes {
+		mb.flush(data)
+		return nil, fmt.Errorf("%w: response length '%v' exceeds maximum '%v'", ErrProtocolError, length, maxBytes)
 	}
-	aduResponse = data[:length]
+	if _, err := io.ReadFull(mb.conn, data[tcpHeaderSize:length]); err != nil {
+		return nil, fmt.Errorf("reading response body: %w", tcpReadError(ctx, err))
+	}
+	aduResponse := data[:length]
 	mb.logf("modbus: received % x\n", aduResponse)
 	return aduResponse, nil
 }
 
+// isReadFunction reports whether functionCode reads data from the device,
+// which a broadcast request can never return.
+func isReadFunction(functionCode byte) bool {
+	switch functionCode {
+	case FuncCodeReadCoils, FuncCodeReadDiscreteInputs,
+		FuncCodeReadHoldingRegisters, FuncCodeReadInputRegisters,
+		FuncCodeReadWriteMultipleRegisters, FuncCodeReadFIFOQueue,
+		FuncCodeReadFileRecord:
+		return true
+	}
+	return false
+}
+
+// tcpReadError classifies a failed response read: a read past the connection
+// deadline is a context deadline or response timeout.
+func tcpReadError(ctx context.Context, err error) error {
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return timeoutError(ctx, err)
+	}
+	return err
+}
+
+// SendNoResponse writes a request without waiting for a response.
+func (mb *tcpTransporter) SendNoResponse(ctx context.Context, aduRequest []byte) (err error) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.stats.requests.Add(1)
+	defer func() { mb.stats.done(nil, err) }()
+
+	if err = ctx.Err(); err != nil {
+		return fmt.Errorf("context cancelled before send: %w", err)
+	}
+	if err = mb.connectContext(ctx); err != nil {
+		return fmt.Errorf("connecting: %w", err)
+	}
+	mb.lastActivity = time.Now()
+	mb.startCloseTimer()
+	mb.startProbeTimer()
+	var timeout time.Time
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = deadline
+	} else if mb.Timeout > 0 {
+		timeout = mb.lastActivity.Add(mb.Timeout)
+	}
+	if err = mb.conn.SetDeadline(timeout); err != nil {
+		return fmt.Errorf("setting deadline: %w", err)
+	}
+	mb.logf("modbus: sending % x (no response expected)", aduRequest)
+	written, err := mb.conn.Write(aduRequest)
+	mb.stats.bytesSent.Add(uint64(written))
+	if err != nil {
+		return fmt.Errorf("writing request: %w", err)
+	}
+	return nil
+}
+
 // Connect establishes a new connection to the address in Address.
 // Connect and Close are exported so that multiple requests can be done with one session
 func (mb *tcpTransporter) Connect() error {
@@ -209,6 +418,25 @@ func (mb *tcpTransporter) Connect() error {
 	return mb.connect()
 }
 
+// Warm dials the server ahead of the first request, so that the request
+// doesn't pay the dial cost. It does nothing if already connected. The
+// connection is closed after IdleTimeout without requests as usual.
+func (mb *tcpTransporter) Warm(ctx context.Context) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	if mb.conn != nil {
+		return nil
+	}
+	if err := mb.connectContext(ctx); err != nil {
+		return fmt.Errorf("connecting: %w", err)
+	}
+	mb.lastActivity = time.Now()
+	mb.startCloseTimer()
+	mb.startProbeTimer()
+	return nil
+}
+
 func (mb *tcpTransporter) connect() error {
 	return mb.connectContext(context.Background())
 }
@@ -216,15 +444,27 @@ func (mb *tcpTransporter) connect() error {
 func (mb *tcpTransporter) connectContext(ctx context.Context) error {
 	if mb.conn == nil {
 		dialer := net.Dialer{Timeout: mb.Timeout}
-		conn, err := dialer.DialContext(ctx, "tcp", mb.Address)
+		address := tcpDialAddress(mb.Address)
+		conn, err := dialer.DialContext(ctx, "tcp", address)
 		if err != nil {
-			return fmt.Errorf("dialing %s: %w", mb.Address, err)
+			return fmt.Errorf("dialing %s: %w", address, err)
 		}
 		mb.conn = conn
+		mb.setLive(conn)
+		mb.stats.connect()
 	}
 	return nil
 }
 
+// tcpDialAddress appends the default Modbus port to address if it has none.
+func tcpDialAddress(address string) string {
+	if _, _, err := net.SplitHostPort(address); err == nil {
+		return address
+	}
+	host := strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+	return net.JoinHostPort(host, tcpDefaultPort)
+}
+
 func (mb *tcpTransporter) startCloseTimer() {
 	if mb.IdleTimeout <= 0 {
 		return
@@ -236,6 +476,25 @@ func (mb *tcpTransporter) startCloseTimer() {
 	}
 }
 
+func (mb *tcpTransporter) startProbeTimer() {
+	if mb.HealthCheckInterval <= 0 {
+		return
+	}
+	if mb.probeTimer == nil {
+		mb.probeTimer = time.AfterFunc(mb.HealthCheckInterval, mb.probe)
+	} else {
+		mb.probeTimer.Reset(mb.HealthCheckInterval)
+	}
+}
+
+// stopProbeTimer stops probing a closed connection; the next connect
+// starts the timer again. Caller must hold the mutex.
+func (mb *tcpTransporter) stopProbeTimer() {
+	if mb.probeTimer != nil {
+		mb.probeTimer.Stop()
+	}
+}
+
 // Close closes current connection.
 func (mb *tcpTransporter) Close() error {
 	mb.mu.Lock()
@@ -244,6 +503,36 @@ func (mb *tcpTransporter) Close() error {
 	return mb.close()
 }
 
+// CloseNow closes the connection without waiting for a request in
+// progress, whose read then fails at once, and then cleans up like Close.
+// It is meant for shutting down while a device hangs mid-response.
+func (mb *tcpTransporter) CloseNow() (err error) {
+	mb.liveMu.Lock()
+	conn := mb.live
+	mb.live = nil
+	mb.liveMu.Unlock()
+	if conn != nil {
+		err = conn.Close()
+	}
+
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	if mb.conn == conn {
+		// Already closed above
+		mb.conn = nil
+		mb.stopProbeTimer()
+		return err
+	}
+	return errors.Join(err, mb.close())
+}
+
+// setLive records the connection CloseNow closes.
+func (mb *tcpTransporter) setLive(conn net.Conn) {
+	mb.liveMu.Lock()
+	mb.live = conn
+	mb.liveMu.Unlock()
+}
+
 // flush flushes pending data in the connection,
 // returns io.EOF if connection is closed.
 func (mb *tcpTransporter) flush(b []byte) (err error) {
@@ -260,17 +549,53 @@ func (mb *tcpTransporter) flush(b []byte) (err error) {
 	return
 }
 
+// probe detects a half-open connection by reading with a short deadline
+// between requests. A timeout means the connection is still alive; EOF or
+// any other error closes it so the next Send redials. Unsolicited data,
+// such as a late response to a timed out request, fails the probe too, as
+// the connection can no longer be trusted to carry the next response.
+func (mb *tcpTransporter) probe() {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	if mb.conn == nil || mb.HealthCheckInterval <= 0 {
+		return
+	}
+	if err := mb.conn.SetReadDeadline(time.Now().Add(tcpProbeTimeout)); err != nil {
+		mb.logf("modbus: closing connection, probe failed: %v", err)
+		mb.close()
+		return
+	}
+	var data [tcpMaxLength]byte
+	n, err := mb.conn.Read(data[:])
+	if n > 0 {
+		mb.logf("modbus: closing connection, probe read unsolicited data % x", data[:n])
+		mb.close()
+		return
+	}
+	if err != nil {
+		if netError, ok := err.(net.Error); !ok || !netError.Timeout() {
+			mb.logf("modbus: closing half-open connection: %v", err)
+			mb.close()
+			return
+		}
+	}
+	mb.probeTimer.Reset(mb.HealthCheckInterval)
+}
+
 func (mb *tcpTransporter) logf(format string, v ...interface{}) {
 	if mb.Logger != nil {
-		mb.Logger.Printf(format, v...)
+		mb.repeats.logf(mb.Logger, mb.LogRepeatWindow, time.Now(), format, v...)
 	}
 }
 
-// closeLocked closes current connection. Caller must hold the mutex before calling this method.
+// closeLocked closes current connection and stops probing it. Caller must hold the mutex before calling this method.
 func (mb *tcpTransporter) close() (err error) {
+	mb.stopProbeTimer()
 	if mb.conn != nil {
 		err = mb.conn.Close()
 		mb.conn = nil
+		mb.setLive(nil)
 	}
 	return
 }
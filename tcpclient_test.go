@@ -7,8 +7,12 @@ package modbus
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
+	"errors"
 	"io"
+	"log"
 	"net"
+	"strings"
 	"testing"
 	"time"
 )
@@ -30,6 +34,27 @@ func TestTCPEncoding(t *testing.T) {
 	}
 }
 
+func TestTCPSetTransactionID(t *testing.T) {
+	handler := NewTCPClientHandler("localhost")
+	for _, id := range []uint16{0x1234, 0, 0xFFFF} {
+		handler.SetTransactionID(id)
+		adu, err := handler.Encode(&ProtocolDataUnit{FunctionCode: 3, Data: []byte{0, 4, 0, 3}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := binary.BigEndian.Uint16(adu); actual != id {
+			t.Errorf("transaction id: expected %v, actual %v", id, actual)
+		}
+		adu, err = handler.Encode(&ProtocolDataUnit{FunctionCode: 3, Data: []byte{0, 4, 0, 3}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := binary.BigEndian.Uint16(adu); actual != id+1 {
+			t.Errorf("next transaction id: expected %v, actual %v", id+1, actual)
+		}
+	}
+}
+
 func TestTCPDecoding(t *testing.T) {
 	packager := tcpPackager{}
 	packager.transactionID = 1
@@ -50,6 +75,27 @@ func TestTCPDecoding(t *testing.T) {
 	}
 }
 
+func TestTCPVerifySkipProtocolIDCheck(t *testing.T) {
+	request := []byte{0, 1, 0, 0, 0, 6, 17, 3, 0, 120, 0, 1}
+	response := []byte{0, 1, 0, 1, 0, 5, 17, 3, 2, 0, 42}
+
+	packager := tcpPackager{}
+	if err := packager.Verify(request, response); err == nil {
+		t.Fatal("expected protocol id mismatch error")
+	}
+	packager.SkipProtocolIDCheck = true
+	if err := packager.Verify(request, response); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Transaction and unit ids are still checked
+	if err := packager.Verify(request, []byte{0, 2, 0, 1, 0, 5, 17, 3, 2, 0, 42}); err == nil {
+		t.Error("expected transaction id mismatch error")
+	}
+	if err := packager.Verify(request, []byte{0, 1, 0, 1, 0, 5, 18, 3, 2, 0, 42}); err == nil {
+		t.Error("expected unit id mismatch error")
+	}
+}
+
 func TestTCPTransporter(t *testing.T) {
 	ln, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
@@ -92,6 +138,274 @@ func TestTCPTransporter(t *testing.T) {
 	}
 }
 
+func TestTCPDefaultUnitID(t *testing.T) {
+	handler := NewTCPClientHandler("localhost")
+	adu, err := handler.Encode(&ProtocolDataUnit{FunctionCode: 3, Data: []byte{0, 4, 0, 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adu[6] != 0xFF {
+		t.Errorf("unit id: expected %v, actual %v", 0xFF, adu[6])
+	}
+}
+
+func TestTCPBroadcastReadWarning(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+	var logs bytes.Buffer
+	client := &tcpTransporter{
+		Address: ln.Addr().String(),
+		Timeout: 1 * time.Second,
+		Logger:  log.New(&logs, "", 0),
+	}
+	defer client.Close()
+
+	// Broadcast write, no warning
+	if _, err = client.Send(context.Background(), []byte{0, 1, 0, 0, 0, 6, 0, 6, 0, 1, 0, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(logs.String(), "warning") {
+		t.Errorf("unexpected warning for broadcast write: %q", logs.String())
+	}
+	// Broadcast read is sent, with a warning
+	if _, err = client.Send(context.Background(), []byte{0, 2, 0, 0, 0, 6, 0, 3, 0, 1, 0, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "warning - read function 3 sent to broadcast unit id 0") {
+		t.Errorf("expected broadcast read warning, got %q", logs.String())
+	}
+}
+
+func TestTCPMaxResponseBytes(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+	client := &tcpTransporter{
+		Address:          ln.Addr().String(),
+		Timeout:          1 * time.Second,
+		MaxResponseBytes: 12,
+	}
+	defer client.Close()
+
+	// 12 bytes fit
+	req := []byte{0, 1, 0, 0, 0, 6, 1, 3, 0, 0, 0, 1}
+	if _, err = client.Send(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	// 14 bytes are rejected
+	req = []byte{0, 2, 0, 0, 0, 8, 1, 16, 0, 0, 0, 1, 2, 0}
+	if _, err = client.Send(context.Background(), req); !errors.Is(err, ErrProtocolError) {
+		t.Fatalf("expected ErrProtocolError, got %v", err)
+	}
+}
+
+func TestTCPTransporterStats(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	client := &tcpTransporter{
+		Address: ln.Addr().String(),
+		Timeout: 1 * time.Second,
+	}
+	req := []byte{0, 1, 0, 2, 0, 2, 1, 2}
+	for i := 0; i < 2; i++ {
+		if _, err = client.Send(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+		client.Close()
+	}
+	// Invalid length in header
+	if _, err = client.Send(context.Background(), []byte{0, 1, 0, 2, 0, 0, 1, 2}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	expected := TransportStats{Requests: 3, BytesSent: 24, BytesReceived: 16, Errors: 1, Reconnects: 2}
+	if stats := client.Stats(); stats != expected {
+		t.Errorf("stats: expected %+v, actual %+v", expected, stats)
+	}
+	client.ResetStats()
+	if stats := client.Stats(); stats != (TransportStats{}) {
+		t.Errorf("stats not reset: %+v", stats)
+	}
+}
+
+func TestTCPTransporterHealthCheck(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		// Answer a single request, then drop the connection
+		var buf [8]byte
+		if _, err = io.ReadFull(conn, buf[:]); err == nil {
+			_, err = conn.Write(buf[:])
+		}
+		if err != nil {
+			t.Error(err)
+		}
+		conn.Close()
+	}()
+	client := &tcpTransporter{
+		Address:             ln.Addr().String(),
+		Timeout:             1 * time.Second,
+		HealthCheckInterval: 20 * time.Millisecond,
+	}
+	req := []byte{0, 1, 0, 2, 0, 2, 1, 2}
+	if _, err = client.Send(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	client.mu.Lock()
+	conn := client.conn
+	client.mu.Unlock()
+	if conn != nil {
+		t.Fatalf("half-open connection is not closed: %+v", conn)
+	}
+}
+
+func TestTCPTransporterHealthCheckUnsolicitedData(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	done := make(chan struct{})
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		// Answer a single request, then send a stray response
+		var buf [8]byte
+		if _, err = io.ReadFull(conn, buf[:]); err == nil {
+			_, err = conn.Write(buf[:])
+		}
+		if err == nil {
+			_, err = conn.Write(buf[:])
+		}
+		if err != nil {
+			t.Error(err)
+		}
+		<-done
+	}()
+	defer close(done)
+	client := &tcpTransporter{
+		Address:             ln.Addr().String(),
+		Timeout:             1 * time.Second,
+		HealthCheckInterval: 20 * time.Millisecond,
+	}
+	req := []byte{0, 1, 0, 2, 0, 2, 1, 2}
+	if _, err = client.Send(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	client.mu.Lock()
+	conn := client.conn
+	client.mu.Unlock()
+	if conn != nil {
+		t.Fatalf("connection with unsolicited data is not closed: %+v", conn)
+	}
+}
+
+func TestTCPTransporterCloseStopsHealthCheck(t *testing.T) {
+	for _, closeFunc := range []func(*tcpTransporter) error{(*tcpTransporter).Close, (*tcpTransporter).CloseNow} {
+		client := &tcpTransporter{HealthCheckInterval: time.Hour}
+		client.startProbeTimer()
+		if err := closeFunc(client); err != nil {
+			t.Fatal(err)
+		}
+		client.mu.Lock()
+		// Stop reports whether the timer was still running
+		running := client.probeTimer.Stop()
+		client.mu.Unlock()
+		if running {
+			t.Error("health check timer is still running after closing")
+		}
+	}
+}
+
+func TestTCPDialAddress(t *testing.T) {
+	tests := []struct {
+		address  string
+		expected string
+	}{
+		{"192.168.1.10", "192.168.1.10:502"},
+		{"plc.local", "plc.local:502"},
+		{"192.168.1.10:1502", "192.168.1.10:1502"},
+		{"localhost:502", "localhost:502"},
+		{"::1", "[::1]:502"},
+		{"[::1]", "[::1]:502"},
+		{"[::1]:1502", "[::1]:1502"},
+	}
+	for _, tt := range tests {
+		if actual := tcpDialAddress(tt.address); actual != tt.expected {
+			t.Errorf("tcpDialAddress(%q) = %q, want %q", tt.address, actual, tt.expected)
+		}
+	}
+}
+
+func FuzzTCPDecode(f *testing.F) {
+	f.Add([]byte{0, 1, 0, 0, 0, 6, 17, 3, 0, 120, 0, 3})
+	f.Add([]byte{0, 1, 0, 0, 0, 0})
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, adu []byte) {
+		packager := tcpPackager{}
+		request := []byte{0, 1, 0, 0, 0, 6, 17, 3, 0, 120, 0, 3}
+		packager.Verify(request, adu)
+		packager.Decode(adu)
+	})
+}
+
 func BenchmarkTCPEncoder(b *testing.B) {
 	encoder := tcpPackager{
 		SlaveID: 10,
@@ -120,3 +434,225 @@ func BenchmarkTCPDecoder(b *testing.B) {
 		}
 	}
 }
+
+func TestTCPTransporterWarm(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	client := &tcpTransporter{
+		Address: ln.Addr().String(),
+		Timeout: 1 * time.Second,
+	}
+	defer client.Close()
+	for i := 0; i < 2; i++ {
+		if err = client.Warm(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = client.Send(context.Background(), []byte{0, 1, 0, 2, 0, 2, 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if stats := client.Stats(); stats.Reconnects != 0 {
+		t.Errorf("expected the warm connection to be reused, got %d reconnects", stats.Reconnects)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cold := &tcpTransporter{Address: ln.Addr().String()}
+	if err = cold.Warm(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestTCPTransporterSendPipelined(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		// Read every request before answering, in reverse order
+		var requests [3][8]byte
+		for i := range requests {
+			if _, err = io.ReadFull(conn, requests[i][:]); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+		for i := len(requests) - 1; i >= 0; i-- {
+			if _, err = conn.Write(requests[i][:]); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	client := &tcpTransporter{
+		Address: ln.Addr().String(),
+		Timeout: 1 * time.Second,
+	}
+	defer client.Close()
+	requests := [][]byte{
+		{0, 1, 0, 0, 0, 2, 1, 3},
+		{0, 2, 0, 0, 0, 2, 1, 4},
+		{0, 3, 0, 0, 0, 2, 1, 5},
+	}
+	responses, err := client.SendPipelined(context.Background(), requests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range requests {
+		if !bytes.Equal(requests[i], responses[i]) {
+			t.Errorf("response %d: expected % x, actual % x", i, requests[i], responses[i])
+		}
+	}
+	if stats := client.Stats(); stats.Requests != 3 || stats.BytesReceived != 24 {
+		t.Errorf("stats: expected 3 requests and 24 bytes received, actual %+v", stats)
+	}
+
+	if _, err = client.SendPipelined(context.Background(), [][]byte{requests[0], requests[0]}); !errors.Is(err, ErrInvalidData) {
+		t.Errorf("expected ErrInvalidData for duplicate transaction ids, got %v", err)
+	}
+}
+
+func TestTCPTransporterSendPipelinedUnknownTransactionID(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		// The first connection answers with an unknown transaction id
+		// followed by the expected responses, which must not be read
+		// back by the next Send
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		var requests [2][8]byte
+		for i := range requests {
+			if _, err = io.ReadFull(conn, requests[i][:]); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+		unknown := requests[0]
+		unknown[1] = 9
+		for _, response := range [][8]byte{unknown, requests[0], requests[1]} {
+			if _, err = conn.Write(response[:]); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+
+		next, err := ln.Accept()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer next.Close()
+		var request [8]byte
+		if _, err = io.ReadFull(next, request[:]); err != nil {
+			t.Error(err)
+			return
+		}
+		if _, err = next.Write(request[:]); err != nil {
+			t.Error(err)
+		}
+	}()
+	client := &tcpTransporter{
+		Address: ln.Addr().String(),
+		Timeout: 1 * time.Second,
+	}
+	defer client.Close()
+	requests := [][]byte{
+		{0, 1, 0, 0, 0, 2, 1, 3},
+		{0, 2, 0, 0, 0, 2, 1, 4},
+	}
+	if _, err = client.SendPipelined(context.Background(), requests); !errors.Is(err, ErrProtocolError) {
+		t.Fatalf("expected ErrProtocolError, got %v", err)
+	}
+	request := []byte{0, 3, 0, 0, 0, 2, 1, 5}
+	response, err := client.Send(context.Background(), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(request, response) {
+		t.Errorf("expected % x, actual % x", request, response)
+	}
+}
+
+func TestTCPTransporterCloseNow(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// The device accepts the request but never responds
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+	client := &tcpTransporter{
+		Address: ln.Addr().String(),
+		Timeout: 10 * time.Second,
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.Send(context.Background(), []byte{0, 1, 0, 0, 0, 6, 1, 3, 0, 0, 0, 1})
+		done <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	if err = client.CloseNow(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err = <-done:
+		if err == nil {
+			t.Error("expected the interrupted send to fail")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected CloseNow to interrupt the send")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected CloseNow to return promptly, took %v", elapsed)
+	}
+	if err = client.Close(); err != nil {
+		t.Errorf("expected Close after CloseNow to succeed, got %v", err)
+	}
+}
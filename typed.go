@@ -0,0 +1,229 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+)
+
+// ReadInputRegistersFloat32 reads count 32-bit floats, two input registers
+// each, starting at address and decodes them with the given byte order.
+func ReadInputRegistersFloat32(ctx context.Context, client Client, address uint16, count int, order ByteOrder) ([]float32, error) {
+	if count < 1 || count*2 > 125 {
+		return nil, fmt.Errorf("%w: float count '%v' must be between '%v' and '%v'", ErrInvalidQuantity, count, 1, 62)
+	}
+	results, err := client.ReadInputRegisters(ctx, address, uint16(count*2))
+	if err != nil {
+		return nil, err
+	}
+	if len(results) != count*4 {
+		return nil, fmt.Errorf("%w: response data size '%v' does not match expected '%v'", ErrInvalidResponse, len(results), count*4)
+	}
+	values := make([]float32, count)
+	for i := range values {
+		values[i] = order.Float32(results[i*4:])
+	}
+	return values, nil
+}
+
+// ReadHoldingRegistersInt16 reads quantity holding registers starting at
+// address and decodes each as a signed two's-complement value.
+func ReadHoldingRegistersInt16(ctx context.Context, client Client, address, quantity uint16) ([]int16, error) {
+	results, err := client.ReadHoldingRegisters(ctx, address, quantity)
+	if err != nil {
+		return nil, err
+	}
+	return decodeInt16s(results, quantity)
+}
+
+// ReadInputRegistersInt16 reads quantity input registers starting at address
+// and decodes each as a signed two's-complement value.
+func ReadInputRegistersInt16(ctx context.Context, client Client, address, quantity uint16) ([]int16, error) {
+	results, err := client.ReadInputRegisters(ctx, address, quantity)
+	if err != nil {
+		return nil, err
+	}
+	return decodeInt16s(results, quantity)
+}
+
+// ReadRegister reads the holding register at address and returns its
+// value.
+func ReadRegister(ctx context.Context, client Client, address uint16) (uint16, error) {
+	results, err := client.ReadHoldingRegisters(ctx, address, 1)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(results), nil
+}
+
+// ReadInputRegister reads the input register at address and returns its
+// value.
+func ReadInputRegister(ctx context.Context, client Client, address uint16) (uint16, error) {
+	results, err := client.ReadInputRegisters(ctx, address, 1)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(results), nil
+}
+
+// decodeInt16s converts the big-endian data of quantity registers to signed
+// values.
+func decodeInt16s(data []byte, quantity uint16) ([]int16, error) {
+	if len(data) != int(quantity)*2 {
+		return nil, fmt.Errorf("%w: response data size '%v' does not match expected '%v'", ErrInvalidResponse, len(data), int(quantity)*2)
+	}
+	values := make([]int16, quantity)
+	for i, register := range decodeRegisters(data) {
+		values[i] = int16(register)
+	}
+	return values, nil
+}
+
+// maxBCDBytes is the number of BCD bytes, 16 digits, that always fit in a
+// uint64.
+const maxBCDBytes = 8
+
+// BytesToBCD decodes packed binary-coded decimal data, two digits per byte
+// with the most significant digit first, e.g. 0x12 0x34 is 1234. It returns
+// ErrInvalidData if a nibble is not a decimal digit or data is empty or
+// longer than 8 bytes.
+func BytesToBCD(data []byte) (uint64, error) {
+	if len(data) < 1 || len(data) > maxBCDBytes {
+		return 0, fmt.Errorf("%w: BCD data size '%v' must be between '%v' and '%v'", ErrInvalidData, len(data), 1, maxBCDBytes)
+	}
+	var value uint64
+	for i, b := range data {
+		high, low := b>>4, b&0x0F
+		if high > 9 || low > 9 {
+			return 0, fmt.Errorf("%w: byte '%v' value '0x%02X' is not BCD", ErrInvalidData, i, b)
+		}
+		value = value*100 + uint64(high)*10 + uint64(low)
+	}
+	return value, nil
+}
+
+// ReadHoldingRegistersBCD reads quantity holding registers starting at
+// address, from 1 to 4, and decodes them as one BCD number of four digits
+// per register, the first register holding the most significant digits.
+func ReadHoldingRegistersBCD(ctx context.Context, client Client, address, quantity uint16) (uint64, error) {
+	if quantity < 1 || quantity > maxBCDBytes/2 {
+		return 0, fmt.Errorf("%w: quantity '%v' must be between '%v' and '%v'", ErrInvalidQuantity, quantity, 1, maxBCDBytes/2)
+	}
+	results, err := client.ReadHoldingRegisters(ctx, address, quantity)
+	if err != nil {
+		return 0, err
+	}
+	value, err := BytesToBCD(results)
+	if err != nil {
+		return 0, fmt.Errorf("reading holding registers as BCD: %w", err)
+	}
+	return value, nil
+}
+
+// ReadWriteMultipleRegistersTyped writes values to the holding registers at
+// writeAddress and reads readQuantity holding registers from readAddress in a
+// single transaction.
+func ReadWriteMultipleRegistersTyped(ctx context.Context, client Client, readAddress, readQuantity, writeAddress uint16, values []uint16) ([]uint16, error) {
+	if len(values) > 121 {
+		return nil, fmt.Errorf("%w: write quantity '%v' must be between '%v' and '%v'", ErrInvalidQuantity, len(values), 1, 121)
+	}
+	results, err := client.ReadWriteMultipleRegisters(ctx, readAddress, readQuantity, writeAddress, uint16(len(values)), dataBlock(values...))
+	if err != nil {
+		return nil, err
+	}
+	if len(results) != int(readQuantity)*2 {
+		return nil, fmt.Errorf("%w: response data size '%v' does not match expected '%v'", ErrInvalidResponse, len(results), int(readQuantity)*2)
+	}
+	return decodeRegisters(results), nil
+}
+
+// byteOrders lists the candidate orders tried by DetectByteOrder.
+var byteOrders = [...]ByteOrder{BigEndian, BigEndianWordSwap, LittleEndian, LittleEndianWordSwap}
+
+// DetectByteOrder finds the word order a device uses for 32-bit floats
+// from a float it already holds whose value is known, such as a nameplate
+// rating or a setpoint configured on the device. It reads the two holding
+// registers at address, decodes them in each byte order and returns the one
+// giving known. Nothing is written. It fails with ErrVerifyFailed if no
+// order gives known, or if more than one does, as for 0 or values whose
+// bytes read the same in several orders.
+func DetectByteOrder(ctx context.Context, client Client, address uint16, known float32) (ByteOrder, error) {
+	results, err := client.ReadHoldingRegisters(ctx, address, 2)
+	if err != nil {
+		return 0, fmt.Errorf("detecting byte order: %w", err)
+	}
+	if len(results) != 4 {
+		return 0, fmt.Errorf("%w: response data size '%v' does not match expected '%v'", ErrInvalidResponse, len(results), 4)
+	}
+	var matches []ByteOrder
+	for _, candidate := range byteOrders {
+		if candidate.Float32(results) == known {
+			matches = append(matches, candidate)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return 0, fmt.Errorf("%w: registers '% x' do not hold '%v' in any byte order", ErrVerifyFailed, results, known)
+	case 1:
+		return matches[0], nil
+	default:
+		return 0, fmt.Errorf("%w: registers '% x' hold '%v' in byte orders '%v'", ErrVerifyFailed, results, known, matches)
+	}
+}
+
+// ReadString reads a string stored two characters per holding register,
+// starting at address. The string ends at the first NUL byte or after
+// maxRegisters registers. Only the byte order within each register is taken
+// from order: LittleEndian and LittleEndianWordSwap store the second
+// character in the high byte.
+func ReadString(ctx context.Context, client Client, address uint16, maxRegisters int, order ByteOrder) (string, error) {
+	if maxRegisters < 1 || maxRegisters > 125 {
+		return "", fmt.Errorf("%w: register count '%v' must be between '%v' and '%v'", ErrInvalidQuantity, maxRegisters, 1, 125)
+	}
+	results, err := client.ReadHoldingRegisters(ctx, address, uint16(maxRegisters))
+	if err != nil {
+		return "", fmt.Errorf("reading string: %w", err)
+	}
+	if len(results) != maxRegisters*2 {
+		return "", fmt.Errorf("%w: response data size '%v' does not match expected '%v'", ErrInvalidResponse, len(results), maxRegisters*2)
+	}
+	text := make([]byte, len(results))
+	for i := 0; i < len(results); i += 2 {
+		if order.byteSwap() {
+			text[i], text[i+1] = results[i+1], results[i]
+		} else {
+			text[i], text[i+1] = results[i], results[i+1]
+		}
+	}
+	if end := bytes.IndexByte(text, 0); end >= 0 {
+		text = text[:end]
+	}
+	return string(text), nil
+}
+
+// WriteString writes s to the holding registers starting at address, two
+// characters per register in the given byte order like ReadString. An odd
+// length string is padded with a NUL byte to fill the last register; the
+// string is not otherwise terminated.
+func WriteString(ctx context.Context, client Client, address uint16, s string, order ByteOrder) error {
+	quantity := (len(s) + 1) / 2
+	if quantity < 1 || quantity > 123 {
+		return fmt.Errorf("%w: register count '%v' must be between '%v' and '%v'", ErrInvalidQuantity, quantity, 1, 123)
+	}
+	value := make([]byte, quantity*2)
+	copy(value, s)
+	if order.byteSwap() {
+		for i := 0; i < len(value); i += 2 {
+			value[i], value[i+1] = value[i+1], value[i]
+		}
+	}
+	if _, err := client.WriteMultipleRegisters(ctx, address, uint16(quantity), value); err != nil {
+		return fmt.Errorf("writing string: %w", err)
+	}
+	return nil
+}
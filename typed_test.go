@@ -0,0 +1,279 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestReadInputRegistersFloat32(t *testing.T) {
+	mockT := &mockTransporter{
+		sendFunc: func(_ context.Context, req []byte) ([]byte, error) {
+			if req[0] != FuncCodeReadInputRegisters || req[4] != 4 {
+				t.Errorf("unexpected request % x", req)
+			}
+			// 230.5 (0x43668000) and -1.25 (0xBFA00000), word swapped
+			return []byte{FuncCodeReadInputRegisters, 8, 0x80, 0x00, 0x43, 0x66, 0x00, 0x00, 0xBF, 0xA0}, nil
+		},
+	}
+	client := NewClientWithPackagerTransporter(&mockPackager{}, mockT)
+
+	values, err := ReadInputRegistersFloat32(context.Background(), client, 0, 2, BigEndianWordSwap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 2 || values[0] != 230.5 || values[1] != -1.25 {
+		t.Errorf("unexpected values: %v", values)
+	}
+
+	for _, count := range []int{0, 63} {
+		if _, err = ReadInputRegistersFloat32(context.Background(), client, 0, count, BigEndian); !errors.Is(err, ErrInvalidQuantity) {
+			t.Errorf("count %d: expected ErrInvalidQuantity, got %v", count, err)
+		}
+	}
+}
+
+func TestReadRegistersInt16(t *testing.T) {
+	mockT := &mockTransporter{
+		sendFunc: func(_ context.Context, req []byte) ([]byte, error) {
+			// 21.5 and -12.5 degrees in tenths, and the extremes
+			return []byte{req[0], 8, 0x00, 0xD7, 0xFF, 0x83, 0x7F, 0xFF, 0x80, 0x00}, nil
+		},
+	}
+	client := NewClientWithPackagerTransporter(&mockPackager{}, mockT)
+	expected := []int16{215, -125, 32767, -32768}
+
+	for name, read := range map[string]func(context.Context, Client, uint16, uint16) ([]int16, error){
+		"holding": ReadHoldingRegistersInt16,
+		"input":   ReadInputRegistersInt16,
+	} {
+		values, err := read(context.Background(), client, 0, 4)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !slices.Equal(values, expected) {
+			t.Errorf("%s: expected %v, got %v", name, expected, values)
+		}
+		if _, err = read(context.Background(), client, 0, 3); !errors.Is(err, ErrInvalidResponse) {
+			t.Errorf("%s: expected ErrInvalidResponse for a short response, got %v", name, err)
+		}
+	}
+}
+
+func TestReadRegister(t *testing.T) {
+	var functionCodes []byte
+	mockT := &mockTransporter{
+		sendFunc: func(_ context.Context, req []byte) ([]byte, error) {
+			functionCodes = append(functionCodes, req[0])
+			if quantity := binary.BigEndian.Uint16(req[3:]); quantity != 1 {
+				t.Errorf("expected quantity 1, got %d", quantity)
+			}
+			return []byte{req[0], 2, 0xBE, 0xEF}, nil
+		},
+	}
+	client := NewClientWithPackagerTransporter(&mockPackager{}, mockT)
+
+	for name, read := range map[string]func(context.Context, Client, uint16) (uint16, error){
+		"holding": ReadRegister,
+		"input":   ReadInputRegister,
+	} {
+		value, err := read(context.Background(), client, 7)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if value != 0xBEEF {
+			t.Errorf("%s: expected 0xBEEF, got 0x%04X", name, value)
+		}
+	}
+	slices.Sort(functionCodes)
+	if !slices.Equal(functionCodes, []byte{FuncCodeReadHoldingRegisters, FuncCodeReadInputRegisters}) {
+		t.Errorf("expected one read of each register type, got %v", functionCodes)
+	}
+
+	mockT.sendFunc = func(_ context.Context, req []byte) ([]byte, error) {
+		return []byte{req[0] | 0x80, ExceptionCodeIllegalDataAddress}, nil
+	}
+	var mbErr *ModbusError
+	if _, err := ReadRegister(context.Background(), client, 7); !errors.As(err, &mbErr) {
+		t.Errorf("expected ModbusError, got %v", err)
+	}
+}
+
+func TestBytesToBCD(t *testing.T) {
+	tests := []struct {
+		data     []byte
+		expected uint64
+	}{
+		{[]byte{0x00}, 0},
+		{[]byte{0x12, 0x34}, 1234},
+		{[]byte{0x00, 0x01, 0x23, 0x45}, 12345},
+		{[]byte{0x99, 0x99, 0x99, 0x99, 0x99, 0x99, 0x99, 0x99}, 9999999999999999},
+	}
+	for _, tt := range tests {
+		value, err := BytesToBCD(tt.data)
+		if err != nil {
+			t.Errorf("% x: %v", tt.data, err)
+		} else if value != tt.expected {
+			t.Errorf("% x: expected %v, got %v", tt.data, tt.expected, value)
+		}
+	}
+
+	for _, data := range [][]byte{nil, {0x1A}, {0xA1}, {0x12, 0x3F}, make([]byte, 9)} {
+		if _, err := BytesToBCD(data); !errors.Is(err, ErrInvalidData) {
+			t.Errorf("% x: expected ErrInvalidData, got %v", data, err)
+		}
+	}
+}
+
+func TestReadHoldingRegistersBCD(t *testing.T) {
+	response := []byte{FuncCodeReadHoldingRegisters, 4, 0x00, 0x12, 0x34, 0x56}
+	mockT := &mockTransporter{
+		sendFunc: func(_ context.Context, _ []byte) ([]byte, error) {
+			return response, nil
+		},
+	}
+	client := NewClientWithPackagerTransporter(&mockPackager{}, mockT)
+
+	value, err := ReadHoldingRegistersBCD(context.Background(), client, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != 123456 {
+		t.Errorf("expected 123456, got %v", value)
+	}
+
+	response = []byte{FuncCodeReadHoldingRegisters, 2, 0x12, 0xF4}
+	if _, err = ReadHoldingRegistersBCD(context.Background(), client, 0, 1); !errors.Is(err, ErrInvalidData) {
+		t.Errorf("expected ErrInvalidData for a non-decimal nibble, got %v", err)
+	}
+	if _, err = ReadHoldingRegistersBCD(context.Background(), client, 0, 5); !errors.Is(err, ErrInvalidQuantity) {
+		t.Errorf("expected ErrInvalidQuantity, got %v", err)
+	}
+}
+
+func TestReadWriteMultipleRegistersTyped(t *testing.T) {
+	mockT := &mockTransporter{
+		sendFunc: func(_ context.Context, req []byte) ([]byte, error) {
+			expected := []byte{FuncCodeReadWriteMultipleRegisters, 0, 10, 0, 2, 0, 20, 0, 1, 2, 0x12, 0x34}
+			if !bytes.Equal(req, expected) {
+				t.Errorf("request: expected % x, actual % x", expected, req)
+			}
+			return []byte{FuncCodeReadWriteMultipleRegisters, 4, 0x00, 0x01, 0xAB, 0xCD}, nil
+		},
+	}
+	client := NewClientWithPackagerTransporter(&mockPackager{}, mockT)
+
+	registers, err := ReadWriteMultipleRegistersTyped(context.Background(), client, 10, 2, 20, []uint16{0x1234})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(registers) != 2 || registers[0] != 0x0001 || registers[1] != 0xABCD {
+		t.Errorf("unexpected registers: %v", registers)
+	}
+
+	if _, err = ReadWriteMultipleRegistersTyped(context.Background(), client, 10, 2, 20, nil); !errors.Is(err, ErrInvalidQuantity) {
+		t.Errorf("expected ErrInvalidQuantity for empty write, got %v", err)
+	}
+}
+
+func TestDetectByteOrder(t *testing.T) {
+	// The device holds its 230.5 V rating in CDAB order
+	stored := []byte{FuncCodeReadHoldingRegisters, 4, 0, 0, 0, 0}
+	mockT := &mockTransporter{
+		sendFunc: func(_ context.Context, req []byte) ([]byte, error) {
+			if req[0] != FuncCodeReadHoldingRegisters {
+				t.Fatalf("unexpected request % x", req)
+			}
+			return stored, nil
+		},
+	}
+	client := NewClientWithPackagerTransporter(&mockPackager{}, mockT)
+
+	BigEndianWordSwap.PutFloat32(stored[2:], 230.5)
+	order, err := DetectByteOrder(context.Background(), client, 100, 230.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order != BigEndianWordSwap {
+		t.Errorf("expected %v, actual %v", BigEndianWordSwap, order)
+	}
+
+	if _, err = DetectByteOrder(context.Background(), client, 100, 42); !errors.Is(err, ErrVerifyFailed) {
+		t.Errorf("expected ErrVerifyFailed for a value not held, got %v", err)
+	}
+	// 0 reads the same in every order
+	BigEndian.PutFloat32(stored[2:], 0)
+	if _, err = DetectByteOrder(context.Background(), client, 100, 0); !errors.Is(err, ErrVerifyFailed) {
+		t.Errorf("expected ErrVerifyFailed for an ambiguous value, got %v", err)
+	}
+}
+
+func TestReadString(t *testing.T) {
+	mockT := &mockTransporter{
+		sendFunc: func(_ context.Context, req []byte) ([]byte, error) {
+			if req[4] == 2 {
+				return []byte{FuncCodeReadHoldingRegisters, 4, 'P', 'M', '-', '1'}, nil
+			}
+			return []byte{FuncCodeReadHoldingRegisters, 8, 'P', 'M', '-', '1', 0, 0, 'x', 'x'}, nil
+		},
+	}
+	client := NewClientWithPackagerTransporter(&mockPackager{}, mockT)
+
+	tests := []struct {
+		registers int
+		order     ByteOrder
+		expected  string
+	}{
+		{4, BigEndian, "PM-1"},
+		{2, BigEndian, "PM-1"},
+		{4, LittleEndian, "MP1-"},
+	}
+	for _, tt := range tests {
+		s, err := ReadString(context.Background(), client, 0, tt.registers, tt.order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != tt.expected {
+			t.Errorf("%d registers %v: expected %q, actual %q", tt.registers, tt.order, tt.expected, s)
+		}
+	}
+
+	if _, err := ReadString(context.Background(), client, 0, 0, BigEndian); !errors.Is(err, ErrInvalidQuantity) {
+		t.Errorf("expected ErrInvalidQuantity, got %v", err)
+	}
+}
+
+func TestWriteString(t *testing.T) {
+	var written []byte
+	mockT := &mockTransporter{
+		sendFunc: func(_ context.Context, req []byte) ([]byte, error) {
+			written = append([]byte(nil), req[6:]...)
+			return req[:5], nil
+		},
+	}
+	client := NewClientWithPackagerTransporter(&mockPackager{}, mockT)
+
+	if err := WriteString(context.Background(), client, 0, "PM-12", BigEndian); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []byte{'P', 'M', '-', '1', '2', 0}; !bytes.Equal(written, expected) {
+		t.Errorf("expected % x, actual % x", expected, written)
+	}
+	if err := WriteString(context.Background(), client, 0, "PM-12", LittleEndianWordSwap); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []byte{'M', 'P', '1', '-', 0, '2'}; !bytes.Equal(written, expected) {
+		t.Errorf("expected % x, actual % x", expected, written)
+	}
+
+	if err := WriteString(context.Background(), client, 0, "", BigEndian); !errors.Is(err, ErrInvalidQuantity) {
+		t.Errorf("expected ErrInvalidQuantity, got %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+)
+
+// WriteRegisterVerified writes value to the holding register at address and
+// reads the register back to confirm it. On failure the write is retried up
+// to the number of times configured with WithVerifyRetries on client.
+func WriteRegisterVerified(ctx context.Context, client Client, address, value uint16) (err error) {
+	for attempt := 0; attempt <= verifyRetriesOf(client); attempt++ {
+		if err = writeRegisterVerified(ctx, client, address, value); err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return err
+}
+
+// verifyRetriesOf returns the retries set with WithVerifyRetries on c, 0
+// for clients not created by NewClient.
+func verifyRetriesOf(c Client) int {
+	if mb := clientOf(c); mb != nil {
+		return mb.verifyRetries
+	}
+	return 0
+}
+
+func writeRegisterVerified(ctx context.Context, client Client, address, value uint16) error {
+	if _, err := client.WriteSingleRegister(ctx, address, value); err != nil {
+		return err
+	}
+	results, err := client.ReadHoldingRegisters(ctx, address, 1)
+	if err != nil {
+		return fmt.Errorf("reading back register: %w", err)
+	}
+	if len(results) != 2 {
+		return fmt.Errorf("%w: read back data size '%v' does not match expected '%v'", ErrInvalidResponse, len(results), 2)
+	}
+	readValue := binary.BigEndian.Uint16(results)
+	if readValue != value {
+		return fmt.Errorf("%w: register '%v' read back '%v', wrote '%v'", ErrVerifyFailed, address, readValue, value)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// registerDevice returns a transporter emulating a device whose holding
+// register stores written values through the given store function.
+func registerDevice(store func(uint16) uint16) *mockTransporter {
+	var stored uint16
+	return &mockTransporter{
+		sendFunc: func(_ context.Context, req []byte) ([]byte, error) {
+			switch req[0] {
+			case FuncCodeWriteSingleRegister:
+				stored = store(uint16(req[3])<<8 | uint16(req[4]))
+				return req, nil
+			case FuncCodeReadHoldingRegisters:
+				return []byte{FuncCodeReadHoldingRegisters, 2, byte(stored >> 8), byte(stored)}, nil
+			}
+			return nil, errors.New("unexpected request")
+		},
+	}
+}
+
+func TestWriteRegisterVerified(t *testing.T) {
+	mockT := registerDevice(func(v uint16) uint16 { return v })
+	client := NewClientWithPackagerTransporter(&mockPackager{}, mockT)
+
+	if err := WriteRegisterVerified(context.Background(), client, 10, 0x1234); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestWriteRegisterVerifiedMismatch(t *testing.T) {
+	writes := 0
+	mockT := registerDevice(func(v uint16) uint16 {
+		writes++
+		return v + 1
+	})
+	client := NewClientWithPackagerTransporter(&mockPackager{}, mockT, WithVerifyRetries(2))
+
+	err := WriteRegisterVerified(context.Background(), client, 10, 0x1234)
+	if !errors.Is(err, ErrVerifyFailed) {
+		t.Fatalf("expected ErrVerifyFailed, got %v", err)
+	}
+	if writes != 3 {
+		t.Errorf("expected 3 write attempts, got %d", writes)
+	}
+}
+
+func TestWriteRegisterVerifiedRetrySucceeds(t *testing.T) {
+	writes := 0
+	mockT := registerDevice(func(v uint16) uint16 {
+		writes++
+		if writes == 1 {
+			return 0
+		}
+		return v
+	})
+	client := NewClientWithPackagerTransporter(&mockPackager{}, mockT, WithVerifyRetries(1))
+
+	if err := WriteRegisterVerified(context.Background(), client, 10, 0x1234); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if writes != 2 {
+		t.Errorf("expected 2 write attempts, got %d", writes)
+	}
+}
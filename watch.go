@@ -0,0 +1,73 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Watch polls quantity holding registers at address every interval and
+// sends the register values on the returned channel when they differ from
+// the previous read; the first read is always sent. Polling waits for the
+// caller to receive the values. Read errors are sent on the error channel,
+// which buffers one, and dropped while it is full, so that a caller
+// receiving only the values is never blocked; polling continues either
+// way. Both channels are closed once ctx is done.
+func Watch(ctx context.Context, client Client, address, quantity uint16, interval time.Duration) (<-chan []uint16, <-chan error, error) {
+	if quantity < 1 || quantity > 125 {
+		return nil, nil, fmt.Errorf("%w: quantity '%v' must be between '%v' and '%v'", ErrInvalidQuantity, quantity, 1, 125)
+	}
+	if interval <= 0 {
+		return nil, nil, fmt.Errorf("%w: interval '%v' must be positive", ErrInvalidData, interval)
+	}
+	values := make(chan []uint16)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(values)
+		defer close(errs)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var previous []uint16
+		for {
+			results, err := client.ReadHoldingRegisters(ctx, address, quantity)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				select {
+				case errs <- fmt.Errorf("watching holding registers: %w", err):
+				default:
+				}
+			} else if registers := decodeRegisters(results); previous == nil || !slices.Equal(registers, previous) {
+				select {
+				case values <- slices.Clone(registers):
+					previous = registers
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return values, errs, nil
+}
+
+// decodeRegisters converts big-endian register data to register values.
+func decodeRegisters(data []byte) []uint16 {
+	registers := make([]uint16, len(data)/2)
+	for i := range registers {
+		registers[i] = binary.BigEndian.Uint16(data[i*2:])
+	}
+	return registers
+}
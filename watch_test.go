@@ -0,0 +1,112 @@
+// Copyright 2014 Quoc-Viet Nguyen. All rights reserved.
+// This software may be modified and distributed under the terms
+// of the BSD license. See the LICENSE file for details.
+
+package modbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	// One register value per poll, an error on the third
+	polls := []uint16{1, 1, 0, 2, 2, 3}
+	reads := 0
+	mockT := &mockTransporter{
+		sendFunc: func(_ context.Context, _ []byte) ([]byte, error) {
+			value := polls[min(reads, len(polls)-1)]
+			reads++
+			if reads == 3 {
+				return nil, errors.New("no response")
+			}
+			return []byte{FuncCodeReadHoldingRegisters, 2, byte(value >> 8), byte(value)}, nil
+		},
+	}
+	client := NewClientWithPackagerTransporter(&mockPackager{}, mockT)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	values, errs, err := Watch(ctx, client, 0, 1, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []uint16
+	var watchErr error
+	for len(got) < 3 {
+		select {
+		case v := <-values:
+			got = append(got, v...)
+		case err := <-errs:
+			if err == nil {
+				t.Fatal("error channel closed")
+			}
+			watchErr = err
+		case <-time.After(time.Second):
+			t.Fatalf("timed out, got %v", got)
+		}
+	}
+	if fmt.Sprint(got) != "[1 2 3]" {
+		t.Errorf("expected changes [1 2 3], got %v", got)
+	}
+	if watchErr == nil {
+		// Buffered before the next values were sent
+		select {
+		case watchErr = <-errs:
+		default:
+			t.Error("expected the read error on the error channel")
+		}
+	}
+
+	cancel()
+	for range values {
+	}
+	for range errs {
+	}
+}
+
+func TestWatchValuesOnly(t *testing.T) {
+	// Every other read fails, the others return a new value
+	reads := 0
+	mockT := &mockTransporter{
+		sendFunc: func(_ context.Context, _ []byte) ([]byte, error) {
+			reads++
+			if reads%2 == 0 {
+				return nil, errors.New("no response")
+			}
+			return []byte{FuncCodeReadHoldingRegisters, 2, 0, byte(reads)}, nil
+		},
+	}
+	client := NewClientWithPackagerTransporter(&mockPackager{}, mockT)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	values, _, err := Watch(ctx, client, 0, 1, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The unread errors don't block polling
+	for i := 0; i < 5; i++ {
+		select {
+		case <-values:
+		case <-time.After(time.Second):
+			t.Fatalf("timed out after %d values", i)
+		}
+	}
+	cancel()
+	for range values {
+	}
+}
+
+func TestWatchInvalid(t *testing.T) {
+	client := NewClientWithPackagerTransporter(&mockPackager{}, &mockTransporter{})
+	if _, _, err := Watch(context.Background(), client, 0, 0, time.Second); !errors.Is(err, ErrInvalidQuantity) {
+		t.Errorf("expected ErrInvalidQuantity, got %v", err)
+	}
+	if _, _, err := Watch(context.Background(), client, 0, 1, 0); !errors.Is(err, ErrInvalidData) {
+		t.Errorf("expected ErrInvalidData, got %v", err)
+	}
+}